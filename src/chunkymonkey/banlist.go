@@ -0,0 +1,102 @@
+package chunkymonkey
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"chunkymonkey/util"
+)
+
+// IBanStore persists the names of banned players.
+type IBanStore interface {
+	LoadBans() (names []string, err os.Error)
+	SaveBans(names []string) os.Error
+}
+
+// BanList records the names of players that may not log in. It is safe for
+// concurrent use.
+type BanList struct {
+	lock  sync.Mutex
+	names map[string]bool
+	store IBanStore
+}
+
+// NewBanList creates a BanList, loading the banned names from store.
+func NewBanList(store IBanStore) (banList *BanList, err os.Error) {
+	names, err := store.LoadBans()
+	if err != nil {
+		return
+	}
+
+	banList = &BanList{
+		names: make(map[string]bool),
+		store: store,
+	}
+	for _, name := range names {
+		banList.names[name] = true
+	}
+
+	return
+}
+
+// IsBanned returns true if the named player may not log in.
+func (banList *BanList) IsBanned(name string) bool {
+	banList.lock.Lock()
+	defer banList.lock.Unlock()
+
+	return banList.names[name]
+}
+
+// Ban prevents the named player from logging in, and saves the change to the
+// store.
+func (banList *BanList) Ban(name string) os.Error {
+	banList.lock.Lock()
+	defer banList.lock.Unlock()
+
+	if banList.names[name] {
+		return nil
+	}
+	banList.names[name] = true
+
+	names := make([]string, 0, len(banList.names))
+	for name := range banList.names {
+		names = append(names, name)
+	}
+
+	return banList.store.SaveBans(names)
+}
+
+// fileBanStore stores banned names in a text file, one name per line.
+type fileBanStore string
+
+func (filename fileBanStore) LoadBans() (names []string, err os.Error) {
+	data, err := ioutil.ReadFile(string(filename))
+	if err != nil {
+		if errno, ok := util.Errno(err); ok && errno == os.ENOENT {
+			// No players have been banned yet.
+			return nil, nil
+		}
+		return
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if name := strings.TrimSpace(line); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return
+}
+
+func (filename fileBanStore) SaveBans(names []string) os.Error {
+	buf := new(bytes.Buffer)
+	for _, name := range names {
+		buf.WriteString(name)
+		buf.WriteString("\n")
+	}
+
+	return ioutil.WriteFile(string(filename), buf.Bytes(), 0644)
+}
@@ -13,6 +13,8 @@ const (
 	regionFileEdge       = 32
 	regionFileEdgeShift  = 5
 	regionFileSectorSize = 4096
+	// The sector count in a region file header entry is a single byte.
+	maxChunkSectors = 255
 	// 5 is the size of chunkDataHeader in bytes.
 	chunkDataHeaderSize = 5
 	chunkDataGuessSize  = 8192
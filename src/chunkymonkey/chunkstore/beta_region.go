@@ -92,12 +92,16 @@ func (rf *regionFile) ReadChunkData(chunkLoc ChunkXz) (r *nbtChunkReader, err os
 		return
 	}
 
-	rf.file.Seek(int64(sectorIndex)*regionFileSectorSize, 0)
+	if _, err = rf.file.Seek(int64(sectorIndex)*regionFileSectorSize, os.SEEK_SET); err != nil {
+		return
+	}
 
 	maxChunkDataSize := (sectorCount * regionFileSectorSize) - chunkDataHeaderSize
 
 	var header chunkDataHeader
-	binary.Read(rf.file, binary.BigEndian, &header)
+	if err = binary.Read(rf.file, binary.BigEndian, &header); err != nil {
+		return
+	}
 	if header.DataSize > maxChunkDataSize {
 		err = fmt.Errorf(
 			"Chunk is too big (%d bytes) for the sectors it is within (%d*%d - %d=%d) header.",
@@ -136,20 +140,24 @@ func (rf *regionFile) WriteChunkData(w *nbtChunkWriter) (err os.Error) {
 	} else {
 		// Chunk doesn't yet exist in the region file or won't fit in its present
 		// location. Write it at the end of the file.
+		sectorCount = requiredSize / regionFileSectorSize
+		if requiredSize%regionFileSectorSize != 0 {
+			sectorCount++
+		}
+		if sectorCount > maxChunkSectors {
+			return fmt.Errorf("Chunk %+v is too big (%d bytes) for a region file.", w.ChunkLoc(), requiredSize)
+		}
+
 		sectorIndex = rf.endSector
 
 		if _, err = rf.file.WriteAt(chunkData, int64(sectorIndex)*regionFileSectorSize); err != nil {
 			return
 		}
 
-		sectorCount = requiredSize / regionFileSectorSize
-		if requiredSize%regionFileSectorSize != 0 {
-			sectorCount++
-		}
 		rf.endSector += sectorCount
 
 		offset.Set(sectorCount, sectorIndex)
-		rf.offsets.SetOffset(w.ChunkLoc(), offset, rf.file)
+		err = rf.offsets.SetOffset(w.ChunkLoc(), offset, rf.file)
 	}
 
 	return
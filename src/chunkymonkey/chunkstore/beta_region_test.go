@@ -0,0 +1,92 @@
+package chunkstore
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"rand"
+	"testing"
+
+	. "chunkymonkey/types"
+)
+
+func testChunkWriter(loc ChunkXz, blocks []byte) *nbtChunkWriter {
+	w := newNbtChunkWriter()
+	w.SetChunkLoc(loc)
+	w.SetBlocks(blocks)
+	return w
+}
+
+func checkChunkData(t *testing.T, rf *regionFile, loc ChunkXz, expectedBlocks []byte) {
+	r, err := rf.ReadChunkData(loc)
+	if err != nil {
+		t.Errorf("Failed to read chunk %+v: %v", loc, err)
+		return
+	}
+	if resultLoc := r.ChunkLoc(); resultLoc.X != loc.X || resultLoc.Z != loc.Z {
+		t.Errorf("Expected chunk %+v, got %+v", loc, resultLoc)
+	}
+	if !bytes.Equal(expectedBlocks, r.Blocks()) {
+		t.Errorf("Chunk %+v has unexpected blocks", loc)
+	}
+}
+
+func TestRegionFile_ReadWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "regionfile")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	filePath := path.Join(dir, "r.0.0.mcr")
+
+	rf, err := newRegionFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to create region file: %v", err)
+	}
+
+	locA := ChunkXz{1, 2}
+	locB := ChunkXz{31, 31}
+
+	if _, err = rf.ReadChunkData(locA); err != NoSuchChunkError(false) {
+		t.Errorf("Expected NoSuchChunkError from empty region file, got %v", err)
+	}
+
+	blocksA := []byte("chunk A blocks")
+	blocksB := []byte("chunk B blocks")
+	if err = rf.WriteChunkData(testChunkWriter(locA, blocksA)); err != nil {
+		t.Fatalf("Failed to write chunk: %v", err)
+	}
+	if err = rf.WriteChunkData(testChunkWriter(locB, blocksB)); err != nil {
+		t.Fatalf("Failed to write chunk: %v", err)
+	}
+	checkChunkData(t, rf, locA, blocksA)
+	checkChunkData(t, rf, locB, blocksB)
+
+	// Rewrite chunk A with data that does not compress, so that it no longer
+	// fits in its original sector.
+	src := rand.New(rand.NewSource(0))
+	bigBlocksA := make([]byte, 3*regionFileSectorSize)
+	for i := range bigBlocksA {
+		bigBlocksA[i] = byte(src.Intn(256))
+	}
+	if err = rf.WriteChunkData(testChunkWriter(locA, bigBlocksA)); err != nil {
+		t.Fatalf("Failed to rewrite chunk: %v", err)
+	}
+	checkChunkData(t, rf, locA, bigBlocksA)
+	checkChunkData(t, rf, locB, blocksB)
+	rf.Close()
+
+	// The chunks can be read back after reopening the file.
+	rf, err = newRegionFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to reopen region file: %v", err)
+	}
+	defer rf.Close()
+
+	checkChunkData(t, rf, locA, bigBlocksA)
+	checkChunkData(t, rf, locB, blocksB)
+	if _, err = rf.ReadChunkData(ChunkXz{0, 0}); err != NoSuchChunkError(false) {
+		t.Errorf("Expected NoSuchChunkError for missing chunk, got %v", err)
+	}
+}
@@ -58,6 +58,16 @@ type IChunkReader interface {
 	RootTag() nbt.ITag
 }
 
+// IGeneratedChunkReader may be implemented by IChunkReaders that return newly
+// generated chunk data, rather than data read from persistant storage. Such
+// chunks need writing to the store even if they are never modified.
+type IGeneratedChunkReader interface {
+	IChunkReader
+
+	// Returns true if the chunk was generated rather than read from a store.
+	IsGenerated() bool
+}
+
 // IChunkWriter is the interface for objects that accept chunk data and write
 // it. These are created by IChunkWriteableStore for use by a chunk to store a
 // snapshot of its current state into. The Set* functions make copies of the
@@ -37,12 +37,22 @@ func (cf *CommandFramework) Commands() map[string]*Command {
 	return cf.cmds
 }
 
+// AddCommand registers a new command. It returns ErrCmdExists if a command
+// with the same trigger is already registered.
+func (cf *CommandFramework) AddCommand(cmd *Command) os.Error {
+	if _, ok := cf.cmds[cmd.Trigger]; ok {
+		return ErrCmdExists
+	}
+	cf.cmds[cmd.Trigger] = cmd
+	return nil
+}
+
 func (cf *CommandFramework) Process(player gamerules.IPlayerClient, message string, game gamerules.IGame) {
-	if len(message) < 2 || message[0:len(cf.prefix)] != cf.prefix {
+	if len(message) <= len(cf.prefix) || !strings.HasPrefix(message, cf.prefix) {
 		return
 	}
 	attr := strings.Split(message, " ")
-	trigger := attr[0][1:]
+	trigger := attr[0][len(cf.prefix):]
 	if cmd, ok := cf.cmds[trigger]; ok {
 		cmd.Callback(player, message, game)
 	}
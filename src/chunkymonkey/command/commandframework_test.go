@@ -6,6 +6,7 @@ import (
 	"gomock.googlecode.com/hg/gomock"
 
 	"chunkymonkey/gamerules"
+	. "chunkymonkey/types"
 	"testmatcher"
 )
 
@@ -13,7 +14,7 @@ func TestCommandFramework(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 
-	itemType1 := gamerules.ItemType{1, "1", 64, 0, 0}
+	itemType1 := gamerules.ItemType{1, "1", 64, 0, 0, 0, 0}
 
 	mockGame := gamerules.NewMockIGame(mockCtrl)
 	mockPlayer := gamerules.NewMockIPlayerClient(mockCtrl)
@@ -53,4 +54,67 @@ func TestCommandFramework(t *testing.T) {
 		mockPlayer.EXPECT().EchoMessage("Description: Shows a list of all commands."),
 	)
 	cf.Process(mockPlayer, "/help help", mockGame)
+
+	mockGame.EXPECT().SetWeather("", WeatherRain).Return(true)
+	mockPlayer.EXPECT().EchoMessage("Changing the weather to rain")
+	cf.Process(mockPlayer, "/weather rain", mockGame)
+
+	mockGame.EXPECT().SetWeather("nether", WeatherThunder).Return(false)
+	mockPlayer.EXPECT().EchoMessage("'nether' is not a world")
+	cf.Process(mockPlayer, "/weather thunder nether", mockGame)
+
+	mockPlayer.EXPECT().EchoMessage(weatherUsage)
+	cf.Process(mockPlayer, "/weather snow", mockGame)
+
+	mockPlayer.EXPECT().SetGameType(GameTypeCreative)
+	mockPlayer.EXPECT().EchoMessage("Changing the game mode to creative")
+	cf.Process(mockPlayer, "/gamemode creative", mockGame)
+
+	mockGame.EXPECT().PlayerByName("otherPlayer").Return(mockOther)
+	mockOther.EXPECT().SetGameType(GameTypeAdventure)
+	mockPlayer.EXPECT().EchoMessage("Changing the game mode to adventure")
+	cf.Process(mockPlayer, "/gamemode adventure otherPlayer", mockGame)
+
+	mockGame.EXPECT().PlayerByName("otherPlayer")
+	mockPlayer.EXPECT().EchoMessage("'otherPlayer' is not logged in")
+	cf.Process(mockPlayer, "/gamemode survival otherPlayer", mockGame)
+
+	mockPlayer.EXPECT().EchoMessage(gameModeUsage)
+	cf.Process(mockPlayer, "/gamemode hardcore", mockGame)
+}
+
+func TestCommandFramework_AddCommand(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockGame := gamerules.NewMockIGame(mockCtrl)
+	mockPlayer := gamerules.NewMockIPlayerClient(mockCtrl)
+
+	cf := NewCommandFramework("/")
+
+	var gotMessage string
+	cmd := NewCommand("test", "A test command.", "test <args>", func(player gamerules.IPlayerClient, message string, game gamerules.IGame) {
+		gotMessage = message
+	})
+
+	if err := cf.AddCommand(cmd); err != nil {
+		t.Fatalf("AddCommand returned error: %v", err)
+	}
+	if err := cf.AddCommand(cmd); err != ErrCmdExists {
+		t.Errorf("AddCommand of existing command expected ErrCmdExists, got %v", err)
+	}
+
+	cf.Process(mockPlayer, "/test foo bar", mockGame)
+	if gotMessage != "/test foo bar" {
+		t.Errorf("Expected command to receive %q, got %q", "/test foo bar", gotMessage)
+	}
+
+	// Ordinary chat and unknown commands are ignored.
+	gotMessage = ""
+	cf.Process(mockPlayer, "test foo bar", mockGame)
+	cf.Process(mockPlayer, "/", mockGame)
+	cf.Process(mockPlayer, "/unknown", mockGame)
+	if gotMessage != "" {
+		t.Errorf("Expected command not to be called, but it received %q", gotMessage)
+	}
 }
@@ -17,6 +17,8 @@ func getCommands() map[string]*Command {
 	cmds[killCmd] = NewCommand(killCmd, killDesc, killUsage, cmdKill)
 	cmds[tellCmd] = NewCommand(tellCmd, tellDesc, tellUsage, cmdTell)
 	cmds[giveCmd] = NewCommand(giveCmd, giveDesc, giveUsage, cmdGive)
+	cmds[weatherCmd] = NewCommand(weatherCmd, weatherDesc, weatherUsage, cmdWeather)
+	cmds[gameModeCmd] = NewCommand(gameModeCmd, gameModeDesc, gameModeUsage, cmdGameMode)
 	return cmds
 }
 
@@ -222,3 +224,74 @@ func cmdGive(player gamerules.IPlayerClient, message string, cmdHandler gamerule
 		target.EchoMessage(msg)
 	}
 }
+
+const weatherCmd = "weather"
+const weatherUsage = "weather <clear|rain|thunder> [<world>]"
+const weatherDesc = "Changes the weather in a world, or the main world if none is given."
+
+var weatherNames = map[string]Weather{
+	"clear":   WeatherClear,
+	"rain":    WeatherRain,
+	"thunder": WeatherThunder,
+}
+
+func cmdWeather(player gamerules.IPlayerClient, message string, cmdHandler gamerules.IGame) {
+	args := strings.Split(message, " ")
+	if len(args) < 2 || len(args) > 3 {
+		player.EchoMessage(weatherUsage)
+		return
+	}
+
+	weather, ok := weatherNames[args[1]]
+	if !ok {
+		player.EchoMessage(weatherUsage)
+		return
+	}
+
+	world := ""
+	if len(args) == 3 {
+		world = args[2]
+	}
+
+	if !cmdHandler.SetWeather(world, weather) {
+		player.EchoMessage(fmt.Sprintf("'%s' is not a world", world))
+		return
+	}
+	player.EchoMessage("Changing the weather to " + args[1])
+}
+
+const gameModeCmd = "gamemode"
+const gameModeUsage = "gamemode <survival|creative|adventure> [<player>]"
+const gameModeDesc = "Changes the game mode of a player, or yourself if none is given."
+
+var gameModeNames = map[string]GameType{
+	"survival":  GameTypeSurvival,
+	"creative":  GameTypeCreative,
+	"adventure": GameTypeAdventure,
+}
+
+func cmdGameMode(player gamerules.IPlayerClient, message string, cmdHandler gamerules.IGame) {
+	args := strings.Split(message, " ")
+	if len(args) < 2 || len(args) > 3 {
+		player.EchoMessage(gameModeUsage)
+		return
+	}
+
+	gameType, ok := gameModeNames[args[1]]
+	if !ok {
+		player.EchoMessage(gameModeUsage)
+		return
+	}
+
+	target := player
+	if len(args) == 3 {
+		target = cmdHandler.PlayerByName(args[2])
+		if target == nil {
+			player.EchoMessage(fmt.Sprintf("'%s' is not logged in", args[2]))
+			return
+		}
+	}
+
+	target.SetGameType(gameType)
+	player.EchoMessage("Changing the game mode to " + args[1])
+}
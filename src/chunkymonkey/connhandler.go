@@ -1,17 +1,21 @@
 package chunkymonkey
 
 import (
+	"flag"
 	"fmt"
-	"log"
 	"os"
 	"net"
+	"path/filepath"
+	"strings"
+	"time"
 
 	. "chunkymonkey/entity"
 	"chunkymonkey/gamerules"
+	"chunkymonkey/logging"
 	"chunkymonkey/player"
 	"chunkymonkey/proto"
+	"chunkymonkey/record"
 	"chunkymonkey/server_auth"
-	"chunkymonkey/shardserver"
 	. "chunkymonkey/types"
 	"chunkymonkey/worldstore"
 	"nbt"
@@ -25,14 +29,29 @@ const (
 	connTypeServerQuery
 )
 
+// How long a login waits for an old session with the same name to disconnect.
+const replaceSessionTimeout = 10 * NanosecondsInSecond
+
+var connCaptureDir = flag.String(
+	"capture_dir", "",
+	"Directory to write a capture of each connection to, from the handshake "+
+		"onwards. Captures can be replayed with \"replay -capture\".")
+
+// How many times a login replaces sessions with the same name that log in at
+// the same time, before giving up.
+const maxReplaceSessionAttempts = 3
+
 var (
 	clientErrGeneral      = os.NewError("Server error.")
 	clientErrUsername     = os.NewError("Bad username.")
 	clientErrLoginDenied  = os.NewError("You do not have access to this server.")
+	clientErrBanned       = os.NewError("You are banned from this server.")
 	clientErrHandshake    = os.NewError("Handshake error.")
 	clientErrLoginGeneral = os.NewError("Login error.")
 	clientErrAuthFailed   = os.NewError("Minecraft authentication failed.")
 	clientErrUserData     = os.NewError("Error reading user data. Please contact the server administrator.")
+	clientErrOldClient    = os.NewError("Outdated client!")
+	clientErrOldServer    = os.NewError("Outdated server!")
 
 	loginErrorConnType    = os.NewError("unknown/bad connection type")
 	loginErrorMaintenance = os.NewError("server under maintenance")
@@ -45,10 +64,20 @@ type GameInfo struct {
 	serverDesc     string
 	maintenanceMsg string
 	serverId       string
-	shardManager   *shardserver.LocalShardManager
+	world          *World
 	entityManager  *EntityManager
 	worldStore     *worldstore.WorldStore
 	authserver     server_auth.IAuthenticator
+	banList        *BanList
+}
+
+// log returns the logger for the game, or the default logger if there is no
+// game yet.
+func (info *GameInfo) log() logging.Logger {
+	if info == nil || info.game == nil {
+		return logging.Default
+	}
+	return info.game.log()
 }
 
 // Handles connections for a game on the given socket.
@@ -87,7 +116,7 @@ func (ch *ConnHandler) run() {
 	for {
 		conn, err := ch.listener.Accept()
 		if err != nil {
-			log.Print("Accept: ", err)
+			ch.gameInfo.log().Error("Accept: %v", err)
 			return
 		}
 
@@ -95,7 +124,7 @@ func (ch *ConnHandler) run() {
 		select {
 		case ch.gameInfo, ok = <-ch.UpdateGameInfo:
 			if !ok {
-				log.Print("Connection handler shut down.")
+				ch.gameInfo.log().Info("Connection handler shut down.")
 				return
 			}
 		default:
@@ -105,33 +134,61 @@ func (ch *ConnHandler) run() {
 			gameInfo: ch.gameInfo,
 			conn:     conn,
 		}
+		if *connCaptureDir != "" {
+			newLogin.capture = newConnCapture(*connCaptureDir, conn, ch.gameInfo.log())
+		}
 		go newLogin.handle()
 	}
 }
 
+// newConnCapture creates a capture of the connection in dir. Returns nil if
+// the capture file cannot be created.
+func newConnCapture(dir string, conn net.Conn, logger logging.Logger) *record.Capture {
+	name := fmt.Sprintf("%d-%s.capture", time.Nanoseconds(), conn.RemoteAddr())
+	file, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		logger.Warn("Failed to create connection capture: %v", err)
+		return nil
+	}
+	return record.NewCapture(file)
+}
+
 type pktHandler struct {
 	gameInfo *GameInfo
 	conn     net.Conn
+	// If not nil, the connection is captured from the handshake onwards. The
+	// capture is handed over to the player once they have logged in.
+	capture *record.Capture
 
-	connType int
-	username string
+	connType      int
+	username      string
+	loginUsername string
 }
 
 func (l *pktHandler) handle() {
 	var err, clientErr os.Error
 
+	// Packets before the player takes over the connection are captured here.
+	conn := l.conn
+	if l.capture != nil {
+		conn = record.NewCaptureConn(l.conn, l.capture)
+	}
+
 	defer func() {
 		if err != nil {
-			log.Print("Connection closed ", err.String())
+			l.gameInfo.log().Info("Connection closed %s", err.String())
 			if clientErr == nil {
 				clientErr = clientErrGeneral
 			}
-			proto.WriteDisconnect(l.conn, clientErr.String())
-			l.conn.Close()
+			proto.WriteDisconnect(conn, clientErr.String())
+			conn.Close()
+			if l.capture != nil {
+				l.capture.Close()
+			}
 		}
 	}()
 
-	err = proto.ServerReadPacketExpect(l.conn, l, []byte{
+	err = proto.ServerReadPacketExpect(conn, l, []byte{
 		proto.PacketIdHandshake,
 		proto.PacketIdServerListPing,
 	})
@@ -142,9 +199,9 @@ func (l *pktHandler) handle() {
 
 	switch l.connType {
 	case connTypeLogin:
-		err, clientErr = l.handleLogin(l.conn)
+		err, clientErr = l.handleLogin(conn)
 	case connTypeServerQuery:
-		err, clientErr = l.handleServerQuery(l.conn)
+		err, clientErr = l.handleServerQuery(conn)
 	default:
 		err = loginErrorConnType
 	}
@@ -157,7 +214,7 @@ func (l *pktHandler) handleLogin(conn net.Conn) (err, clientErr os.Error) {
 		return
 	}
 
-	log.Print("Client ", conn.RemoteAddr(), " connected as ", l.username)
+	l.gameInfo.log().Info("Client %v connected as %s", conn.RemoteAddr(), l.username)
 
 	// TODO Allow admins to connect.
 	if l.gameInfo.maintenanceMsg != "" {
@@ -166,6 +223,12 @@ func (l *pktHandler) handleLogin(conn net.Conn) (err, clientErr os.Error) {
 		return
 	}
 
+	if l.gameInfo.banList.IsBanned(l.username) {
+		err = fmt.Errorf("Player %q is banned", l.username)
+		clientErr = clientErrBanned
+		return
+	}
+
 	// Load player permissions.
 	permissions := gamerules.Permissions.UserPermissions(l.username)
 	if !permissions.Has("login") {
@@ -193,28 +256,87 @@ func (l *pktHandler) handleLogin(conn net.Conn) (err, clientErr os.Error) {
 			clientErr = clientErrAuthFailed
 			return
 		}
-		log.Print("Client ", conn.RemoteAddr(), " passed minecraft.net authentication")
+		l.gameInfo.log().Info("Client %v passed minecraft.net authentication", conn.RemoteAddr())
 	}
 
 	err = proto.ServerReadPacketExpect(conn, l, []byte{
 		proto.PacketIdLogin,
 	})
 	if err != nil {
-		clientErr = clientErrLoginGeneral
+		clientErr = loginClientError(err)
+		return
+	}
+
+	if l.loginUsername != l.username {
+		err = fmt.Errorf("Client %v: login username %q does not match handshake username %q", conn.RemoteAddr(), l.loginUsername, l.username)
+		clientErr = clientErrUsername
 		return
 	}
 
 	entityId := l.gameInfo.entityManager.NewEntity()
 
+	for attempt := 1; ; attempt++ {
+		// Disconnect any old session with the same name, such as one left behind
+		// by a client that lost its connection. Its player data must be saved
+		// before it is read for the new session.
+		select {
+		case <-l.gameInfo.game.replaceSession(l.username):
+		case <-time.After(replaceSessionTimeout):
+			err = fmt.Errorf("Player %q: timed out waiting for the previous session to disconnect", l.username)
+			clientErr = clientErrLoginGeneral
+			return
+		}
+
+		var newPlayer *player.Player
+		if newPlayer, err, clientErr = l.loadPlayer(entityId); err != nil {
+			return
+		}
+
+		if l.gameInfo.game.connectPlayer(newPlayer) {
+			if l.capture != nil {
+				newPlayer.StartCapture(l.capture)
+			}
+			newPlayer.Run()
+			return
+		}
+
+		// Another login with the same name was added to the game first. Replace
+		// it in turn, and read the player data again once it has been saved.
+		if attempt >= maxReplaceSessionAttempts {
+			err = fmt.Errorf("Player %q: gave up replacing sessions that logged in at the same time", l.username)
+			clientErr = clientErrLoginGeneral
+			return
+		}
+	}
+
+	return
+}
+
+// loadPlayer creates the player for the login from their saved player data.
+func (l *pktHandler) loadPlayer(entityId EntityId) (newPlayer *player.Player, err, clientErr os.Error) {
 	var playerData *nbt.Compound
 	if playerData, err = l.gameInfo.game.worldStore.PlayerData(l.username); err != nil {
 		clientErr = clientErrUserData
 		return
 	}
 
-	player := player.NewPlayer(entityId, l.gameInfo.shardManager, conn, l.username, l.gameInfo.worldStore.SpawnPosition, l.gameInfo.game.playerDisconnect, l.gameInfo.game)
+	// Put the player back in the world that they were last in, if it is still
+	// loaded. The game's worlds are not changed after it starts, so they can be
+	// read here.
+	world := l.gameInfo.world
+	if playerData != nil {
+		if name, ok := player.SavedWorld(playerData); ok {
+			if savedWorld, ok := l.gameInfo.game.worlds[name]; ok {
+				world = savedWorld
+			}
+		}
+	}
+
+	// The player reads and writes the connection directly, and captures the
+	// packets itself.
+	newPlayer = player.NewPlayer(entityId, world.name, world.shardManager, l.conn, l.username, world.spawnPosition, l.gameInfo.game.playerDisconnect, l.gameInfo.game, l.gameInfo.game.logger)
 	if playerData != nil {
-		if err = player.UnmarshalNbt(playerData); err != nil {
+		if err = newPlayer.UnmarshalNbt(playerData); err != nil {
 			// Don't let the player log in, as they will only have default inventory
 			// etc., which could lose items from them. Better for an administrator to
 			// sort this out.
@@ -224,22 +346,46 @@ func (l *pktHandler) handleLogin(conn net.Conn) (err, clientErr os.Error) {
 		}
 	}
 
-	l.gameInfo.game.playerConnect <- player
-	player.Run()
-
 	return
 }
 
+// loginClientError returns the error to report to the client for an error
+// reading its login packet.
+func loginClientError(err os.Error) os.Error {
+	if packetErr, ok := err.(*proto.PacketError); ok {
+		err = packetErr.Err
+	}
+
+	if versionErr, ok := err.(proto.UnsupportedProtocolVersionError); ok {
+		if versionErr.IsClientOutdated() {
+			return clientErrOldClient
+		}
+		return clientErrOldServer
+	}
+
+	return clientErrLoginGeneral
+}
+
 func (l *pktHandler) handleServerQuery(conn net.Conn) (err, clientErr os.Error) {
 	err = loginErrorServerList
-	clientErr = fmt.Errorf(
-		"%s§%d§%d",
+	clientErr = os.NewError(serverListResponse(
 		l.gameInfo.serverDesc,
-		l.gameInfo.game.PlayerCount(), l.gameInfo.maxPlayerCount)
+		l.gameInfo.game.PlayerCount(), l.gameInfo.maxPlayerCount))
 	return
 }
 
+// serverListResponse formats the reason sent in the disconnect packet in
+// reply to a server list ping. The fields are delimited by '§', so that
+// character is removed from the description.
+func serverListResponse(serverDesc string, playerCount, maxPlayerCount int) string {
+	return fmt.Sprintf(
+		"%s§%d§%d",
+		strings.Replace(serverDesc, "§", "", -1),
+		playerCount, maxPlayerCount)
+}
+
 func (l *pktHandler) PacketServerLogin(username string) {
+	l.loginUsername = username
 }
 
 func (l *pktHandler) PacketServerHandshake(username string) {
@@ -251,6 +397,10 @@ func (l *pktHandler) PacketServerListPing() {
 	l.connType = connTypeServerQuery
 }
 
+func (l *pktHandler) PacketClientSettings(locale string, viewDistance byte, chatFlags byte) {}
+
+func (l *pktHandler) PacketCreativeInventoryAction(slotId SlotId, slot *proto.WindowSlot) {}
+
 func (l *pktHandler) PacketKeepAlive(id int32) {}
 
 func (l *pktHandler) PacketChatMessage(message string) {}
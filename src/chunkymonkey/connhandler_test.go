@@ -0,0 +1,115 @@
+package chunkymonkey
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"chunkymonkey/proto"
+	"chunkymonkey/record"
+)
+
+func TestServerListResponse(t *testing.T) {
+	type Test struct {
+		serverDesc     string
+		playerCount    int
+		maxPlayerCount int
+		expectedDesc   string
+	}
+
+	tests := []Test{
+		{"A Minecraft server", 3, 20, "A Minecraft server"},
+		{"", 0, 1, ""},
+		{"§4Red§ server", 10, 10, "4Red server"},
+	}
+
+	for _, test := range tests {
+		response := serverListResponse(test.serverDesc, test.playerCount, test.maxPlayerCount)
+
+		fields := strings.Split(response, "§")
+		if len(fields) != 3 {
+			t.Errorf("%q: expected 3 fields but got %q", test.serverDesc, fields)
+			continue
+		}
+
+		playerCount, err := strconv.Atoi(fields[1])
+		if err != nil || playerCount != test.playerCount {
+			t.Errorf("%q: expected player count %d but got %q", test.serverDesc, test.playerCount, fields[1])
+		}
+		maxPlayerCount, err := strconv.Atoi(fields[2])
+		if err != nil || maxPlayerCount != test.maxPlayerCount {
+			t.Errorf("%q: expected max players %d but got %q", test.serverDesc, test.maxPlayerCount, fields[2])
+		}
+		if fields[0] != test.expectedDesc {
+			t.Errorf("%q: expected description %q but got %q", test.serverDesc, test.expectedDesc, fields[0])
+		}
+	}
+}
+
+// closingBuffer is a capture log that records whether it has been closed.
+type closingBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *closingBuffer) Close() os.Error {
+	b.closed = true
+	return nil
+}
+
+func TestPktHandler_CapturesFromHandshake(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	captureLog := new(closingBuffer)
+	l := &pktHandler{
+		conn:    serverConn,
+		capture: record.NewCapture(captureLog),
+	}
+	done := make(chan bool)
+	go func() {
+		l.handle()
+		close(done)
+	}()
+
+	// A handshake with an invalid username is turned away before the game is
+	// involved.
+	handshake := new(bytes.Buffer)
+	handshake.WriteByte(proto.PacketIdHandshake)
+	binary.Write(handshake, binary.BigEndian, uint16(3))
+	for _, c := range "a b" {
+		binary.Write(handshake, binary.BigEndian, uint16(c))
+	}
+	clientConn.Write(handshake.Bytes())
+	ioutil.ReadAll(clientConn)
+	<-done
+
+	if !captureLog.closed {
+		t.Errorf("expected capture log to be closed")
+	}
+
+	var received, sent bytes.Buffer
+	for {
+		rec, err := record.ReadCaptureRecord(captureLog)
+		if err == os.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("failed to read capture: %v", err)
+		}
+		if rec.Direction == record.DirectionClientToServer {
+			received.Write(rec.Data)
+		} else {
+			sent.Write(rec.Data)
+		}
+	}
+
+	if !bytes.Equal(handshake.Bytes(), received.Bytes()) {
+		t.Errorf("expected handshake % x to be captured, got % x", handshake.Bytes(), received.Bytes())
+	}
+	if sent.Len() == 0 || sent.Bytes()[0] != proto.PacketIdDisconnect {
+		t.Errorf("expected disconnect packet to be captured, got % x", sent.Bytes())
+	}
+}
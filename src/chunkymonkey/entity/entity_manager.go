@@ -1,11 +1,16 @@
 package entity
 
 import (
+	"math"
 	"sync"
 
 	. "chunkymonkey/types"
 )
 
+const maxEntityId = EntityId(math.MaxInt32)
+
+// EntityManager allocates world-unique EntityIds. It is safe for concurrent
+// use.
 type EntityManager struct {
 	nextEntityId EntityId
 	entities     map[EntityId]bool
@@ -20,12 +25,16 @@ func (mgr *EntityManager) Init() {
 	mgr.entities = make(map[EntityId]bool)
 }
 
+// createEntityId returns the next free EntityId. Ids are handed out in
+// increasing order so that an id is not reused soon after its entity is
+// removed (clients may still have packets in flight that refer to it). Once the
+// positive range of EntityId is used up, allocation wraps around and reuses
+// the ids of removed entities.
 func (mgr *EntityManager) createEntityId() EntityId {
-	// Search for next free ID
 	entityId := mgr.nextEntityId
 	_, exists := mgr.entities[entityId]
 	for exists {
-		entityId++
+		entityId = nextEntityId(entityId)
 		if entityId == mgr.nextEntityId {
 			// TODO Better handling of this? It shouldn't happen, realistically - but
 			// neither should it explode.
@@ -33,13 +42,20 @@ func (mgr *EntityManager) createEntityId() EntityId {
 		}
 		_, exists = mgr.entities[entityId]
 	}
-	mgr.nextEntityId = entityId + 1
+	mgr.nextEntityId = nextEntityId(entityId)
 
 	return entityId
 }
 
-// AddEntity adds an entity to the manager, and assigns it a world-unique
-// EntityId.
+// nextEntityId returns the id following entityId, wrapping around to zero
+// rather than overflowing into negative ids.
+func nextEntityId(entityId EntityId) EntityId {
+	if entityId >= maxEntityId {
+		return 0
+	}
+	return entityId + 1
+}
+
 // NewEntity creates a world-unique entityId in the manager and returns it.
 func (mgr *EntityManager) NewEntity() EntityId {
 	mgr.lock.Lock()
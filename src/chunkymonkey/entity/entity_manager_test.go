@@ -0,0 +1,55 @@
+package entity
+
+import (
+	"testing"
+
+	. "chunkymonkey/types"
+)
+
+func TestEntityManager_NewEntity(t *testing.T) {
+	var mgr EntityManager
+	mgr.Init()
+
+	seen := make(map[EntityId]bool)
+	last := EntityId(-1)
+	for i := 0; i < 100; i++ {
+		entityId := mgr.NewEntity()
+		if seen[entityId] {
+			t.Fatalf("entity id %d allocated twice", entityId)
+		}
+		if entityId <= last {
+			t.Errorf("expected entity id greater than %d, got %d", last, entityId)
+		}
+		seen[entityId] = true
+		last = entityId
+	}
+
+	// Removed ids are not reused straight away.
+	mgr.RemoveEntityById(50)
+	if entityId := mgr.NewEntity(); entityId != 100 {
+		t.Errorf("expected entity id 100, got %d", entityId)
+	}
+}
+
+func TestEntityManager_Wraparound(t *testing.T) {
+	var mgr EntityManager
+	mgr.Init()
+
+	first := mgr.NewEntity()
+	second := mgr.NewEntity()
+	mgr.RemoveEntityById(first)
+
+	mgr.nextEntityId = maxEntityId
+	if entityId := mgr.NewEntity(); entityId != maxEntityId {
+		t.Errorf("expected entity id %d, got %d", maxEntityId, entityId)
+	}
+
+	// The freed id is reused once the id space wraps around, and the id still
+	// in use is skipped.
+	if entityId := mgr.NewEntity(); entityId != first {
+		t.Errorf("expected freed entity id %d to be reused, got %d", first, entityId)
+	}
+	if entityId := mgr.NewEntity(); entityId == second || entityId < 0 {
+		t.Errorf("expected a free, non-negative entity id, got %d", entityId)
+	}
+}
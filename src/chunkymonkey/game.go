@@ -2,10 +2,11 @@ package chunkymonkey
 
 import (
 	"bytes"
+	"flag"
 	"fmt"
-	"log"
 	"net"
 	"os"
+	"path"
 	"rand"
 	"regexp"
 	"time"
@@ -13,41 +14,90 @@ import (
 	"chunkymonkey/command"
 	. "chunkymonkey/entity"
 	"chunkymonkey/gamerules"
+	"chunkymonkey/logging"
 	"chunkymonkey/player"
 	"chunkymonkey/proto"
 	"chunkymonkey/server_auth"
-	"chunkymonkey/shardserver"
 	. "chunkymonkey/types"
 	"chunkymonkey/worldstore"
 	"nbt"
 )
 
+var (
+	gameDayLength = flag.Int64(
+		"game_day_length", 24000,
+		"Length of a day in ticks. The time of day wraps around to zero after "+
+			"this many ticks.")
+
+	gameTimeUpdateInterval = flag.Int64(
+		"game_time_update_interval", TicksPerSecond,
+		"Number of ticks between sending the time of day to players.")
+
+	gameWorlds = flag.String(
+		"game_worlds", "",
+		"Comma-separated list of additional worlds to load, each given as "+
+			"name=path. The world that players log in to is named \"world\".")
+)
+
+// The reason given to a player who is disconnected by a new login with the
+// same name.
+const loginElsewhereReason = "You logged in from another location"
+
+// The messages given to a player who cannot sleep in a bed.
+const (
+	bedNotNightMessage = "You can only sleep at night"
+	bedOccupiedMessage = "This bed is occupied"
+)
+
 // We regard usernames as valid if they don't contain "dangerous" characters.
 // That is: characters that might be abused in filename components, etc.
 var validPlayerUsername = regexp.MustCompile(`^[\-a-zA-Z0-9_]+$`)
 
 type Game struct {
-	shardManager  *shardserver.LocalShardManager
 	entityManager EntityManager
 	worldStore    *worldstore.WorldStore
 	connHandler   *ConnHandler
+	banList       *BanList
+
+	// Worlds by name. Players log in to the world they were last in, or to
+	// defaultWorld.
+	worlds       map[string]*World
+	defaultWorld *World
 
 	// Mapping between entityId/name and player object
 	players     map[EntityId]*player.Player
 	playerNames map[string]*player.Player
 
+	// Channels to close when the player with the given name has left the
+	// game, for new logins that are replacing an old session.
+	nameFreed map[string][]chan bool
+
+	// The players shown in clients' player lists.
+	playerList playerList
+
 	// Channels for events/actions
 	workQueue        chan func(*Game)
-	playerConnect    chan *player.Player
+	playerConnect    chan *connectRequest
 	playerDisconnect chan EntityId
+	stopGame         chan bool
+	stopped          chan bool // Closed once the game starts shutting down.
+
+	// The rate that the game has been measured to be ticking at.
+	tps tickRate
+
+	// When the game was created, in nanoseconds.
+	startTime int64
 
 	// Server information
-	time           Ticks
 	serverId       string
 	maintenanceMsg string // if set, logins are disallowed.
+
+	// The logger for the game, which is also given to its players and
+	// shards. If nil, logging.Default is used.
+	logger logging.Logger
 }
 
-func NewGame(worldPath string, listener net.Listener, serverDesc, maintenanceMsg string, maxPlayerCount int) (game *Game, err os.Error) {
+func NewGame(worldPath string, listener net.Listener, serverDesc, maintenanceMsg string, maxPlayerCount int, logger logging.Logger) (game *Game, err os.Error) {
 	worldStore, err := worldstore.LoadWorldStore(worldPath)
 	if err != nil {
 		return nil, err
@@ -58,22 +108,47 @@ func NewGame(worldPath string, listener net.Listener, serverDesc, maintenanceMsg
 		return
 	}
 
+	banList, err := NewBanList(fileBanStore(path.Join(worldPath, "banned-players.txt")))
+	if err != nil {
+		return
+	}
+
 	game = &Game{
 		players:          make(map[EntityId]*player.Player),
 		playerNames:      make(map[string]*player.Player),
+		nameFreed:        make(map[string][]chan bool),
 		workQueue:        make(chan func(*Game), 256),
-		playerConnect:    make(chan *player.Player),
+		playerConnect:    make(chan *connectRequest),
 		playerDisconnect: make(chan EntityId),
-		time:             worldStore.Time,
+		stopGame:         make(chan bool, 1),
+		stopped:          make(chan bool),
 		worldStore:       worldStore,
+		worlds:           make(map[string]*World),
+		banList:          banList,
+		logger:           logger,
+		startTime:        time.Nanoseconds(),
 	}
 
 	game.entityManager.Init()
+	game.playerList.init()
 
 	game.serverId = fmt.Sprintf("%016x", rand.NewSource(worldStore.Seed).Int63())
 	//game.serverId = "-"
 
-	game.shardManager = shardserver.NewLocalShardManager(worldStore.ChunkStore, &game.entityManager)
+	game.defaultWorld = NewWorld(defaultWorldName, worldStore, &game.entityManager, logger)
+	game.worlds[defaultWorldName] = game.defaultWorld
+
+	worldPaths, err := parseWorldPaths(*gameWorlds)
+	if err != nil {
+		return nil, err
+	}
+	for name, worldPath := range worldPaths {
+		var store *worldstore.WorldStore
+		if store, err = worldstore.LoadWorldStore(worldPath); err != nil {
+			return nil, err
+		}
+		game.worlds[name] = NewWorld(name, store, &game.entityManager, logger)
+	}
 
 	// TODO: Load the prefix from a config file
 	gamerules.CommandFramework = command.NewCommandFramework("/")
@@ -85,74 +160,374 @@ func NewGame(worldPath string, listener net.Listener, serverDesc, maintenanceMsg
 		serverDesc:     serverDesc,
 		maintenanceMsg: maintenanceMsg,
 		serverId:       game.serverId,
-		shardManager:   game.shardManager,
+		world:          game.defaultWorld,
 		entityManager:  &game.entityManager,
 		worldStore:     game.worldStore,
 		authserver:     authserver,
+		banList:        banList,
 	})
 
 	return
 }
 
-// Fetch external events and respond appropriately.
+// log returns the logger for the game.
+func (game *Game) log() logging.Logger {
+	if game.logger == nil {
+		return logging.Default
+	}
+	return game.logger
+}
+
+// Fetch external events and respond appropriately. Serve returns once the
+// game has been shut down. The game's ticks are driven by RunTicks.
 func (game *Game) Serve() {
-	defer game.connHandler.Stop()
+	for {
+		select {
+		case f := <-game.workQueue:
+			f(game)
+		case req := <-game.playerConnect:
+			req.added <- game.onPlayerConnect(req.player)
+		case entityId := <-game.playerDisconnect:
+			game.onPlayerDisconnect(entityId)
+		case <-game.stopGame:
+			close(game.stopped)
+			game.onShutdown()
+			return
+		}
+	}
+}
 
-	ticker := time.NewTicker(NanosecondsInSecond / TicksPerSecond)
+// Shutdown requests that the game stop. New connections are refused, all
+// players are disconnected, and the world is saved before Serve returns.
+func (game *Game) Shutdown() {
+	// Don't block. If the channel has a message in already, then that's good
+	// enough.
+	select {
+	case game.stopGame <- true:
+	default:
+	}
+}
 
-	for {
+func (game *Game) onShutdown() {
+	game.log().Info("Shutting down.")
+
+	game.connHandler.Stop()
+
+	buf := new(bytes.Buffer)
+	proto.WriteDisconnect(buf, "Server shutting down.")
+	packet := buf.Bytes()
+
+	for _, player := range game.players {
+		player.TransmitPacket(packet)
+		player.Stop()
+	}
+
+	// Wait for all players to disconnect, which saves their data. Keep servicing
+	// the work queue, as players use it while disconnecting.
+	for len(game.players) > 0 {
 		select {
 		case f := <-game.workQueue:
 			f(game)
-		case <-ticker.C:
-			game.onTick()
-		case player := <-game.playerConnect:
-			game.onPlayerConnect(player)
+		case req := <-game.playerConnect:
+			added := game.onPlayerConnect(req.player)
+			if added {
+				req.player.TransmitPacket(packet)
+				req.player.Stop()
+			}
+			req.added <- added
 		case entityId := <-game.playerDisconnect:
 			game.onPlayerDisconnect(entityId)
 		}
 	}
+
+	for _, world := range game.worlds {
+		world.shardManager.SaveAll()
+	}
+}
+
+// connectRequest asks the game to add a player that has logged in. Whether
+// the player was added is sent on added.
+type connectRequest struct {
+	player *player.Player
+	added  chan bool
 }
 
-// A new player has connected to the server
-func (game *Game) onPlayerConnect(newPlayer *player.Player) {
+// connectPlayer adds a player that has logged in to the game. It returns
+// false, without adding the player, if another player with the same name is
+// already in the game.
+func (game *Game) connectPlayer(newPlayer *player.Player) bool {
+	added := make(chan bool, 1)
+	game.playerConnect <- &connectRequest{newPlayer, added}
+	return <-added
+}
+
+// A new player has connected to the server. Returns false if another player
+// with the same name is already in the game, in which case the new player is
+// not added.
+func (game *Game) onPlayerConnect(newPlayer *player.Player) bool {
+	// Logins wait in replaceSession for an old session to leave, but two logins
+	// for the same name can race each other. The later login must replace the
+	// earlier one in turn, so that it reads the player data that the earlier
+	// session saves when it leaves.
+	if _, ok := game.playerNames[newPlayer.Name()]; ok {
+		return false
+	}
+
+	world, ok := game.worlds[newPlayer.World()]
+	if !ok {
+		world = game.defaultWorld
+	}
+
 	game.players[newPlayer.GetEntityId()] = newPlayer
 	game.playerNames[newPlayer.Name()] = newPlayer
+	world.players[newPlayer.GetEntityId()] = newPlayer.Client()
+
+	newPlayer.TransmitPacket(world.joinPackets())
+	game.playerList.add(newPlayer.GetEntityId(), newPlayer.Name(), newPlayer.Client())
+
+	return true
 }
 
 // A player has disconnected from the server
 func (game *Game) onPlayerDisconnect(entityId EntityId) {
-	oldPlayer := game.players[entityId]
+	oldPlayer, ok := game.players[entityId]
+	if !ok {
+		// The player disconnected before they were added to the game.
+		game.entityManager.RemoveEntityById(entityId)
+		return
+	}
 	game.players[entityId] = nil, false
-	game.playerNames[oldPlayer.Name()] = nil, false
+	if game.playerNames[oldPlayer.Name()] == oldPlayer {
+		game.playerNames[oldPlayer.Name()] = nil, false
+	}
+	defer game.onNameFreed(oldPlayer.Name())
+	for _, world := range game.worlds {
+		world.removePlayer(entityId)
+	}
+	game.playerList.remove(entityId)
 	game.entityManager.RemoveEntityById(entityId)
 
 	playerData := nbt.NewCompound()
 	if err := oldPlayer.MarshalNbt(playerData); err != nil {
-		log.Printf("Failed to marshal player data: %v", err)
+		game.log().Error("Failed to marshal player data for %v: %v", oldPlayer, err)
 		return
 	}
 
 	if err := game.worldStore.WritePlayerData(oldPlayer.Name(), playerData); err != nil {
-		log.Printf("Failed when writing player data: %v", err)
+		game.log().Error("Failed when writing player data for %v: %v", oldPlayer, err)
+	}
+}
+
+// replaceSession disconnects any player already logged in with the given
+// name, so that they can log in again from a new client. The returned channel
+// is closed once the old session has left the game and its player data has
+// been saved. If the old session is already disconnecting, it is waited for
+// in the same way.
+func (game *Game) replaceSession(name string) <-chan bool {
+	freed := make(chan bool)
+	game.enqueue(func(game *Game) {
+		if !game.kick(name, loginElsewhereReason) {
+			close(freed)
+			return
+		}
+		game.nameFreed[name] = append(game.nameFreed[name], freed)
+	})
+	return freed
+}
+
+// onNameFreed wakes the logins waiting for a player with the given name to
+// leave the game.
+func (game *Game) onNameFreed(name string) {
+	if _, ok := game.playerNames[name]; ok {
+		// Another session with the name is still in the game.
+		return
 	}
+	for _, freed := range game.nameFreed[name] {
+		close(freed)
+	}
+	game.nameFreed[name] = nil, false
+}
+
+// kick disconnects the named player, giving them the reason. Returns false if
+// the player is not connected.
+func (game *Game) kick(name string, reason string) bool {
+	player, ok := game.playerNames[name]
+	if !ok {
+		return false
+	}
+
+	game.log().Info("Kicking player %q: %s", name, reason)
+
+	buf := new(bytes.Buffer)
+	proto.WriteDisconnect(buf, reason)
+	player.TransmitPacket(buf.Bytes())
+	player.Stop()
+
+	return true
 }
 
 func (game *Game) onTick() {
-	game.time++
-	if game.time%TicksPerSecond == 0 {
-		game.sendTimeUpdate()
+	for _, player := range game.players {
+		player.Tick()
+	}
+
+	for _, world := range game.worlds {
+		world.shardManager.Tick()
+
+		lightChanged := false
+		if world.weather.tick(world.rand) {
+			game.sendWeather(world)
+			lightChanged = true
+		}
+		if world.advanceTime(Ticks(*gameDayLength), Ticks(*gameTimeUpdateInterval)) {
+			game.sendTimeUpdate(world)
+			lightChanged = true
+		}
+		if game.skipNight(world) {
+			lightChanged = true
+		}
+		if lightChanged {
+			game.updateSkyDarkness(world)
+		}
+	}
+}
+
+// setWeather forces the weather in the named world, or the default world if
+// the name is empty. The weather then lasts as long as if it had changed
+// naturally. Returns false if there is no such world.
+func (game *Game) setWeather(name string, weather Weather) bool {
+	world := game.defaultWorld
+	if name != "" {
+		var ok bool
+		if world, ok = game.worlds[name]; !ok {
+			return false
+		}
+	}
+
+	world.weather.set(weather, world.rand)
+	game.sendWeather(world)
+	game.updateSkyDarkness(world)
+
+	return true
+}
+
+// requestSleep puts a player to sleep in the bed at bedLoc if it is night in
+// their world and the bed is free, and otherwise tells them why they cannot
+// sleep.
+func (game *Game) requestSleep(entityId EntityId, bedLoc BlockXyz) {
+	for _, world := range game.worlds {
+		client, ok := world.players[entityId]
+		if !ok {
+			continue
+		}
+
+		switch {
+		case !world.isNight(Ticks(*gameDayLength)):
+			client.EchoMessage(bedNotNightMessage)
+		case world.bedOccupied(&bedLoc):
+			client.EchoMessage(bedOccupiedMessage)
+		default:
+			world.sleepers[entityId] = bedLoc
+			client.EnterBed(bedLoc)
+		}
+		return
+	}
+}
+
+// playerWokeUp records that a player is no longer asleep in whichever world
+// they are in.
+func (game *Game) playerWokeUp(entityId EntityId) {
+	for _, world := range game.worlds {
+		world.sleepers[entityId] = BlockXyz{}, false
+	}
+}
+
+// skipNight moves the time in a world on to the next morning if it is night
+// and all of the players in the world are asleep, and wakes them up. Returns
+// true if the night was skipped.
+func (game *Game) skipNight(world *World) bool {
+	dayLength := Ticks(*gameDayLength)
+	if !world.isNight(dayLength) || !world.allSleeping() {
+		return false
+	}
+
+	world.time = 0
+	game.sendTimeUpdate(world)
+
+	for entityId := range world.sleepers {
+		world.players[entityId].WakeUp()
+	}
+	world.sleepers = make(map[EntityId]BlockXyz)
+
+	return true
+}
+
+func (game *Game) updateSkyDarkness(world *World) {
+	world.shardManager.SetSkyDarkness(world.skyDarkness(Ticks(*gameDayLength)))
+}
+
+// movePlayerToWorld moves the player to the spawn position of the named
+// world. Returns false if there is no such world.
+func (game *Game) movePlayerToWorld(p *player.Player, name string) bool {
+	world, ok := game.worlds[name]
+	if !ok {
+		return false
+	}
+
+	entityId := p.GetEntityId()
+	for _, oldWorld := range game.worlds {
+		oldWorld.removePlayer(entityId)
+	}
+	world.players[entityId] = p.Client()
+
+	p.ChangeWorld(world.name, world.shardManager, world.spawnPosition, world.joinPackets())
+
+	return true
+}
+
+// skyDarkness returns how much darker sky light is than at midday at the given
+// time of day. The first half of the day is light, followed by dusk, night,
+// and dawn.
+func skyDarkness(time, dayLength Ticks) int8 {
+	const (
+		maxDarkness = 11
+		dusk        = 0.5
+		night       = 0.575
+		dawn        = 0.925
+	)
+
+	if dayLength <= 0 {
+		return 0
 	}
+
+	f := float64(time%dayLength) / float64(dayLength)
+	switch {
+	case f < dusk:
+		return 0
+	case f < night:
+		return int8(maxDarkness * (f - dusk) / (night - dusk))
+	case f < dawn:
+		return maxDarkness
+	}
+	return int8(maxDarkness * (1 - f) / (1 - dawn))
 }
 
 // Utility functions
 
-// Send a time/keepalive packet
-func (game *Game) sendTimeUpdate() {
+// Send a time/keepalive packet to the players in a world
+func (game *Game) sendTimeUpdate(world *World) {
+	buf := new(bytes.Buffer)
+	proto.ServerWriteTimeUpdate(buf, world.time)
+
+	world.multicastPacket(buf.Bytes())
+}
+
+// Send the weather to the players in a world
+func (game *Game) sendWeather(world *World) {
 	buf := new(bytes.Buffer)
-	proto.ServerWriteTimeUpdate(buf, game.time)
+	writeWeather(buf, world.weather.weather)
 
-	game.multicastPacket(buf.Bytes(), nil)
+	world.multicastPacket(buf.Bytes())
 }
 
 // Send a packet to every player connected to the server
@@ -171,6 +546,21 @@ func (game *Game) enqueue(f func(*Game)) {
 	game.workQueue <- f
 }
 
+// EnqueueAsync runs f on the game goroutine. It returns immediately with a
+// channel that receives f's result once it has run.
+func (game *Game) EnqueueAsync(f func(*Game) interface{}) <-chan interface{} {
+	result := make(chan interface{}, 1)
+	game.enqueue(func(game *Game) {
+		result <- f(game)
+	})
+	return result
+}
+
+// EnqueueWithResult runs f on the game goroutine, and returns its result.
+func (game *Game) EnqueueWithResult(f func(*Game) interface{}) interface{} {
+	return <-game.EnqueueAsync(f)
+}
+
 // The following functions implement the IGame interface
 
 func (game *Game) BroadcastPacket(packet []byte) {
@@ -191,37 +581,98 @@ func (game *Game) ItemTypeById(id int) (gamerules.ItemType, bool) {
 }
 
 func (game *Game) PlayerCount() int {
-	result := make(chan int)
-	game.enqueue(func(_ *Game) {
-		result <- len(game.players)
-	})
-	return <-result
+	return game.EnqueueWithResult(func(game *Game) interface{} {
+		return len(game.players)
+	}).(int)
 }
 
 func (game *Game) PlayerByEntityId(id EntityId) gamerules.IPlayerClient {
-	result := make(chan gamerules.IPlayerClient)
-	game.enqueue(func(_ *Game) {
-		player, ok := game.players[id]
-		if ok {
-			result <- player.Client()
-		} else {
-			result <- nil
+	client, _ := game.EnqueueWithResult(func(game *Game) interface{} {
+		if player, ok := game.players[id]; ok {
+			return player.Client()
 		}
-		close(result)
+		return nil
+	}).(gamerules.IPlayerClient)
+	return client
+}
+
+// Kick disconnects the named player, giving them the reason. Returns false if
+// the player is not connected.
+func (game *Game) Kick(name string, reason string) bool {
+	return game.EnqueueWithResult(func(game *Game) interface{} {
+		return game.kick(name, reason)
+	}).(bool)
+}
+
+// Ban prevents the named player from logging in again, and kicks them if
+// they are connected.
+func (game *Game) Ban(name string) (err os.Error) {
+	if err = game.banList.Ban(name); err != nil {
+		return
+	}
+	game.Kick(name, clientErrBanned.String())
+	return
+}
+
+// Explode causes an explosion of the given power at center, destroying nearby
+// blocks and hurting nearby players in the default world. Only the shard
+// containing center is affected. Returns false, and nothing happens, if that
+// shard is not loaded.
+func (game *Game) Explode(center AbsXyz, power float32) bool {
+	shardClient := game.defaultWorld.shardManager.ShardShardConnect(center.ToShardXz())
+	if shardClient == nil {
+		return false
+	}
+	shardClient.ReqExplode(center, power)
+	return true
+}
+
+// MovePlayerToWorld moves the player to the spawn position of the named
+// world. The player's chunks in their old world are unloaded, and the chunks
+// around the spawn position are loaded from the new world. Returns false if
+// there is no such world.
+func (game *Game) MovePlayerToWorld(p *player.Player, world string) bool {
+	return game.EnqueueWithResult(func(game *Game) interface{} {
+		return game.movePlayerToWorld(p, world)
+	}).(bool)
+}
+
+// SetWeather forces the weather in the named world, or the default world if
+// the name is empty. Returns false if there is no such world.
+func (game *Game) SetWeather(world string, weather Weather) bool {
+	return game.EnqueueWithResult(func(game *Game) interface{} {
+		return game.setWeather(world, weather)
+	}).(bool)
+}
+
+// RequestSleep asks for a player to go to sleep in the bed at bedLoc. The
+// night is skipped in a world once all of the players in it are asleep.
+func (game *Game) RequestSleep(entityId EntityId, bedLoc BlockXyz) {
+	game.enqueue(func(game *Game) {
+		game.requestSleep(entityId, bedLoc)
+	})
+}
+
+// PlayerWokeUp records that a player is no longer asleep in a bed.
+func (game *Game) PlayerWokeUp(entityId EntityId) {
+	game.enqueue(func(game *Game) {
+		game.playerWokeUp(entityId)
+	})
+}
+
+// SetPlayerPing updates the ping shown for a player in the player list.
+func (game *Game) SetPlayerPing(entityId EntityId, pingMs int16) {
+	game.enqueue(func(game *Game) {
+		game.playerList.setPing(entityId, pingMs)
 	})
-	return <-result
 }
 
 func (game *Game) PlayerByName(name string) gamerules.IPlayerClient {
-	result := make(chan gamerules.IPlayerClient)
-	game.enqueue(func(_ *Game) {
-		player, ok := game.playerNames[name]
-		if ok {
-			result <- player.Client()
-		} else {
-			result <- nil
+	client, _ := game.EnqueueWithResult(func(game *Game) interface{} {
+		if player, ok := game.playerNames[name]; ok {
+			return player.Client()
 		}
-		close(result)
-	})
-	return <-result
+		return nil
+	}).(gamerules.IPlayerClient)
+	return client
 }
@@ -0,0 +1,712 @@
+package chunkymonkey
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"rand"
+	"strings"
+	"testing"
+
+	"chunkymonkey/gamerules"
+	"chunkymonkey/logging"
+	"chunkymonkey/player"
+	"chunkymonkey/proto"
+	"chunkymonkey/shardserver"
+	. "chunkymonkey/types"
+	"chunkymonkey/worldstore"
+)
+
+func TestWorld_advanceTime(t *testing.T) {
+	world := &World{time: 23990}
+
+	numUpdates := 0
+	for i := 0; i < 30; i++ {
+		if world.advanceTime(24000, 20) {
+			numUpdates++
+		}
+	}
+
+	if world.time != 20 {
+		t.Errorf("expected time to wrap around to 20 but got %d", world.time)
+	}
+	// Updates are due at times 0 and 20.
+	if numUpdates != 2 {
+		t.Errorf("expected 2 time updates but got %d", numUpdates)
+	}
+}
+
+func Test_skyDarkness(t *testing.T) {
+	type Test struct {
+		time     Ticks
+		expected int8
+	}
+
+	tests := []Test{
+		{0, 0},
+		{6000, 0},
+		{12000, 0},
+		{18000, 11},
+		{24000, 0},
+	}
+
+	for _, test := range tests {
+		if darkness := skyDarkness(test.time, 24000); darkness != test.expected {
+			t.Errorf("at time %d expected darkness %d but got %d", test.time, test.expected, darkness)
+		}
+	}
+
+	// Darkness increases through dusk.
+	last := int8(0)
+	for time := Ticks(12000); time <= 13800; time += 100 {
+		darkness := skyDarkness(time, 24000)
+		if darkness < last {
+			t.Errorf("expected darkness to increase during dusk, but went from %d to %d at %d", last, darkness, time)
+		}
+		last = darkness
+	}
+}
+
+// recordingBanStore keeps banned names in memory, and records saves.
+type recordingBanStore struct {
+	names []string
+	saves int
+}
+
+func (store *recordingBanStore) LoadBans() ([]string, os.Error) {
+	return store.names, nil
+}
+
+func (store *recordingBanStore) SaveBans(names []string) os.Error {
+	store.names = names
+	store.saves++
+	return nil
+}
+
+func TestGame_kick(t *testing.T) {
+	bob := player.NewPlayer(1, defaultWorldName, nil, nil, "bob", BlockXyz{0, 64, 0}, nil, nil, nil)
+	game := &Game{
+		players:     map[EntityId]*player.Player{1: bob},
+		playerNames: map[string]*player.Player{"bob": bob},
+	}
+
+	if game.kick("alice", "Go away") {
+		t.Errorf("expected kicking a player who is not connected to fail")
+	}
+	if !game.kick("bob", "Go away") {
+		t.Errorf("expected kicking a connected player to succeed")
+	}
+}
+
+func TestGame_replaceSession(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replace_session")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	logger := &logging.Recorder{}
+	bob := player.NewPlayer(1, defaultWorldName, nil, nil, "bob", BlockXyz{0, 64, 0}, nil, nil, nil)
+	game := &Game{
+		players:     map[EntityId]*player.Player{1: bob},
+		playerNames: map[string]*player.Player{"bob": bob},
+		nameFreed:   make(map[string][]chan bool),
+		workQueue:   make(chan func(*Game), 1),
+		worldStore:  &worldstore.WorldStore{WorldPath: dir},
+		worlds:      make(map[string]*World),
+		logger:      logger,
+	}
+	game.entityManager.Init()
+	game.playerList.init()
+
+	// bob logs in again from a new client, and the old session is kicked.
+	freed := game.replaceSession("bob")
+	serveWork(game, 1)
+
+	kicked := false
+	for _, entry := range logger.Entries {
+		if strings.Contains(entry.Message, loginElsewhereReason) {
+			kicked = true
+		}
+	}
+	if !kicked {
+		t.Errorf("expected the old session to be kicked, got log %+v", logger.Entries)
+	}
+
+	// The new login waits while the old session disconnects.
+	select {
+	case <-freed:
+		t.Fatalf("expected the new login to wait for the old session to leave")
+	default:
+	}
+
+	game.onPlayerDisconnect(1)
+
+	select {
+	case <-freed:
+	default:
+		t.Fatalf("expected the new login to continue once the old session left")
+	}
+	if data, err := game.worldStore.PlayerData("bob"); data == nil || err != nil {
+		t.Errorf("expected the old session's player data to be saved first, got %v, %v", data, err)
+	}
+	if _, ok := game.playerNames["bob"]; ok {
+		t.Errorf("expected bob to have left the game")
+	}
+
+	// With nobody logged in as bob, a login continues straight away.
+	freed = game.replaceSession("bob")
+	serveWork(game, 1)
+	select {
+	case <-freed:
+	default:
+		t.Errorf("expected a login with no old session not to wait")
+	}
+}
+
+func TestGame_onPlayerConnect_NameInUse(t *testing.T) {
+	bob := player.NewPlayer(1, defaultWorldName, nil, nil, "bob", BlockXyz{0, 64, 0}, nil, nil, nil)
+	game := &Game{
+		players:     map[EntityId]*player.Player{1: bob},
+		playerNames: map[string]*player.Player{"bob": bob},
+	}
+
+	// A second login for bob that raced the first is not added, and the first
+	// session is left alone for the second login to replace.
+	racer := player.NewPlayer(2, defaultWorldName, nil, nil, "bob", BlockXyz{0, 64, 0}, nil, nil, nil)
+	if game.onPlayerConnect(racer) {
+		t.Errorf("expected a login for a name in use not to be added")
+	}
+	if game.playerNames["bob"] != bob {
+		t.Errorf("expected the first session to stay in the game")
+	}
+	if _, ok := game.players[2]; ok {
+		t.Errorf("expected the racing login not to be in the game")
+	}
+}
+
+func TestBanList(t *testing.T) {
+	store := &recordingBanStore{names: []string{"griefer"}}
+	banList, err := NewBanList(store)
+	if err != nil {
+		t.Fatalf("unexpected error creating ban list: %v", err)
+	}
+
+	if !banList.IsBanned("griefer") {
+		t.Errorf("expected player loaded from the store to be banned")
+	}
+	if banList.IsBanned("bob") {
+		t.Errorf("expected bob not to be banned")
+	}
+
+	if err = banList.Ban("bob"); err != nil {
+		t.Fatalf("unexpected error banning bob: %v", err)
+	}
+	if !banList.IsBanned("bob") {
+		t.Errorf("expected bob to be banned")
+	}
+	if store.saves != 1 || len(store.names) != 2 {
+		t.Errorf("expected both banned players to be saved once, got %v after %d saves", store.names, store.saves)
+	}
+
+	// Banning a banned player again does nothing.
+	banList.Ban("bob")
+	if store.saves != 1 {
+		t.Errorf("expected no further saves, got %d", store.saves)
+	}
+}
+
+func TestHandleLogin_Banned(t *testing.T) {
+	banList, _ := NewBanList(&recordingBanStore{names: []string{"griefer"}})
+
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	l := &pktHandler{
+		gameInfo: &GameInfo{banList: banList},
+		conn:     serverConn,
+		username: "griefer",
+	}
+
+	err, clientErr := l.handleLogin(serverConn)
+	if err == nil || clientErr != clientErrBanned {
+		t.Errorf("expected banned login to be refused, got err=%v clientErr=%v", err, clientErr)
+	}
+}
+
+// serveWork runs n functions from the game's work queue.
+func serveWork(game *Game, n int) {
+	for i := 0; i < n; i++ {
+		f := <-game.workQueue
+		f(game)
+	}
+}
+
+func TestGame_EnqueueWithResult(t *testing.T) {
+	bob := player.NewPlayer(1, defaultWorldName, nil, nil, "bob", BlockXyz{0, 64, 0}, nil, nil, nil)
+	game := &Game{
+		players:   map[EntityId]*player.Player{1: bob},
+		workQueue: make(chan func(*Game), 1),
+	}
+	go serveWork(game, 3)
+
+	result := game.EnqueueWithResult(func(game *Game) interface{} {
+		return len(game.players)
+	})
+	if count, ok := result.(int); !ok || count != 1 {
+		t.Errorf("expected player count 1, got %v", result)
+	}
+
+	resultChan := game.EnqueueAsync(func(game *Game) interface{} {
+		return len(game.players) + 1
+	})
+	result = <-resultChan
+	if count, ok := result.(int); !ok || count != 2 {
+		t.Errorf("expected async result 2, got %v", result)
+	}
+
+	if count := game.PlayerCount(); count != 1 {
+		t.Errorf("expected PlayerCount 1, got %d", count)
+	}
+}
+
+func TestGame_movePlayerToWorld(t *testing.T) {
+	bob := player.NewPlayer(1, defaultWorldName, nil, nil, "bob", BlockXyz{0, 64, 0}, nil, nil, nil)
+	world := &World{
+		name:          defaultWorldName,
+		spawnPosition: BlockXyz{0, 64, 0},
+		players:       map[EntityId]gamerules.IPlayerClient{1: bob.Client()},
+	}
+	nether := &World{
+		name:          "nether",
+		spawnPosition: BlockXyz{100, 64, 100},
+		players:       make(map[EntityId]gamerules.IPlayerClient),
+	}
+	game := &Game{
+		worlds:       map[string]*World{world.name: world, nether.name: nether},
+		defaultWorld: world,
+		players:      map[EntityId]*player.Player{1: bob},
+		playerNames:  map[string]*player.Player{"bob": bob},
+	}
+
+	if game.movePlayerToWorld(bob, "the_end") {
+		t.Errorf("expected moving to a world that does not exist to fail")
+	}
+
+	if !game.movePlayerToWorld(bob, "nether") {
+		t.Fatalf("expected moving to the nether to succeed")
+	}
+	if _, ok := world.players[1]; ok {
+		t.Errorf("expected bob to have left the default world")
+	}
+	if _, ok := nether.players[1]; !ok {
+		t.Errorf("expected bob to be in the nether")
+	}
+
+	if !game.movePlayerToWorld(bob, defaultWorldName) {
+		t.Fatalf("expected moving back to the default world to succeed")
+	}
+	if _, ok := world.players[1]; !ok {
+		t.Errorf("expected bob to be back in the default world")
+	}
+	if len(nether.players) != 0 {
+		t.Errorf("expected nobody left in the nether but got %d players", len(nether.players))
+	}
+}
+
+func Test_parseWorldPaths(t *testing.T) {
+	worldPaths, err := parseWorldPaths("nether=worlds/nether,end=worlds/end")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(worldPaths) != 2 || worldPaths["nether"] != "worlds/nether" || worldPaths["end"] != "worlds/end" {
+		t.Errorf("unexpected worlds %v", worldPaths)
+	}
+
+	for _, s := range []string{"nether", "=path", "nether=a,nether=b", "world=path"} {
+		if _, err := parseWorldPaths(s); err == nil {
+			t.Errorf("expected error parsing %q", s)
+		}
+	}
+}
+
+// packetRecordingClient records the packets and messages sent to it, and
+// whether it was put to bed or woken up.
+type packetRecordingClient struct {
+	gamerules.IPlayerClient
+	packets  [][]byte
+	messages []string
+	inBed    bool
+	woken    bool
+}
+
+func (client *packetRecordingClient) EchoMessage(msg string) {
+	client.messages = append(client.messages, msg)
+}
+
+func (client *packetRecordingClient) EnterBed(bedLoc BlockXyz) {
+	client.inBed = true
+}
+
+func (client *packetRecordingClient) TransmitPacket(packet []byte) {
+	client.packets = append(client.packets, packet)
+}
+
+func (client *packetRecordingClient) WakeUp() {
+	client.woken = true
+}
+
+func newWeatherTestWorld(name string, clients ...gamerules.IPlayerClient) *World {
+	world := &World{
+		name:         name,
+		shardManager: shardserver.NewLocalShardManager(nil, nil, nil),
+		rand:         rand.New(rand.NewSource(1)),
+		players:      make(map[EntityId]gamerules.IPlayerClient),
+		sleepers:     make(map[EntityId]BlockXyz),
+	}
+	for i, client := range clients {
+		world.players[EntityId(i+1)] = client
+	}
+	world.weather.set(WeatherClear, world.rand)
+	return world
+}
+
+func TestGame_setWeather_BroadcastsToWorld(t *testing.T) {
+	alice := &packetRecordingClient{}
+	bob := &packetRecordingClient{}
+	carol := &packetRecordingClient{}
+	world := newWeatherTestWorld(defaultWorldName, alice, bob)
+	nether := newWeatherTestWorld("nether", carol)
+	game := &Game{
+		worlds:       map[string]*World{world.name: world, nether.name: nether},
+		defaultWorld: world,
+	}
+
+	if game.setWeather("the_end", WeatherRain) {
+		t.Errorf("expected setting the weather in a world that does not exist to fail")
+	}
+	if !game.setWeather("", WeatherRain) {
+		t.Fatalf("expected setting the weather in the default world to succeed")
+	}
+
+	expected := new(bytes.Buffer)
+	proto.WriteState(expected, StateReasonBeginRain, 0)
+	for _, client := range []*packetRecordingClient{alice, bob} {
+		if len(client.packets) != 1 || !bytes.Equal(client.packets[0], expected.Bytes()) {
+			t.Errorf("expected rain packet %x but got %x", expected.Bytes(), client.packets)
+		}
+	}
+	if len(carol.packets) != 0 {
+		t.Errorf("expected no packets to players in another world but got %x", carol.packets)
+	}
+
+	if world.skyDarkness(24000) != weatherRainDarkness {
+		t.Errorf("expected rain to darken the sky by %d at midday but got %d",
+			weatherRainDarkness, world.skyDarkness(24000))
+	}
+}
+
+func TestWeatherState_tick(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	// The weather changes when the countdown runs out.
+	w := weatherState{weather: WeatherClear, remaining: 1}
+	if w.tick(r) {
+		t.Errorf("expected weather not to change before the countdown runs out")
+	}
+	if !w.tick(r) || w.weather == WeatherClear {
+		t.Errorf("expected clear weather to turn stormy, but got %d", w.weather)
+	}
+
+	// Forcing the weather restarts the countdown.
+	w = weatherState{weather: WeatherRain, remaining: 0}
+	w.set(WeatherClear, r)
+	for i := 0; i < weatherClearMinTicks; i++ {
+		if w.tick(r) {
+			t.Fatalf("expected forced weather to last at least %d ticks, but changed after %d",
+				weatherClearMinTicks, i)
+		}
+	}
+}
+
+func TestGame_skipNight_AllSleeping(t *testing.T) {
+	alice := &packetRecordingClient{}
+	bob := &packetRecordingClient{}
+	world := newWeatherTestWorld(defaultWorldName, alice, bob)
+	game := &Game{
+		worlds:       map[string]*World{world.name: world},
+		defaultWorld: world,
+	}
+	world.time = Ticks(*gameDayLength) * 3 / 4
+
+	game.requestSleep(1, BlockXyz{0, 64, 0})
+	game.requestSleep(2, BlockXyz{4, 64, 0})
+
+	if !game.skipNight(world) {
+		t.Fatalf("expected the night to be skipped when all players are asleep")
+	}
+	if world.time != 0 {
+		t.Errorf("expected time to move on to morning, but got %d", world.time)
+	}
+
+	expected := new(bytes.Buffer)
+	proto.ServerWriteTimeUpdate(expected, 0)
+	for _, client := range []*packetRecordingClient{alice, bob} {
+		if len(client.packets) != 1 || !bytes.Equal(client.packets[0], expected.Bytes()) {
+			t.Errorf("expected time update %x but got %x", expected.Bytes(), client.packets)
+		}
+		if !client.woken {
+			t.Errorf("expected sleeping player to be woken")
+		}
+	}
+	if len(world.sleepers) != 0 {
+		t.Errorf("expected no sleepers after the night was skipped, got %v", world.sleepers)
+	}
+}
+
+func TestGame_skipNight_OneOfTwoSleeping(t *testing.T) {
+	alice := &packetRecordingClient{}
+	bob := &packetRecordingClient{}
+	world := newWeatherTestWorld(defaultWorldName, alice, bob)
+	game := &Game{
+		worlds:       map[string]*World{world.name: world},
+		defaultWorld: world,
+	}
+	night := Ticks(*gameDayLength) * 3 / 4
+	world.time = night
+
+	game.requestSleep(1, BlockXyz{0, 64, 0})
+
+	if game.skipNight(world) {
+		t.Errorf("expected the night not to be skipped while a player is awake")
+	}
+	if world.time != night {
+		t.Errorf("expected time to stay at %d, but got %d", night, world.time)
+	}
+	if alice.woken || len(alice.packets) != 0 || len(bob.packets) != 0 {
+		t.Errorf("expected no players to be woken or sent packets")
+	}
+
+	// The night is skipped once the other player leaves, even though the
+	// sleeper is then alone in the world.
+	world.removePlayer(2)
+	if !game.skipNight(world) || !alice.woken {
+		t.Errorf("expected the night to be skipped for a lone sleeper")
+	}
+
+	// An empty world never counts as all asleep.
+	world.removePlayer(1)
+	world.time = night
+	if game.skipNight(world) {
+		t.Errorf("expected the night not to be skipped in an empty world")
+	}
+}
+
+func TestGame_requestSleep(t *testing.T) {
+	alice := &packetRecordingClient{}
+	bob := &packetRecordingClient{}
+	world := newWeatherTestWorld(defaultWorldName, alice, bob)
+	game := &Game{
+		worlds:       map[string]*World{world.name: world},
+		defaultWorld: world,
+	}
+	bedLoc := BlockXyz{0, 64, 0}
+
+	// Players can't sleep during the day.
+	world.time = 0
+	game.requestSleep(1, bedLoc)
+	if alice.inBed || len(alice.messages) != 1 || alice.messages[0] != bedNotNightMessage {
+		t.Errorf("expected to be told to wait for night, got inBed=%t, messages %v", alice.inBed, alice.messages)
+	}
+
+	world.time = Ticks(*gameDayLength) * 3 / 4
+	game.requestSleep(1, bedLoc)
+	if !alice.inBed {
+		t.Errorf("expected to be put to bed at night")
+	}
+
+	// Only one player fits in a bed.
+	game.requestSleep(2, bedLoc)
+	if bob.inBed || len(bob.messages) != 1 || bob.messages[0] != bedOccupiedMessage {
+		t.Errorf("expected to be told the bed is occupied, got inBed=%t, messages %v", bob.inBed, bob.messages)
+	}
+
+	// The bed is free once its sleeper wakes up.
+	game.playerWokeUp(1)
+	game.requestSleep(2, bedLoc)
+	if !bob.inBed {
+		t.Errorf("expected to be put to bed once it was free")
+	}
+}
+
+// fakeClock is a clock that only moves forward when told to, or when slept on.
+type fakeClock struct {
+	now    int64
+	sleeps []int64
+}
+
+func (clock *fakeClock) Nanoseconds() int64 {
+	return clock.now
+}
+
+func (clock *fakeClock) Sleep(ns int64) {
+	clock.sleeps = append(clock.sleeps, ns)
+	clock.now += ns
+}
+
+func TestTickLoop_CatchesUpOverrunTicks(t *testing.T) {
+	const interval = NanosecondsInSecond / 20
+	clock := &fakeClock{now: 1000}
+	var measured tickRate
+	logger := &logging.Recorder{}
+	loop := newTickLoop(clock, 20, &measured, logger)
+
+	// On time, the loop sleeps until each tick is due.
+	if ticks := loop.next(); ticks != 1 {
+		t.Errorf("expected 1 tick when on time, got %d", ticks)
+	}
+	if len(clock.sleeps) != 1 || clock.sleeps[0] != interval {
+		t.Errorf("expected to sleep for %d ns, got %v", interval, clock.sleeps)
+	}
+
+	// A tick that takes two and a half intervals is caught up by running two
+	// ticks straight away.
+	clock.sleeps = nil
+	clock.now += interval * 5 / 2
+	if ticks := loop.next(); ticks != 2 {
+		t.Errorf("expected 2 ticks to catch up, got %d", ticks)
+	}
+	if len(clock.sleeps) != 0 {
+		t.Errorf("expected not to sleep when behind, got %v", clock.sleeps)
+	}
+
+	// Then it is back on schedule, with only the remaining time to wait.
+	if ticks := loop.next(); ticks != 1 {
+		t.Errorf("expected 1 tick after catching up, got %d", ticks)
+	}
+	if len(clock.sleeps) != 1 || clock.sleeps[0] != interval/2 {
+		t.Errorf("expected to sleep for %d ns, got %v", interval/2, clock.sleeps)
+	}
+
+	// Falling too far behind catches up only so far, and drops the rest.
+	clock.sleeps = nil
+	clock.now += 100 * interval
+	if ticks := loop.next(); ticks != maxCatchUpTicks {
+		t.Errorf("expected %d ticks when far behind, got %d", maxCatchUpTicks, ticks)
+	}
+	if levels := logger.Levels(); len(levels) != 1 || levels[0] != logging.LevelWarn {
+		t.Errorf("expected one warning about skipped ticks, got %+v", logger.Entries)
+	}
+	if ticks := loop.next(); ticks != 1 {
+		t.Errorf("expected 1 tick after dropping ticks, got %d", ticks)
+	}
+	if len(clock.sleeps) != 1 || clock.sleeps[0] != interval {
+		t.Errorf("expected to sleep for %d ns, got %v", interval, clock.sleeps)
+	}
+}
+
+func TestTickLoop_MeasuresTps(t *testing.T) {
+	clock := &fakeClock{}
+	var measured tickRate
+	loop := newTickLoop(clock, 20, &measured, &logging.Recorder{})
+
+	for i := 0; i < 20; i++ {
+		loop.next()
+	}
+	if tps := measured.get(); tps != 20 {
+		t.Errorf("expected 20 TPS when on time, got %v", tps)
+	}
+
+	// Each round of ticks takes a whole second, so ticks are dropped.
+	for i := 0; i < 10; i++ {
+		clock.now += NanosecondsInSecond
+		loop.next()
+	}
+	if tps := measured.get(); tps != maxCatchUpTicks {
+		t.Errorf("expected %d TPS when dropping ticks, got %v", maxCatchUpTicks, tps)
+	}
+}
+
+func TestPlayerList_add(t *testing.T) {
+	alice := &packetRecordingClient{}
+	bob := &packetRecordingClient{}
+	carol := &packetRecordingClient{}
+
+	var list playerList
+	list.init()
+	list.add(1, "alice", alice)
+	list.add(2, "bob", bob)
+	list.setPing(2, 50)
+	alice.packets, bob.packets = nil, nil
+
+	list.add(3, "carol", carol)
+
+	// The joining player is told about everybody, including themselves.
+	if len(carol.packets) != 1 {
+		t.Fatalf("expected 1 packet sent to joining player, got %d", len(carol.packets))
+	}
+	expectedItems := map[string]int16{"alice": 0, "bob": 50, "carol": 0}
+	reader := bytes.NewBuffer(carol.packets[0])
+	for reader.Len() > 0 {
+		handler := &userListRecordingHandler{}
+		if err := proto.ClientReadPacket(reader, handler); err != nil {
+			t.Fatalf("failed to read packet sent to joining player: %v", err)
+		}
+		pingMs, ok := expectedItems[handler.username]
+		if !ok || !handler.online || handler.pingMs != pingMs {
+			t.Errorf("unexpected player list item %+v", handler)
+		}
+		expectedItems[handler.username] = 0, false
+	}
+	if len(expectedItems) != 0 {
+		t.Errorf("expected joining player to be told about %v", expectedItems)
+	}
+
+	// Everybody else is told about the joining player.
+	expected := new(bytes.Buffer)
+	proto.WriteUserListItem(expected, "carol", true, 0)
+	for _, client := range []*packetRecordingClient{alice, bob} {
+		if len(client.packets) != 1 || !bytes.Equal(expected.Bytes(), client.packets[0]) {
+			t.Errorf("expected existing player to be sent %x, got %x", expected.Bytes(), client.packets)
+		}
+	}
+
+	// When a player leaves, they are removed from everybody else's list.
+	alice.packets, carol.packets = nil, nil
+	list.remove(2)
+	expected.Reset()
+	proto.WriteUserListItem(expected, "bob", false, 0)
+	for _, client := range []*packetRecordingClient{alice, carol} {
+		if len(client.packets) != 1 || !bytes.Equal(expected.Bytes(), client.packets[0]) {
+			t.Errorf("expected remaining player to be sent %x, got %x", expected.Bytes(), client.packets)
+		}
+	}
+}
+
+// userListRecordingHandler records the player list item packet read by it.
+type userListRecordingHandler struct {
+	proto.IClientPacketHandler
+	username string
+	online   bool
+	pingMs   int16
+}
+
+func (h *userListRecordingHandler) PacketUserListItem(username string, online bool, pingMs int16) {
+	h.username = username
+	h.online = online
+	h.pingMs = pingMs
+}
+
+func TestGame_Explode_ShardNotLoaded(t *testing.T) {
+	game := &Game{
+		defaultWorld: &World{
+			shardManager: shardserver.NewLocalShardManager(nil, nil, nil),
+		},
+	}
+
+	if game.Explode(AbsXyz{0, 64, 0}, 4) {
+		t.Errorf("Expected no explosion in a shard that is not loaded")
+	}
+}
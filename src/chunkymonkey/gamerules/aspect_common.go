@@ -29,6 +29,7 @@ type blockDropItem struct {
 	DroppedItem ItemTypeId
 	Probability byte // Probabilities specified as a percentage
 	Count       ItemCount
+	MaxCount    ItemCount // If set, between Count and MaxCount items drop.
 	CopyData    bool
 }
 
@@ -40,7 +41,12 @@ func (bdi *blockDropItem) drop(chunk IChunkBlock, blockLoc BlockXyz, blockData b
 		itemData = ItemData(blockData)
 	}
 
-	spawnItemInBlock(chunk, blockLoc, bdi.DroppedItem, bdi.Count, itemData)
+	count := bdi.Count
+	if bdi.MaxCount > bdi.Count {
+		count += ItemCount(chunk.Rand().Intn(int(bdi.MaxCount-bdi.Count) + 1))
+	}
+
+	spawnItemInBlock(chunk, blockLoc, bdi.DroppedItem, count, itemData)
 }
 
 func (bdi *blockDropItem) check() os.Error {
@@ -52,5 +58,9 @@ func (bdi *blockDropItem) check() os.Error {
 		return fmt.Errorf("dropped item has Count %d", bdi.Count)
 	}
 
+	if bdi.MaxCount != 0 && bdi.MaxCount < bdi.Count {
+		return fmt.Errorf("dropped item has MaxCount %d less than Count %d", bdi.MaxCount, bdi.Count)
+	}
+
 	return nil
 }
@@ -22,11 +22,23 @@ type IChunkBlock interface {
 	AddOnUnsubscribe(entityId EntityId, observer IUnsubscribed)
 	RemoveOnUnsubscribe(entityId EntityId, observer IUnsubscribed)
 
+	// BlockAt returns the type and data of a block in the chunk or in a loaded
+	// neighbouring chunk. ok is false if the block could not be read.
+	BlockAt(blockLoc *BlockXyz) (blockId BlockId, blockData byte, ok bool)
+
+	// SetBlockAt sets a block in the chunk or in a loaded neighbouring chunk.
+	// Returns false if the block could not be set.
+	SetBlockAt(blockLoc *BlockXyz, blockId BlockId, blockData byte) bool
+
 	// AddActiveBlock flags a block in any chunk as active.
 	AddActiveBlock(blockXyz *BlockXyz)
 
 	// AddActiveBlockIndex flags a block in the chunk itself as active by index.
 	AddActiveBlockIndex(blockIndex BlockIndex)
+
+	// ScheduleBlockTick flags a block in the chunk itself as active after the
+	// given number of ticks have passed.
+	ScheduleBlockTick(blockIndex BlockIndex, delay Ticks)
 }
 
 // IUnsubscribed is the interface by which blocks (and potentially other
@@ -76,9 +88,11 @@ type IBlockAspect interface {
 	// inventory for the block (assuming it still has one).
 	InventoryUnsubscribed(instance *BlockInstance, player IPlayerClient)
 
-	// Destroy is called when the block is destroyed by a player hitting it.
-	// TODO And in other situations, maybe?
-	Destroy(instance *BlockInstance)
+	// Destroy is called when the block is destroyed by a player hitting it,
+	// with held being the item that they were holding. It is also called with
+	// held as nil when the block is destroyed in other ways, such as by an
+	// explosion.
+	Destroy(instance *BlockInstance, held *Slot)
 
 	// Tick tells the aspect to run the block for a tick. It should return false
 	// if the block should not tick again.
@@ -0,0 +1,50 @@
+package gamerules
+
+import (
+	. "chunkymonkey/types"
+)
+
+const (
+	// Bed block data holds the direction that the bed faces in the lower two
+	// bits, and whether the block is the head of the bed.
+	bedDirectionMask = 0x3
+	bedHeadFlag      = 0x8
+)
+
+// Behaviour of a bed block, which players sleep in when they right-click it.
+func makeBedAspect() (aspect IBlockAspect) {
+	return &BedAspect{}
+}
+
+type BedAspect struct {
+	StandardAspect
+}
+
+func (aspect *BedAspect) Name() string {
+	return "Bed"
+}
+
+func (aspect *BedAspect) Interact(instance *BlockInstance, player IPlayerClient) {
+	if headLoc := bedHeadLoc(&instance.BlockLoc, instance.Data); headLoc != nil {
+		player.UseBed(*headLoc)
+	}
+}
+
+// bedHeadLoc returns the location of the head of a bed, given either of its
+// blocks. A bed is known by its head, so that players using either half of
+// it use the same bed.
+func bedHeadLoc(blockLoc *BlockXyz, data byte) *BlockXyz {
+	if data&bedHeadFlag != 0 {
+		return blockLoc
+	}
+
+	switch data & bedDirectionMask {
+	case 0:
+		return blockLoc.AddXyz(0, 0, 1)
+	case 1:
+		return blockLoc.AddXyz(-1, 0, 0)
+	case 2:
+		return blockLoc.AddXyz(0, 0, -1)
+	}
+	return blockLoc.AddXyz(1, 0, 0)
+}
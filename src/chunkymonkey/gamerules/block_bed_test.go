@@ -0,0 +1,31 @@
+package gamerules
+
+import (
+	"testing"
+
+	. "chunkymonkey/types"
+)
+
+func Test_bedHeadLoc(t *testing.T) {
+	type Test struct {
+		data     byte
+		expected BlockXyz
+	}
+
+	footLoc := BlockXyz{10, 64, 10}
+	tests := []Test{
+		{0, BlockXyz{10, 64, 11}},
+		{1, BlockXyz{9, 64, 10}},
+		{2, BlockXyz{10, 64, 9}},
+		{3, BlockXyz{11, 64, 10}},
+		// The head of the bed is already the head.
+		{bedHeadFlag | 2, footLoc},
+	}
+
+	for _, test := range tests {
+		result := bedHeadLoc(&footLoc, test.data)
+		if result == nil || *result != test.expected {
+			t.Errorf("data %#x: expected head at %v but got %v", test.data, test.expected, result)
+		}
+	}
+}
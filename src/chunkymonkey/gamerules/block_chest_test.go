@@ -0,0 +1,88 @@
+package gamerules
+
+import (
+	"testing"
+
+	"chunkymonkey/proto"
+	. "chunkymonkey/types"
+)
+
+// recordingInvPlayer records the inventory updates sent to a player.
+type recordingInvPlayer struct {
+	IPlayerClient
+	entityId    EntityId
+	subscribed  int
+	slotUpdates map[SlotId]Slot
+	cursor      Slot
+}
+
+func newRecordingInvPlayer(entityId EntityId) *recordingInvPlayer {
+	return &recordingInvPlayer{
+		entityId:    entityId,
+		slotUpdates: make(map[SlotId]Slot),
+	}
+}
+
+func (player *recordingInvPlayer) GetEntityId() EntityId {
+	return player.entityId
+}
+
+func (player *recordingInvPlayer) InventorySubscribed(block BlockXyz, invTypeId InvTypeId, slots []proto.WindowSlot) {
+	player.subscribed++
+}
+
+func (player *recordingInvPlayer) InventorySlotUpdate(block BlockXyz, slot Slot, slotId SlotId) {
+	player.slotUpdates[slotId] = slot
+}
+
+func (player *recordingInvPlayer) InventoryCursorUpdate(block BlockXyz, cursor Slot) {
+	player.cursor = cursor
+}
+
+func (player *recordingInvPlayer) InventoryTxState(block BlockXyz, txId TxId, accepted bool) {
+}
+
+func TestChestAspect_SharedBetweenPlayers(t *testing.T) {
+	aspect := makeChestAspect()
+	instance := &BlockInstance{
+		Chunk:    newFakeChunkBlock(),
+		BlockLoc: BlockXyz{1, 64, 1},
+		Index:    BlockIndex(5),
+	}
+
+	alice := newRecordingInvPlayer(1)
+	bob := newRecordingInvPlayer(2)
+
+	aspect.Interact(instance, alice)
+	aspect.Interact(instance, bob)
+	if alice.subscribed != 1 || bob.subscribed != 1 {
+		t.Fatalf("expected both players to open the chest, got %d and %d", alice.subscribed, bob.subscribed)
+	}
+
+	// Clicks from both players are applied to the same chest in turn, as the
+	// chunk serializes them.
+	planks := Slot{plankId, 10, 0}
+	aspect.InventoryClick(instance, alice, &Click{SlotId: 3, Cursor: planks, TxId: 1})
+	if update := bob.slotUpdates[3]; !update.Equals(&planks) {
+		t.Errorf("expected bob to see %v put in the chest, got %v", planks, update)
+	}
+
+	aspect.InventoryClick(instance, bob, &Click{SlotId: 3, ExpectedSlot: planks, TxId: 1})
+	if !bob.cursor.Equals(&planks) {
+		t.Errorf("expected bob to take %v from the chest, got %v", planks, bob.cursor)
+	}
+	if update := alice.slotUpdates[3]; !update.IsEmpty() {
+		t.Errorf("expected alice to see the slot emptied, got %v", update)
+	}
+
+	// Once bob closes the chest, changes are no longer sent to bob.
+	aspect.InventoryUnsubscribed(instance, bob)
+	bob.slotUpdates = make(map[SlotId]Slot)
+	aspect.InventoryClick(instance, alice, &Click{SlotId: 4, Cursor: planks, TxId: 2})
+	if len(bob.slotUpdates) != 0 {
+		t.Errorf("expected no updates after closing the chest, got %v", bob.slotUpdates)
+	}
+	if update := alice.slotUpdates[4]; !update.Equals(&planks) {
+		t.Errorf("expected alice to see %v put in the chest, got %v", planks, update)
+	}
+}
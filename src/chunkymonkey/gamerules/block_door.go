@@ -0,0 +1,120 @@
+package gamerules
+
+import (
+	. "chunkymonkey/types"
+)
+
+const (
+	// Set in the data of doors, trapdoors and fence gates that are open.
+	doorOpen = 0x4
+	// Set in the data of the top half of a door.
+	doorTopHalf = 0x8
+
+	// The number of ticks between the redstone next to a door changing and the
+	// door opening or closing.
+	doorRedstoneTickDelay = Ticks(1)
+)
+
+// Behaviour of blocks that open and close, such as doors, trapdoors and fence
+// gates. Bit 0x4 of the block data is set while the block is open.
+func makeDoorAspect() (aspect IBlockAspect) {
+	return &DoorAspect{}
+}
+
+type DoorAspect struct {
+	StandardAspect
+	// HandOperated is set for blocks that players can open and close
+	// themselves. Others, such as iron doors, are only moved by redstone.
+	HandOperated bool
+	// TwoHigh is set for doors made of a bottom and a top half, which are
+	// opened, closed and broken together. Bit 0x8 of the data is set in the
+	// top half.
+	TwoHigh bool
+}
+
+func (aspect *DoorAspect) Name() string {
+	return "Door"
+}
+
+func (aspect *DoorAspect) RedstoneTickDelay() Ticks {
+	return doorRedstoneTickDelay
+}
+
+func (aspect *DoorAspect) Interact(instance *BlockInstance, player IPlayerClient) {
+	if !aspect.HandOperated {
+		return
+	}
+	aspect.setOpen(instance, instance.Data&doorOpen == 0)
+}
+
+// Tick opens the door when redstone next to either half of it is powered, and
+// closes it again when the power goes.
+func (aspect *DoorAspect) Tick(instance *BlockInstance) bool {
+	power, connected := RedstonePowerInto(instance.Chunk, &instance.BlockLoc)
+	if otherLoc := aspect.otherHalf(instance); otherLoc != nil {
+		otherPower, otherConnected := RedstonePowerInto(instance.Chunk, otherLoc)
+		if otherPower > power {
+			power = otherPower
+		}
+		connected = connected || otherConnected
+	}
+
+	if !connected {
+		// Leave doors that are away from any redstone as players left them.
+		return false
+	}
+
+	if open := power > 0; open != (instance.Data&doorOpen != 0) {
+		aspect.setOpen(instance, open)
+	}
+	return false
+}
+
+func (aspect *DoorAspect) Destroy(instance *BlockInstance, held *Slot) {
+	aspect.StandardAspect.Destroy(instance, held)
+
+	// Only the broken half drops anything.
+	if otherLoc := aspect.otherHalf(instance); otherLoc != nil {
+		instance.Chunk.SetBlockAt(otherLoc, BlockIdAir, 0)
+	}
+}
+
+// setOpen opens or closes the door, along with its other half.
+func (aspect *DoorAspect) setOpen(instance *BlockInstance, open bool) {
+	toggle := func(data byte) byte {
+		if open {
+			return data | doorOpen
+		}
+		return data &^ doorOpen
+	}
+
+	instance.Chunk.SetBlockAt(&instance.BlockLoc, instance.BlockType.id, toggle(instance.Data))
+
+	if otherLoc := aspect.otherHalf(instance); otherLoc != nil {
+		if _, otherData, ok := instance.Chunk.BlockAt(otherLoc); ok {
+			instance.Chunk.SetBlockAt(otherLoc, instance.BlockType.id, toggle(otherData))
+		}
+	}
+}
+
+// otherHalf returns the location of the other half of a two high door, or nil
+// if there is no other half.
+func (aspect *DoorAspect) otherHalf(instance *BlockInstance) *BlockXyz {
+	if !aspect.TwoHigh {
+		return nil
+	}
+
+	dy := BlockYCoord(1)
+	if instance.Data&doorTopHalf != 0 {
+		dy = -1
+	}
+	otherLoc := instance.BlockLoc.AddXyz(0, dy, 0)
+	if otherLoc == nil {
+		return nil
+	}
+
+	if blockId, _, ok := instance.Chunk.BlockAt(otherLoc); !ok || blockId != instance.BlockType.id {
+		return nil
+	}
+	return otherLoc
+}
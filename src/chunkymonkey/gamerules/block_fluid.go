@@ -0,0 +1,216 @@
+package gamerules
+
+import (
+	"fmt"
+	"os"
+
+	. "chunkymonkey/types"
+)
+
+const (
+	// The lower bits of a fluid block's data are its level, which increases
+	// with distance from the source block (level 0).
+	fluidLevelMask = 0x7
+	// Set in the data of fluid blocks that are falling.
+	fluidFalling = 0x8
+)
+
+// Behaviour of a fluid block (water or lava), which flows into neighbouring
+// air blocks.
+func makeFluidAspect() (aspect IBlockAspect) {
+	return &FluidAspect{}
+}
+
+// FluidAspect flows downwards and outwards into air blocks, with the level
+// increasing by one per block travelled horizontally until MaxLevel is
+// reached. Flowing blocks that are no longer fed by a neighbour dry up.
+type FluidAspect struct {
+	VoidAspect
+
+	// The block types of the moving and still forms of the fluid.
+	Flowing    BlockId
+	Stationary BlockId
+
+	// MaxLevel is the furthest that the fluid flows horizontally.
+	MaxLevel byte
+	// TickDelay is the number of ticks between the fluid flowing into a block
+	// and flowing onwards from it.
+	TickDelay Ticks
+
+	// The fluid hardens when it touches a HardenedBy block, or either form of
+	// it if it is also a fluid. Source blocks become SourceHardensTo, and other
+	// blocks become FlowHardensTo. The fluid flowing down onto a HardenedBy
+	// block turns that block into FlowIntoHardensTo. A HardenedBy of 0 (air)
+	// means that the fluid does not harden.
+	HardenedBy        BlockId
+	SourceHardensTo   BlockId
+	FlowHardensTo     BlockId
+	FlowIntoHardensTo BlockId
+}
+
+func (aspect *FluidAspect) Name() string {
+	return "Fluid"
+}
+
+func (aspect *FluidAspect) Check() os.Error {
+	if aspect.MaxLevel > fluidLevelMask {
+		return fmt.Errorf("fluid MaxLevel %d is greater than %d", aspect.MaxLevel, fluidLevelMask)
+	}
+	if aspect.TickDelay < 1 {
+		return os.NewError("fluid TickDelay must be at least 1")
+	}
+	return nil
+}
+
+func (aspect *FluidAspect) Tick(instance *BlockInstance) bool {
+	if aspect.harden(instance) {
+		return false
+	}
+
+	if !aspect.isSource(instance.Data) {
+		data, fed := aspect.flowData(instance)
+		if !fed {
+			instance.Chunk.SetBlockAt(&instance.BlockLoc, BlockIdAir, 0)
+			return false
+		}
+		if data != instance.Data {
+			// Setting the block causes it to tick again, when it will spread.
+			instance.Chunk.SetBlockAt(&instance.BlockLoc, aspect.Flowing, data)
+			return false
+		}
+	}
+
+	aspect.spread(instance)
+
+	return false
+}
+
+// isFluid returns true if the block type is either form of this fluid.
+func (aspect *FluidAspect) isFluid(blockId BlockId) bool {
+	return blockId == aspect.Flowing || blockId == aspect.Stationary
+}
+
+func (aspect *FluidAspect) isSource(data byte) bool {
+	return data == 0
+}
+
+func (aspect *FluidAspect) isHardenedBy(blockId BlockId) bool {
+	if aspect.HardenedBy == BlockIdAir {
+		return false
+	}
+	if blockId == aspect.HardenedBy {
+		return true
+	}
+	if blockType, ok := Blocks.Get(aspect.HardenedBy); ok {
+		if other, ok := blockType.Aspect.(*FluidAspect); ok {
+			return other.isFluid(blockId)
+		}
+	}
+	return false
+}
+
+// spreadLevel returns the level of the fluid that flows horizontally out of a
+// block with the given data.
+func (aspect *FluidAspect) spreadLevel(data byte) byte {
+	if data&fluidFalling != 0 {
+		return 0
+	}
+	return data & fluidLevelMask
+}
+
+// harden turns the fluid block into a solid block if it touches a block that
+// hardens it. Returns true if the block was hardened.
+func (aspect *FluidAspect) harden(instance *BlockInstance) bool {
+	if aspect.HardenedBy == BlockIdAir {
+		return false
+	}
+
+	for face := Face(FaceMinValid); face <= FaceMaxValid; face++ {
+		if face == FaceBottom {
+			// The fluid flows down onto blocks below it instead.
+			continue
+		}
+		neighbourLoc := instance.BlockLoc.AddXyz(face.Dxyz())
+		if neighbourLoc == nil {
+			continue
+		}
+		if blockId, _, ok := instance.Chunk.BlockAt(neighbourLoc); ok && aspect.isHardenedBy(blockId) {
+			hardensTo := aspect.FlowHardensTo
+			if aspect.isSource(instance.Data) {
+				hardensTo = aspect.SourceHardensTo
+			}
+			instance.Chunk.SetBlockAt(&instance.BlockLoc, hardensTo, 0)
+			return true
+		}
+	}
+
+	return false
+}
+
+// flowData returns the data that a non-source fluid block should have, given
+// the fluid around it. fed is false if no fluid flows into the block.
+func (aspect *FluidAspect) flowData(instance *BlockInstance) (data byte, fed bool) {
+	if aboveLoc := instance.BlockLoc.AddXyz(0, 1, 0); aboveLoc != nil {
+		if blockId, _, ok := instance.Chunk.BlockAt(aboveLoc); ok && aspect.isFluid(blockId) {
+			return fluidFalling, true
+		}
+	}
+
+	level := byte(fluidLevelMask + 1)
+	for face := Face(FaceEast); face <= FaceSouth; face++ {
+		neighbourLoc := instance.BlockLoc.AddXyz(face.Dxyz())
+		if neighbourLoc == nil {
+			continue
+		}
+		blockId, blockData, ok := instance.Chunk.BlockAt(neighbourLoc)
+		if !ok || !aspect.isFluid(blockId) {
+			continue
+		}
+		if neighbourLevel := aspect.spreadLevel(blockData) + 1; neighbourLevel < level {
+			level = neighbourLevel
+		}
+	}
+
+	if level > aspect.MaxLevel {
+		return 0, false
+	}
+
+	return level, true
+}
+
+// spread makes the fluid flow down into the block below if it can, and
+// otherwise outwards into the air blocks beside it.
+func (aspect *FluidAspect) spread(instance *BlockInstance) {
+	chunk := instance.Chunk
+
+	if belowLoc := instance.BlockLoc.AddXyz(0, -1, 0); belowLoc != nil {
+		if blockId, _, ok := chunk.BlockAt(belowLoc); ok {
+			switch {
+			case blockId == BlockIdAir:
+				chunk.SetBlockAt(belowLoc, aspect.Flowing, fluidFalling)
+				return
+			case aspect.isHardenedBy(blockId):
+				chunk.SetBlockAt(belowLoc, aspect.FlowIntoHardensTo, 0)
+				return
+			case aspect.isFluid(blockId):
+				// Already flowing downwards.
+				return
+			}
+		}
+	}
+
+	level := aspect.spreadLevel(instance.Data) + 1
+	if level > aspect.MaxLevel {
+		return
+	}
+
+	for face := Face(FaceEast); face <= FaceSouth; face++ {
+		neighbourLoc := instance.BlockLoc.AddXyz(face.Dxyz())
+		if neighbourLoc == nil {
+			continue
+		}
+		if blockId, _, ok := chunk.BlockAt(neighbourLoc); ok && blockId == BlockIdAir {
+			chunk.SetBlockAt(neighbourLoc, aspect.Flowing, level)
+		}
+	}
+}
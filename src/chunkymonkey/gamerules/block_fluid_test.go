@@ -0,0 +1,210 @@
+package gamerules
+
+import (
+	"strings"
+	"testing"
+
+	. "chunkymonkey/types"
+)
+
+const fluidTestBlocks = `{
+  "0": {"Name": "air", "Aspect": "Void", "AspectArgs": {}},
+  "1": {"Name": "stone", "Solid": true, "Aspect": "Void", "AspectArgs": {}},
+  "4": {"Name": "cobblestone", "Solid": true, "Aspect": "Void", "AspectArgs": {}},
+  "8": {"Name": "water", "Aspect": "Fluid", "AspectArgs": {
+    "Flowing": 8, "Stationary": 9, "MaxLevel": 7, "TickDelay": 5
+  }},
+  "9": {"Name": "stationary water", "Aspect": "Fluid", "AspectArgs": {
+    "Flowing": 8, "Stationary": 9, "MaxLevel": 7, "TickDelay": 5
+  }},
+  "10": {"Name": "lava", "Aspect": "Fluid", "AspectArgs": {
+    "Flowing": 10, "Stationary": 11, "MaxLevel": 3, "TickDelay": 30,
+    "HardenedBy": 8, "SourceHardensTo": 49, "FlowHardensTo": 4, "FlowIntoHardensTo": 1
+  }},
+  "11": {"Name": "stationary lava", "Aspect": "Fluid", "AspectArgs": {
+    "Flowing": 10, "Stationary": 11, "MaxLevel": 3, "TickDelay": 30,
+    "HardenedBy": 8, "SourceHardensTo": 49, "FlowHardensTo": 4, "FlowIntoHardensTo": 1
+  }},
+  "49": {"Name": "obsidian", "Solid": true, "Aspect": "Void", "AspectArgs": {}}
+}`
+
+type fluidTestBlock struct {
+	blockId   BlockId
+	blockData byte
+}
+
+// fluidTestChunk holds the blocks within a small box. Blocks outside of the
+// box cannot be read or set. Changing a block queues it and its neighbours to
+// be ticked, as a real chunk does for fluids.
+type fluidTestChunk struct {
+	*fakeChunkBlock
+	min, max BlockXyz
+	blocks   map[BlockXyz]fluidTestBlock
+	pending  []BlockXyz
+}
+
+func newFluidTestChunk(min, max BlockXyz) *fluidTestChunk {
+	return &fluidTestChunk{
+		fakeChunkBlock: newFakeChunkBlock(),
+		min:            min,
+		max:            max,
+		blocks:         make(map[BlockXyz]fluidTestBlock),
+	}
+}
+
+func (chunk *fluidTestChunk) contains(loc *BlockXyz) bool {
+	return loc.X >= chunk.min.X && loc.X <= chunk.max.X &&
+		loc.Y >= chunk.min.Y && loc.Y <= chunk.max.Y &&
+		loc.Z >= chunk.min.Z && loc.Z <= chunk.max.Z
+}
+
+func (chunk *fluidTestChunk) BlockAt(blockLoc *BlockXyz) (blockId BlockId, blockData byte, ok bool) {
+	if !chunk.contains(blockLoc) {
+		return
+	}
+	block := chunk.blocks[*blockLoc]
+	return block.blockId, block.blockData, true
+}
+
+func (chunk *fluidTestChunk) SetBlockAt(blockLoc *BlockXyz, blockId BlockId, blockData byte) bool {
+	if !chunk.contains(blockLoc) {
+		return false
+	}
+	chunk.blocks[*blockLoc] = fluidTestBlock{blockId, blockData}
+
+	chunk.pending = append(chunk.pending, *blockLoc)
+	for face := Face(FaceMinValid); face <= FaceMaxValid; face++ {
+		chunk.pending = append(chunk.pending, *blockLoc.AddXyz(face.Dxyz()))
+	}
+	return true
+}
+
+// run ticks fluid blocks until they stop changing.
+func (chunk *fluidTestChunk) run(t *testing.T) {
+	for ticks := 0; len(chunk.pending) > 0; ticks++ {
+		if ticks > 10000 {
+			t.Fatalf("fluid did not stop flowing")
+		}
+
+		loc := chunk.pending[0]
+		chunk.pending = chunk.pending[1:]
+
+		blockId, blockData, ok := chunk.BlockAt(&loc)
+		if !ok {
+			continue
+		}
+		blockType, ok := Blocks.Get(blockId)
+		if !ok {
+			continue
+		}
+		if _, isFluid := blockType.Aspect.(*FluidAspect); !isFluid {
+			continue
+		}
+
+		blockType.Aspect.Tick(&BlockInstance{
+			Chunk:     chunk,
+			BlockLoc:  loc,
+			BlockType: blockType,
+			Data:      blockData,
+		})
+	}
+}
+
+func (chunk *fluidTestChunk) fill(min, max BlockXyz, blockId BlockId) {
+	for x := min.X; x <= max.X; x++ {
+		for y := min.Y; y <= max.Y; y++ {
+			for z := min.Z; z <= max.Z; z++ {
+				chunk.blocks[BlockXyz{x, y, z}] = fluidTestBlock{blockId, 0}
+			}
+		}
+	}
+}
+
+func loadFluidTestBlocks(t *testing.T) {
+	blocks, err := LoadBlockDefs(strings.NewReader(fluidTestBlocks))
+	if err != nil {
+		t.Fatalf("failed to load block types: %v", err)
+	}
+	Blocks = blocks
+}
+
+func TestFluidAspect_WaterFlowsDownStep(t *testing.T) {
+	defer func(blocks BlockTypeList) { Blocks = blocks }(Blocks)
+	loadFluidTestBlocks(t)
+
+	// A channel one block wide, with a step down of two blocks between x=1
+	// and x=2.
+	chunk := newFluidTestChunk(BlockXyz{0, 60, 0}, BlockXyz{7, 70, 0})
+	chunk.fill(BlockXyz{0, 60, 0}, BlockXyz{1, 64, 0}, 1)
+	chunk.fill(BlockXyz{2, 60, 0}, BlockXyz{7, 62, 0}, 1)
+
+	chunk.SetBlockAt(&BlockXyz{0, 65, 0}, 9, 0)
+	chunk.run(t)
+
+	type Test struct {
+		desc      string
+		loc       BlockXyz
+		blockId   BlockId
+		blockData byte
+	}
+
+	tests := []Test{
+		{"source", BlockXyz{0, 65, 0}, 9, 0},
+		{"on the top step", BlockXyz{1, 65, 0}, 8, 1},
+		{"over the edge", BlockXyz{2, 65, 0}, 8, 2},
+		{"falling", BlockXyz{2, 64, 0}, 8, fluidFalling},
+		{"landed", BlockXyz{2, 63, 0}, 8, fluidFalling},
+		{"flowing from the landing", BlockXyz{3, 63, 0}, 8, 1},
+		{"spread along the bottom", BlockXyz{7, 63, 0}, 8, 5},
+		{"not beside the fall", BlockXyz{3, 64, 0}, 0, 0},
+		{"not beyond the edge", BlockXyz{3, 65, 0}, 0, 0},
+	}
+
+	for _, test := range tests {
+		blockId, blockData, _ := chunk.BlockAt(&test.loc)
+		if blockId != test.blockId || blockData != test.blockData {
+			t.Errorf(
+				"%s: expected block %d with data %d at %v but got %d with data %d",
+				test.desc, test.blockId, test.blockData, test.loc, blockId, blockData)
+		}
+	}
+}
+
+func TestFluidAspect_LavaMeetsWater(t *testing.T) {
+	defer func(blocks BlockTypeList) { Blocks = blocks }(Blocks)
+	loadFluidTestBlocks(t)
+
+	type Test struct {
+		desc     string
+		lava     BlockXyz
+		water    BlockXyz
+		loc      BlockXyz
+		expected BlockId
+	}
+
+	tests := []Test{
+		{
+			"lava flowing down onto water",
+			BlockXyz{0, 65, 0}, BlockXyz{0, 64, 0},
+			BlockXyz{0, 64, 0}, 1,
+		},
+		{
+			"water flowing beside a lava source",
+			BlockXyz{0, 64, 0}, BlockXyz{2, 64, 0},
+			BlockXyz{0, 64, 0}, 49,
+		},
+	}
+
+	for _, test := range tests {
+		chunk := newFluidTestChunk(BlockXyz{0, 63, 0}, BlockXyz{2, 66, 0})
+		chunk.fill(BlockXyz{0, 63, 0}, BlockXyz{2, 63, 0}, 1)
+		chunk.blocks[test.lava] = fluidTestBlock{11, 0}
+		chunk.SetBlockAt(&test.water, 9, 0)
+		chunk.pending = append(chunk.pending, test.lava)
+		chunk.run(t)
+
+		if blockId, _, _ := chunk.BlockAt(&test.loc); blockId != test.expected {
+			t.Errorf("%s: expected block %d at %v but got %d", test.desc, test.expected, test.loc, blockId)
+		}
+	}
+}
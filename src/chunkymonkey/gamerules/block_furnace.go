@@ -44,6 +44,16 @@ func (aspect *FurnaceAspect) InventoryClick(instance *BlockInstance, player IPla
 		return
 	}
 
+	// The player who takes the smelted items earns the experience for them.
+	if click.SlotId == furnaceSlotOutput {
+		output := furnaceInv.Slot(furnaceSlotOutput)
+		if output.IsEmpty() {
+			if experience := furnaceInv.TakeExperience(); experience > 0 {
+				player.GiveExperience(experience)
+			}
+		}
+	}
+
 	aspect.updateBlock(instance, blockInv, furnaceInv.IsLit())
 }
 
@@ -24,7 +24,7 @@ func (aspect *InventoryAspect) InventoryClick(instance *BlockInstance, player IP
 		blkInv.Click(player, click)
 	} else {
 		// No inventory to act on (shouldn't happen, normally).
-		player.InventoryTxState(blkInv.blockLoc, click.TxId, false)
+		player.InventoryTxState(instance.BlockLoc, click.TxId, false)
 		player.InventoryCursorUpdate(instance.BlockLoc, click.Cursor)
 		return
 	}
@@ -37,14 +37,14 @@ func (aspect *InventoryAspect) InventoryUnsubscribed(instance *BlockInstance, pl
 	}
 }
 
-func (aspect *InventoryAspect) Destroy(instance *BlockInstance) {
+func (aspect *InventoryAspect) Destroy(instance *BlockInstance, held *Slot) {
 	blkInv := aspect.blockInv(instance, false)
 	if blkInv != nil {
 		blkInv.EjectItems()
 		blkInv.Destroyed()
 	}
 
-	aspect.StandardAspect.Destroy(instance)
+	aspect.StandardAspect.Destroy(instance, held)
 }
 
 func (aspect *InventoryAspect) blockInv(instance *BlockInstance, create bool) *blockInventory {
@@ -193,17 +193,26 @@ func LoadBlocksFromFile(filename string) (blockTypes BlockTypeList, err os.Error
 
 func init() {
 	aspectMakers = map[string]aspectMakerFn{
-		"Chest":        makeChestAspect,
-		"Dispenser":    makeDispenserAspect,
-		"Furnace":      makeFurnaceAspect,
-		"MobSpawner":   makeMobSpawnerAspect,
-		"Music":        makeMusicAspect,
-		"RecordPlayer": makeRecordPlayerAspect,
-		"Sapling":      makeSaplingAspect,
-		"Sign":         makeSignAspect,
-		"Standard":     makeStandardAspect,
-		"Todo":         makeTodoAspect,
-		"Void":         makeVoidAspect,
-		"Workbench":    makeWorkbenchAspect,
+		"Bed":           makeBedAspect,
+		"Button":        makeButtonAspect,
+		"Chest":         makeChestAspect,
+		"Dispenser":     makeDispenserAspect,
+		"Door":          makeDoorAspect,
+		"Fluid":         makeFluidAspect,
+		"Furnace":       makeFurnaceAspect,
+		"Lever":         makeLeverAspect,
+		"MobSpawner":    makeMobSpawnerAspect,
+		"Music":         makeMusicAspect,
+		"Oriented":      makeOrientedAspect,
+		"Rail":          makeRailAspect,
+		"RecordPlayer":  makeRecordPlayerAspect,
+		"RedstoneTorch": makeRedstoneTorchAspect,
+		"RedstoneWire":  makeRedstoneWireAspect,
+		"Sapling":       makeSaplingAspect,
+		"Sign":          makeSignAspect,
+		"Standard":      makeStandardAspect,
+		"Todo":          makeTodoAspect,
+		"Void":          makeVoidAspect,
+		"Workbench":     makeWorkbenchAspect,
 	}
 }
@@ -0,0 +1,44 @@
+package gamerules
+
+import (
+	"math"
+
+	. "chunkymonkey/types"
+)
+
+// IPlacementAspect is implemented by block aspects that set the data of
+// blocks placed by players, for instance to turn them to face a particular
+// way.
+type IPlacementAspect interface {
+	// PlacementData returns the data for a block placed by a player looking
+	// in the given direction.
+	PlacementData(look *LookDegrees) byte
+}
+
+// Behaviour of a block that is turned to face a direction when it is placed,
+// such as stairs or pumpkins.
+func makeOrientedAspect() (aspect IBlockAspect) {
+	return &OrientedAspect{}
+}
+
+type OrientedAspect struct {
+	StandardAspect
+	// Orientations is the block data to place the block with when the placing
+	// player faces south (+Z), west (-X), north (-Z) and east (+X)
+	// respectively.
+	Orientations [4]byte
+}
+
+func (aspect *OrientedAspect) Name() string {
+	return "Oriented"
+}
+
+func (aspect *OrientedAspect) PlacementData(look *LookDegrees) byte {
+	return aspect.Orientations[horizontalFacing(look.Yaw)]
+}
+
+// horizontalFacing returns the compass direction nearest to yaw, as 0 to 3 for
+// south, west, north and east respectively. A yaw of zero faces south.
+func horizontalFacing(yaw AngleDegrees) int {
+	return int(math.Floor(float64(yaw)/90+0.5)) & 3
+}
@@ -0,0 +1,106 @@
+package gamerules
+
+import (
+	. "chunkymonkey/types"
+)
+
+// Behaviour of a rail block, which minecarts run along. The block data gives
+// the shape of the rail.
+func makeRailAspect() (aspect IBlockAspect) {
+	return &RailAspect{}
+}
+
+type RailAspect struct {
+	StandardAspect
+	// Curved is true for rails that can be laid around corners. Other rails
+	// are always straight, and use the top bit of their data to store whether
+	// they are powered.
+	Curved bool
+}
+
+func (aspect *RailAspect) Name() string {
+	return "Rail"
+}
+
+// railDir is a horizontal direction along a rail.
+type railDir struct {
+	dx, dz BlockCoord
+}
+
+var (
+	railNorth = railDir{0, -1}
+	railSouth = railDir{0, 1}
+	railEast  = railDir{1, 0}
+	railWest  = railDir{-1, 0}
+)
+
+func (dir railDir) reverse() railDir {
+	return railDir{-dir.dx, -dir.dz}
+}
+
+// railShape is the shape of a piece of rail, given by the two directions it
+// connects to. Sloped rails rise towards their first direction.
+type railShape struct {
+	exits  [2]railDir
+	sloped bool
+}
+
+// exitFrom returns the direction in which a minecart leaves the rail when it
+// enters it from the entry direction.
+func (shape *railShape) exitFrom(entry railDir) (exit railDir, ok bool) {
+	switch entry {
+	case shape.exits[0]:
+		return shape.exits[1], true
+	case shape.exits[1]:
+		return shape.exits[0], true
+	}
+	return
+}
+
+// The shapes of rails, indexed by block data.
+var railShapes = [...]railShape{
+	{[2]railDir{railNorth, railSouth}, false},
+	{[2]railDir{railEast, railWest}, false},
+	{[2]railDir{railEast, railWest}, true},
+	{[2]railDir{railWest, railEast}, true},
+	{[2]railDir{railNorth, railSouth}, true},
+	{[2]railDir{railSouth, railNorth}, true},
+	// The remaining shapes are curves, which only Curved rails may have.
+	{[2]railDir{railSouth, railEast}, false},
+	{[2]railDir{railSouth, railWest}, false},
+	{[2]railDir{railNorth, railWest}, false},
+	{[2]railDir{railNorth, railEast}, false},
+}
+
+const numStraightRailShapes = 6
+
+// shape returns the shape of a rail block with the given data.
+func (aspect *RailAspect) shape(data byte) (shape *railShape, ok bool) {
+	numShapes := len(railShapes)
+	if !aspect.Curved {
+		data &= 0x7
+		numShapes = numStraightRailShapes
+	}
+	if int(data) >= numShapes {
+		return nil, false
+	}
+	return &railShapes[data], true
+}
+
+// railAt returns the shape of the rail at blockLoc. ok is false if there is
+// no rail there, or if the block could not be read.
+func railAt(rails IRailQuerier, blockLoc *BlockXyz) (shape *railShape, ok bool) {
+	blockId, data, ok := rails.BlockAt(blockLoc)
+	if !ok {
+		return
+	}
+	blockType, ok := Blocks.Get(blockId)
+	if !ok {
+		return
+	}
+	rail, ok := blockType.Aspect.(*RailAspect)
+	if !ok {
+		return
+	}
+	return rail.shape(data)
+}
@@ -0,0 +1,243 @@
+package gamerules
+
+import (
+	. "chunkymonkey/types"
+)
+
+const (
+	// RedstoneMaxPower is the power given out by redstone sources. Power falls
+	// by one for each block of wire that it travels along.
+	RedstoneMaxPower = 15
+
+	// The number of ticks between the block next to a wire changing and the
+	// wire updating its power.
+	redstoneWireTickDelay = Ticks(1)
+
+	// Set in the data of levers and buttons that are switched on.
+	redstoneSwitchOn = 0x8
+)
+
+// IRedstoneSourceAspect is implemented by the aspects of blocks that give out
+// redstone power, such as levers and torches.
+type IRedstoneSourceAspect interface {
+	// RedstonePower returns the power given out by a block with the given data.
+	RedstonePower(data byte) byte
+}
+
+// IRedstoneAspect is implemented by the aspects of blocks that react to
+// redstone power, such as wires and doors. These blocks tick
+// RedstoneTickDelay ticks after a block near them changes, so that they can
+// check whether they have been powered.
+type IRedstoneAspect interface {
+	RedstoneTickDelay() Ticks
+}
+
+// IsRedstoneBlock returns true if the block is a redstone source or wire, so
+// that changing it might change the power reaching the blocks around it.
+func IsRedstoneBlock(blockId BlockId) bool {
+	blockType, ok := Blocks.Get(blockId)
+	if !ok {
+		return false
+	}
+	switch blockType.Aspect.(type) {
+	case IRedstoneSourceAspect, *RedstoneWireAspect:
+		return true
+	}
+	return false
+}
+
+// RedstonePowerInto returns the redstone power reaching the block at blockLoc
+// from the sources and wires next to it. connected is true if there are any
+// sources or wires next to the block, powered or not.
+func RedstonePowerInto(chunk IChunkBlock, blockLoc *BlockXyz) (power byte, connected bool) {
+	for face := Face(FaceMinValid); face <= FaceMaxValid; face++ {
+		neighbourLoc := blockLoc.AddXyz(face.Dxyz())
+		if neighbourLoc == nil {
+			continue
+		}
+		blockId, blockData, ok := chunk.BlockAt(neighbourLoc)
+		if !ok {
+			continue
+		}
+		blockType, ok := Blocks.Get(blockId)
+		if !ok {
+			continue
+		}
+
+		var neighbourPower byte
+		switch aspect := blockType.Aspect.(type) {
+		case IRedstoneSourceAspect:
+			neighbourPower = aspect.RedstonePower(blockData)
+			connected = true
+		case *RedstoneWireAspect:
+			neighbourPower = blockData & 0xf
+			connected = true
+		}
+		if neighbourPower > power {
+			power = neighbourPower
+		}
+	}
+	return
+}
+
+// Behaviour of redstone wire, which carries power from redstone sources to the
+// blocks along it. The data of a wire block is its power level.
+func makeRedstoneWireAspect() (aspect IBlockAspect) {
+	return &RedstoneWireAspect{}
+}
+
+type RedstoneWireAspect struct {
+	StandardAspect
+}
+
+func (aspect *RedstoneWireAspect) Name() string {
+	return "RedstoneWire"
+}
+
+func (aspect *RedstoneWireAspect) RedstoneTickDelay() Ticks {
+	return redstoneWireTickDelay
+}
+
+func (aspect *RedstoneWireAspect) Tick(instance *BlockInstance) bool {
+	if power := aspect.power(instance); power != instance.Data {
+		// Setting the block schedules the blocks around it to update in turn.
+		instance.Chunk.SetBlockAt(&instance.BlockLoc, instance.BlockType.id, power)
+	}
+	return false
+}
+
+// power returns the power that the wire should have, being the strongest of
+// the power from sources next to it, and one less than the power of the wires
+// that it connects to. Wires connect to the wires beside them, and to the
+// wires diagonally above or below them on slopes.
+func (aspect *RedstoneWireAspect) power(instance *BlockInstance) (power byte) {
+	chunk := instance.Chunk
+
+	wirePower := func(loc *BlockXyz) byte {
+		if loc == nil {
+			return 0
+		}
+		blockId, blockData, ok := chunk.BlockAt(loc)
+		if !ok {
+			return 0
+		}
+		if blockType, ok := Blocks.Get(blockId); ok {
+			if _, isWire := blockType.Aspect.(*RedstoneWireAspect); isWire && blockData&0xf > 0 {
+				return blockData&0xf - 1
+			}
+		}
+		return 0
+	}
+
+	for face := Face(FaceMinValid); face <= FaceMaxValid; face++ {
+		neighbourLoc := instance.BlockLoc.AddXyz(face.Dxyz())
+		if neighbourLoc == nil {
+			continue
+		}
+
+		if blockId, blockData, ok := chunk.BlockAt(neighbourLoc); ok {
+			if blockType, ok := Blocks.Get(blockId); ok {
+				if source, ok := blockType.Aspect.(IRedstoneSourceAspect); ok {
+					if sourcePower := source.RedstonePower(blockData); sourcePower > power {
+						power = sourcePower
+					}
+				}
+			}
+		}
+
+		if face == FaceBottom || face == FaceTop {
+			continue
+		}
+		dx, _, dz := face.Dxyz()
+		for dy := -1; dy <= 1; dy++ {
+			if p := wirePower(instance.BlockLoc.AddXyz(dx, BlockYCoord(dy), dz)); p > power {
+				power = p
+			}
+		}
+	}
+
+	return
+}
+
+// Behaviour of a lever, which is switched on and off by players, and powers
+// redstone while it is on.
+func makeLeverAspect() (aspect IBlockAspect) {
+	return &LeverAspect{}
+}
+
+type LeverAspect struct {
+	StandardAspect
+}
+
+func (aspect *LeverAspect) Name() string {
+	return "Lever"
+}
+
+func (aspect *LeverAspect) RedstonePower(data byte) byte {
+	if data&redstoneSwitchOn != 0 {
+		return RedstoneMaxPower
+	}
+	return 0
+}
+
+func (aspect *LeverAspect) Interact(instance *BlockInstance, player IPlayerClient) {
+	instance.Chunk.SetBlockAt(&instance.BlockLoc, instance.BlockType.id, instance.Data^redstoneSwitchOn)
+}
+
+// Behaviour of a button, which powers redstone for a short time after a
+// player presses it.
+func makeButtonAspect() (aspect IBlockAspect) {
+	return &ButtonAspect{}
+}
+
+type ButtonAspect struct {
+	StandardAspect
+	// PressTicks is how long the button stays pressed for.
+	PressTicks Ticks
+}
+
+func (aspect *ButtonAspect) Name() string {
+	return "Button"
+}
+
+func (aspect *ButtonAspect) RedstonePower(data byte) byte {
+	if data&redstoneSwitchOn != 0 {
+		return RedstoneMaxPower
+	}
+	return 0
+}
+
+func (aspect *ButtonAspect) Interact(instance *BlockInstance, player IPlayerClient) {
+	if instance.Data&redstoneSwitchOn != 0 {
+		// Already pressed.
+		return
+	}
+	instance.Chunk.SetBlockAt(&instance.BlockLoc, instance.BlockType.id, instance.Data|redstoneSwitchOn)
+	instance.Chunk.ScheduleBlockTick(instance.Index, aspect.PressTicks)
+}
+
+func (aspect *ButtonAspect) Tick(instance *BlockInstance) bool {
+	if instance.Data&redstoneSwitchOn != 0 {
+		// Pop back out.
+		instance.Chunk.SetBlockAt(&instance.BlockLoc, instance.BlockType.id, instance.Data&^redstoneSwitchOn)
+	}
+	return false
+}
+
+// Behaviour of a redstone torch, which always gives out Power.
+func makeRedstoneTorchAspect() (aspect IBlockAspect) {
+	return &RedstoneTorchAspect{}
+}
+
+type RedstoneTorchAspect struct {
+	StandardAspect
+	Power byte
+}
+
+func (aspect *RedstoneTorchAspect) Name() string {
+	return "RedstoneTorch"
+}
+
+func (aspect *RedstoneTorchAspect) RedstonePower(data byte) byte {
+	return aspect.Power
+}
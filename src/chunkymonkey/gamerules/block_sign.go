@@ -1,11 +1,18 @@
 package gamerules
 
 import (
+	"io"
 	"os"
+	"strings"
+	"utf8"
 
+	"chunkymonkey/proto"
 	"nbt"
 )
 
+// The most characters that a line of text on a sign may have.
+const SignLineMaxLength = 15
+
 func makeSignAspect() (aspect IBlockAspect) {
 	return &SignAspect{}
 }
@@ -61,6 +68,11 @@ func (sign *signTileEntity) MarshalNbt(tag *nbt.Compound) (err os.Error) {
 	return nil
 }
 
+// SendUpdate writes the packet that tells clients the text on the sign.
+func (sign *signTileEntity) SendUpdate(writer io.Writer) os.Error {
+	return proto.WriteSignUpdate(writer, &sign.blockLoc, sign.text)
+}
+
 type SignAspect struct {
 	StandardAspect
 }
@@ -69,4 +81,40 @@ func (aspect SignAspect) Name() string {
 	return "Sign"
 }
 
-// TODO behaviours for signs.
+// SetText changes the text written on the sign. The text is checked with
+// SanitizeSignText, and ok is false if it is not allowed.
+func (aspect *SignAspect) SetText(instance *BlockInstance, lines [4]string) (sign IVisibleTileEntity, ok bool) {
+	if lines, ok = SanitizeSignText(lines); !ok {
+		return nil, false
+	}
+
+	signEntity, isSign := instance.Chunk.TileEntity(instance.Index).(*signTileEntity)
+	if !isSign {
+		signEntity = &signTileEntity{}
+		signEntity.chunk = instance.Chunk
+		signEntity.blockLoc = instance.BlockLoc
+	}
+	signEntity.text = lines
+	// Setting the tile entity again marks the chunk as changed.
+	instance.Chunk.SetTileEntity(instance.Index, signEntity)
+
+	return signEntity, true
+}
+
+// SanitizeSignText removes control characters from the text for a sign. ok is
+// false if any of the lines is too long to fit on a sign.
+func SanitizeSignText(lines [4]string) (sanitized [4]string, ok bool) {
+	for i, line := range lines {
+		line = strings.Map(func(rune int) int {
+			if rune < 0x20 || rune == 0x7f {
+				return -1
+			}
+			return rune
+		}, line)
+		if utf8.RuneCountInString(line) > SignLineMaxLength {
+			return sanitized, false
+		}
+		sanitized[i] = line
+	}
+	return sanitized, true
+}
@@ -0,0 +1,61 @@
+package gamerules
+
+import (
+	"testing"
+)
+
+func TestSanitizeSignText(t *testing.T) {
+	type Test struct {
+		desc     string
+		input    [4]string
+		expected [4]string
+		ok       bool
+	}
+
+	tests := []Test{
+		{
+			"plain text",
+			[4]string{"one", "two", "", "four"},
+			[4]string{"one", "two", "", "four"},
+			true,
+		},
+		{
+			"control characters removed",
+			[4]string{"\ttab", "bell\x07", "new\nline", "del\x7f"},
+			[4]string{"tab", "bell", "newline", "del"},
+			true,
+		},
+		{
+			"longest line allowed",
+			[4]string{"123456789012345", "", "", ""},
+			[4]string{"123456789012345", "", "", ""},
+			true,
+		},
+		{
+			"longest line counted in characters",
+			[4]string{"ééééééééééééééé", "", "", ""},
+			[4]string{"ééééééééééééééé", "", "", ""},
+			true,
+		},
+		{
+			"line too long",
+			[4]string{"", "", "", "1234567890123456"},
+			[4]string{},
+			false,
+		},
+	}
+
+	for _, r := range tests {
+		result, ok := SanitizeSignText(r.input)
+		if ok != r.ok {
+			t.Errorf("%s: expected ok=%t but got %t", r.desc, r.ok, ok)
+			continue
+		}
+		for i := range result {
+			if ok && result[i] != r.expected[i] {
+				t.Errorf("%s: expected %q but got %q", r.desc, r.expected, result)
+				break
+			}
+		}
+	}
+}
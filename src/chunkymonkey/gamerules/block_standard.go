@@ -19,6 +19,15 @@ type StandardAspect struct {
 	// Items, up to one of which will potentially spawn when block destroyed.
 	DroppedItems []blockDropItem
 	BreakOn      DigStatus
+	// ToolType is the type of tool that the block is mined with. If
+	// ToolRequired is set, the block drops nothing when broken by a player
+	// holding any other tool, or nothing at all.
+	ToolType     ToolTypeId
+	ToolRequired bool
+	// MinExperience and MaxExperience are the range of experience dropped when
+	// the block is broken by a player, such as for ores.
+	MinExperience int16
+	MaxExperience int16
 }
 
 func (aspect *StandardAspect) setAttrs(blockAttrs *BlockAttrs) {
@@ -57,7 +66,11 @@ func (aspect *StandardAspect) InventoryClick(instance *BlockInstance, player IPl
 func (aspect *StandardAspect) InventoryUnsubscribed(instance *BlockInstance, player IPlayerClient) {
 }
 
-func (aspect *StandardAspect) Destroy(instance *BlockInstance) {
+func (aspect *StandardAspect) Destroy(instance *BlockInstance, held *Slot) {
+	if !aspect.isRightTool(instance, held) {
+		return
+	}
+
 	if len(aspect.DroppedItems) > 0 {
 		rand := instance.Chunk.Rand()
 		// Possibly drop item(s)
@@ -70,6 +83,34 @@ func (aspect *StandardAspect) Destroy(instance *BlockInstance) {
 			r -= dropItem.Probability
 		}
 	}
+
+	if held != nil && aspect.MaxExperience > 0 {
+		aspect.dropExperience(instance)
+	}
+}
+
+// dropExperience spawns an experience orb where the block was broken.
+func (aspect *StandardAspect) dropExperience(instance *BlockInstance) {
+	value := aspect.MinExperience
+	if spread := int(aspect.MaxExperience - aspect.MinExperience); spread > 0 {
+		value += int16(instance.Chunk.Rand().Intn(spread + 1))
+	}
+	if value <= 0 {
+		return
+	}
+
+	position := instance.BlockLoc.MidPointToAbsXyz()
+	instance.Chunk.AddEntity(NewExperienceOrb(value, position, &AbsVelocity{}))
+}
+
+// isRightTool returns true if the block drops items when destroyed while held
+// is held. Blocks destroyed other than by a player always drop items.
+func (aspect *StandardAspect) isRightTool(instance *BlockInstance, held *Slot) bool {
+	if !aspect.ToolRequired || held == nil {
+		return true
+	}
+	itemType, ok := instance.Chunk.ItemType(held.ItemTypeId)
+	return ok && itemType.ToolType == aspect.ToolType
 }
 
 func (aspect *StandardAspect) Tick(instance *BlockInstance) bool {
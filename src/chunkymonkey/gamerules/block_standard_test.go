@@ -0,0 +1,218 @@
+package gamerules
+
+import (
+	"rand"
+	"testing"
+
+	. "chunkymonkey/types"
+)
+
+// fakeChunkBlock records entities and tile entities added to it, and
+// otherwise does nothing.
+type fakeChunkBlock struct {
+	rand         *rand.Rand
+	entities     []INonPlayerEntity
+	tileEntities map[BlockIndex]ITileEntity
+}
+
+func newFakeChunkBlock() *fakeChunkBlock {
+	return &fakeChunkBlock{
+		rand:         rand.New(rand.NewSource(0)),
+		tileEntities: make(map[BlockIndex]ITileEntity),
+	}
+}
+
+func (chunk *fakeChunkBlock) Rand() *rand.Rand {
+	return chunk.rand
+}
+
+func (chunk *fakeChunkBlock) ItemType(itemTypeId ItemTypeId) (itemType *ItemType, ok bool) {
+	itemType, ok = Items[itemTypeId]
+	return
+}
+
+func (chunk *fakeChunkBlock) AddEntity(s INonPlayerEntity) {
+	chunk.entities = append(chunk.entities, s)
+}
+
+func (chunk *fakeChunkBlock) SetBlockByIndex(blockIndex BlockIndex, blockId BlockId, blockData byte) {
+}
+
+func (chunk *fakeChunkBlock) BlockAt(blockLoc *BlockXyz) (blockId BlockId, blockData byte, ok bool) {
+	return
+}
+
+func (chunk *fakeChunkBlock) SetBlockAt(blockLoc *BlockXyz, blockId BlockId, blockData byte) bool {
+	return false
+}
+
+func (chunk *fakeChunkBlock) TileEntity(blockIndex BlockIndex) ITileEntity {
+	return chunk.tileEntities[blockIndex]
+}
+
+func (chunk *fakeChunkBlock) SetTileEntity(blockIndex BlockIndex, extra ITileEntity) {
+	chunk.tileEntities[blockIndex] = extra
+}
+
+func (chunk *fakeChunkBlock) AddOnUnsubscribe(entityId EntityId, observer IUnsubscribed) {
+}
+
+func (chunk *fakeChunkBlock) RemoveOnUnsubscribe(entityId EntityId, observer IUnsubscribed) {
+}
+
+func (chunk *fakeChunkBlock) AddActiveBlock(blockXyz *BlockXyz) {
+}
+
+func (chunk *fakeChunkBlock) AddActiveBlockIndex(blockIndex BlockIndex) {
+}
+
+func (chunk *fakeChunkBlock) ScheduleBlockTick(blockIndex BlockIndex, delay Ticks) {
+}
+
+func TestStandardAspect_HitAndDestroy(t *testing.T) {
+	// Stone drops cobblestone when broken.
+	aspect := &StandardAspect{
+		DroppedItems: []blockDropItem{
+			blockDropItem{DroppedItem: 4, Probability: 100, Count: 1},
+		},
+		BreakOn: DigBlockBroke,
+	}
+
+	chunk := newFakeChunkBlock()
+	instance := &BlockInstance{
+		Chunk:    chunk,
+		BlockLoc: BlockXyz{1, 64, 1},
+		Data:     0,
+	}
+
+	if aspect.Hit(instance, nil, DigStarted) {
+		t.Errorf("expected block not to be destroyed when digging started")
+	}
+	if !aspect.Hit(instance, nil, DigBlockBroke) {
+		t.Fatalf("expected block to be destroyed when digging finished")
+	}
+
+	aspect.Destroy(instance, nil)
+
+	if len(chunk.entities) != 1 {
+		t.Fatalf("expected 1 dropped item, got %d", len(chunk.entities))
+	}
+	item, ok := chunk.entities[0].(*Item)
+	if !ok {
+		t.Fatalf("expected dropped entity to be *Item, got %T", chunk.entities[0])
+	}
+	expected := Slot{ItemTypeId: 4, Count: 1, Data: 0}
+	if !expected.Equals(item.GetSlot()) {
+		t.Errorf("expected dropped %v, got %v", expected, *item.GetSlot())
+	}
+}
+
+func TestStandardAspect_Destroy_ToolRequired(t *testing.T) {
+	defer func(items ItemTypeMap) { Items = items }(Items)
+	Items = ItemTypeMap{
+		4:   &ItemType{Id: 4, Name: "cobblestone", MaxStack: MaxStackDefault},
+		269: &ItemType{Id: 269, Name: "wooden shovel", MaxStack: 1, ToolType: ToolTypeIdShovel},
+		270: &ItemType{Id: 270, Name: "wooden pickaxe", MaxStack: 1, ToolType: ToolTypeIdPickaxe},
+	}
+
+	// Stone must be mined with a pickaxe to drop cobblestone.
+	aspect := &StandardAspect{
+		DroppedItems: []blockDropItem{
+			blockDropItem{DroppedItem: 4, Probability: 100, Count: 1},
+		},
+		BreakOn:      DigBlockBroke,
+		ToolType:     ToolTypeIdPickaxe,
+		ToolRequired: true,
+	}
+
+	type Test struct {
+		desc    string
+		held    *Slot
+		expDrop bool
+	}
+
+	tests := []Test{
+		{"pickaxe", &Slot{ItemTypeId: 270, Count: 1}, true},
+		{"hand", &Slot{}, false},
+		{"shovel", &Slot{ItemTypeId: 269, Count: 1}, false},
+		{"not destroyed by a player", nil, true},
+	}
+
+	for _, test := range tests {
+		chunk := newFakeChunkBlock()
+		instance := &BlockInstance{
+			Chunk:    chunk,
+			BlockLoc: BlockXyz{1, 64, 1},
+		}
+
+		aspect.Destroy(instance, test.held)
+
+		if !test.expDrop {
+			if len(chunk.entities) != 0 {
+				t.Errorf("%s: expected no drop, got %d items", test.desc, len(chunk.entities))
+			}
+			continue
+		}
+
+		if len(chunk.entities) != 1 {
+			t.Errorf("%s: expected 1 dropped item, got %d", test.desc, len(chunk.entities))
+			continue
+		}
+		item, ok := chunk.entities[0].(*Item)
+		if !ok || item.GetSlot().ItemTypeId != 4 {
+			t.Errorf("%s: expected cobblestone to drop, got %v", test.desc, chunk.entities[0])
+		}
+	}
+}
+
+func TestStandardAspect_Destroy_LeavesDropSaplings(t *testing.T) {
+	// Leaves drop a sapling one time in twenty.
+	aspect := &StandardAspect{
+		DroppedItems: []blockDropItem{
+			blockDropItem{DroppedItem: 6, Probability: 5, Count: 1, CopyData: true},
+		},
+		BreakOn: DigBlockBroke,
+	}
+
+	chunk := newFakeChunkBlock()
+	instance := &BlockInstance{
+		Chunk:    chunk,
+		BlockLoc: BlockXyz{1, 64, 1},
+		Data:     2,
+	}
+
+	const numDestroyed = 1000
+	for i := 0; i < numDestroyed; i++ {
+		aspect.Destroy(instance, &Slot{})
+	}
+
+	// Expect about 50 saplings.
+	if n := len(chunk.entities); n < 25 || n > 75 {
+		t.Errorf("expected about %d saplings from %d leaves, got %d", numDestroyed/20, numDestroyed, n)
+	}
+	for _, entity := range chunk.entities {
+		item := entity.(*Item)
+		expected := Slot{ItemTypeId: 6, Count: 1, Data: 2}
+		if !expected.Equals(item.GetSlot()) {
+			t.Errorf("expected dropped %v, got %v", expected, *item.GetSlot())
+			break
+		}
+	}
+}
+
+func TestBlockDropItem_CountRange(t *testing.T) {
+	drop := &blockDropItem{DroppedItem: 331, Probability: 100, Count: 4, MaxCount: 5}
+	chunk := newFakeChunkBlock()
+
+	counts := make(map[ItemCount]int)
+	for i := 0; i < 100; i++ {
+		drop.drop(chunk, BlockXyz{1, 64, 1}, 0)
+	}
+	for _, entity := range chunk.entities {
+		counts[entity.(*Item).GetSlot().Count]++
+	}
+
+	if len(counts) != 2 || counts[4] == 0 || counts[5] == 0 {
+		t.Errorf("expected drops of both 4 and 5 items, got counts %v", counts)
+	}
+}
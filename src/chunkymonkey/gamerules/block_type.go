@@ -8,11 +8,15 @@ type BlockAttrs struct {
 	id           BlockId
 	Name         string
 	Opacity      int8
+	Brightness   int8
 	defined      bool
 	Destructable bool
 	Solid        bool
 	Replaceable  bool
 	Attachable   bool
+
+	// BlastResistance is how well the block absorbs the force of explosions.
+	BlastResistance float32
 }
 
 // The core information about any block type.
@@ -27,7 +31,7 @@ type BlockTypeList []BlockType
 // Get returns the requested BlockType by ID. ok = false if the block type does
 // not exist.
 func (btl *BlockTypeList) Get(id BlockId) (block *BlockType, ok bool) {
-	if id < 0 || int(id) > len(*btl) {
+	if id < 0 || int(id) >= len(*btl) {
 		ok = false
 		return
 	}
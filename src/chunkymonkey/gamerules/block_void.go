@@ -38,7 +38,7 @@ func (aspect *VoidAspect) InventoryClick(instance *BlockInstance, player IPlayer
 func (aspect *VoidAspect) InventoryUnsubscribed(instance *BlockInstance, player IPlayerClient) {
 }
 
-func (aspect *VoidAspect) Destroy(instance *BlockInstance) {
+func (aspect *VoidAspect) Destroy(instance *BlockInstance, held *Slot) {
 }
 
 func (aspect *VoidAspect) Tick(instance *BlockInstance) bool {
@@ -54,6 +54,14 @@ type INonPlayerEntity interface {
 	Tick(physics.IBlockQuerier) (leftBlock bool)
 }
 
+// IMob is implemented by all types of mob.
+type IMob interface {
+	INonPlayerEntity
+
+	// GetMob returns the state common to all mobs.
+	GetMob() *Mob
+}
+
 // ITileEntity is the interface common to entities that are tile-based.
 type ITileEntity interface {
 	INbtSerializable
@@ -66,3 +74,12 @@ type ITileEntity interface {
 	// Block returns the position of the tile entity.
 	Block() BlockXyz
 }
+
+// IVisibleTileEntity is implemented by tile entities that are shown to
+// clients, such as the text on signs.
+type IVisibleTileEntity interface {
+	ITileEntity
+
+	// SendUpdate writes the packets that tell a client about the tile entity.
+	SendUpdate(writer io.Writer) os.Error
+}
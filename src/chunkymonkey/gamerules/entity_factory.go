@@ -4,6 +4,9 @@ var EntityCreateByName = map[string]func() INonPlayerEntity{
 	// Pick-up items.
 	"Item": NewBlankItem,
 
+	// Experience.
+	"XPOrb": NewBlankExperienceOrb,
+
 	// Mobs.
 	"Hen":      NewHen,
 	"Chicken":  NewHen,
@@ -0,0 +1,80 @@
+package gamerules
+
+import (
+	"io"
+	"os"
+
+	"chunkymonkey/nbtutil"
+	"chunkymonkey/physics"
+	"chunkymonkey/proto"
+	. "chunkymonkey/types"
+	"nbt"
+)
+
+const (
+	// ExperienceOrbPickupImmunity is how long a newly spawned experience orb
+	// must exist before it can be collected.
+	ExperienceOrbPickupImmunity = Ticks(10)
+)
+
+// ExperienceOrb is an entity that gives experience to the player that collects
+// it.
+type ExperienceOrb struct {
+	EntityId
+	physics.PointObject
+	Value          int16
+	PickupImmunity Ticks
+}
+
+func NewBlankExperienceOrb() INonPlayerEntity {
+	return new(ExperienceOrb)
+}
+
+func NewExperienceOrb(value int16, position *AbsXyz, velocity *AbsVelocity) (orb *ExperienceOrb) {
+	orb = &ExperienceOrb{
+		Value:          value,
+		PickupImmunity: ExperienceOrbPickupImmunity,
+	}
+	orb.PointObject.Init(position, velocity)
+	return
+}
+
+func (orb *ExperienceOrb) UnmarshalNbt(tag *nbt.Compound) (err os.Error) {
+	if err = orb.PointObject.UnmarshalNbt(tag); err != nil {
+		return
+	}
+
+	if orb.Value, err = nbtutil.ReadShort(tag, "Value"); err != nil {
+		return
+	}
+
+	return nil
+}
+
+func (orb *ExperienceOrb) MarshalNbt(tag *nbt.Compound) (err os.Error) {
+	if err = orb.PointObject.MarshalNbt(tag); err != nil {
+		return
+	}
+	tag.Set("id", &nbt.String{"XPOrb"})
+	tag.Set("Value", &nbt.Short{orb.Value})
+	return nil
+}
+
+func (orb *ExperienceOrb) SendSpawn(writer io.Writer) (err os.Error) {
+	return proto.WriteExperienceOrb(writer, orb.EntityId, orb.PointObject.LastSentPosition, orb.Value)
+}
+
+func (orb *ExperienceOrb) SendUpdate(writer io.Writer) (err os.Error) {
+	if err = proto.WriteEntity(writer, orb.EntityId); err != nil {
+		return
+	}
+
+	return orb.PointObject.SendUpdate(writer, orb.EntityId, &LookBytes{0, 0})
+}
+
+// ExperienceToLevel returns the experience that a player at the given level
+// needs to reach the next level. This is 7, 10, 14, 17, ... for levels 0, 1,
+// 2, 3, ...
+func ExperienceToLevel(level int16) int16 {
+	return 7 + (level*7)>>1
+}
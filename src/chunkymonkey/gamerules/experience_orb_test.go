@@ -0,0 +1,15 @@
+package gamerules
+
+import (
+	"testing"
+)
+
+func TestExperienceToLevel(t *testing.T) {
+	expected := []int16{7, 10, 14, 17, 21, 24, 28}
+
+	for level, experience := range expected {
+		if result := ExperienceToLevel(int16(level)); result != experience {
+			t.Errorf("level %d: expected %d experience to the next level but got %d", level, experience, result)
+		}
+	}
+}
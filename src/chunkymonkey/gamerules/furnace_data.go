@@ -23,6 +23,9 @@ type FurnaceData struct {
 type Reaction struct {
 	Output     ItemTypeId
 	OutputData ItemData
+	// Experience is given to the player for each item produced. It may be a
+	// fraction, in which case it builds up over several items.
+	Experience float32
 }
 
 // furnaceDataDef is used in unmarshalling data from the JSON definition of
@@ -37,6 +40,7 @@ type furnaceDataDef struct {
 		Input      ItemTypeId
 		Output     ItemTypeId
 		OutputData ItemData
+		Experience float32
 	}
 }
 
@@ -77,6 +81,7 @@ func LoadFurnaceData(reader io.Reader) (furnaceData FurnaceData, err os.Error) {
 		furnaceData.Reactions[reactionDef.Input] = Reaction{
 			Output:     reactionDef.Output,
 			OutputData: reactionDef.OutputData,
+			Experience: reactionDef.Experience,
 		}
 	}
 
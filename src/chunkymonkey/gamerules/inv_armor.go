@@ -0,0 +1,72 @@
+package gamerules
+
+import (
+	. "chunkymonkey/types"
+)
+
+// Armor slot indices, in the order that they appear in the player inventory
+// window.
+const (
+	ArmorSlotHead = SlotId(iota)
+	ArmorSlotTorso
+	ArmorSlotLegs
+	ArmorSlotFeet
+	armorNumSlots
+)
+
+const (
+	// Armor item types run from the leather cap to the gold boots in groups of
+	// four per material, ordered head, torso, legs, feet.
+	armorItemTypeIdFirst = ItemTypeId(298)
+	armorItemTypeIdLast  = ItemTypeId(317)
+)
+
+// armorPoints is the number of half-points of protection given by each armor
+// piece, indexed by armor slot.
+var armorPoints = [armorNumSlots]int{3, 8, 6, 3}
+
+// ArmorSlotForItem returns the armor slot that the given item type may be
+// worn in. ok is false if the item is not armor.
+func ArmorSlotForItem(itemTypeId ItemTypeId) (slotId SlotId, ok bool) {
+	if itemTypeId < armorItemTypeIdFirst || itemTypeId > armorItemTypeIdLast {
+		return 0, false
+	}
+	return SlotId((itemTypeId - armorItemTypeIdFirst) % armorNumSlots), true
+}
+
+// ArmorInventory holds the armor worn by a player. Each slot only accepts the
+// matching type of armor piece.
+type ArmorInventory struct {
+	Inventory
+}
+
+// InitArmorInventory initializes inv as a player's armor inventory.
+func (inv *ArmorInventory) InitArmorInventory() {
+	inv.Inventory.Init(armorNumSlots)
+}
+
+// Click handles window clicks from a user, rejecting any attempt to put an
+// item into a slot that it cannot be worn in. The cursor is left unchanged
+// when the click is rejected.
+func (inv *ArmorInventory) Click(click *Click) (txState TxState) {
+	if !click.Cursor.IsEmpty() {
+		slotId, ok := ArmorSlotForItem(click.Cursor.ItemTypeId)
+		if !ok || slotId != click.SlotId {
+			return TxStateRejected
+		}
+	}
+
+	return inv.Inventory.Click(click)
+}
+
+// ArmorPoints returns the number of half-points of protection given by the
+// armor currently worn.
+func (inv *ArmorInventory) ArmorPoints() (points int) {
+	for i := range inv.slots {
+		slotId, ok := ArmorSlotForItem(inv.slots[i].ItemTypeId)
+		if ok && slotId == SlotId(i) {
+			points += armorPoints[i]
+		}
+	}
+	return
+}
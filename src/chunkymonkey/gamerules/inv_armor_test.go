@@ -0,0 +1,75 @@
+package gamerules
+
+import (
+	"testing"
+
+	. "chunkymonkey/types"
+)
+
+func TestArmorInventory_Click(t *testing.T) {
+	defer func(items ItemTypeMap) { Items = items }(Items)
+	Items = make(ItemTypeMap)
+	ironHelmet := ItemTypeId(306)
+	apple := ItemTypeId(260)
+
+	makeItemType(ironHelmet)
+	makeItemType(apple)
+
+	type Test struct {
+		desc           string
+		slotId         SlotId
+		cursor         Slot
+		expectedState  TxState
+		expectedSlot   Slot
+		expectedCursor Slot
+	}
+
+	tests := []Test{
+		{
+			"helmet into the helmet slot",
+			ArmorSlotHead, Slot{ironHelmet, 1, 0},
+			TxStateAccepted,
+			Slot{ironHelmet, 1, 0}, Slot{0, 0, 0},
+		},
+		{
+			"helmet into the boots slot",
+			ArmorSlotFeet, Slot{ironHelmet, 1, 0},
+			TxStateRejected,
+			Slot{0, 0, 0}, Slot{ironHelmet, 1, 0},
+		},
+		{
+			"non-armor into the helmet slot",
+			ArmorSlotHead, Slot{apple, 1, 0},
+			TxStateRejected,
+			Slot{0, 0, 0}, Slot{apple, 1, 0},
+		},
+	}
+
+	for _, test := range tests {
+		var inv ArmorInventory
+		inv.InitArmorInventory()
+
+		click := Click{SlotId: test.slotId, Cursor: test.cursor}
+		if state := inv.Click(&click); state != test.expectedState {
+			t.Errorf("%s: expected tx state %v but got %v", test.desc, test.expectedState, state)
+		}
+		if !slotEq(&test.expectedSlot, &inv.slots[test.slotId]) {
+			t.Errorf("%s: expected slot %+v but got %+v", test.desc, test.expectedSlot, inv.slots[test.slotId])
+		}
+		if !slotEq(&test.expectedCursor, &click.Cursor) {
+			t.Errorf("%s: expected cursor %+v but got %+v", test.desc, test.expectedCursor, click.Cursor)
+		}
+	}
+}
+
+func TestArmorInventory_ArmorPoints(t *testing.T) {
+	var inv ArmorInventory
+	inv.InitArmorInventory()
+
+	inv.slots[ArmorSlotHead] = Slot{ItemTypeId(306), 1, 0}
+	inv.slots[ArmorSlotFeet] = Slot{ItemTypeId(313), 1, 0}
+
+	if points := inv.ArmorPoints(); points != 6 {
+		t.Errorf("expected 6 armor points but got %d", points)
+	}
+}
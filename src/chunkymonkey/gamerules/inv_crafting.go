@@ -46,6 +46,8 @@ func NewWorkbenchInventory() *CraftingInventory {
 
 // Click handles window clicks from a user with special handling for crafting.
 func (inv *CraftingInventory) Click(click *Click) (txState TxState) {
+	outputCount := inv.slots[0].Count
+
 	if click.SlotId == 0 {
 		// Player may only *take* the *whole* stack from the output slot.
 		txState = inv.Inventory.TakeOnlyClick(click)
@@ -58,11 +60,11 @@ func (inv *CraftingInventory) Click(click *Click) (txState TxState) {
 		return
 	}
 
-	if click.SlotId == 0 {
+	if click.SlotId == 0 && outputCount > 0 && inv.slots[0].IsEmpty() {
 		// Player took items from the output slot. Subtract 1 count from each
 		// non-empty input slot.
 		for i := 1; i < len(inv.slots); i++ {
-			inv.slots[i].Decrement()
+			inv.slots[i].Decrement(1)
 			inv.slotUpdate(&inv.slots[i], SlotId(i))
 		}
 	}
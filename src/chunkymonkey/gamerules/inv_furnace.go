@@ -22,6 +22,9 @@ type FurnaceInventory struct {
 	burnTimeMax Ticks
 	burnTime    Ticks
 	cookTime    Ticks
+	// experience is earned by the reactions whose output has not yet been
+	// taken.
+	experience float32
 
 	lastCurFuel           PrgBarValue
 	lastReactionRemaining PrgBarValue
@@ -113,7 +116,7 @@ func (inv *FurnaceInventory) stateCheck() {
 	// Work out if the output slot is ready for items to be produced from the
 	// reaction.
 	var outputReady bool
-	if outputSlot.ItemTypeId != 0 {
+	if !outputSlot.IsEmpty() {
 		itemType := outputSlot.ItemType()
 		maxStack := MaxStackDefault
 		if itemType != nil {
@@ -141,7 +144,7 @@ func (inv *FurnaceInventory) stateCheck() {
 		if haveReagent && haveFuel && outputReady {
 			// Everything is in place, light the furnace by consuming one unit of
 			// fuel.
-			fuelSlot.Decrement()
+			fuelSlot.Decrement(1)
 			inv.burnTimeMax = fuelTicks
 			inv.burnTime = fuelTicks
 			inv.slotUpdate(fuelSlot, furnaceSlotFuel)
@@ -167,7 +170,8 @@ func (inv *FurnaceInventory) stateCheck() {
 
 			outputSlot.AddOne(&itemCreated)
 			inv.slotUpdate(outputSlot, furnaceSlotOutput)
-			reagentSlot.Decrement()
+			inv.experience += reaction.Experience
+			reagentSlot.Decrement(1)
 			inv.slotUpdate(reagentSlot, furnaceSlotReagent)
 		}
 	}
@@ -201,6 +205,15 @@ func (inv *FurnaceInventory) sendProgressUpdates() {
 	}
 }
 
+// TakeExperience returns the whole experience points earned by smelting, for
+// giving to the player who takes the output. Any fraction of a point is kept
+// for the next time.
+func (inv *FurnaceInventory) TakeExperience() (experience int16) {
+	experience = int16(inv.experience)
+	inv.experience -= float32(experience)
+	return
+}
+
 func (inv *FurnaceInventory) IsLit() bool {
 	return inv.burnTime > 0
 }
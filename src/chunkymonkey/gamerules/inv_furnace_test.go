@@ -192,3 +192,34 @@ func Test_FurnaceBurnsMultipleFuel(t *testing.T) {
 	runner.runUntil(plankFuelTime * 2)
 	checkLit(t, furnace, false)
 }
+
+func Test_FurnaceRunsOutOfFuel(t *testing.T) {
+	furnace, runner := loadedFurnace(t, 1, 2)
+
+	// The single plank burns for long enough to smelt one ingot, but runs out
+	// part way through smelting the second.
+	runner.runUntil(plankFuelTime)
+	checkLit(t, furnace, false)
+	checkSlot(t, Slot{ironIngotId, 1, 0}, furnace.slots[furnaceSlotOutput])
+	checkSlot(t, Slot{ironOreId, 1, 0}, furnace.slots[furnaceSlotReagent])
+
+	// The unfinished smelt is lost, and no more ingots are produced.
+	runner.runUntil(2 * plankFuelTime)
+	checkSlot(t, Slot{ironIngotId, 1, 0}, furnace.slots[furnaceSlotOutput])
+	checkSlot(t, Slot{ironOreId, 1, 0}, furnace.slots[furnaceSlotReagent])
+	if furnace.cookTime != reactionDuration {
+		t.Errorf("Expected cook time to reset to %d, got %d", reactionDuration, furnace.cookTime)
+	}
+}
+
+func Test_FurnaceOutputFull(t *testing.T) {
+	furnace, runner := loadedFurnace(t, 1, 1)
+
+	fullOutput := Slot{ironIngotId, MaxStackDefault, 0}
+	furnace.slots[furnaceSlotOutput] = fullOutput
+
+	// Nothing is smelted while there is no room in the output slot.
+	runner.runFor(reactionDuration)
+	checkSlot(t, fullOutput, furnace.slots[furnaceSlotOutput])
+	checkSlot(t, Slot{ironOreId, 1, 0}, furnace.slots[furnaceSlotReagent])
+}
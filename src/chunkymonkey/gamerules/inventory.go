@@ -62,7 +62,7 @@ func (inv *Inventory) SetSubscriber(subscriber IInventorySubscriber) {
 // Click takes the default actions upon a click event from a player. The Cursor
 // attribute of click may be modified to represent the cursors new contents.
 func (inv *Inventory) Click(click *Click) TxState {
-	if click.SlotId < 0 || int(click.SlotId) > len(inv.slots) {
+	if click.SlotId < 0 || int(click.SlotId) >= len(inv.slots) {
 		return TxStateRejected
 	}
 
@@ -73,7 +73,7 @@ func (inv *Inventory) Click(click *Click) TxState {
 	}
 
 	// Apply the change.
-	if click.Cursor.Count == 0 {
+	if click.Cursor.IsEmpty() {
 		if click.RightClick {
 			clickedSlot.Split(&click.Cursor)
 		} else {
@@ -105,7 +105,7 @@ func (inv *Inventory) Click(click *Click) TxState {
 // items are taken at all. This is intended for use by crafting/furnace output
 // slots.
 func (inv *Inventory) TakeOnlyClick(click *Click) TxState {
-	if click.SlotId < 0 || int(click.SlotId) > len(inv.slots) {
+	if click.SlotId < 0 || int(click.SlotId) >= len(inv.slots) {
 		return TxStateRejected
 	}
 
@@ -129,6 +129,13 @@ func (inv *Inventory) Slot(slotId SlotId) Slot {
 	return inv.slots[slotId]
 }
 
+// SetSlot replaces the contents of a slot, for instance when a player in
+// creative mode picks an item.
+func (inv *Inventory) SetSlot(slotId SlotId, slot *Slot) {
+	inv.slots[slotId] = *slot
+	inv.slotUpdate(&inv.slots[slotId], slotId)
+}
+
 func (inv *Inventory) TakeOneItem(slotId SlotId, into *Slot) {
 	slot := &inv.slots[slotId]
 	if into.AddOne(slot) {
@@ -136,6 +143,21 @@ func (inv *Inventory) TakeOneItem(slotId SlotId, into *Slot) {
 	}
 }
 
+// UseTool uses up one of the remaining uses of the tool in the given slot, if
+// it holds one. Returns true if the tool broke.
+func (inv *Inventory) UseTool(slotId SlotId) (broke bool) {
+	slot := &inv.slots[slotId]
+	itemType := slot.ItemType()
+	if itemType == nil || itemType.ToolUses <= 0 {
+		return
+	}
+
+	broke = slot.DecrementUses(itemType.ToolUses)
+	inv.slotUpdate(slot, slotId)
+
+	return
+}
+
 // PutItem attempts to put the given item into the inventory.
 func (inv *Inventory) PutItem(item *Slot) {
 	// TODO optimize this algorithm, maybe by maintaining a map of non-full
@@ -143,7 +165,7 @@ func (inv *Inventory) PutItem(item *Slot) {
 	// should prefer to put stackable items into stacks of the same type,
 	// rather than in empty slots.
 	for slotIndex := range inv.slots {
-		if item.Count <= 0 {
+		if item.IsEmpty() {
 			break
 		}
 		slot := &inv.slots[slotIndex]
@@ -156,7 +178,7 @@ func (inv *Inventory) PutItem(item *Slot) {
 // CanTakeItem returns true if it can take at least one item from the passed
 // Slot.
 func (inv *Inventory) CanTakeItem(item *Slot) bool {
-	if item.Count <= 0 {
+	if item.IsEmpty() {
 		return false
 	}
 
@@ -2,6 +2,8 @@ package gamerules
 
 import (
 	"testing"
+
+	. "chunkymonkey/types"
 )
 
 func TestInventory_Init(t *testing.T) {
@@ -14,3 +16,91 @@ func TestInventory_Init(t *testing.T) {
 		}
 	}
 }
+
+func TestInventory_Click(t *testing.T) {
+	defer func(items ItemTypeMap) { Items = items }(Items)
+	Items = make(ItemTypeMap)
+	apple := ItemTypeId(1)
+	orange := ItemTypeId(2)
+
+	makeItemType(apple)
+	makeItemType(orange)
+
+	type Test struct {
+		desc           string
+		initial        Slot
+		click          Click
+		expectedState  TxState
+		expectedSlot   Slot
+		expectedCursor Slot
+	}
+
+	tests := []Test{
+		{
+			"left-click picks up a stack",
+			Slot{apple, 10, 0},
+			Click{SlotId: 0, ExpectedSlot: Slot{apple, 10, 0}},
+			TxStateAccepted,
+			Slot{0, 0, 0}, Slot{apple, 10, 0},
+		},
+		{
+			"right-click picks up half a stack",
+			Slot{apple, 10, 0},
+			Click{SlotId: 0, RightClick: true, ExpectedSlot: Slot{apple, 10, 0}},
+			TxStateAccepted,
+			Slot{apple, 5, 0}, Slot{apple, 5, 0},
+		},
+		{
+			"left-click places onto a compatible stack",
+			Slot{apple, 10, 0},
+			Click{SlotId: 0, Cursor: Slot{apple, 5, 0}, ExpectedSlot: Slot{apple, 10, 0}},
+			TxStateAccepted,
+			Slot{apple, 15, 0}, Slot{0, 0, 0},
+		},
+		{
+			"right-click places one item",
+			Slot{0, 0, 0},
+			Click{SlotId: 0, Cursor: Slot{apple, 5, 0}, RightClick: true, ExpectedSlot: Slot{0, 0, 0}},
+			TxStateAccepted,
+			Slot{apple, 1, 0}, Slot{apple, 4, 0},
+		},
+		{
+			"left-click swaps with a different item",
+			Slot{apple, 10, 0},
+			Click{SlotId: 0, Cursor: Slot{orange, 5, 0}, ExpectedSlot: Slot{apple, 10, 0}},
+			TxStateAccepted,
+			Slot{orange, 5, 0}, Slot{apple, 10, 0},
+		},
+		{
+			"click with an unexpected slot is rejected",
+			Slot{apple, 10, 0},
+			Click{SlotId: 0, ExpectedSlot: Slot{apple, 9, 0}},
+			TxStateRejected,
+			Slot{apple, 10, 0}, Slot{0, 0, 0},
+		},
+		{
+			"click past the end of the inventory is rejected",
+			Slot{apple, 10, 0},
+			Click{SlotId: 2},
+			TxStateRejected,
+			Slot{apple, 10, 0}, Slot{0, 0, 0},
+		},
+	}
+
+	for _, test := range tests {
+		var inv Inventory
+		inv.Init(2)
+		inv.slots[0] = test.initial
+
+		click := test.click
+		if state := inv.Click(&click); state != test.expectedState {
+			t.Errorf("%s: expected tx state %v but got %v", test.desc, test.expectedState, state)
+		}
+		if !slotEq(&test.expectedSlot, &inv.slots[0]) {
+			t.Errorf("%s: expected slot %+v but got %+v", test.desc, test.expectedSlot, inv.slots[0])
+		}
+		if !slotEq(&test.expectedCursor, &click.Cursor) {
+			t.Errorf("%s: expected cursor %+v but got %+v", test.desc, test.expectedCursor, click.Cursor)
+		}
+	}
+}
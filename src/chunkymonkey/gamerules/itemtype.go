@@ -10,12 +10,27 @@ const (
 
 type ToolTypeId byte
 
+// Types of tool used to break blocks.
+const (
+	ToolTypeIdNone    = ToolTypeId(0)
+	ToolTypeIdShovel  = ToolTypeId(1)
+	ToolTypeIdPickaxe = ToolTypeId(2)
+	ToolTypeIdAxe     = ToolTypeId(3)
+	ToolTypeIdSword   = ToolTypeId(4)
+	ToolTypeIdHoe     = ToolTypeId(5)
+)
+
 type ItemType struct {
 	Id       ItemTypeId
 	Name     string
 	MaxStack ItemCount
 	ToolType ToolTypeId
 	ToolUses ItemData
+	// Food is the amount of food that eating the item restores, or zero if the
+	// item can't be eaten.
+	Food FoodUnits
+	// Saturation is the food saturation that eating the item gives.
+	Saturation float32
 }
 
 type ItemTypeMap map[ItemTypeId]*ItemType
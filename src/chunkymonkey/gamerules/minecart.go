@@ -0,0 +1,246 @@
+package gamerules
+
+import (
+	"io"
+	"os"
+
+	"chunkymonkey/physics"
+	"chunkymonkey/proto"
+	. "chunkymonkey/types"
+	"nbt"
+)
+
+const (
+	ItemTypeIdMinecart = ItemTypeId(328)
+
+	// Distance that a moving minecart travels along the rails each tick, in
+	// blocks.
+	minecartSpeed = 0.4
+
+	// The vehicle ID sent in an attach entity packet when an entity leaves its
+	// vehicle.
+	noVehicleId = EntityId(-1)
+)
+
+// IRailQuerier is the interface required by minecarts to find the rails that
+// they run on. It is implemented by chunks.
+type IRailQuerier interface {
+	BlockAt(blockLoc *BlockXyz) (blockId BlockId, blockData byte, ok bool)
+}
+
+// Minecart is a vehicle that runs along rails, and that a player may ride in.
+// A minecart that is not on rails falls like any other object.
+//
+// A moving minecart travels from the centre of one rail block to the centre
+// of the next, turning at the centre of curved rails. It stops when it
+// reaches the end of the track.
+type Minecart struct {
+	Object
+
+	rider IPlayerClient // nil if nobody is riding the minecart.
+
+	block    BlockXyz // The rail block that the minecart last passed the centre of.
+	heading  railDir
+	progress AbsCoord // Distance travelled from the centre of block.
+	speed    AbsCoord
+}
+
+func NewMinecart() INonPlayerEntity {
+	return &Minecart{
+		Object: *NewObject(ObjTypeIdMinecart),
+	}
+}
+
+// NewMinecartOnRail creates a stationary minecart on the rail at blockLoc.
+// ok is false if there is no rail there.
+func NewMinecartOnRail(rails IRailQuerier, blockLoc *BlockXyz) (cart *Minecart, ok bool) {
+	shape, ok := railAt(rails, blockLoc)
+	if !ok {
+		return nil, false
+	}
+
+	cart = NewMinecart().(*Minecart)
+	cart.block = *blockLoc
+	cart.heading = shape.exits[0]
+	cart.updatePosition(shape)
+	cart.PointObject.Init(cart.Position(), &AbsVelocity{})
+
+	return cart, true
+}
+
+func (cart *Minecart) UnmarshalNbt(tag *nbt.Compound) (err os.Error) {
+	if err = cart.Object.UnmarshalNbt(tag); err != nil {
+		return
+	}
+	cart.block = *cart.Position().ToBlockXyz()
+	return
+}
+
+func (cart *Minecart) SendSpawn(writer io.Writer) (err os.Error) {
+	if err = cart.Object.SendSpawn(writer); err != nil {
+		return
+	}
+	if cart.rider != nil {
+		err = proto.WriteAttachEntity(writer, cart.rider.GetEntityId(), cart.EntityId)
+	}
+	return
+}
+
+// Rider returns the player riding in the minecart, or nil if it is empty.
+func (cart *Minecart) Rider() IPlayerClient {
+	return cart.rider
+}
+
+// Mount puts rider in the minecart, and sets it moving along the rails.
+// Returns false if somebody is already riding in it.
+func (cart *Minecart) Mount(rider IPlayerClient, rails IRailQuerier) bool {
+	if cart.rider != nil {
+		return false
+	}
+	cart.rider = rider
+	cart.push(rails)
+	return true
+}
+
+// Dismount takes the rider out of the minecart, returning them. Returns nil if
+// nobody was riding in it.
+func (cart *Minecart) Dismount() (rider IPlayerClient) {
+	rider = cart.rider
+	cart.rider = nil
+	return
+}
+
+// WriteAttach writes the packet that tells clients about the rider getting
+// into the minecart.
+func (cart *Minecart) WriteAttach(writer io.Writer, rider IPlayerClient) os.Error {
+	return proto.WriteAttachEntity(writer, rider.GetEntityId(), cart.EntityId)
+}
+
+// WriteDetach writes the packet that tells clients about the rider getting
+// out of the minecart.
+func (cart *Minecart) WriteDetach(writer io.Writer, rider IPlayerClient) os.Error {
+	return proto.WriteAttachEntity(writer, rider.GetEntityId(), noVehicleId)
+}
+
+// push sets the minecart moving along the rails. It sets off the other way if
+// the track ends in the direction that it is facing.
+func (cart *Minecart) push(rails IRailQuerier) {
+	if _, _, _, ok := cart.nextRail(rails); !ok {
+		cart.heading = cart.heading.reverse()
+	}
+	cart.speed = minecartSpeed
+}
+
+func (cart *Minecart) Tick(blockQuerier physics.IBlockQuerier) (leftChunk bool) {
+	rails, ok := blockQuerier.(IRailQuerier)
+	if !ok {
+		return cart.PointObject.Tick(blockQuerier)
+	}
+
+	shape, onRail := railAt(rails, &cart.block)
+	if !onRail {
+		// Derailed minecarts fall until they land, perhaps on another rail.
+		leftChunk = cart.PointObject.Tick(blockQuerier)
+		cart.block = *cart.Position().ToBlockXyz()
+		cart.progress = 0
+		cart.speed = 0
+		return
+	}
+
+	if cart.speed <= 0 {
+		return false
+	}
+
+	oldChunkLoc := cart.Position().ToChunkXz()
+
+	for remaining := cart.speed; remaining > 0; {
+		if cart.progress == 0 {
+			if _, _, _, ok := cart.nextRail(rails); !ok {
+				// The end of the track. The minecart stops, and will set off
+				// back the way that it came when next pushed.
+				cart.heading = cart.heading.reverse()
+				cart.speed = 0
+				break
+			}
+		}
+
+		move := 1 - cart.progress
+		if remaining < move {
+			move = remaining
+		}
+		cart.progress += move
+		remaining -= move
+
+		if cart.progress >= 1 {
+			next, nextShape, heading, ok := cart.nextRail(rails)
+			if !ok {
+				// The rail ahead has been removed.
+				cart.progress = 0
+				cart.speed = 0
+				break
+			}
+			cart.block = next
+			cart.heading = heading
+			cart.progress = 0
+			shape = nextShape
+		}
+	}
+
+	cart.updatePosition(shape)
+
+	if cart.rider != nil {
+		cart.rider.MoveWithVehicle(*cart.Position())
+	}
+
+	newChunkLoc := cart.Position().ToChunkXz()
+	return newChunkLoc.X != oldChunkLoc.X || newChunkLoc.Z != oldChunkLoc.Z
+}
+
+// nextRail finds the rail that the minecart moves on to after the one that it
+// is on, and the direction that it will then be heading in.
+func (cart *Minecart) nextRail(rails IRailQuerier) (next BlockXyz, shape *railShape, heading railDir, ok bool) {
+	cur, ok := railAt(rails, &cart.block)
+	if !ok {
+		return
+	}
+
+	next = BlockXyz{cart.block.X + cart.heading.dx, cart.block.Y, cart.block.Z + cart.heading.dz}
+	if cur.sloped && cur.exits[0] == cart.heading {
+		next.Y++
+	}
+
+	entry := cart.heading.reverse()
+	if shape, ok = railAt(rails, &next); !ok {
+		// The track may continue down a slope from the block below.
+		next.Y--
+		if shape, ok = railAt(rails, &next); !ok || !shape.sloped || shape.exits[0] != entry {
+			return next, nil, heading, false
+		}
+	}
+
+	heading, ok = shape.exitFrom(entry)
+	return
+}
+
+// updatePosition moves the minecart to its position along the rail, which has
+// the given shape.
+func (cart *Minecart) updatePosition(shape *railShape) {
+	pos := cart.Position()
+	pos.X = AbsCoord(cart.block.X) + 0.5 + AbsCoord(cart.heading.dx)*cart.progress
+	pos.Y = AbsCoord(cart.block.Y)
+	pos.Z = AbsCoord(cart.block.Z) + 0.5 + AbsCoord(cart.heading.dz)*cart.progress
+
+	if shape.sloped {
+		// Sloped rails are half way up at their centre.
+		rise := 0.5 - cart.progress
+		if shape.exits[0] == cart.heading {
+			rise = 0.5 + cart.progress
+		}
+		if rise < 0 {
+			rise = 0
+		} else if rise > 1 {
+			rise = 1
+		}
+		pos.Y += rise
+	}
+}
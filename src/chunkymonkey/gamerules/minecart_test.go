@@ -0,0 +1,113 @@
+package gamerules
+
+import (
+	"strings"
+	"testing"
+
+	. "chunkymonkey/types"
+)
+
+const minecartTestBlocks = `{
+  "0": {"Name": "air", "Aspect": "Void", "AspectArgs": {}},
+  "66": {"Name": "rail", "Aspect": "Rail", "AspectArgs": {"Curved": true}}
+}`
+
+// testRails is a world of air containing rails, keyed by location with the
+// rail's block data as value.
+type testRails map[BlockXyz]byte
+
+func (rails testRails) BlockAt(blockLoc *BlockXyz) (blockId BlockId, blockData byte, ok bool) {
+	if data, isRail := rails[*blockLoc]; isRail {
+		return 66, data, true
+	}
+	return BlockIdAir, 0, true
+}
+
+func (rails testRails) BlockQuery(blockLoc BlockXyz) (isSolid bool, isWithinChunk bool) {
+	return false, true
+}
+
+// ridingPlayerClient records the positions that vehicles carry it to.
+type ridingPlayerClient struct {
+	IPlayerClient
+	entityId  EntityId
+	positions []AbsXyz
+}
+
+func (p *ridingPlayerClient) GetEntityId() EntityId {
+	return p.entityId
+}
+
+func (p *ridingPlayerClient) MoveWithVehicle(position AbsXyz) {
+	p.positions = append(p.positions, position)
+}
+
+func loadMinecartTestBlocks(t *testing.T) {
+	blocks, err := LoadBlockDefs(strings.NewReader(minecartTestBlocks))
+	if err != nil {
+		t.Fatalf("failed to load block types: %v", err)
+	}
+	Blocks = blocks
+}
+
+func TestMinecart_Tick_MovesRider(t *testing.T) {
+	defer func(blocks BlockTypeList) { Blocks = blocks }(Blocks)
+	loadMinecartTestBlocks(t)
+
+	// A straight track running south, curving west at the end.
+	rails := testRails{
+		BlockXyz{0, 64, 0}:  0,
+		BlockXyz{0, 64, 1}:  0,
+		BlockXyz{0, 64, 2}:  0,
+		BlockXyz{0, 64, 3}:  0,
+		BlockXyz{0, 64, 4}:  8,
+		BlockXyz{-1, 64, 4}: 1,
+	}
+
+	if _, ok := NewMinecartOnRail(rails, &BlockXyz{1, 64, 0}); ok {
+		t.Errorf("expected no minecart to be put where there is no rail")
+	}
+	cart, ok := NewMinecartOnRail(rails, &BlockXyz{0, 64, 0})
+	if !ok {
+		t.Fatalf("expected a minecart to be put on the rail")
+	}
+
+	// A minecart doesn't move until somebody gets in.
+	cart.Tick(rails)
+	if pos := *cart.Position(); pos != (AbsXyz{0.5, 64, 0.5}) {
+		t.Errorf("expected stationary minecart at the rail's centre, got %v", pos)
+	}
+
+	rider := &ridingPlayerClient{entityId: 1}
+	if !cart.Mount(rider, rails) {
+		t.Fatalf("expected to get into an empty minecart")
+	}
+	if cart.Mount(&ridingPlayerClient{entityId: 2}, rails) {
+		t.Errorf("expected not to get into a minecart that is already ridden")
+	}
+
+	// The track ends to the north, so the minecart sets off south.
+	cart.Tick(rails)
+	if pos := *cart.Position(); pos.X != 0.5 || pos.Z <= 0.5 {
+		t.Errorf("expected minecart to move south, got %v", pos)
+	}
+	if len(rider.positions) != 1 || rider.positions[0] != *cart.Position() {
+		t.Errorf("expected rider to be moved to %v, got %v", *cart.Position(), rider.positions)
+	}
+
+	// Around the corner to the end of the track, where it stops.
+	for i := 0; i < 20; i++ {
+		cart.Tick(rails)
+	}
+	expected := AbsXyz{-0.5, 64, 4.5}
+	if pos := *cart.Position(); pos != expected {
+		t.Errorf("expected minecart to stop at the end of the track at %v, got %v", expected, pos)
+	}
+	if last := rider.positions[len(rider.positions)-1]; last != expected {
+		t.Errorf("expected rider to be carried to %v, got %v", expected, last)
+	}
+
+	if cart.Dismount() != rider || cart.Rider() != nil {
+		t.Errorf("expected the rider to get out of the minecart")
+	}
+}
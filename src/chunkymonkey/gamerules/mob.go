@@ -4,6 +4,7 @@ import (
 	"expvar"
 	"io"
 	"os"
+	"rand"
 
 	"chunkymonkey/nbtutil"
 	"chunkymonkey/physics"
@@ -20,6 +21,22 @@ func init() {
 	expVarMobSpawnCount = expvar.NewInt("mob-spawn-count")
 }
 
+const (
+	// mobMaxHealth is the health that mobs are spawned with.
+	mobMaxHealth = Health(20)
+
+	// An idle mob has a one in mobWanderChance chance of moving each tick.
+	mobWanderChance = 40
+)
+
+// IMobBehaviour controls what a mob does of its own accord each tick, before
+// physics is applied to it.
+type IMobBehaviour interface {
+	// Update runs the behaviour for a single tick. It returns true if the mob
+	// moved out of the chunk that it was in.
+	Update(mob *Mob, blockQuerier physics.IBlockQuerier) (leftChunk bool)
+}
+
 // When using an object of type Mob or a sub-type, the caller must set an
 // EntityId, most likely obtained from the EntityManager.
 type Mob struct {
@@ -27,6 +44,9 @@ type Mob struct {
 	physics.PointObject
 	mobType EntityMobType
 	look    LookDegrees
+	health  Health
+	// Behaviour run each tick. Mobs wander at random by default.
+	Behaviour IMobBehaviour
 	// TODO(nictuku): Move to a more structured form.
 	metadata map[byte]byte
 	// TODO: Change to an AABB object when we have that.
@@ -34,6 +54,8 @@ type Mob struct {
 
 func (mob *Mob) Init(id EntityMobType) {
 	mob.mobType = id
+	mob.health = mobMaxHealth
+	mob.Behaviour = WanderBehaviour{}
 	mob.metadata = map[byte]byte{
 		0:  byte(0),
 		16: byte(0),
@@ -57,7 +79,7 @@ func (mob *Mob) UnmarshalNbt(tag *nbt.Compound) (err os.Error) {
 	_ = tag.Lookup("DeathTime").(*nbt.Short).Value
 	_ = tag.Lookup("FallDistance").(*nbt.Float).Value
 	_ = tag.Lookup("Fire").(*nbt.Short).Value
-	_ = tag.Lookup("Health").(*nbt.Short).Value
+	mob.health = Health(tag.Lookup("Health").(*nbt.Short).Value)
 	_ = tag.Lookup("HurtTime").(*nbt.Short).Value
 
 	return nil
@@ -82,7 +104,7 @@ func (mob *Mob) MarshalNbt(tag *nbt.Compound) (err os.Error) {
 	tag.Set("DeathTime", &nbt.Short{0})
 	tag.Set("FallDistance", &nbt.Float{0})
 	tag.Set("Fire", &nbt.Short{0})
-	tag.Set("Health", &nbt.Short{0})
+	tag.Set("Health", &nbt.Short{int16(mob.health)})
 	tag.Set("HurtTime", &nbt.Short{0})
 	return nil
 }
@@ -99,16 +121,85 @@ func (mob *Mob) SetBurning(burn bool) {
 	}
 }
 
+func (mob *Mob) GetMob() *Mob {
+	return mob
+}
+
+// Health returns the mob's remaining health.
+func (mob *Mob) Health() Health {
+	return mob.health
+}
+
+// ApplyDamage hurts the mob by the given amount, returning true if it has
+// died.
+func (mob *Mob) ApplyDamage(amount Health) (dead bool) {
+	mob.health -= amount
+	if mob.health < 0 {
+		mob.health = 0
+	}
+	return mob.health == 0
+}
+
 func (mob *Mob) Tick(blockQuerier physics.IBlockQuerier) (leftBlock bool) {
-	// TODO: Spontaneous mob movement.
+	if mob.Behaviour != nil && mob.Behaviour.Update(mob, blockQuerier) {
+		return true
+	}
 	return mob.PointObject.Tick(blockQuerier)
 }
 
+// WanderBehaviour occasionally moves a mob to a random neighbouring block
+// that it can stand in.
+type WanderBehaviour struct{}
+
+func (b WanderBehaviour) Update(mob *Mob, blockQuerier physics.IBlockQuerier) (leftChunk bool) {
+	if rand.Intn(mobWanderChance) != 0 {
+		return
+	}
+
+	pos := mob.Position()
+	blockLoc := pos.ToBlockXyz()
+	face := Face(FaceEast + rand.Intn(FaceSouth-FaceEast+1))
+	target := blockLoc.AddXyz(face.Dxyz())
+	if target == nil {
+		return
+	}
+
+	walkable, isWithinChunk := isWalkable(blockQuerier, target)
+	if !walkable {
+		return
+	}
+
+	pos.X = AbsCoord(target.X) + 0.5
+	pos.Z = AbsCoord(target.Z) + 0.5
+
+	return !isWithinChunk
+}
+
+// isWalkable returns true if a mob can stand in the given block, which must
+// have a solid block below it and room for the mob above.
+func isWalkable(blockQuerier physics.IBlockQuerier, blockLoc *BlockXyz) (walkable bool, isWithinChunk bool) {
+	floorLoc := blockLoc.AddXyz(0, -1, 0)
+	headLoc := blockLoc.AddXyz(0, 1, 0)
+	if floorLoc == nil || headLoc == nil {
+		return false, false
+	}
+
+	if floorSolid, _ := blockQuerier.BlockQuery(*floorLoc); !floorSolid {
+		return false, false
+	}
+	if headSolid, _ := blockQuerier.BlockQuery(*headLoc); headSolid {
+		return false, false
+	}
+	solid, isWithinChunk := blockQuerier.BlockQuery(*blockLoc)
+
+	return !solid, isWithinChunk
+}
+
 func (mob *Mob) FormatMetadata() []proto.EntityMetadata {
 	x := make([]proto.EntityMetadata, len(mob.metadata))
 	i := 0
 	for k, v := range mob.metadata {
-		x[i] = proto.EntityMetadata{0, k, v}
+		x[i] = proto.EntityMetadata{proto.EntityMetadataByte, k, v}
 		i++
 	}
 	return x
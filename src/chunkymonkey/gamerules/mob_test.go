@@ -89,3 +89,59 @@ func TestMobSpawn(t *testing.T) {
 		}
 	}
 }
+
+// boxBlockQuerier has a solid floor at y=63 within a small square, and a
+// pillar in the middle. Everything outside of the square is solid.
+type boxBlockQuerier struct{}
+
+func (q boxBlockQuerier) BlockQuery(blockLoc types.BlockXyz) (isSolid bool, isWithinChunk bool) {
+	if blockLoc.X < 0 || blockLoc.X > 4 || blockLoc.Z < 0 || blockLoc.Z > 4 {
+		return true, false
+	}
+	if blockLoc.Y <= 63 {
+		return true, true
+	}
+	return blockLoc.X == 2 && blockLoc.Z == 2, true
+}
+
+func TestWanderBehaviour_StaysOnWalkableBlocks(t *testing.T) {
+	m := NewCow().(*Cow)
+	m.PointObject.Init(&types.AbsXyz{0.5, 64, 0.5}, &types.AbsVelocity{})
+
+	var querier boxBlockQuerier
+	moved := false
+	for i := 0; i < 2000; i++ {
+		before := *m.Position()
+		if leftChunk := m.Behaviour.Update(&m.Mob, querier); leftChunk {
+			t.Fatalf("mob left the chunk at %v", m.Position())
+		}
+		pos := m.Position()
+		if *pos != before {
+			moved = true
+		}
+		if walkable, _ := isWalkable(querier, pos.ToBlockXyz()); !walkable {
+			t.Fatalf("mob wandered to an unwalkable position %v", pos)
+		}
+	}
+
+	if !moved {
+		t.Errorf("expected the mob to wander")
+	}
+}
+
+func TestMob_ApplyDamage(t *testing.T) {
+	m := NewZombie().(*Zombie)
+
+	if m.ApplyDamage(5) {
+		t.Errorf("expected mob to survive 5 damage")
+	}
+	if health := m.Health(); health != mobMaxHealth-5 {
+		t.Errorf("expected health %d but got %d", mobMaxHealth-5, health)
+	}
+	if !m.ApplyDamage(mobMaxHealth) {
+		t.Errorf("expected mob to die")
+	}
+	if health := m.Health(); health != 0 {
+		t.Errorf("expected health 0 but got %d", health)
+	}
+}
@@ -92,10 +92,6 @@ func NewBoat() INonPlayerEntity {
 	return NewObject(ObjTypeIdBoat)
 }
 
-func NewMinecart() INonPlayerEntity {
-	return NewObject(ObjTypeIdMinecart)
-}
-
 func NewStorageCart() INonPlayerEntity {
 	return NewObject(ObjTypeIdStorageCart)
 }
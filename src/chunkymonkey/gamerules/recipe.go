@@ -6,6 +6,7 @@ package gamerules
 import (
 	"fmt"
 	"os"
+	"sort"
 )
 
 const (
@@ -19,11 +20,12 @@ const (
 )
 
 type Recipe struct {
-	Comment string
-	Width   byte
-	Height  byte
-	Input   []Slot
-	Output  Slot
+	Comment   string
+	Width     byte
+	Height    byte
+	Shapeless bool
+	Input     []Slot
+	Output    Slot
 }
 
 func (r *Recipe) match(width, height byte, slots []Slot, indices []int) (isMatch bool) {
@@ -43,6 +45,23 @@ func (r *Recipe) match(width, height byte, slots []Slot, indices []int) (isMatch
 	return
 }
 
+// normalizeShapeless removes the empty slots from a shapeless recipe's input
+// and sorts the remainder, so that it can be matched against the input in any
+// arrangement.
+func (r *Recipe) normalizeShapeless() {
+	input := make([]Slot, 0, len(r.Input))
+	for i := range r.Input {
+		if r.Input[i].ItemTypeId != 0 {
+			input = append(input, r.Input[i])
+		}
+	}
+	sort.Sort(slotsByType(input))
+
+	r.Input = input
+	r.Width = byte(len(input))
+	r.Height = 1
+}
+
 func (r *Recipe) hash() (hash uint32) {
 	indices := make([]int, len(r.Input))
 	for i := range r.Input {
@@ -85,21 +104,48 @@ func inputHash(slots []Slot, indices []int) (hash uint32) {
 	return
 }
 
+// slotsByType sorts slots by item type and data, ignoring count.
+type slotsByType []Slot
+
+func (s slotsByType) Len() int {
+	return len(s)
+}
+
+func (s slotsByType) Less(i, j int) bool {
+	if s[i].ItemTypeId != s[j].ItemTypeId {
+		return s[i].ItemTypeId < s[j].ItemTypeId
+	}
+	return s[i].Data < s[j].Data
+}
+
+func (s slotsByType) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
 type RecipeSet struct {
 	recipes []Recipe
 
 	// Recipe by inputs hash.
 	recipeHash map[uint32][]*Recipe
+
+	// Shapeless recipe by sorted inputs hash.
+	shapelessHash map[uint32][]*Recipe
 }
 
 func (r *RecipeSet) init() os.Error {
 	r.recipeHash = make(map[uint32][]*Recipe)
+	r.shapelessHash = make(map[uint32][]*Recipe)
 	for i := range r.recipes {
 		recipe := &r.recipes[i]
+		recipeHash := r.recipeHash
+		if recipe.Shapeless {
+			recipe.normalizeShapeless()
+			recipeHash = r.shapelessHash
+		}
 		hash := recipe.hash()
-		bucket := r.recipeHash[hash]
+		bucket := recipeHash[hash]
 		bucket = append(bucket, recipe)
-		r.recipeHash[hash] = bucket
+		recipeHash[hash] = bucket
 	}
 
 	return r.check()
@@ -124,6 +170,10 @@ type RecipeSetMatcher struct {
 	// slotBuf is used in searching for a match. Having it in the struct saves
 	// reallocation per call to Match().
 	indicesArray [maxRecipeWidth * maxRecipeHeight]int
+
+	// shapelessArray holds the sorted non-empty input slots while searching for
+	// a shapeless recipe.
+	shapelessArray [maxRecipeWidth * maxRecipeHeight]Slot
 }
 
 func (r *RecipeSetMatcher) Init(recipes *RecipeSet) {
@@ -134,7 +184,8 @@ func (r *RecipeSetMatcher) Init(recipes *RecipeSet) {
 // with the result of any matching recipe. output.ItemType==nil and
 // output.Count==0 if nothing matched).
 //
-// The order of slots is left to right, then top to bottom.
+// The order of slots is left to right, then top to bottom. Shaped recipes are
+// tried first, then shapeless recipes.
 //
 // Precondition: len(slots) == width * height
 func (r *RecipeSetMatcher) Match(width, height int, slots []Slot) (output Slot) {
@@ -189,18 +240,40 @@ func (r *RecipeSetMatcher) Match(width, height int, slots []Slot) (output Slot)
 
 	hash := inputHash(slots, indices)
 
-	bucket, ok := r.recipes.recipeHash[hash]
-
-	if !ok {
-		return
-	}
-
 	// Find the matching recipe, if any.
+	bucket := r.recipes.recipeHash[hash]
 	for i := range bucket {
 		recipe := bucket[i]
 		if recipe.match(byte(widthUsed), byte(heightUsed), slots, indices) {
 			// Found matching recipe.
-			output = recipe.Output
+			return recipe.Output
+		}
+	}
+
+	return r.matchShapeless(slots)
+}
+
+// matchShapeless looks for a shapeless recipe that uses the non-empty input
+// slots in any arrangement.
+func (r *RecipeSetMatcher) matchShapeless(slots []Slot) (output Slot) {
+	input := r.shapelessArray[:0]
+	for i := range slots {
+		if slots[i].Count > 0 {
+			input = append(input, slots[i])
+		}
+	}
+	sort.Sort(slotsByType(input))
+
+	indices := r.indicesArray[:len(input)]
+	for i := range indices {
+		indices[i] = i
+	}
+
+	bucket := r.recipes.shapelessHash[inputHash(input, indices)]
+	for i := range bucket {
+		recipe := bucket[i]
+		if recipe.match(byte(len(input)), 1, input, indices) {
+			return recipe.Output
 		}
 	}
 
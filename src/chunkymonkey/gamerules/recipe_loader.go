@@ -23,6 +23,7 @@ func (ti *typeInstance) createRecipeSlot(itemTypes ItemTypeMap) (slot Slot) {
 // recipeTemplate is the serialization structure for 0:M Recipes.
 type recipeTemplate struct {
 	Comment     string
+	Shapeless   bool
 	Input       []string
 	InputTypes  map[string][]typeInstance
 	OutputTypes []typeInstance
@@ -81,10 +82,11 @@ func (rt *recipeTemplate) numRecipes() int {
 func (rt *recipeTemplate) createRecipe(recipeIndex int, itemTypes ItemTypeMap) (recipe Recipe, err os.Error) {
 
 	recipe = Recipe{
-		Comment: rt.Comment,
-		Width:   byte(rt.width),
-		Height:  byte(rt.height),
-		Input:   make([]Slot, rt.width*rt.height),
+		Comment:   rt.Comment,
+		Width:     byte(rt.width),
+		Height:    byte(rt.height),
+		Shapeless: rt.Shapeless,
+		Input:     make([]Slot, rt.width*rt.height),
 	}
 
 	slotIndex := 0
@@ -128,3 +128,107 @@ func TestRecipeSet_Match(t *testing.T) {
 	// TODO test things other than square or 1x1 recipes
 	// TODO test recipes with gaps in
 }
+
+const shapedAndShapelessRecipes = ("[\n" +
+	"  {\n" +
+	"    \"Comment\": \"plank->sticks\",\n" +
+	"    \"Input\": [\n" +
+	"      \"P\",\n" +
+	"      \"P\"\n" +
+	"    ],\n" +
+	"    \"InputTypes\": {\n" +
+	"      \"P\": [{\"Id\": 5}]\n" +
+	"    },\n" +
+	"    \"OutputTypes\": [{\"Id\": 280}],\n" +
+	"    \"OutputCount\": 4\n" +
+	"  },\n" +
+	"  {\n" +
+	"    \"Comment\": \"orange dye\",\n" +
+	"    \"Shapeless\": true,\n" +
+	"    \"Input\": [\n" +
+	"      \"RY\"\n" +
+	"    ],\n" +
+	"    \"InputTypes\": {\n" +
+	"      \"R\": [{\"Id\": 351, \"Data\": 1}],\n" +
+	"      \"Y\": [{\"Id\": 351, \"Data\": 11}]\n" +
+	"    },\n" +
+	"    \"OutputTypes\": [{\"Id\": 351, \"Data\": 14}],\n" +
+	"    \"OutputCount\": 2\n" +
+	"  }\n" +
+	"]\n")
+
+func TestRecipeSet_MatchShapeless(t *testing.T) {
+	reader := strings.NewReader(shapedAndShapelessRecipes)
+	recipes, err := LoadRecipes(reader, createItemTypes())
+	if err != nil {
+		t.Fatalf("Failed to load recipes for match test: %v", err)
+	}
+
+	empty := Slot{0, 0, 0}
+	plank := Slot{5, 1, 0}
+	red := Slot{351, 1, 1}
+	yellow := Slot{351, 1, 11}
+	sticks := Slot{280, 4, 0}
+	orange := Slot{351, 2, 14}
+
+	tests := []struct {
+		comment string
+		width   int
+		height  int
+		input   []Slot
+		expect  *Slot
+	}{
+		{
+			"P.\nP.",
+			2, 2,
+			Slots(plank, empty, plank, empty),
+			&sticks,
+		},
+		{
+			"...\n..P\n..P",
+			3, 3,
+			Slots(empty, empty, empty, empty, empty, plank, empty, empty, plank),
+			&sticks,
+		},
+		{
+			"PP\n..",
+			2, 2,
+			Slots(plank, plank, empty, empty),
+			&empty,
+		},
+		{
+			"RY\n..",
+			2, 2,
+			Slots(red, yellow, empty, empty),
+			&orange,
+		},
+		{
+			"Y..\n...\n..R",
+			3, 3,
+			Slots(yellow, empty, empty, empty, empty, empty, empty, empty, red),
+			&orange,
+		},
+		{
+			"RR\n..",
+			2, 2,
+			Slots(red, red, empty, empty),
+			&empty,
+		},
+		{
+			"RY\nY.",
+			2, 2,
+			Slots(red, yellow, yellow, empty),
+			&empty,
+		},
+	}
+
+	var matcher RecipeSetMatcher
+	matcher.Init(recipes)
+
+	for i := range tests {
+		test := &tests[i]
+		t.Logf("Test #%d:\n%s", i, test.comment)
+		output := matcher.Match(test.width, test.height, test.input)
+		assertSlotEq(t, test.expect, &output)
+	}
+}
@@ -23,6 +23,8 @@ func (s *Slot) Clear() {
 	s.Data = 0
 }
 
+// Equals returns true if both slots hold the same item type, count and data
+// (uses, for tools).
 func (s *Slot) Equals(other *Slot) bool {
 	return (s.ItemTypeId == other.ItemTypeId &&
 		s.Count == other.Count &&
@@ -66,6 +68,7 @@ func (s *Slot) Normalize() {
 	}
 }
 
+// IsEmpty returns true if the slot holds no items.
 func (s *Slot) IsEmpty() bool {
 	return s.Count == 0 || s.ItemTypeId == 0
 }
@@ -196,22 +199,36 @@ func (s *Slot) Swap(src *Slot) (changed bool) {
 
 // Splits the contents of the subject slot (s) into half, half remaining in s,
 // and half moving to src (odd amounts put the spare item into the src slot).
-// If src is not empty, then this does nothing.
+// If src already holds items of the same type, then the moved half is added to
+// them, limited by the maximum stack size. If src holds items of a different
+// type, then this does nothing.
 // Returns true if slots changed as a result.
 func (s *Slot) Split(src *Slot) (changed bool) {
-	if s.IsEmpty() || !src.IsEmpty() {
+	if s.IsEmpty() {
 		return
 	}
 
-	changed = true
-	src.ItemTypeId = s.ItemTypeId
-	src.Data = s.Data
+	if src.IsEmpty() {
+		src.ItemTypeId = s.ItemTypeId
+		src.Data = s.Data
+		src.Count = 0
+	} else if !s.IsSameType(src) {
+		return
+	}
 
-	count := s.Count >> 1
-	odd := s.Count & 1
+	toTransfer := (s.Count >> 1) + (s.Count & 1)
+	if maxStack := s.MaxStack(); src.Count+toTransfer > maxStack {
+		toTransfer = maxStack - src.Count
+	}
 
-	src.setCount(count + odd)
-	s.setCount(count)
+	if toTransfer <= 0 {
+		src.Normalize()
+		return
+	}
+
+	changed = true
+	src.setCount(src.Count + toTransfer)
+	s.setCount(s.Count - toTransfer)
 
 	return
 }
@@ -242,14 +259,39 @@ func (s *Slot) AddOne(src *Slot) (changed bool) {
 	return
 }
 
-// Decrement destroys one item count from the subject slot.
-func (s *Slot) Decrement() (changed bool) {
-	if s.Count <= 0 {
+// Decrement destroys up to n items from the subject slot, leaving it empty if
+// no items remain. Returns the number of items destroyed, which is less than n
+// if the slot held fewer than n items.
+func (s *Slot) Decrement(n ItemCount) (removed ItemCount) {
+	if s.Count <= 0 || n <= 0 {
 		return
 	}
 
-	s.setCount(s.Count - 1)
-	changed = true
+	removed = n
+	if removed > s.Count {
+		removed = s.Count
+	}
+
+	s.setCount(s.Count - removed)
+	return
+}
+
+// DecrementUses uses up one of the remaining uses of a tool, where maxUses is
+// the durability of the tool's item type. The uses so far are held in the
+// slot's Data. When no uses remain the tool breaks, leaving the slot empty.
+// It does nothing if maxUses is not positive (i.e the item is not a tool).
+// Returns true if the tool broke.
+func (s *Slot) DecrementUses(maxUses ItemData) (broke bool) {
+	if s.IsEmpty() || maxUses <= 0 {
+		return
+	}
+
+	s.Data++
+	if s.Data >= maxUses {
+		s.setCount(0)
+		broke = true
+	}
+
 	return
 }
 
@@ -185,6 +185,59 @@ func TestSlot_Add(t *testing.T) {
 	)
 }
 
+func TestSlot_Add_MaxStack(t *testing.T) {
+	Items = make(ItemTypeMap)
+	snowball := ItemTypeId(1)
+	sword := ItemTypeId(2)
+
+	Items[snowball] = &ItemType{
+		Id:       snowball,
+		Name:     "<Test snowball>",
+		MaxStack: 16,
+	}
+	Items[sword] = &ItemType{
+		Id:       sword,
+		Name:     "<Test sword>",
+		MaxStack: 1,
+		ToolType: 1,
+		ToolUses: 32,
+	}
+
+	tests := []slotTest{
+		{
+			"10 + 10 => 16 + 4 (hitting max count of 16)",
+			Slot{snowball, 10, 0}, Slot{snowball, 10, 0},
+			Slot{snowball, 16, 0}, Slot{snowball, 4, 0},
+			true,
+		},
+		{
+			"0 + 16 => 16 + 0",
+			Slot{0, 0, 0}, Slot{snowball, 16, 0},
+			Slot{snowball, 16, 0}, Slot{0, 0, 0},
+			true,
+		},
+		{
+			"1 + 1 => 1 + 1 (tools never stack)",
+			Slot{sword, 1, 0}, Slot{sword, 1, 0},
+			Slot{sword, 1, 0}, Slot{sword, 1, 0},
+			false,
+		},
+		{
+			"0 + 1 => 1 + 0 (tool into empty slot)",
+			Slot{0, 0, 0}, Slot{sword, 1, 3},
+			Slot{sword, 1, 3}, Slot{0, 0, 0},
+			true,
+		},
+	}
+
+	runTests(
+		t, tests,
+		func(a, b *Slot) bool {
+			return a.Add(b)
+		},
+	)
+}
+
 func TestSlot_AddWhole(t *testing.T) {
 	Items = make(ItemTypeMap)
 	apple := ItemTypeId(1)
@@ -255,9 +308,9 @@ func TestSlot_Split(t *testing.T) {
 			false,
 		},
 		{
-			"splitting from a non-empty slot to another non-empty",
-			Slot{apple, 2, 0}, Slot{apple, 3, 0},
-			Slot{apple, 2, 0}, Slot{apple, 3, 0},
+			"splitting into a full stack",
+			Slot{apple, 10, 0}, Slot{apple, 64, 0},
+			Slot{apple, 10, 0}, Slot{apple, 64, 0},
 			false,
 		},
 		{
@@ -305,6 +358,24 @@ func TestSlot_Split(t *testing.T) {
 			Slot{0, 0, 0}, Slot{apple, 1, 5},
 			true,
 		},
+		{
+			"splitting even-numbered stack onto a partial stack",
+			Slot{apple, 2, 0}, Slot{apple, 3, 0},
+			Slot{apple, 1, 0}, Slot{apple, 4, 0},
+			true,
+		},
+		{
+			"splitting odd-numbered stack onto a partial stack",
+			Slot{apple, 5, 0}, Slot{apple, 2, 0},
+			Slot{apple, 2, 0}, Slot{apple, 5, 0},
+			true,
+		},
+		{
+			"splitting onto a partial stack, hitting max count",
+			Slot{apple, 10, 0}, Slot{apple, 60, 0},
+			Slot{apple, 6, 0}, Slot{apple, 64, 0},
+			true,
+		},
 	}
 
 	runTests(
@@ -384,3 +455,118 @@ func TestSlot_AddOne(t *testing.T) {
 		},
 	)
 }
+
+func TestSlot_DecrementUses(t *testing.T) {
+	Items = make(ItemTypeMap)
+	pickaxe := ItemTypeId(1)
+	apple := ItemTypeId(2)
+	const pickaxeUses = ItemData(5)
+
+	Items[pickaxe] = &ItemType{
+		Id:       pickaxe,
+		Name:     "<Test pickaxe>",
+		MaxStack: 1,
+		ToolType: 1,
+		ToolUses: pickaxeUses,
+	}
+	makeItemType(apple)
+
+	tool := Slot{pickaxe, 1, 0}
+	for i := ItemData(1); i < pickaxeUses; i++ {
+		if broke := tool.DecrementUses(pickaxeUses); broke {
+			t.Fatalf("Tool broke after %d uses, expected %d", i, pickaxeUses)
+		}
+		if expected := (Slot{pickaxe, 1, i}); !slotEq(&expected, &tool) {
+			t.Errorf("After %d uses expected %+v but got %+v", i, expected, tool)
+		}
+	}
+
+	if broke := tool.DecrementUses(pickaxeUses); !broke {
+		t.Errorf("Tool did not break after %d uses", pickaxeUses)
+	}
+	if !tool.IsEmpty() {
+		t.Errorf("Broken tool should leave slot empty, but got %+v", tool)
+	}
+
+	notTool := Slot{apple, 3, 0}
+	if broke := notTool.DecrementUses(0); broke {
+		t.Errorf("Non-tool item should not break")
+	}
+	if expected := (Slot{apple, 3, 0}); !slotEq(&expected, &notTool) {
+		t.Errorf("Non-tool item should be unchanged, but got %+v", notTool)
+	}
+}
+
+func TestSlot_IsEmpty(t *testing.T) {
+	type Test struct {
+		slot     Slot
+		expected bool
+	}
+
+	tests := []Test{
+		{Slot{0, 0, 0}, true},
+		{Slot{1, 0, 0}, true},
+		{Slot{0, 1, 0}, true},
+		{Slot{1, 1, 0}, false},
+		{Slot{1, 1, 5}, false},
+	}
+
+	for _, test := range tests {
+		if result := test.slot.IsEmpty(); result != test.expected {
+			t.Errorf("%+v: expected IsEmpty %t but got %t", test.slot, test.expected, result)
+		}
+	}
+}
+
+func TestSlot_Equals(t *testing.T) {
+	type Test struct {
+		desc     string
+		a, b     Slot
+		expected bool
+	}
+
+	tests := []Test{
+		{"empty", Slot{0, 0, 0}, Slot{0, 0, 0}, true},
+		{"identical", Slot{1, 5, 2}, Slot{1, 5, 2}, true},
+		{"differing type", Slot{1, 5, 2}, Slot{2, 5, 2}, false},
+		{"differing count", Slot{1, 5, 2}, Slot{1, 4, 2}, false},
+		{"differing uses", Slot{1, 1, 2}, Slot{1, 1, 3}, false},
+	}
+
+	for _, test := range tests {
+		if result := test.a.Equals(&test.b); result != test.expected {
+			t.Errorf("%s: expected %t but got %t", test.desc, test.expected, result)
+		}
+		if result := test.b.Equals(&test.a); result != test.expected {
+			t.Errorf("%s (reversed): expected %t but got %t", test.desc, test.expected, result)
+		}
+	}
+}
+
+func TestSlot_Decrement(t *testing.T) {
+	type Test struct {
+		desc            string
+		initial         Slot
+		n               ItemCount
+		expectedRemoved ItemCount
+		expected        Slot
+	}
+
+	tests := []Test{
+		{"part of a stack", Slot{1, 10, 2}, 3, 3, Slot{1, 7, 2}},
+		{"the whole stack", Slot{1, 10, 2}, 10, 10, Slot{0, 0, 0}},
+		{"more than the stack", Slot{1, 10, 2}, 15, 10, Slot{0, 0, 0}},
+		{"from an empty slot", Slot{0, 0, 0}, 1, 0, Slot{0, 0, 0}},
+		{"nothing", Slot{1, 10, 2}, 0, 0, Slot{1, 10, 2}},
+	}
+
+	for _, test := range tests {
+		slot := test.initial
+		if removed := slot.Decrement(test.n); removed != test.expectedRemoved {
+			t.Errorf("%s: expected %d removed but got %d", test.desc, test.expectedRemoved, removed)
+		}
+		if !slotEq(&test.expected, &slot) {
+			t.Errorf("%s: expected %+v but got %+v", test.desc, test.expected, slot)
+		}
+	}
+}
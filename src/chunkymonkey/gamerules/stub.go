@@ -27,6 +27,10 @@ type IPlayerShardClient interface {
 
 	ReqSubscribeChunk(chunkLoc ChunkXz, notify bool)
 
+	// ReqPrefetchChunks requests that the given chunks are loaded in the
+	// background, in anticipation of them being subscribed to.
+	ReqPrefetchChunks(chunkLocs []ChunkXz)
+
 	ReqUnsubscribeChunk(chunkLoc ChunkXz)
 
 	ReqMulticastPlayers(chunkLoc ChunkXz, exclude EntityId, packet []byte)
@@ -39,6 +43,15 @@ type IPlayerShardClient interface {
 
 	ReqSetPlayerLook(chunkLoc ChunkXz, look LookBytes)
 
+	// ReqCheckPlayerMove requests that the player's move between two positions
+	// be checked for passing through solid blocks. If it does, then the player
+	// is told to return to the latest position that they reached without doing
+	// so with RejectMove.
+	ReqCheckPlayerMove(from, to AbsXyz)
+
+	// ReqSetPlayerHeldItem sets the item that the player is seen to be holding.
+	ReqSetPlayerHeldItem(chunkLoc ChunkXz, held Slot)
+
 	// ReqHitBlock requests that the targetted block be hit.
 	ReqHitBlock(held Slot, target BlockXyz, digStatus DigStatus, face Face)
 
@@ -48,8 +61,9 @@ type IPlayerShardClient interface {
 	// ReqPlaceItem requests that the item passed be placed at the given target
 	// location. The shard *may* choose not to do this, but if it cannot, then it
 	// *must* account for the item in some way (maybe hand it back to the player
-	// or just drop it on the ground).
-	ReqPlaceItem(target BlockXyz, slot Slot)
+	// or just drop it on the ground). look is the direction that the player was
+	// facing, which decides which way some blocks are placed.
+	ReqPlaceItem(target BlockXyz, slot Slot, look LookDegrees)
 
 	// ReqTakeItem requests that the item with the specified entityId is given to
 	// the player. The chunk doesn't have to respect this (particularly if the
@@ -68,6 +82,15 @@ type IPlayerShardClient interface {
 	// ReqInventoryUnsubscribed requests that the inventory for the block be
 	// unsubscribed to.
 	ReqInventoryUnsubscribed(block BlockXyz)
+
+	// ReqUseEntity requests that the player use (or hit, if leftClick is true)
+	// the entity with the given entityId, which is in or next to the chunk at
+	// chunkLoc. For instance, using a minecart gets into or out of it.
+	ReqUseEntity(chunkLoc ChunkXz, entityId EntityId, leftClick bool)
+
+	// ReqSetSignText requests that the text on the sign at target be changed.
+	// The change is ignored if the text is not allowed on a sign.
+	ReqSetSignText(target BlockXyz, lines [4]string)
 }
 
 // IShardShardClient provides an interface for shards to make requests against
@@ -79,6 +102,10 @@ type IShardShardClient interface {
 	ReqSetActiveBlocks(blocks []BlockXyz)
 
 	ReqTransferEntity(loc ChunkXz, entity INonPlayerEntity)
+
+	// ReqExplode requests that an explosion of the given power occurs at
+	// center, destroying blocks and hurting players in the shard.
+	ReqExplode(center AbsXyz, power float32)
 }
 
 // IGame provide an interface for interacting with and taking action on the
@@ -99,6 +126,22 @@ type IGame interface {
 	// Return an ItemType from a numeric item. The boolean flag indicates
 	// whether or not 'id' was a valid item type.
 	ItemTypeById(id int) (ItemType, bool)
+
+	// Force the weather in the named world, or the world that players log in
+	// to if the name is empty. Returns false if there is no such world.
+	SetWeather(world string, weather Weather) bool
+
+	// Ask for a player to go to sleep in the bed at bedLoc. If it is night in
+	// their world and nobody else is asleep in the bed, the player is put to bed
+	// with IPlayerClient.EnterBed, otherwise they are told why not. The night is
+	// skipped in a world once all of the players in it are asleep.
+	RequestSleep(entityId EntityId, bedLoc BlockXyz)
+
+	// Record that a player is no longer asleep in a bed.
+	PlayerWokeUp(entityId EntityId)
+
+	// Update the ping shown for a player in the player list, in milliseconds.
+	SetPlayerPing(entityId EntityId, pingMs int16)
 }
 
 // IShardClient is the interface by which shards communicate to players on
@@ -161,8 +204,41 @@ type IPlayerClient interface {
 	// SetPositionLook changes the player's position and look
 	SetPositionLook(AbsXyz, LookDegrees)
 
+	// RejectMove informs the player that a move passed through solid blocks,
+	// and that they must return to the given position.
+	RejectMove(position AbsXyz)
+
 	// EchoMessage displays a message to the player
 	EchoMessage(msg string)
+
+	// ApplyDamage hurts the player by the given amount. cause describes how the
+	// damage was taken, e.g. "fell".
+	ApplyDamage(amount Health, cause string)
+
+	// UseBed requests that the player go to sleep in the bed at bedLoc.
+	UseBed(bedLoc BlockXyz)
+
+	// EnterBed puts the player to sleep in the bed at bedLoc, once the game
+	// has agreed that they may sleep in it.
+	EnterBed(bedLoc BlockXyz)
+
+	// WakeUp gets the player out of bed, if they are asleep in one.
+	WakeUp()
+
+	// MoveWithVehicle informs the player that the vehicle that they are riding
+	// has carried them to position. The client moves along with the vehicle by
+	// itself, so is not told about the move.
+	MoveWithVehicle(position AbsXyz)
+
+	// SetGameType changes the player's game mode.
+	SetGameType(gameType GameType)
+
+	// GiveExperience adds experience points to the player.
+	GiveExperience(amount int16)
+
+	// BlockBroken tells the player that the shard has broken the block that
+	// they dug at target, so that their held tool is worn.
+	BlockBroken(target BlockXyz)
 }
 
 type ICommandFramework interface {
@@ -9,12 +9,16 @@ import (
 	"nbt"
 	"perlin"
 	"rand"
-	"time"
 )
 
 const SeaLevel = 63
 
-// ChunkData implements chunkstore.IChunkReader.
+// terrainCacheSize is the number of chunks of bare terrain that a generator
+// keeps. Chunks tend to be generated next to each other, so each chunk's
+// terrain is used to populate several of its neighbours.
+const terrainCacheSize = 64
+
+// ChunkData implements chunkstore.IGeneratedChunkReader.
 type ChunkData struct {
 	loc        ChunkXz
 	blocks     []byte
@@ -35,6 +39,17 @@ func newChunkData(loc ChunkXz) *ChunkData {
 	}
 }
 
+// clone returns a copy of the chunk data.
+func (data *ChunkData) clone() *ChunkData {
+	clone := newChunkData(data.loc)
+	copy(clone.blocks, data.blocks)
+	copy(clone.blockData, data.blockData)
+	copy(clone.blockLight, data.blockLight)
+	copy(clone.skyLight, data.skyLight)
+	copy(clone.heightMap, data.heightMap)
+	return clone
+}
+
 func (data *ChunkData) ChunkLoc() ChunkXz {
 	return data.loc
 }
@@ -71,22 +86,33 @@ func (data *ChunkData) RootTag() nbt.ITag {
 	return nil
 }
 
-// TestGenerator implements chunkstore.IChunkStore.
-type TestGenerator struct {
+func (data *ChunkData) IsGenerated() bool {
+	return true
+}
+
+// PerlinChunkGenerator implements chunkstore.IChunkStore. It generates
+// terrain from layered Perlin noise. Generation depends only on the seed and
+// the chunk location, so generators with the same seed produce identical
+// chunks, in any order.
+type PerlinChunkGenerator struct {
+	seed         int64
 	heightSource ISource
-	randSource   rand.Source
-	randGen      *rand.Rand
+	populators   []IPopulator
+
+	// Recently generated bare terrain, which must not be modified. The
+	// oldest entry in terrainOrder is replaced once the cache is full.
+	terrain      map[ChunkXz]*ChunkData
+	terrainOrder []ChunkXz
+	terrainNext  int
 }
 
-func NewTestGenerator(seed int64) *TestGenerator {
+func NewPerlinChunkGenerator(seed int64) *PerlinChunkGenerator {
 	perlin := perlin.NewPerlinNoise(seed)
 
-	randSource := rand.NewSource(time.Nanoseconds())
-	randGen := rand.New(randSource)
-
-	return &TestGenerator{
-		randSource: randSource,
-		randGen:    randGen,
+	return &PerlinChunkGenerator{
+		seed:       seed,
+		populators: defaultPopulators,
+		terrain:    make(map[ChunkXz]*ChunkData),
 		heightSource: &Sum{
 			Inputs: []ISource{
 				&Turbulence{
@@ -127,19 +153,53 @@ func NewTestGenerator(seed int64) *TestGenerator {
 	}
 }
 
-func (s *TestGenerator) SupportsWrite() bool {
+func (s *PerlinChunkGenerator) SupportsWrite() bool {
 	return false
 }
 
-func (s *TestGenerator) Writer() chunkstore.IChunkWriter {
+func (s *PerlinChunkGenerator) Writer() chunkstore.IChunkWriter {
 	return nil
 }
 
-func (s *TestGenerator) WriteChunk(writer chunkstore.IChunkWriter) os.Error {
-	return os.NewError("writes not supported by TestGenerator")
+func (s *PerlinChunkGenerator) WriteChunk(writer chunkstore.IChunkWriter) os.Error {
+	return os.NewError("writes not supported by PerlinChunkGenerator")
+}
+
+func (gen *PerlinChunkGenerator) ReadChunk(chunkLoc ChunkXz) (reader chunkstore.IChunkReader, err os.Error) {
+	data := gen.cachedTerrain(chunkLoc).clone()
+
+	// The terrain has been generated, now add trees, ores etc.
+	gen.populate(data)
+	gen.setHeightMap(data)
+	gen.setSkylight(data)
+
+	return data, nil
+}
+
+// cachedTerrain returns the bare terrain of the chunk at chunkLoc, generating
+// it if it isn't cached. The terrain returned must not be modified.
+func (gen *PerlinChunkGenerator) cachedTerrain(chunkLoc ChunkXz) *ChunkData {
+	if data, ok := gen.terrain[chunkLoc]; ok {
+		return data
+	}
+
+	data := gen.generateTerrain(chunkLoc)
+
+	if len(gen.terrainOrder) < terrainCacheSize {
+		gen.terrainOrder = append(gen.terrainOrder, chunkLoc)
+	} else {
+		gen.terrain[gen.terrainOrder[gen.terrainNext]] = nil, false
+		gen.terrainOrder[gen.terrainNext] = chunkLoc
+		gen.terrainNext = (gen.terrainNext + 1) % terrainCacheSize
+	}
+	gen.terrain[chunkLoc] = data
+
+	return data
 }
 
-func (gen *TestGenerator) ReadChunk(chunkLoc ChunkXz) (reader chunkstore.IChunkReader, err os.Error) {
+// generateTerrain generates the bare terrain of the chunk at chunkLoc, before
+// it is populated.
+func (gen *PerlinChunkGenerator) generateTerrain(chunkLoc ChunkXz) *ChunkData {
 	baseBlockXyz := chunkLoc.ChunkCornerBlockXY()
 
 	baseX, baseZ := baseBlockXyz.X, baseBlockXyz.Z
@@ -170,14 +230,41 @@ func (gen *TestGenerator) ReadChunk(chunkLoc ChunkXz) (reader chunkstore.IChunkR
 		}
 	}
 
-	// The chunk has been generated, now add some trees if appropriate
-	gen.addSaplings(data)
-	gen.setSkylight(data)
+	return data
+}
 
-	return data, nil
+// populate adds the features of the chunk, and the parts of its neighbours'
+// features that extend into it. A chunk is only populated once the terrain of
+// its neighbours exists, so the neighbours' terrain is generated here as
+// needed, or taken from the cache. This keeps features whole at chunk
+// borders, whichever order the chunks are generated in.
+func (gen *PerlinChunkGenerator) populate(data *ChunkData) {
+	chunks := map[ChunkXz]*ChunkData{data.loc: data}
+
+	for dx := ChunkCoord(-1); dx <= 1; dx++ {
+		for dz := ChunkCoord(-1); dz <= 1; dz++ {
+			loc := ChunkXz{data.loc.X + dx, data.loc.Z + dz}
+
+			region := &Region{
+				loc:     loc,
+				terrain: gen.cachedTerrain(loc),
+				chunks:  chunks,
+			}
+			rnd := rand.New(rand.NewSource(gen.chunkSeed(loc)))
+			for _, populator := range gen.populators {
+				populator.Populate(region, rnd)
+			}
+		}
+	}
 }
 
-func (gen *TestGenerator) setBlockStack(height int, blocks []byte) (skyLightHeight int) {
+// chunkSeed returns the seed for the random choices made while populating
+// the chunk at chunkLoc.
+func (gen *PerlinChunkGenerator) chunkSeed(chunkLoc ChunkXz) int64 {
+	return gen.seed ^ int64(chunkLoc.X)*341873128712 ^ int64(chunkLoc.Z)*132897987541
+}
+
+func (gen *PerlinChunkGenerator) setBlockStack(height int, blocks []byte) (skyLightHeight int) {
 	var topBlockType byte
 	if height < SeaLevel+1 {
 		skyLightHeight = SeaLevel + 1
@@ -204,6 +291,7 @@ func (gen *TestGenerator) setBlockStack(height int, blocks []byte) (skyLightHeig
 	for y := height - 3; y > 0; y-- {
 		blocks[y] = 1 // stone
 	}
+	blocks[0] = 7 // bedrock
 
 	if skyLightHeight < 0 {
 		skyLightHeight = 0
@@ -212,13 +300,17 @@ func (gen *TestGenerator) setBlockStack(height int, blocks []byte) (skyLightHeig
 	return
 }
 
-func (gen *TestGenerator) setSkyLightStack(skyLightHeight int, blocks []byte, skyLight []byte) {
+func (gen *PerlinChunkGenerator) setSkyLightStack(skyLightHeight int, blocks []byte, skyLight []byte) {
 	for y := ChunkSizeY - 1; y >= skyLightHeight; y-- {
 		BlockIndex(y).SetBlockData(skyLight, 15)
 	}
 
 	var lightLevel int8 = 15
 
+	if skyLightHeight >= ChunkSizeY {
+		// Blocks reach the top of the chunk.
+		skyLightHeight = ChunkSizeY - 1
+	}
 	for y := skyLightHeight; y >= 0 && lightLevel > 0; y-- {
 		blockType, ok := gamerules.Blocks.Get(BlockId(blocks[y]))
 		if lightLevel > 0 && ok && blockType.Opacity > 0 {
@@ -229,76 +321,35 @@ func (gen *TestGenerator) setSkyLightStack(skyLightHeight int, blocks []byte, sk
 	}
 }
 
-func (gen *TestGenerator) setSkylight(data *ChunkData) {
+// setHeightMap sets the height map from the highest non-air block in each
+// column of the chunk.
+func (gen *PerlinChunkGenerator) setHeightMap(data *ChunkData) {
 	baseIndex := 0
-	heightMapIndex := 0
-
-	for x := 0; x < ChunkSizeH; x++ {
-		for z := 0; z < ChunkSizeH; z++ {
-			lightBase := baseIndex >> 1
-
-			gen.setSkyLightStack(
-				int(data.heightMap[heightMapIndex]),
-				data.blocks[baseIndex:baseIndex+ChunkSizeY],
-				data.skyLight[lightBase:lightBase+ChunkSizeY/2])
-			heightMapIndex++
-			baseIndex += ChunkSizeY
+	for heightMapIndex := range data.heightMap {
+		height := ChunkSizeY
+		for height > 0 && data.blocks[baseIndex+height-1] == 0 {
+			height--
 		}
+		data.heightMap[heightMapIndex] = byte(height)
+		baseIndex += ChunkSizeY
 	}
-
 }
 
-func (gen *TestGenerator) addSaplings(data *ChunkData) {
+func (gen *PerlinChunkGenerator) setSkylight(data *ChunkData) {
 	baseIndex := 0
 	heightMapIndex := 0
 
-	// Move throughout the chunk, but refuse to create trees on chunk
-	// boundaries.
 	for x := 0; x < ChunkSizeH; x++ {
 		for z := 0; z < ChunkSizeH; z++ {
-			topBlock := int(data.heightMap[heightMapIndex] - 1)
-			blockIndex := baseIndex + int(topBlock)
-
-			if data.blocks[blockIndex] == 2 {
-				// We could add a tree, check to see if we want to
-				addTree := gen.randGen.Intn(100) > 95
-				if addTree && x > 0 && x < ChunkSizeH-1 && z > 0 && z < ChunkSizeH-1 {
-					if !adjacentBlockIs(data, x, topBlock, z, 2, 2, 2, 6) {
-						// Check if an adjacent block has a sapling already
-						data.blocks[blockIndex+1] = 6
-					}
-				}
-			}
+			lightBase := baseIndex >> 1
 
+			gen.setSkyLightStack(
+				int(data.heightMap[heightMapIndex]),
+				data.blocks[baseIndex:baseIndex+ChunkSizeY],
+				data.skyLight[lightBase:lightBase+ChunkSizeY/2])
 			heightMapIndex++
 			baseIndex += ChunkSizeY
 		}
 	}
-}
 
-// adjacentBlockIs return whether or not at least one block adjacent to
-// (bx,by,bz) is of type 'blockType'. The area which this function checks is
-// specified by dx,dy,dz. Blocks outside the given chunk are not checked.
-func adjacentBlockIs(data *ChunkData, bx, by, bz, dx, dy, dz int, blockType byte) bool {
-	subChunk := new(SubChunkXyz)
-
-	for x := bx - dx; x <= bx+dx; x++ {
-		for z := bz - dz; z <= bz+dz; z++ {
-			for y := by - dy; y <= by+dy; y++ {
-				if x != bx || y != by || z != bz {
-					subChunk.X = SubChunkCoord(x)
-					subChunk.Y = SubChunkCoord(y)
-					subChunk.Z = SubChunkCoord(z)
-					index, ok := subChunk.BlockIndex()
-					if ok {
-						if data.blocks[index] == blockType {
-							return true
-						}
-					}
-				}
-			}
-		}
-	}
-
-	return false
 }
@@ -1,13 +1,15 @@
 package generation
 
 import (
+	"bytes"
 	"testing"
 
+	"chunkymonkey/chunkstore"
 	. "chunkymonkey/types"
 )
 
-func Benchmark_TestGenerator_generate(b *testing.B) {
-	gen := NewTestGenerator(0)
+func Benchmark_PerlinChunkGenerator_generate(b *testing.B) {
+	gen := NewPerlinChunkGenerator(0)
 	var loc ChunkXz
 
 	b.ResetTimer()
@@ -19,3 +21,144 @@ func Benchmark_TestGenerator_generate(b *testing.B) {
 		gen.ReadChunk(loc)
 	}
 }
+
+func Test_PerlinChunkGenerator_ReadChunk(t *testing.T) {
+	gen := NewPerlinChunkGenerator(0)
+	loc := ChunkXz{3, -2}
+
+	reader, err := gen.ReadChunk(loc)
+	if err != nil {
+		t.Fatalf("ReadChunk(%#v) returned error: %v", loc, err)
+	}
+
+	if chunkLoc := reader.ChunkLoc(); !chunkLoc.Equals(loc) {
+		t.Errorf("Expected chunk at %#v but got %#v", loc, chunkLoc)
+	}
+
+	generated, ok := reader.(chunkstore.IGeneratedChunkReader)
+	if !ok || !generated.IsGenerated() {
+		t.Errorf("Expected generated chunk to report IsGenerated() == true")
+	}
+}
+
+// readChunkData generates the chunk at loc.
+func readChunkData(t *testing.T, gen *PerlinChunkGenerator, loc ChunkXz) *ChunkData {
+	reader, err := gen.ReadChunk(loc)
+	if err != nil {
+		t.Fatalf("ReadChunk(%#v) returned error: %v", loc, err)
+	}
+	return reader.(*ChunkData)
+}
+
+// sameChunkData returns true if the two chunks have identical contents.
+func sameChunkData(a, b *ChunkData) bool {
+	return bytes.Equal(a.blocks, b.blocks) &&
+		bytes.Equal(a.blockData, b.blockData) &&
+		bytes.Equal(a.skyLight, b.skyLight) &&
+		bytes.Equal(a.blockLight, b.blockLight) &&
+		bytes.Equal(a.heightMap, b.heightMap)
+}
+
+var testChunkLocs = []ChunkXz{
+	{0, 0},
+	{3, -2},
+	{-7, -7},
+	{100, 40},
+	{-1000, 12},
+}
+
+func Test_PerlinChunkGenerator_Deterministic(t *testing.T) {
+	genA := NewPerlinChunkGenerator(1234)
+	genB := NewPerlinChunkGenerator(1234)
+
+	// Generate the chunks in opposite orders, as the result must not depend on
+	// what was generated before.
+	chunksA := make([]*ChunkData, len(testChunkLocs))
+	for i, loc := range testChunkLocs {
+		chunksA[i] = readChunkData(t, genA, loc)
+	}
+	for i := len(testChunkLocs) - 1; i >= 0; i-- {
+		loc := testChunkLocs[i]
+		if chunkB := readChunkData(t, genB, loc); !sameChunkData(chunksA[i], chunkB) {
+			t.Errorf("Chunk %#v differs between generators with the same seed", loc)
+		}
+	}
+}
+
+func Test_PerlinChunkGenerator_SeedsDiffer(t *testing.T) {
+	genA := NewPerlinChunkGenerator(1234)
+	genB := NewPerlinChunkGenerator(5678)
+
+	numSame := 0
+	for _, loc := range testChunkLocs {
+		if sameChunkData(readChunkData(t, genA, loc), readChunkData(t, genB, loc)) {
+			numSame++
+		}
+	}
+	if numSame == len(testChunkLocs) {
+		t.Errorf("Expected generators with different seeds to produce different chunks")
+	}
+}
+
+func Test_PerlinChunkGenerator_Layers(t *testing.T) {
+	gen := NewPerlinChunkGenerator(1234)
+
+	for _, loc := range testChunkLocs {
+		data := gen.generateTerrain(loc)
+
+		baseIndex := 0
+		for i, height := range data.heightMap {
+			stack := data.blocks[baseIndex : baseIndex+ChunkSizeY]
+			baseIndex += ChunkSizeY
+
+			if stack[0] != 7 {
+				t.Errorf("Chunk %#v column %d: expected bedrock at y=0, got block %d", loc, i, stack[0])
+			}
+			if ground := int(height) - 1; ground > SeaLevel+1 {
+				if stack[ground] != 2 || stack[ground-1] != 3 || stack[ground-3] != 1 {
+					t.Errorf("Chunk %#v column %d: expected grass over dirt over stone, got blocks %v", loc, i, stack[ground-3:ground+1])
+				}
+			}
+			for y := int(height); y < ChunkSizeY; y++ {
+				if stack[y] != 0 && stack[y] != 9 {
+					t.Errorf("Chunk %#v column %d: expected only air or water above the ground at y=%d, got block %d", loc, i, y, stack[y])
+					break
+				}
+			}
+		}
+	}
+}
+
+func Test_PerlinChunkGenerator_cachedTerrain(t *testing.T) {
+	gen := NewPerlinChunkGenerator(1234)
+
+	// Generating a chunk generates the terrain of it and its neighbours once.
+	readChunkData(t, gen, ChunkXz{0, 0})
+	if len(gen.terrain) != 9 {
+		t.Errorf("Expected terrain of 9 chunks to be cached, got %d", len(gen.terrain))
+	}
+	cached := gen.terrain[ChunkXz{1, 0}]
+
+	// The neighbour reuses the cached terrain rather than generating it again.
+	readChunkData(t, gen, ChunkXz{1, 0})
+	if gen.terrain[ChunkXz{1, 0}] != cached {
+		t.Errorf("Expected the cached terrain to be reused")
+	}
+	if len(gen.terrain) != 12 {
+		t.Errorf("Expected terrain of 12 chunks to be cached, got %d", len(gen.terrain))
+	}
+	if !sameChunkData(cached, gen.generateTerrain(ChunkXz{1, 0})) {
+		t.Errorf("Expected the cached terrain not to be changed by population")
+	}
+
+	// The cache doesn't grow past its size.
+	for x := ChunkCoord(0); x < terrainCacheSize; x++ {
+		gen.cachedTerrain(ChunkXz{x, 100})
+	}
+	if len(gen.terrain) != terrainCacheSize {
+		t.Errorf("Expected %d chunks of terrain cached, got %d", terrainCacheSize, len(gen.terrain))
+	}
+	if _, ok := gen.terrain[ChunkXz{0, 0}]; ok {
+		t.Errorf("Expected the oldest terrain to be dropped from the cache")
+	}
+}
@@ -0,0 +1,201 @@
+package generation
+
+import (
+	"rand"
+
+	. "chunkymonkey/types"
+)
+
+// IPopulator adds features, such as trees and ore veins, to generated
+// terrain.
+type IPopulator interface {
+	// Populate adds the features of the chunk at the centre of the region. The
+	// features may extend into the neighbouring chunks. All random choices
+	// must come from rnd, and depend only on the region's terrain, so that
+	// a chunk's features are the same each time it is populated.
+	Populate(region *Region, rnd *rand.Rand)
+}
+
+var defaultPopulators = []IPopulator{
+	&OrePopulator{BlockId: 16, Veins: 20, Size: 12, MaxY: 128}, // coal
+	&OrePopulator{BlockId: 15, Veins: 20, Size: 8, MaxY: 64},   // iron
+	&OrePopulator{BlockId: 14, Veins: 2, Size: 8, MaxY: 32},    // gold
+	&OrePopulator{BlockId: 73, Veins: 8, Size: 7, MaxY: 16},    // redstone
+	&OrePopulator{BlockId: 56, Veins: 1, Size: 7, MaxY: 16},    // diamond
+	&OrePopulator{BlockId: 21, Veins: 1, Size: 6, MaxY: 32},    // lapis lazuli
+	&PoolPopulator{Chance: 8},
+	&TreePopulator{MaxTrees: 3},
+}
+
+// Region is the part of the world that a populator may change: a chunk and
+// its eight neighbours. Block coordinates are relative to the corner of the
+// centre chunk, so run from -ChunkSizeH to 2*ChunkSizeH-1 horizontally.
+type Region struct {
+	loc ChunkXz
+	// The terrain of the centre chunk, before any population.
+	terrain *ChunkData
+	// The chunks that blocks may be set in. Blocks in other chunks are left
+	// alone, as they are set when those chunks are generated.
+	chunks map[ChunkXz]*ChunkData
+}
+
+// Surface returns the height and type of the highest block of the centre
+// chunk's terrain at (x, z).
+func (region *Region) Surface(x, z int) (y int, blockId byte) {
+	index := x<<ChunkHShift + z
+	y = int(region.terrain.heightMap[index]) - 1
+	if y < 0 {
+		return 0, 0
+	}
+	return y, region.terrain.blocks[index<<ChunkYShift+y]
+}
+
+// BlockAt returns the type of the block at (x, y, z). ok is false if the block
+// is outside of the chunks that may be changed.
+func (region *Region) BlockAt(x, y, z int) (blockId byte, ok bool) {
+	data, index, ok := region.blockIndex(x, y, z)
+	if !ok {
+		return 0, false
+	}
+	return data.blocks[index], true
+}
+
+// SetBlockAt sets the type of the block at (x, y, z), if it is inside the
+// chunks that may be changed.
+func (region *Region) SetBlockAt(x, y, z int, blockId byte) {
+	if data, index, ok := region.blockIndex(x, y, z); ok {
+		data.blocks[index] = blockId
+	}
+}
+
+func (region *Region) blockIndex(x, y, z int) (data *ChunkData, index BlockIndex, ok bool) {
+	if y < 0 || y >= ChunkSizeY {
+		return
+	}
+
+	// Shifting rounds down, so negative coordinates are in the chunk before.
+	dx, dz := x>>ChunkHShift, z>>ChunkHShift
+	if dx < -1 || dx > 1 || dz < -1 || dz > 1 {
+		return
+	}
+
+	data, ok = region.chunks[ChunkXz{region.loc.X + ChunkCoord(dx), region.loc.Z + ChunkCoord(dz)}]
+	if !ok {
+		return
+	}
+
+	subLoc := SubChunkXyz{
+		SubChunkCoord(x & ChunkHMask),
+		SubChunkCoord(y),
+		SubChunkCoord(z & ChunkHMask),
+	}
+	index, ok = subLoc.BlockIndex()
+	return
+}
+
+// TreePopulator grows up to MaxTrees trees on the grass in each chunk.
+type TreePopulator struct {
+	MaxTrees int
+}
+
+func (pop *TreePopulator) Populate(region *Region, rnd *rand.Rand) {
+	numTrees := rnd.Intn(pop.MaxTrees + 1)
+	for i := 0; i < numTrees; i++ {
+		x, z := rnd.Intn(ChunkSizeH), rnd.Intn(ChunkSizeH)
+		height := 4 + rnd.Intn(3)
+
+		if y, blockId := region.Surface(x, z); blockId == 2 { // grass
+			placeTree(region, x, y+1, z, height)
+		}
+	}
+}
+
+// placeTree places a tree whose trunk starts at (x, y, z). Its leaves reach up
+// to two blocks out from the trunk.
+func placeTree(region *Region, x, y, z, height int) {
+	top := y + height - 1
+
+	for ly := top - 2; ly <= top+1; ly++ {
+		radius := 2
+		if ly >= top {
+			radius = 1
+		}
+		for dx := -radius; dx <= radius; dx++ {
+			for dz := -radius; dz <= radius; dz++ {
+				if ly == top+1 && dx != 0 && dz != 0 {
+					// Round off the corners of the top layer.
+					continue
+				}
+				if blockId, ok := region.BlockAt(x+dx, ly, z+dz); ok && blockId == 0 {
+					region.SetBlockAt(x+dx, ly, z+dz, 18) // leaves
+				}
+			}
+		}
+	}
+
+	for ty := y; ty <= top; ty++ {
+		if blockId, ok := region.BlockAt(x, ty, z); ok && (blockId == 0 || blockId == 18) {
+			region.SetBlockAt(x, ty, z, 17) // log
+		}
+	}
+}
+
+// OrePopulator places Veins veins of the ore in the stone of each chunk. Each
+// vein wanders for Size blocks from a start below MaxY.
+type OrePopulator struct {
+	BlockId byte
+	Veins   int
+	Size    int
+	MaxY    int
+}
+
+func (pop *OrePopulator) Populate(region *Region, rnd *rand.Rand) {
+	for i := 0; i < pop.Veins; i++ {
+		x, y, z := rnd.Intn(ChunkSizeH), 1+rnd.Intn(pop.MaxY-1), rnd.Intn(ChunkSizeH)
+
+		for j := 0; j < pop.Size; j++ {
+			if blockId, ok := region.BlockAt(x, y, z); ok && blockId == 1 { // stone
+				region.SetBlockAt(x, y, z, pop.BlockId)
+			}
+			x += rnd.Intn(3) - 1
+			y += rnd.Intn(3) - 1
+			z += rnd.Intn(3) - 1
+		}
+	}
+}
+
+// PoolPopulator sinks a pool of water into the grass of one in Chance
+// chunks.
+type PoolPopulator struct {
+	Chance int
+}
+
+func (pop *PoolPopulator) Populate(region *Region, rnd *rand.Rand) {
+	if rnd.Intn(pop.Chance) != 0 {
+		return
+	}
+
+	x, z := rnd.Intn(ChunkSizeH), rnd.Intn(ChunkSizeH)
+	radius := 2 + rnd.Intn(2)
+
+	y, blockId := region.Surface(x, z)
+	if blockId != 2 { // grass
+		return
+	}
+
+	for dx := -radius; dx <= radius; dx++ {
+		for dz := -radius; dz <= radius; dz++ {
+			if dx*dx+dz*dz > radius*radius {
+				continue
+			}
+			// The pool is level with the ground at its centre. Columns where
+			// the ground is higher or lower are left alone.
+			if above, ok := region.BlockAt(x+dx, y+1, z+dz); !ok || above != 0 {
+				continue
+			}
+			if ground, ok := region.BlockAt(x+dx, y, z+dz); ok && (ground == 2 || ground == 3) {
+				region.SetBlockAt(x+dx, y, z+dz, 9) // stationary water
+			}
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package generation
+
+import (
+	"bytes"
+	"rand"
+	"testing"
+
+	. "chunkymonkey/types"
+)
+
+// blockAt returns the block at the given position within the chunk.
+func blockAt(data *ChunkData, x, y, z int) byte {
+	subLoc := SubChunkXyz{SubChunkCoord(x), SubChunkCoord(y), SubChunkCoord(z)}
+	index, _ := subLoc.BlockIndex()
+	return data.blocks[index]
+}
+
+func Test_placeTree_OverhangsIntoNeighbour(t *testing.T) {
+	loc := ChunkXz{0, 0}
+	eastLoc := ChunkXz{1, 0}
+
+	data := newChunkData(loc)
+	east := newChunkData(eastLoc)
+	region := &Region{
+		loc:    loc,
+		chunks: map[ChunkXz]*ChunkData{loc: data, eastLoc: east},
+	}
+
+	// A tree at the eastern edge of the chunk, with its trunk from y=64 to 68.
+	placeTree(region, 15, 64, 8, 5)
+
+	for y := 64; y <= 68; y++ {
+		if blockId := blockAt(data, 15, y, 8); blockId != 17 {
+			t.Errorf("Expected log at (15, %d, 8), got block %d", y, blockId)
+		}
+	}
+	for _, x := range []int{0, 1} {
+		if blockId := blockAt(east, x, 66, 8); blockId != 18 {
+			t.Errorf("Expected leaves at (%d, 66, 8) in the neighbouring chunk, got block %d", x, blockId)
+		}
+	}
+	if blockId := blockAt(east, 2, 66, 8); blockId != 0 {
+		t.Errorf("Expected leaves to reach no further than 2 blocks from the trunk, got block %d", blockId)
+	}
+
+	// The same tree placed while generating only the neighbouring chunk gives
+	// it the same leaves.
+	eastOnly := newChunkData(eastLoc)
+	region.chunks = map[ChunkXz]*ChunkData{eastLoc: eastOnly}
+	placeTree(region, 15, 64, 8, 5)
+	if !bytes.Equal(east.blocks, eastOnly.blocks) {
+		t.Errorf("Expected the neighbouring chunk to get the same leaves when generated alone")
+	}
+}
+
+// edgeTreePopulator places a tree at the same place at the eastern edge of
+// every chunk.
+type edgeTreePopulator struct{}
+
+func (pop *edgeTreePopulator) Populate(region *Region, rnd *rand.Rand) {
+	y, _ := region.Surface(15, 8)
+	placeTree(region, 15, y+1, 8, 5)
+}
+
+func Test_PerlinChunkGenerator_PopulatesAcrossBorders(t *testing.T) {
+	gen := NewPerlinChunkGenerator(1234)
+	gen.populators = []IPopulator{&edgeTreePopulator{}}
+
+	numChecked := 0
+	for _, loc := range testChunkLocs {
+		westLoc := ChunkXz{loc.X - 1, loc.Z}
+		west := readChunkData(t, gen, westLoc)
+
+		// Find the top of the tree in the western neighbour.
+		top := -1
+		for y := 0; y < ChunkSizeY; y++ {
+			if blockAt(west, 15, y, 8) == 17 {
+				top = y
+			}
+		}
+		if top < 2 {
+			continue
+		}
+
+		terrain := gen.generateTerrain(loc)
+		if blockAt(terrain, 0, top-2, 8) != 0 {
+			// The leaves are in the ground.
+			continue
+		}
+
+		data := readChunkData(t, gen, loc)
+		if blockId := blockAt(data, 0, top-2, 8); blockId != 18 {
+			t.Errorf("Chunk %#v: expected leaves at (0, %d, 8) from the tree in chunk %#v, got block %d", loc, top-2, westLoc, blockId)
+		}
+		numChecked++
+	}
+
+	if numChecked == 0 {
+		t.Errorf("Expected some trees to overhang their chunk")
+	}
+}
+
+func Test_PerlinChunkGenerator_PopulationDeterministic(t *testing.T) {
+	loc := ChunkXz{3, -2}
+
+	populate := func(seed int64) *ChunkData {
+		gen := NewPerlinChunkGenerator(seed)
+		data := gen.generateTerrain(loc)
+		gen.populate(data)
+		return data
+	}
+
+	terrain := NewPerlinChunkGenerator(1234).generateTerrain(loc)
+	first := populate(1234)
+
+	if bytes.Equal(terrain.blocks, first.blocks) {
+		t.Errorf("Expected population to add features to the terrain")
+	}
+	if second := populate(1234); !bytes.Equal(first.blocks, second.blocks) {
+		t.Errorf("Expected population with the same seed to add the same features")
+	}
+}
@@ -0,0 +1,94 @@
+// Package logging provides leveled logging, so that the chatty messages about
+// individual packets can be silenced while warnings and errors are still
+// logged.
+package logging
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// Level is the importance of a log message.
+type Level int
+
+const (
+	// LevelDebug is for tracing what happens to individual packets and
+	// requests, such as ignored player movements.
+	LevelDebug = Level(iota)
+	// LevelInfo is for noteworthy events, such as players connecting.
+	LevelInfo
+	// LevelWarn is for things that are wrong, but that the server recovers
+	// from.
+	LevelWarn
+	// LevelError is for failures that lose data or service, such as a chunk
+	// failing to load.
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (level Level) String() string {
+	if level < 0 || int(level) >= len(levelNames) {
+		return fmt.Sprintf("Level(%d)", int(level))
+	}
+	return levelNames[level]
+}
+
+// ParseLevel returns the Level with the given name, such as "debug" or "warn".
+func ParseLevel(name string) (level Level, err os.Error) {
+	name = strings.ToLower(name)
+	for i, levelName := range levelNames {
+		if name == levelName {
+			return Level(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q", name)
+}
+
+// Logger is implemented by things that log messages at different levels. The
+// arguments are formatted in the manner of fmt.Printf.
+type Logger interface {
+	Debug(format string, v ...interface{})
+	Info(format string, v ...interface{})
+	Warn(format string, v ...interface{})
+	Error(format string, v ...interface{})
+}
+
+// Default is the Logger used by things that were not given one. It logs
+// messages at LevelInfo and above.
+var Default Logger = New(LevelInfo)
+
+// New returns a Logger that writes messages at or above the given level using
+// the standard log package.
+func New(level Level) Logger {
+	return &stdLogger{level}
+}
+
+type stdLogger struct {
+	level Level
+}
+
+func (l *stdLogger) logf(level Level, format string, v []interface{}) {
+	if level < l.level {
+		return
+	}
+	log.Printf("[%s] %s", level, fmt.Sprintf(format, v...))
+}
+
+func (l *stdLogger) Debug(format string, v ...interface{}) {
+	l.logf(LevelDebug, format, v)
+}
+
+func (l *stdLogger) Info(format string, v ...interface{}) {
+	l.logf(LevelInfo, format, v)
+}
+
+func (l *stdLogger) Warn(format string, v ...interface{}) {
+	l.logf(LevelWarn, format, v)
+}
+
+func (l *stdLogger) Error(format string, v ...interface{}) {
+	l.logf(LevelError, format, v)
+}
@@ -0,0 +1,39 @@
+package logging
+
+import (
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	type Test struct {
+		name     string
+		expected Level
+		ok       bool
+	}
+
+	tests := []Test{
+		{"debug", LevelDebug, true},
+		{"info", LevelInfo, true},
+		{"WARN", LevelWarn, true},
+		{"error", LevelError, true},
+		{"verbose", 0, false},
+		{"", 0, false},
+	}
+
+	for _, r := range tests {
+		level, err := ParseLevel(r.name)
+		if ok := err == nil; ok != r.ok {
+			t.Errorf("ParseLevel(%q): expected ok=%t, got error %v", r.name, r.ok, err)
+		} else if ok && level != r.expected {
+			t.Errorf("ParseLevel(%q): expected %v, got %v", r.name, r.expected, level)
+		}
+	}
+}
+
+func TestLevel_String(t *testing.T) {
+	for level := LevelDebug; level <= LevelError; level++ {
+		if parsed, err := ParseLevel(level.String()); err != nil || parsed != level {
+			t.Errorf("level %d named %q, which parses to %v, %v", int(level), level, parsed, err)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package logging
+
+import (
+	"fmt"
+)
+
+// Entry is a message kept by a Recorder.
+type Entry struct {
+	Level   Level
+	Message string
+}
+
+// Recorder is a Logger that keeps the messages logged to it, for tests to
+// inspect.
+type Recorder struct {
+	Entries []Entry
+}
+
+func (r *Recorder) record(level Level, format string, v []interface{}) {
+	r.Entries = append(r.Entries, Entry{level, fmt.Sprintf(format, v...)})
+}
+
+func (r *Recorder) Debug(format string, v ...interface{}) {
+	r.record(LevelDebug, format, v)
+}
+
+func (r *Recorder) Info(format string, v ...interface{}) {
+	r.record(LevelInfo, format, v)
+}
+
+func (r *Recorder) Warn(format string, v ...interface{}) {
+	r.record(LevelWarn, format, v)
+}
+
+func (r *Recorder) Error(format string, v ...interface{}) {
+	r.record(LevelError, format, v)
+}
+
+// Levels returns the level of each message recorded.
+func (r *Recorder) Levels() (levels []Level) {
+	levels = make([]Level, len(r.Entries))
+	for i := range r.Entries {
+		levels[i] = r.Entries[i].Level
+	}
+	return
+}
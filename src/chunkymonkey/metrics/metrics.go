@@ -0,0 +1,162 @@
+// Package metrics counts what the server is doing, so that operators can see
+// how busy it is. Counters are updated atomically, so that they can be
+// updated from any goroutine without serializing the code that updates them.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// Server holds the metrics for the running server.
+var Server = new(Metrics)
+
+// Metrics holds counters of packets, chunks and players. The zero value is
+// ready to use.
+type Metrics struct {
+	packetsReceived [256]int64 // By packet ID.
+	packetsSent     [256]int64 // By packet ID.
+
+	chunksLoaded    int64
+	chunksUnloaded  int64
+	chunksGenerated int64
+
+	activePlayers int64
+
+	// The measured tick rate is only updated once a second, so it is simply
+	// kept under a lock.
+	tpsLock sync.Mutex
+	tps     float64
+}
+
+// Snapshot holds the values of a Metrics at one moment.
+type Snapshot struct {
+	PacketsReceived map[byte]int64 // By packet ID. IDs not seen are omitted.
+	PacketsSent     map[byte]int64 // By packet ID. IDs not seen are omitted.
+	ChunksLoaded    int64
+	ChunksUnloaded  int64
+	ChunksGenerated int64
+	ActivePlayers   int64
+	TicksPerSecond  float64
+}
+
+// load reads a counter. Adding zero is used as an atomic read.
+func load(counter *int64) int64 {
+	return atomic.AddInt64(counter, 0)
+}
+
+// PacketReceived counts a packet received from a client.
+func (m *Metrics) PacketReceived(packetId byte) {
+	atomic.AddInt64(&m.packetsReceived[packetId], 1)
+}
+
+// PacketSent counts a packet sent to a client. Packets that are queued
+// together to be sent in one piece are counted once, by the ID of the first
+// of them.
+func (m *Metrics) PacketSent(packetId byte) {
+	atomic.AddInt64(&m.packetsSent[packetId], 1)
+}
+
+// ChunkLoaded counts a chunk being loaded into a shard. Chunks that were
+// generated rather than read from the store are also counted as generated.
+func (m *Metrics) ChunkLoaded(generated bool) {
+	atomic.AddInt64(&m.chunksLoaded, 1)
+	if generated {
+		atomic.AddInt64(&m.chunksGenerated, 1)
+	}
+}
+
+// ChunkUnloaded counts a chunk being unloaded from a shard.
+func (m *Metrics) ChunkUnloaded() {
+	atomic.AddInt64(&m.chunksUnloaded, 1)
+}
+
+// PlayerConnected counts a player as active until PlayerDisconnected is
+// called for them.
+func (m *Metrics) PlayerConnected() {
+	atomic.AddInt64(&m.activePlayers, 1)
+}
+
+func (m *Metrics) PlayerDisconnected() {
+	atomic.AddInt64(&m.activePlayers, -1)
+}
+
+// SetTicksPerSecond records the tick rate that the game was last measured to
+// run at.
+func (m *Metrics) SetTicksPerSecond(tps float64) {
+	m.tpsLock.Lock()
+	defer m.tpsLock.Unlock()
+	m.tps = tps
+}
+
+// Snapshot returns the current values of the metrics.
+func (m *Metrics) Snapshot() (s Snapshot) {
+	s.PacketsReceived = make(map[byte]int64)
+	s.PacketsSent = make(map[byte]int64)
+	for i := range m.packetsReceived {
+		if count := load(&m.packetsReceived[i]); count != 0 {
+			s.PacketsReceived[byte(i)] = count
+		}
+		if count := load(&m.packetsSent[i]); count != 0 {
+			s.PacketsSent[byte(i)] = count
+		}
+	}
+
+	s.ChunksLoaded = load(&m.chunksLoaded)
+	s.ChunksUnloaded = load(&m.chunksUnloaded)
+	s.ChunksGenerated = load(&m.chunksGenerated)
+	s.ActivePlayers = load(&m.activePlayers)
+
+	m.tpsLock.Lock()
+	defer m.tpsLock.Unlock()
+	s.TicksPerSecond = m.tps
+
+	return
+}
+
+// WriteText writes the metrics in the Prometheus text format.
+func (s *Snapshot) WriteText(w io.Writer) (err os.Error) {
+	counters := []struct {
+		name string
+		byId map[byte]int64
+		help string
+	}{
+		{"chunkymonkey_packets_received_total", s.PacketsReceived, "Packets received from clients, by packet ID."},
+		{"chunkymonkey_packets_sent_total", s.PacketsSent, "Packets sent to clients, by packet ID."},
+	}
+	for _, c := range counters {
+		if _, err = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name); err != nil {
+			return
+		}
+		for id := 0; id < 256; id++ {
+			if count, ok := c.byId[byte(id)]; ok {
+				if _, err = fmt.Fprintf(w, "%s{id=\"0x%02x\"} %d\n", c.name, id, count); err != nil {
+					return
+				}
+			}
+		}
+	}
+
+	values := []struct {
+		name      string
+		valueType string
+		value     interface{}
+		help      string
+	}{
+		{"chunkymonkey_chunks_loaded_total", "counter", s.ChunksLoaded, "Chunks loaded into shards."},
+		{"chunkymonkey_chunks_unloaded_total", "counter", s.ChunksUnloaded, "Chunks unloaded from shards."},
+		{"chunkymonkey_chunks_generated_total", "counter", s.ChunksGenerated, "Chunks generated rather than read from the store."},
+		{"chunkymonkey_active_players", "gauge", s.ActivePlayers, "Players connected."},
+		{"chunkymonkey_ticks_per_second", "gauge", s.TicksPerSecond, "Measured game tick rate."},
+	}
+	for _, v := range values {
+		if _, err = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", v.name, v.help, v.name, v.valueType, v.name, v.value); err != nil {
+			return
+		}
+	}
+
+	return
+}
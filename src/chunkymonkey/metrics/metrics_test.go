@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMetrics_Snapshot(t *testing.T) {
+	m := new(Metrics)
+
+	m.PacketReceived(0x0d)
+	m.PacketReceived(0x0d)
+	m.PacketReceived(0x00)
+	m.PacketSent(0x33)
+	m.ChunkLoaded(false)
+	m.ChunkLoaded(true)
+	m.ChunkUnloaded()
+	m.PlayerConnected()
+	m.PlayerConnected()
+	m.PlayerDisconnected()
+	m.SetTicksPerSecond(19.5)
+
+	s := m.Snapshot()
+
+	if len(s.PacketsReceived) != 2 || s.PacketsReceived[0x0d] != 2 || s.PacketsReceived[0x00] != 1 {
+		t.Errorf("unexpected packets received %v", s.PacketsReceived)
+	}
+	if len(s.PacketsSent) != 1 || s.PacketsSent[0x33] != 1 {
+		t.Errorf("unexpected packets sent %v", s.PacketsSent)
+	}
+	if s.ChunksLoaded != 2 || s.ChunksGenerated != 1 || s.ChunksUnloaded != 1 {
+		t.Errorf("expected 2 chunks loaded, 1 generated and 1 unloaded, got %+v", s)
+	}
+	if s.ActivePlayers != 1 {
+		t.Errorf("expected 1 active player, got %d", s.ActivePlayers)
+	}
+	if s.TicksPerSecond != 19.5 {
+		t.Errorf("expected 19.5 ticks per second, got %v", s.TicksPerSecond)
+	}
+}
+
+func TestMetrics_ConcurrentUpdates(t *testing.T) {
+	m := new(Metrics)
+
+	const goroutines = 8
+	const perGoroutine = 1000
+	done := make(chan bool)
+	for i := 0; i < goroutines; i++ {
+		go func() {
+			for j := 0; j < perGoroutine; j++ {
+				m.PacketSent(0x04)
+			}
+			done <- true
+		}()
+	}
+	for i := 0; i < goroutines; i++ {
+		<-done
+	}
+
+	if count := m.Snapshot().PacketsSent[0x04]; count != goroutines*perGoroutine {
+		t.Errorf("expected %d packets sent, got %d", goroutines*perGoroutine, count)
+	}
+}
+
+func TestSnapshot_WriteText(t *testing.T) {
+	m := new(Metrics)
+	m.PacketReceived(0x0d)
+	m.PacketReceived(0x0d)
+	m.ChunkLoaded(true)
+	m.PlayerConnected()
+	m.SetTicksPerSecond(19.5)
+
+	s := m.Snapshot()
+	buf := new(bytes.Buffer)
+	if err := s.WriteText(buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	text := buf.String()
+
+	expectedLines := []string{
+		"# TYPE chunkymonkey_packets_received_total counter",
+		`chunkymonkey_packets_received_total{id="0x0d"} 2`,
+		"chunkymonkey_chunks_loaded_total 1",
+		"chunkymonkey_chunks_unloaded_total 0",
+		"chunkymonkey_chunks_generated_total 1",
+		"# TYPE chunkymonkey_active_players gauge",
+		"chunkymonkey_active_players 1",
+		"chunkymonkey_ticks_per_second 19.5",
+	}
+	for _, line := range expectedLines {
+		if !strings.Contains(text, line+"\n") {
+			t.Errorf("expected line %q in:\n%s", line, text)
+		}
+	}
+	if strings.Contains(text, "chunkymonkey_packets_sent_total{") {
+		t.Errorf("expected no sent packet counts in:\n%s", text)
+	}
+}
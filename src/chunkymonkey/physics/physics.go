@@ -118,20 +118,9 @@ func (obj *PointObject) SendUpdate(writer io.Writer, entityId EntityId, look *Lo
 	dz := curPosition.Z - obj.LastSentPosition.Z
 
 	if dx != 0 || dy != 0 || dz != 0 {
-		if dx >= -128 && dx <= 127 && dy >= -128 && dy <= 127 && dz >= -128 && dz <= 127 {
-			err = proto.WriteEntityRelMove(
-				writer, entityId,
-				&RelMove{
-					RelMoveCoord(dx),
-					RelMoveCoord(dy),
-					RelMoveCoord(dz),
-				},
-			)
-		} else {
-			err = proto.WriteEntityTeleport(
-				writer, entityId,
-				curPosition, look)
-		}
+		err = proto.WriteEntityMoveOrTeleport(
+			writer, entityId,
+			&obj.LastSentPosition, curPosition, look)
 		if err != nil {
 			return
 		}
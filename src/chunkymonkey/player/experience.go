@@ -0,0 +1,34 @@
+package player
+
+import (
+	"bytes"
+
+	"chunkymonkey/gamerules"
+	"chunkymonkey/proto"
+)
+
+// sendExperience tells the client the player's experience and level. It must
+// be called with player.lock held.
+func (player *Player) sendExperience() {
+	buf := new(bytes.Buffer)
+	proto.WritePlayerExperience(buf, int8(player.experience), int8(player.level), player.totalExperience)
+	player.TransmitPacket(buf.Bytes())
+}
+
+// giveExperience adds experience points to the player, raising their level
+// each time they have enough experience for the next. It must be called with
+// player.lock held.
+func (player *Player) giveExperience(amount int16) {
+	if amount <= 0 || player.dead {
+		return
+	}
+
+	player.totalExperience += amount
+	player.experience += amount
+	for player.experience >= gamerules.ExperienceToLevel(player.level) {
+		player.experience -= gamerules.ExperienceToLevel(player.level)
+		player.level++
+	}
+
+	player.sendExperience()
+}
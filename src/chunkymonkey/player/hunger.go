@@ -0,0 +1,195 @@
+package player
+
+import (
+	"bytes"
+	"math"
+
+	"chunkymonkey/gamerules"
+	"chunkymonkey/proto"
+	. "chunkymonkey/types"
+)
+
+const (
+	// InitialSaturation is the food saturation that a player starts with, and
+	// that they are given when they respawn.
+	InitialSaturation = float32(5)
+
+	// Players with at least RegenFoodUnits of food slowly regain health.
+	RegenFoodUnits = FoodUnits(18)
+
+	// Every FoodTickInterval ticks, a well fed player heals a point of damage,
+	// and a player without food takes a point of starvation damage.
+	FoodTickInterval = 80
+
+	// EatTicks is how long a player must hold down the use button to eat the
+	// food that they are holding.
+	EatTicks = 32
+
+	// Every ExhaustionPerFoodUnit of exhaustion uses up one unit of saturation,
+	// or one unit of food once the player has no saturation left.
+	ExhaustionPerFoodUnit = float32(4)
+
+	// Exhaustion caused by various activities.
+	ExhaustionSprintPerBlock = float32(0.1)
+	ExhaustionJump           = float32(0.2)
+	ExhaustionSprintJump     = float32(0.8)
+	ExhaustionDamage         = float32(0.3)
+	ExhaustionBlockBreak     = float32(0.025)
+	ExhaustionRegen          = float32(3)
+)
+
+// sendHealth tells the client the player's health and food levels. It must be
+// called with player.lock held.
+func (player *Player) sendHealth() {
+	buf := new(bytes.Buffer)
+	proto.WriteUpdateHealth(buf, player.health, player.foodLevel, player.saturation)
+	player.TransmitPacket(buf.Bytes())
+}
+
+// addExhaustion makes the player hungrier as a result of some activity. It
+// must be called with player.lock held.
+func (player *Player) addExhaustion(amount float32) {
+	if player.dead || player.gameType == GameTypeCreative {
+		return
+	}
+
+	player.exhaustion += amount
+	if player.exhaustion < ExhaustionPerFoodUnit {
+		return
+	}
+
+	for player.exhaustion >= ExhaustionPerFoodUnit {
+		player.exhaustion -= ExhaustionPerFoodUnit
+		if player.saturation > 0 {
+			player.saturation--
+			if player.saturation < 0 {
+				player.saturation = 0
+			}
+		} else if player.foodLevel > 0 {
+			player.foodLevel--
+		}
+	}
+	player.sendHealth()
+}
+
+// updateMoveExhaustion adds the exhaustion from the player moving by the given
+// amounts. wasOnGround is true if the player was on the ground before the move.
+// It must be called with player.lock held.
+func (player *Player) updateMoveExhaustion(dx, dy, dz AbsCoord, wasOnGround, onGround bool) {
+	if player.sprinting {
+		// Only horizontal movement tires a sprinting player.
+		distance := math.Sqrt(float64(dx*dx + dz*dz))
+		player.addExhaustion(ExhaustionSprintPerBlock * float32(distance))
+	}
+
+	if wasOnGround && !onGround && dy > 0 {
+		if player.sprinting {
+			player.addExhaustion(ExhaustionSprintJump)
+		} else {
+			player.addExhaustion(ExhaustionJump)
+		}
+	}
+}
+
+// heal restores health to the player, up to MaxHealth. It must be called with
+// player.lock held.
+func (player *Player) heal(amount Health) {
+	if player.dead {
+		return
+	}
+
+	player.health += amount
+	if player.health > MaxHealth {
+		player.health = MaxHealth
+	}
+	player.sendHealth()
+}
+
+// tickFood is called every tick to heal the player when they are well fed,
+// and to starve them when they have no food. It must be called with
+// player.lock held.
+func (player *Player) tickFood() {
+	if player.dead || player.gameType == GameTypeCreative {
+		return
+	}
+
+	player.foodTimer++
+	if player.foodTimer < FoodTickInterval {
+		return
+	}
+	player.foodTimer = 0
+
+	if player.foodLevel >= RegenFoodUnits && player.health < MaxHealth {
+		player.heal(1)
+		player.addExhaustion(ExhaustionRegen)
+	} else if player.foodLevel == 0 {
+		player.applyDamage(1, "starved")
+	}
+}
+
+// startEating starts the player eating their held item, if it is food. It
+// must be called with player.lock held.
+func (player *Player) startEating() {
+	held, _ := player.inventory.HeldItem()
+	itemType := held.ItemType()
+	if itemType == nil || itemType.Food <= 0 {
+		player.eatTimer = 0
+		return
+	}
+	if player.foodLevel >= MaxFoodUnits {
+		// Players can't eat when they're full.
+		return
+	}
+	player.eatTimer = EatTicks
+}
+
+// stopEating stops the player eating, if they were. It must be called with
+// player.lock held.
+func (player *Player) stopEating() {
+	player.eatTimer = 0
+}
+
+// tickEating counts down the time that the player has been eating for, and
+// eats the held item when they have eaten for long enough. It must be called
+// with player.lock held.
+func (player *Player) tickEating() {
+	if player.eatTimer <= 0 {
+		return
+	}
+	player.eatTimer--
+	if player.eatTimer == 0 {
+		player.eatHeldItem()
+	}
+}
+
+// eatHeldItem takes one item of food from the held stack, and feeds it to the
+// player. It must be called with player.lock held.
+func (player *Player) eatHeldItem() {
+	held, _ := player.inventory.HeldItem()
+	itemType := held.ItemType()
+	if itemType == nil || itemType.Food <= 0 {
+		player.log().Debug("%v: tried to eat %v, which is not food", player, held)
+		return
+	}
+
+	var eaten gamerules.Slot
+	player.inventory.TakeOneHeldItem(&eaten)
+	if eaten.Count != 1 {
+		return
+	}
+
+	player.foodLevel += itemType.Food
+	if player.foodLevel > MaxFoodUnits {
+		player.foodLevel = MaxFoodUnits
+	}
+	// Saturation can never be more than the food level.
+	player.saturation += itemType.Saturation
+	if player.saturation > float32(player.foodLevel) {
+		player.saturation = float32(player.foodLevel)
+	}
+
+	buf := new(bytes.Buffer)
+	proto.WriteEntityStatus(buf, player.EntityId, EntityStatusEatingAccepted)
+	player.TransmitPacket(buf.Bytes())
+	player.sendHealth()
+}
@@ -1,21 +1,27 @@
 package player
 
 import (
+	"bufio"
 	"bytes"
 	"expvar"
 	"flag"
 	"fmt"
-	"log"
+	"io"
+	"math"
 	"net"
 	"os"
 	"rand"
+	"strings"
 	"sync"
 	"time"
 
 	"chunkymonkey/gamerules"
+	"chunkymonkey/logging"
+	"chunkymonkey/metrics"
 	"chunkymonkey/nbtutil"
 	"chunkymonkey/physics"
 	"chunkymonkey/proto"
+	"chunkymonkey/record"
 	. "chunkymonkey/types"
 	"chunkymonkey/window"
 	"nbt"
@@ -30,6 +36,40 @@ var (
 		"player_ping_no_check", false,
 		"Relax checks on player keep-alive packets. This can be useful for "+
 			"recorded/replayed sessions.")
+
+	playerMaxMoveDistance = flag.Float64(
+		"player_max_move_distance", 10,
+		"Maximum distance (in blocks) that a player may move in a single "+
+			"position update, excluding falling.")
+
+	playerMaxMoveSpeed = flag.Float64(
+		"player_max_move_speed", 12,
+		"Maximum speed (in blocks per second) that a player may move at, "+
+			"excluding falling. Players who have been still may move up to "+
+			"player_max_move_distance at once.")
+
+	playerMaxPacketSize = flag.Int(
+		"player_max_packet_size", 1<<16,
+		"Maximum size (in bytes) of a single packet received from a player.")
+
+	playerMaxFallDistance = flag.Float64(
+		"player_max_fall_distance", 100,
+		"Maximum distance (in blocks) that a player may fall in a single "+
+			"position update.")
+
+	// clientViewDistances maps the view distances that clients choose to
+	// distances in chunks.
+	clientViewDistances = [...]ChunkCoord{
+		ViewDistanceFar:    16,
+		ViewDistanceNormal: 8,
+		ViewDistanceShort:  4,
+		ViewDistanceTiny:   2,
+	}
+
+	playerMaxViewDistance = flag.Int(
+		"player_max_view_distance", ChunkRadius,
+		"Maximum distance (in chunks) around a player that chunks are sent to "+
+			"them.")
 )
 
 const (
@@ -37,8 +77,20 @@ const (
 	MaxHealth    = Health(20)
 	MaxFoodUnits = FoodUnits(20)
 
+	// Players may fall this many blocks without taking damage. Each further
+	// block fallen does one point of damage.
+	SafeFallDistance = 3
+
+	// SprintMoveFactor is how much further a sprinting player may move in a
+	// single position update than a player who is not sprinting.
+	SprintMoveFactor = 1.3
+
 	PingTimeoutNs  = 1e9 * 60 // Player connection times out after 60 seconds.
 	PingIntervalNs = 1e9 * 20 // Time between receiving keep alive response from client and sending new request.
+
+	// Maximum number of ticks that a player queues up while it is busy. Ticks
+	// beyond this are dropped.
+	maxQueuedTicks = 10
 )
 
 func init() {
@@ -52,6 +104,7 @@ type Player struct {
 
 	EntityId
 	playerClient   playerClient
+	world          string // Name of the world that the player is in.
 	shardConnecter gamerules.IShardConnecter
 	conn           net.Conn
 	name           string
@@ -60,6 +113,9 @@ type Player struct {
 
 	game gamerules.IGame
 
+	// The logger for the player. If nil, logging.Default is used.
+	logger logging.Logger
+
 	// ping is used to determine the player's current roundtrip latency, and to
 	// determine if the player should be disconnected for not responding.
 	ping struct {
@@ -77,9 +133,12 @@ type Player struct {
 	mainQueue    chan func(*Player)
 	txQueue      chan []byte
 	txErrChan    chan os.Error
+	txDone       chan bool // Closed when the transmitLoop exits.
 	rxErrChan    chan os.Error
 	rxRunning    bool // Only used by the receiveLoop.
 	stopPlayer   chan bool
+	ticks        chan bool
+	capture      packetCapture
 
 	// The following attributes are game-logic related.
 
@@ -89,8 +148,34 @@ type Player struct {
 	height     AbsCoord
 	look       LookDegrees
 	chunkSubs  chunkSubscriptions
-	health     Health
-	food       FoodUnits
+	// viewDistance is the distance (in chunks) around the player that chunks
+	// are sent to them.
+	viewDistance ChunkCoord
+	locale       string
+	chatFlags    byte
+	health       Health
+	foodLevel    FoodUnits
+	saturation   float32
+	exhaustion   float32
+	foodTimer    int // Ticks since the player last healed or starved.
+	eatTimer     int // Ticks until the held food is eaten, or 0 if not eating.
+	gameType     GameType
+	dead         bool // Awaiting a respawn packet from the client.
+	sneaking     bool
+	sprinting    bool
+	inBed        bool // Asleep in the bed at bedLoc.
+	bedLoc       BlockXyz
+
+	// The distance that the player could have moved, but didn't, as of their
+	// last accepted move at lastMoveNs.
+	moveAllowance AbsCoord
+	lastMoveNs    int64
+
+	// experience is the player's progress towards their next level, and
+	// totalExperience is all the experience that they have collected.
+	experience      int16
+	level           int16
+	totalExperience int16
 
 	// The following data fields are loaded, but not used yet
 	dimension    int32
@@ -110,11 +195,21 @@ type Player struct {
 	curWindow    window.IWindow
 	nextWindowId WindowId
 	remoteInv    *RemoteInventory
+
+	// rejectedTx records a window click that was rejected. The client ignores
+	// the window until it has confirmed that it saw the rejection, and so
+	// further clicks on the window are ignored until then.
+	rejectedTx struct {
+		pending  bool
+		windowId WindowId
+		txId     TxId
+	}
 }
 
-func NewPlayer(entityId EntityId, shardConnecter gamerules.IShardConnecter, conn net.Conn, name string, spawnBlock BlockXyz, onDisconnect chan<- EntityId, game gamerules.IGame) *Player {
+func NewPlayer(entityId EntityId, world string, shardConnecter gamerules.IShardConnecter, conn net.Conn, name string, spawnBlock BlockXyz, onDisconnect chan<- EntityId, game gamerules.IGame, logger logging.Logger) *Player {
 	player := &Player{
 		EntityId:       entityId,
+		world:          world,
 		shardConnecter: shardConnecter,
 		conn:           conn,
 		name:           name,
@@ -127,8 +222,11 @@ func NewPlayer(entityId EntityId, shardConnecter gamerules.IShardConnecter, conn
 		height: StanceNormal,
 		look:   LookDegrees{0, 0},
 
-		health: MaxHealth,
-		food:   MaxFoodUnits, // TODO: Check what initial level should be.
+		viewDistance: ChunkCoord(*playerMaxViewDistance),
+
+		health:     MaxHealth,
+		foodLevel:  MaxFoodUnits,
+		saturation: InitialSaturation,
 
 		curWindow:    nil,
 		nextWindowId: WindowIdFreeMin,
@@ -136,20 +234,41 @@ func NewPlayer(entityId EntityId, shardConnecter gamerules.IShardConnecter, conn
 		mainQueue:  make(chan func(*Player), 128),
 		txQueue:    make(chan []byte, 128),
 		txErrChan:  make(chan os.Error, 1),
+		txDone:     make(chan bool),
 		rxErrChan:  make(chan os.Error, 1),
 		stopPlayer: make(chan bool, 1),
+		ticks:      make(chan bool, maxQueuedTicks),
 
-		game: game,
+		game:   game,
+		logger: logger,
 
 		onDisconnect: onDisconnect,
 	}
 
 	player.playerClient.Init(player)
 	player.inventory.Init(player.EntityId, player)
+	player.capture.init(player)
 
 	return player
 }
 
+// clampViewDistance limits a view distance to the range that the server
+// allows.
+func clampViewDistance(viewDistance ChunkCoord) ChunkCoord {
+	maxViewDistance := ChunkCoord(*playerMaxViewDistance)
+	if maxViewDistance < MinChunkRadius {
+		maxViewDistance = MinChunkRadius
+	}
+
+	switch {
+	case viewDistance < MinChunkRadius:
+		return MinChunkRadius
+	case viewDistance > maxViewDistance:
+		return maxViewDistance
+	}
+	return viewDistance
+}
+
 func (player *Player) Name() string {
 	return player.name
 }
@@ -158,6 +277,14 @@ func (player *Player) String() string {
 	return fmt.Sprintf("Player(%q)", player.name)
 }
 
+// log returns the logger for the player.
+func (player *Player) log() logging.Logger {
+	if player.logger == nil {
+		return logging.Default
+	}
+	return player.logger
+}
+
 func (player *Player) Position() AbsXyz {
 	return player.position
 }
@@ -174,11 +301,26 @@ func (player *Player) Look() LookDegrees {
 	return player.look
 }
 
+// SavedWorld returns the name of the world that the player was in when their
+// data was saved. ok is false for data saved before worlds were recorded.
+func SavedWorld(tag *nbt.Compound) (world string, ok bool) {
+	worldTag, ok := tag.Lookup("World").(*nbt.String)
+	if !ok {
+		return "", false
+	}
+	return worldTag.Value, true
+}
+
 // UnmarshalNbt unpacks the player data from their persistantly stored NBT
 // data. It must only be called before Player.Run().
 func (player *Player) UnmarshalNbt(tag *nbt.Compound) (err os.Error) {
-	if player.position, err = nbtutil.ReadAbsXyz(tag, "Pos"); err != nil {
-		return
+	// The saved position is only meaningful in the world it was saved in. A
+	// player whose world is no longer loaded starts at the spawn position of
+	// the world they are put in.
+	if world, ok := SavedWorld(tag); !ok || world == player.world {
+		if player.position, err = nbtutil.ReadAbsXyz(tag, "Pos"); err != nil {
+			return
+		}
 	}
 
 	if player.look, err = nbtutil.ReadLookDegrees(tag, "Rotation"); err != nil {
@@ -191,6 +333,51 @@ func (player *Player) UnmarshalNbt(tag *nbt.Compound) (err os.Error) {
 	}
 	player.health = Health(health)
 
+	// Food levels are missing from players saved by older versions.
+	if tag.Lookup("foodLevel") != nil {
+		foodLevel, err := nbtutil.ReadInt(tag, "foodLevel")
+		if err != nil {
+			return err
+		}
+		player.foodLevel = FoodUnits(foodLevel)
+
+		if player.saturation, err = nbtutil.ReadFloat(tag, "foodSaturationLevel"); err != nil {
+			return err
+		}
+
+		if player.exhaustion, err = nbtutil.ReadFloat(tag, "foodExhaustionLevel"); err != nil {
+			return err
+		}
+
+		foodTimer, err := nbtutil.ReadInt(tag, "foodTickTimer")
+		if err != nil {
+			return err
+		}
+		player.foodTimer = int(foodTimer)
+	}
+
+	// As is experience.
+	if tag.Lookup("XpLevel") != nil {
+		level, err := nbtutil.ReadInt(tag, "XpLevel")
+		if err != nil {
+			return err
+		}
+		player.level = int16(level)
+
+		total, err := nbtutil.ReadInt(tag, "XpTotal")
+		if err != nil {
+			return err
+		}
+		player.totalExperience = int16(total)
+
+		// The progress into the level is stored as a fraction.
+		progress, err := nbtutil.ReadFloat(tag, "XpP")
+		if err != nil {
+			return err
+		}
+		player.experience = int16(progress * float32(gamerules.ExperienceToLevel(player.level)))
+	}
+
 	if err = player.inventory.UnmarshalNbt(tag.Lookup("Inventory")); err != nil {
 		return
 	}
@@ -249,6 +436,7 @@ func (player *Player) MarshalNbt(tag *nbt.Compound) (err os.Error) {
 		return
 	}
 
+	tag.Set("World", &nbt.String{player.world})
 	tag.Set("OnGround", &nbt.Byte{player.onGround})
 	tag.Set("Dimension", &nbt.Int{player.dimension})
 	tag.Set("Sleeping", &nbt.Byte{player.sleeping})
@@ -274,6 +462,13 @@ func (player *Player) MarshalNbt(tag *nbt.Compound) (err os.Error) {
 	}})
 	tag.Set("Fire", &nbt.Short{player.fire})
 	tag.Set("Health", &nbt.Short{int16(player.health)})
+	tag.Set("foodLevel", &nbt.Int{int32(player.foodLevel)})
+	tag.Set("foodSaturationLevel", &nbt.Float{player.saturation})
+	tag.Set("foodExhaustionLevel", &nbt.Float{player.exhaustion})
+	tag.Set("foodTickTimer", &nbt.Int{int32(player.foodTimer)})
+	tag.Set("XpLevel", &nbt.Int{int32(player.level)})
+	tag.Set("XpTotal", &nbt.Int{int32(player.totalExperience)})
+	tag.Set("XpP", &nbt.Float{float32(player.experience) / float32(gamerules.ExperienceToLevel(player.level))})
 
 	return nil
 }
@@ -294,7 +489,7 @@ func (player *Player) Run() {
 	// TODO pass proper map seed.
 	// TODO pass proper values for the difficulty.
 	// TODO proper max number of players.
-	proto.ServerWriteLogin(buf, player.EntityId, 0, 0, DimensionNormal, GameDifficultyNormal, MaxYCoord+1, 8)
+	proto.ServerWriteLogin(buf, player.EntityId, 0, int32(player.gameType), DimensionNormal, GameDifficultyNormal, MaxYCoord+1, 8)
 	proto.WriteSpawnPosition(buf, &player.spawnBlock)
 	player.TransmitPacket(buf.Bytes())
 
@@ -312,6 +507,16 @@ func (player *Player) Stop() {
 	}
 }
 
+// Tick queues a tick for the player to run, for the game logic that happens
+// over time. It is called from the game's tick loop, and does not block.
+func (player *Player) Tick() {
+	select {
+	case player.ticks <- true:
+	default:
+		// The player is too far behind, drop the tick.
+	}
+}
+
 // Start of packet handling code
 // Note: any packet handlers that could change the player state or read a
 // changeable state must use player.lock
@@ -332,45 +537,116 @@ func (player *Player) PacketServerHandshake(username string) {
 
 func (player *Player) PacketChatMessage(message string) {
 	prefix := gamerules.CommandFramework.Prefix()
-	if message[0:len(prefix)] == prefix {
+	if strings.HasPrefix(message, prefix) {
 		// We pass the IPlayerClient to the command framework to avoid having
 		// to fetch it as the first part of every command.
 		gamerules.CommandFramework.Process(&player.playerClient, message, player.game)
 	} else {
-		player.sendChatMessage(fmt.Sprintf("<%s> %s", player.name, message), true)
+		player.game.BroadcastMessage(fmt.Sprintf("<%s> %s", player.name, message))
 	}
 }
 
 func (player *Player) PacketEntityAction(entityId EntityId, action EntityAction) {
+	player.lock.Lock()
+	defer player.lock.Unlock()
+
+	if entityId != player.EntityId {
+		player.log().Debug("%v: Ignoring entity action for entity %d", player, entityId)
+		return
+	}
+
+	switch action {
+	case EntityActionCrouch:
+		player.sneaking = true
+	case EntityActionUncrouch:
+		player.sneaking = false
+	case EntityActionStartSprint:
+		player.sprinting = true
+	case EntityActionStopSprint:
+		player.sprinting = false
+	case EntityActionLeaveBed:
+		player.wakeUp()
+		return
+	default:
+		return
+	}
+
+	player.sendStatusMetadata()
 }
 
 func (player *Player) PacketUseEntity(user EntityId, target EntityId, leftClick bool) {
+	player.lock.Lock()
+	defer player.lock.Unlock()
+
+	if user != player.EntityId {
+		player.log().Debug("%v: Ignoring use of entity %d by entity %d", player, target, user)
+		return
+	}
+
+	if shard, ok := player.chunkSubs.CurrentShardClient(); ok {
+		shard.ReqUseEntity(player.chunkSubs.curChunkLoc, target, leftClick)
+	}
 }
 
 func (player *Player) PacketRespawn(dimension DimensionId, unknown int8, gameType GameType, worldHeight int16, mapSeed RandomSeed) {
+	player.lock.Lock()
+	defer player.lock.Unlock()
+
+	if !player.dead {
+		player.log().Debug("%v: Ignoring respawn request from living player", player)
+		return
+	}
+
+	player.respawn()
 }
 
 func (player *Player) PacketPlayer(onGround bool) {
+	player.lock.Lock()
+	defer player.lock.Unlock()
+
+	if !player.spawnComplete || player.dead {
+		return
+	}
+
+	player.updateFall(0, onGround)
 }
 
 func (player *Player) PacketPlayerPosition(position *AbsXyz, stance AbsCoord, onGround bool) {
 	player.lock.Lock()
 	defer player.lock.Unlock()
 
-	if !player.spawnComplete {
+	if !player.spawnComplete || player.dead {
 		// Ignore position packets from player until spawned at initial position
-		// with chunk loaded.
+		// with chunk loaded, and while dead.
 		return
 	}
 
-	if !player.position.IsWithinDistanceOf(position, 10) {
-		log.Printf("Discarding player position that is too far removed (%.2f, %.2f, %.2f)",
-			position.X, position.Y, position.Z)
+	now := time.Nanoseconds()
+	maxMove := player.maxMoveDistance(now)
+	if !isValidMove(&player.position, position, maxMove, AbsCoord(*playerMaxFallDistance)) {
+		player.log().Debug("%v: Discarding player position that is too far removed (%.2f, %.2f, %.2f)",
+			player, position.X, position.Y, position.Z)
+
+		// Put the client back to where the server thinks the player is.
+		player.sendPositionReset()
 		return
 	}
+	from := player.position
+	player.moveAllowance = maxMove - moveDistance(&from, position)
+	player.lastMoveNs = now
+	dy := position.Y - player.position.Y
+	wasOnGround := player.onGround != 0
 	player.position = *position
 	player.height = stance - position.Y
 	player.chunkSubs.Move(position)
+	player.chunkSubs.CheckMove(&from, position)
+
+	player.updateFall(dy, onGround)
+	player.updateMoveExhaustion(position.X-from.X, dy, position.Z-from.Z, wasOnGround, onGround)
+
+	if player.inBed && !isNearBed(position, &player.bedLoc) {
+		player.wakeUp()
+	}
 
 	// TODO: Should keep track of when players enter/leave their mutual radius
 	// of "awareness". I.e a client should receive a RemoveEntity packet when
@@ -379,6 +655,118 @@ func (player *Player) PacketPlayerPosition(position *AbsXyz, stance AbsCoord, on
 	// of each other.
 }
 
+// rejectMove puts the player back to a position after a move from it has been
+// found to pass through solid blocks.
+func (player *Player) rejectMove(position AbsXyz) {
+	if player.dead {
+		return
+	}
+
+	player.log().Debug("%v: Discarding player movement through solid blocks from (%.2f, %.2f, %.2f)",
+		player, position.X, position.Y, position.Z)
+
+	player.position = position
+	player.fallDistance = 0
+	player.chunkSubs.Move(&player.position)
+	player.sendPositionReset()
+}
+
+// sendPositionReset tells the client to move the player back to where the
+// server thinks the player is.
+func (player *Player) sendPositionReset() {
+	buf := new(bytes.Buffer)
+	proto.ServerWritePlayerPositionLook(
+		buf,
+		&player.position, player.position.Y+player.height,
+		&player.look, false)
+	player.TransmitPacket(buf.Bytes())
+}
+
+// maxMoveDistance returns the furthest that the player may move in a position
+// update at time nowNs, excluding falling. The distance builds up at the
+// player's maximum speed from their last accepted move, up to the most that
+// they may move in a single update, so sending more position updates does not
+// let a player move any faster.
+func (player *Player) maxMoveDistance(nowNs int64) AbsCoord {
+	maxMove := AbsCoord(*playerMaxMoveDistance)
+	speed := AbsCoord(*playerMaxMoveSpeed)
+	if player.sprinting {
+		maxMove *= SprintMoveFactor
+		speed *= SprintMoveFactor
+	}
+
+	elapsed := AbsCoord(nowNs-player.lastMoveNs) / NanosecondsInSecond
+	if allowance := player.moveAllowance + speed*elapsed; allowance < maxMove {
+		return allowance
+	}
+	return maxMove
+}
+
+// moveDistance returns the distance that a move covers, excluding falling.
+func moveDistance(from, to *AbsXyz) AbsCoord {
+	move := to.Sub(from)
+	if move.Y < 0 {
+		move.Y = 0
+	}
+	return move.Length()
+}
+
+// isValidMove returns true if a player could legitimately move from one
+// position to another in a single position update. Falling is limited
+// separately from other movement, as it can legitimately cover a much greater
+// distance.
+func isValidMove(from, to *AbsXyz, maxMove, maxFall AbsCoord) bool {
+	move := to.Sub(from)
+
+	if move.Y < 0 {
+		if -move.Y > maxFall {
+			return false
+		}
+		move.Y = 0
+	}
+
+	return move.LengthSquared() <= maxMove*maxMove
+}
+
+// Players asleep in a bed are woken if they move further than this many
+// blocks from it.
+const bedWakeDistance = 2
+
+// isNearBed returns true if a player at position is close enough to the bed
+// at bedLoc to still be in it.
+func isNearBed(position *AbsXyz, bedLoc *BlockXyz) bool {
+	bedCenter := &AbsXyz{AbsCoord(bedLoc.X) + 0.5, AbsCoord(bedLoc.Y), AbsCoord(bedLoc.Z) + 0.5}
+	return position.IsWithinDistanceOf(bedCenter, bedWakeDistance)
+}
+
+// fallDamage returns the damage done by falling the given distance.
+func fallDamage(fallDistance float32) Health {
+	damage := math.Ceil(float64(fallDistance) - SafeFallDistance)
+	if damage <= 0 {
+		return 0
+	}
+	return Health(damage)
+}
+
+// updateFall tracks how far the player has fallen, and applies fall damage
+// when they land. dy is the change in height since the last position update.
+// It must be called with player.lock held.
+func (player *Player) updateFall(dy AbsCoord, onGround bool) {
+	if onGround {
+		player.onGround = 1
+		// Creative players can't be hurt by falling.
+		if damage := fallDamage(player.fallDistance); damage > 0 && player.gameType != GameTypeCreative {
+			player.applyDamage(damage, "fell")
+		}
+		player.fallDistance = 0
+	} else {
+		player.onGround = 0
+		if dy < 0 {
+			player.fallDistance -= float32(dy)
+		}
+	}
+}
+
 func (player *Player) PacketPlayerLook(look *LookDegrees, onGround bool) {
 	player.lock.Lock()
 	defer player.lock.Unlock()
@@ -396,6 +784,11 @@ func (player *Player) PacketPlayerBlockHit(status DigStatus, target *BlockXyz, f
 	player.lock.Lock()
 	defer player.lock.Unlock()
 
+	if status == DigReleaseUseItem {
+		player.stopEating()
+		return
+	}
+
 	// This packet handles 'throwing' an item as well, with status = 4, and
 	// the zero values for target and face, so check for that.
 	if status == DigDropItem && target.IsZero() && face == 0 {
@@ -407,22 +800,31 @@ func (player *Player) PacketPlayerBlockHit(status DigStatus, target *BlockXyz, f
 
 		var itemToThrow gamerules.Slot
 		player.inventory.TakeOneHeldItem(&itemToThrow)
-		if !itemToThrow.IsEmpty() {
-			velocity := physics.VelocityFromLook(player.look, 0.50)
-			position := player.position
-			position.Y += player.height
-			shardClient.ReqDropItem(itemToThrow, position, velocity, TicksPerSecond/2)
-		}
+		player.throwItem(shardClient, &itemToThrow)
 		return
 	}
 
 	// Validate that the player is actually somewhere near the block.
 	targetAbsPos := target.MidPointToAbsXyz()
 	if !targetAbsPos.IsWithinDistanceOf(&player.position, MaxInteractDistance) {
-		log.Printf("Player/PacketPlayerBlockHit: ignoring player dig at %v (too far away)", target)
+		player.log().Debug("%v: Ignoring dig at %v (too far away)", player, target)
 		return
 	}
 
+	switch player.gameType {
+	case GameTypeAdventure:
+		if status == DigStarted || status == DigBlockBroke {
+			player.log().Debug("%v: Ignoring dig at %v in adventure mode", player, target)
+			return
+		}
+	case GameTypeCreative:
+		// Creative players break blocks instantly, and don't send a packet when
+		// they finish digging.
+		if status == DigStarted {
+			status = DigBlockBroke
+		}
+	}
+
 	// TODO measure the dig time on the target block and relay to the shard to
 	// stop speed hacking (based on block type and tool used - non-trivial).
 
@@ -430,13 +832,33 @@ func (player *Player) PacketPlayerBlockHit(status DigStatus, target *BlockXyz, f
 	if ok {
 		held, _ := player.inventory.HeldItem()
 		shardClient.ReqHitBlock(held, *target, status, face)
+
+		if status == DigBlockBroke {
+			player.addExhaustion(ExhaustionBlockBreak)
+		}
+	}
+}
+
+// blockBroken wears the held tool once the shard has broken a block that the
+// player dug.
+func (player *Player) blockBroken() {
+	if player.gameType != GameTypeCreative {
+		player.inventory.UseHeldTool()
 	}
 }
 
 func (player *Player) PacketPlayerBlockInteract(itemId ItemTypeId, target *BlockXyz, face Face, amount ItemCount, uses ItemData) {
+	if face == FaceNull {
+		// The player is using their held item without aiming at a block.
+		player.lock.Lock()
+		defer player.lock.Unlock()
+
+		player.startEating()
+		return
+	}
+
 	if face < FaceMinValid || face > FaceMaxValid {
-		// TODO sometimes FaceNull means something. This case should be covered.
-		log.Printf("Player/PacketPlayerBlockInteract: invalid face %d", face)
+		player.log().Debug("%v: Ignoring interaction with invalid face %d", player, face)
 		return
 	}
 
@@ -446,7 +868,7 @@ func (player *Player) PacketPlayerBlockInteract(itemId ItemTypeId, target *Block
 	// Validate that the player is actually somewhere near the block.
 	targetAbsPos := target.MidPointToAbsXyz()
 	if !targetAbsPos.IsWithinDistanceOf(&player.position, MaxInteractDistance) {
-		log.Printf("Player/PacketPlayerBlockInteract: ignoring player interact at %v (too far away)", target)
+		player.log().Debug("%v: Ignoring interaction at %v (too far away)", player, target)
 		return
 	}
 
@@ -460,10 +882,44 @@ func (player *Player) PacketPlayerBlockInteract(itemId ItemTypeId, target *Block
 func (player *Player) PacketHoldingChange(slotId SlotId) {
 	player.lock.Lock()
 	defer player.lock.Unlock()
-	player.inventory.SetHolding(slotId)
+
+	if !player.inventory.SetHolding(slotId) {
+		player.log().Debug("%v: ignored holding change to invalid slot %d", player, slotId)
+		return
+	}
+	player.stopEating()
+
+	// Update playerData on current chunk, and show other players the new item.
+	if shard, ok := player.chunkSubs.CurrentShardClient(); ok {
+		held, _ := player.inventory.HeldItem()
+		shard.ReqSetPlayerHeldItem(player.chunkSubs.curChunkLoc, held)
+	}
 }
 
 func (player *Player) PacketEntityAnimation(entityId EntityId, animation EntityAnimation) {
+	player.lock.Lock()
+	defer player.lock.Unlock()
+
+	if entityId != player.EntityId {
+		player.log().Debug("%v: Ignoring animation for entity %d", player, entityId)
+		return
+	}
+
+	switch animation {
+	case EntityAnimationSwingArm, EntityAnimationCrouch, EntityAnimationUncrouch:
+	case EntityAnimationNone:
+		return
+	default:
+		player.log().Debug("%v: Ignoring unexpected animation %d", player, animation)
+		return
+	}
+
+	// Show the animation to other players nearby.
+	if shard, ok := player.chunkSubs.CurrentShardClient(); ok {
+		buf := new(bytes.Buffer)
+		proto.WriteEntityAnimation(buf, player.EntityId, animation)
+		shard.ReqMulticastPlayers(player.chunkSubs.curChunkLoc, player.EntityId, buf.Bytes())
+	}
 }
 
 func (player *Player) PacketWindowClose(windowId WindowId) {
@@ -471,12 +927,27 @@ func (player *Player) PacketWindowClose(windowId WindowId) {
 	defer player.lock.Unlock()
 
 	player.closeCurrentWindow(false)
+
+	// Any items left on the cursor are thrown out into the world.
+	if !player.cursor.IsEmpty() {
+		blockLoc := player.position.ToBlockXyz()
+		if shardClient, _, ok := player.chunkSubs.ShardClientForBlockXyz(blockLoc); ok {
+			player.throwItem(shardClient, &player.cursor)
+		}
+	}
 }
 
 func (player *Player) PacketWindowClick(windowId WindowId, slotId SlotId, rightClick bool, txId TxId, shiftClick bool, expectedSlot *proto.WindowSlot) {
 	player.lock.Lock()
 	defer player.lock.Unlock()
 
+	if player.rejectedTx.pending && player.rejectedTx.windowId == windowId {
+		player.log().Debug(
+			"%v: ignored window click on window ID %d awaiting confirmation of transaction %d",
+			player, windowId, player.rejectedTx.txId)
+		return
+	}
+
 	// Note that the expectedSlot parameter is currently ignored. The item(s)
 	// involved are worked out from the server-side data.
 	// TODO use the expectedSlot as a conditions for the click, and base the
@@ -491,9 +962,9 @@ func (player *Player) PacketWindowClick(windowId WindowId, slotId SlotId, rightC
 	} else if player.curWindow != nil && player.curWindow.WindowId() == windowId {
 		clickedWindow = player.curWindow
 	} else {
-		log.Printf(
-			"Warning: ignored window click on unknown window ID %d",
-			windowId)
+		player.log().Warn(
+			"%v: ignored window click on unknown window ID %d",
+			player, windowId)
 	}
 
 	expectedSlotContent := &gamerules.Slot{
@@ -523,7 +994,7 @@ func (player *Player) PacketWindowClick(windowId WindowId, slotId SlotId, rightC
 	case TxStateAccepted, TxStateRejected:
 		// Inform client of operation status.
 		buf := new(bytes.Buffer)
-		proto.WriteWindowTransaction(buf, windowId, txId, txState == TxStateAccepted)
+		player.writeWindowTransaction(buf, windowId, txId, txState == TxStateAccepted)
 		player.cursor = click.Cursor
 		player.cursor.SendUpdate(buf, WindowIdCursor, SlotIdCursor)
 		player.TransmitPacket(buf.Bytes())
@@ -532,15 +1003,67 @@ func (player *Player) PacketWindowClick(windowId WindowId, slotId SlotId, rightC
 	}
 }
 
+// PacketWindowTransaction is sent by the client to confirm that it has seen
+// a rejected window click.
 func (player *Player) PacketWindowTransaction(windowId WindowId, txId TxId, accepted bool) {
-	// TODO investigate when this packet is sent from the client and what it
-	// means when it does get sent.
-	log.Printf(
-		"Got PacketWindowTransaction from player %q: windowId=%d txId=%d accepted=%t",
-		player.name, windowId, txId, accepted)
+	player.lock.Lock()
+	defer player.lock.Unlock()
+
+	rejectedTx := &player.rejectedTx
+	if !rejectedTx.pending || rejectedTx.windowId != windowId || rejectedTx.txId != txId {
+		player.log().Warn(
+			"%v: unexpected PacketWindowTransaction: windowId=%d txId=%d accepted=%t",
+			player, windowId, txId, accepted)
+		return
+	}
+
+	rejectedTx.pending = false
+}
+
+func (player *Player) PacketCreativeInventoryAction(slotId SlotId, windowSlot *proto.WindowSlot) {
+	player.lock.Lock()
+	defer player.lock.Unlock()
+
+	if player.gameType != GameTypeCreative {
+		player.log().Debug("%v: Ignoring creative inventory action from player not in creative mode", player)
+		return
+	}
+
+	var slot gamerules.Slot
+	slot.SetWindowSlot(windowSlot)
+	slot.Normalize()
+	if !slot.IsEmpty() && (!slot.IsValidType() || slot.Count < 0 || slot.Count > slot.MaxStack()) {
+		player.log().Debug("%v: Ignoring creative inventory action with bad item %+v", player, slot)
+		return
+	}
+
+	if !player.inventory.SetSlot(slotId, &slot) {
+		player.log().Debug("%v: Ignoring creative inventory action on slot %d", player, slotId)
+	}
 }
 
 func (player *Player) PacketSignUpdate(position *BlockXyz, lines [4]string) {
+	player.lock.Lock()
+	defer player.lock.Unlock()
+
+	if shardClient, _, ok := player.chunkSubs.ShardClientForBlockXyz(position); ok {
+		shardClient.ReqSetSignText(*position, lines)
+	}
+}
+
+func (player *Player) PacketClientSettings(locale string, viewDistance byte, chatFlags byte) {
+	player.lock.Lock()
+	defer player.lock.Unlock()
+
+	player.locale = locale
+	player.chatFlags = chatFlags
+
+	if int(viewDistance) >= len(clientViewDistances) {
+		player.log().Debug("%v: bad view distance %d in client settings", player, viewDistance)
+		return
+	}
+	player.viewDistance = clampViewDistance(clientViewDistances[viewDistance])
+	player.chunkSubs.SetRadius(player.viewDistance)
 }
 
 func (player *Player) PacketServerListPing() {
@@ -548,17 +1071,33 @@ func (player *Player) PacketServerListPing() {
 }
 
 func (player *Player) PacketDisconnect(reason string) {
-	log.Printf("Player %s disconnected reason=%s", player.name, reason)
+	player.log().Info("%v: disconnected reason=%s", player, reason)
 
-	player.sendChatMessage(fmt.Sprintf("%s has left", player.name), false)
+	player.game.BroadcastMessage(fmt.Sprintf("%s has left", player.name))
 
 	player.Stop()
 }
 
 func (player *Player) receiveLoop() {
+	capReader := &captureReader{reader: player.conn, capture: &player.capture}
+	reader := proto.NewPacketReadLimiter(capReader, *playerMaxPacketSize)
+	loggedSkippedIds := make(map[proto.SkippedPacketIdError]bool)
+
 	player.rxRunning = true
 	for player.rxRunning {
-		err := proto.ServerReadPacket(player.conn, player)
+		reader.ResetLimit()
+		packetId, err := proto.ServerReadPacketId(reader, player)
+		capReader.flush()
+		if err == nil {
+			metrics.Server.PacketReceived(packetId)
+		}
+		if skipped, ok := err.(proto.SkippedPacketIdError); ok {
+			if !loggedSkippedIds[skipped] {
+				player.log().Info("%v: %v", player, skipped)
+				loggedSkippedIds[skipped] = true
+			}
+			continue
+		}
 		if err != nil {
 			player.rxErrChan <- err
 			return
@@ -569,14 +1108,28 @@ func (player *Player) receiveLoop() {
 // End of packet handling code
 
 func (player *Player) transmitLoop() {
+	// Packets are written through a buffer, which is only flushed when there
+	// are no further packets waiting to be sent. This coalesces bursts of
+	// packets into fewer writes to the connection.
+	writer := bufio.NewWriter(player.conn)
+
+	defer close(player.txDone)
+
 	for {
 		bs := <-player.txQueue
 
 		if bs == nil {
-			player.txErrChan <- nil
+			player.txErrChan <- writer.Flush()
 			return // txQueue closed
 		}
-		_, err := player.conn.Write(bs)
+
+		player.capture.record(record.DirectionServerToClient, bs)
+		metrics.Server.PacketSent(bs[0])
+
+		_, err := writer.Write(bs)
+		if err == nil && len(player.txQueue) == 0 {
+			err = writer.Flush()
+		}
 		if err != nil {
 			player.txErrChan <- err
 			return
@@ -584,6 +1137,17 @@ func (player *Player) transmitLoop() {
 	}
 }
 
+// stopTransmitLoop asks the transmitLoop to exit once it has written all
+// packets queued before the call, and waits for it to do so.
+func (player *Player) stopTransmitLoop() {
+	select {
+	case player.txQueue <- nil:
+		<-player.txDone
+	case <-player.txDone:
+		// transmitLoop already exited due to an error.
+	}
+}
+
 func (player *Player) TransmitPacket(packet []byte) {
 	if packet == nil {
 		return // skip empty packets
@@ -591,6 +1155,14 @@ func (player *Player) TransmitPacket(packet []byte) {
 	player.txQueue <- packet
 }
 
+// StartCapture records every packet sent to and received from the player in
+// capture, until the player disconnects, when the capture is closed. It
+// continues a capture started when the player connected, so must be called
+// before Player.Run().
+func (player *Player) StartCapture(capture *record.Capture) {
+	player.capture.start(capture)
+}
+
 func (player *Player) runQueuedCall(f func(*Player)) {
 	player.lock.Lock()
 	defer player.lock.Unlock()
@@ -600,7 +1172,7 @@ func (player *Player) runQueuedCall(f func(*Player)) {
 // pingNew starts a new "keep-alive" ping.
 func (player *Player) pingNew() {
 	if player.ping.running {
-		log.Printf("%v: Attempted to start a ping while another is running.", player)
+		player.log().Warn("%v: Attempted to start a ping while another is running.", player)
 	} else {
 		if player.ping.timer != nil {
 			player.ping.timer.Stop()
@@ -647,11 +1219,11 @@ func (player *Player) pingReceived(id int32) {
 		}
 	} else {
 		if !player.ping.running {
-			log.Printf("%v: Received keep-alive id=%d when none was running", player, id)
+			player.log().Warn("%v: Received keep-alive id=%d when none was running", player, id)
 			player.Stop()
 			return
 		} else if id != player.ping.id {
-			log.Printf("%v: Bad keep alive ID received", player)
+			player.log().Warn("%v: Bad keep alive ID received", player)
 			player.Stop()
 			return
 		}
@@ -668,9 +1240,7 @@ func (player *Player) pingReceived(id int32) {
 	// Check that there wasn't an apparent time-shift on this before broadcasting
 	// this latency value.
 	if latencyNs >= 0 && latencyNs < PingTimeoutNs {
-		buf := new(bytes.Buffer)
-		proto.WriteUserListItem(buf, player.name, true, int16(latencyNs/1e6))
-		player.game.BroadcastPacket(buf.Bytes())
+		player.game.SetPlayerPing(player.EntityId, int16(latencyNs/1e6))
 	}
 
 	player.ping.running = false
@@ -680,23 +1250,23 @@ func (player *Player) pingReceived(id int32) {
 
 func (player *Player) mainLoop() {
 	defer func() {
-		// Close the transmitLoop and receiveLoop cleanly.
-		player.txQueue <- nil
+		// Close the transmitLoop and receiveLoop cleanly. Queued packets (such as
+		// a disconnect message) are written before the connection is closed.
+		player.stopTransmitLoop()
 		player.conn.Close()
+		player.capture.stop()
 
 		player.onDisconnect <- player.EntityId
 
 		if player.ping.timer != nil {
 			player.ping.timer.Stop()
 		}
-
-		buf := new(bytes.Buffer)
-		proto.WriteUserListItem(buf, player.name, false, 0)
-		player.game.BroadcastPacket(buf.Bytes())
 	}()
 
 	expVarPlayerConnectionCount.Add(1)
 	defer expVarPlayerDisconnectionCount.Add(1)
+	metrics.Server.PlayerConnected()
+	defer metrics.Server.PlayerDisconnected()
 
 	player.chunkSubs.Init(player)
 	defer player.chunkSubs.Close()
@@ -704,7 +1274,7 @@ func (player *Player) mainLoop() {
 	// Start the keep-alive/latency pings.
 	player.pingNew()
 
-	player.sendChatMessage(fmt.Sprintf("%s has joined", player.name), false)
+	player.game.BroadcastMessage(fmt.Sprintf("%s has joined", player.name))
 
 MAINLOOP:
 	for {
@@ -721,17 +1291,34 @@ MAINLOOP:
 		case _ = <-player.ping.timer.C:
 			player.pingTimeout()
 
+		case _ = <-player.ticks:
+			player.tick()
+
 		case err := <-player.rxErrChan:
-			log.Printf("%v: receive loop failed: %v", player, err)
+			player.log().Info("%v: receive loop failed: %v", player, err)
 			player.Stop()
 
 		case err := <-player.txErrChan:
-			log.Printf("%v: send loop failed: %v", player, err)
+			player.log().Info("%v: send loop failed: %v", player, err)
 			player.Stop()
 		}
 	}
 }
 
+// tick runs the game logic for the player that happens over time, such as
+// hunger.
+func (player *Player) tick() {
+	player.lock.Lock()
+	defer player.lock.Unlock()
+
+	if !player.spawnComplete {
+		return
+	}
+
+	player.tickEating()
+	player.tickFood()
+}
+
 func (player *Player) notifyChunkLoad() {
 	if !player.spawnComplete {
 		player.spawnComplete = true
@@ -746,12 +1333,212 @@ func (player *Player) notifyChunkLoad() {
 			&player.position, player.position.Y+player.height,
 			&player.look, false)
 		player.inventory.WriteWindowItems(buf)
-		proto.WriteUpdateHealth(buf, player.health, player.food, 0)
+		proto.WriteUpdateHealth(buf, player.health, player.foodLevel, player.saturation)
+		proto.WritePlayerExperience(buf, int8(player.experience), int8(player.level), player.totalExperience)
 
 		player.TransmitPacket(buf.Bytes())
 	}
 }
 
+// sendStatusMetadata tells other players nearby about the player's crouching
+// and sprinting. It must be called with player.lock held.
+func (player *Player) sendStatusMetadata() {
+	var flags byte
+	if player.sneaking {
+		flags |= EntityFlagCrouched
+	}
+	if player.sprinting {
+		flags |= EntityFlagSprinting
+	}
+
+	buf := new(bytes.Buffer)
+	proto.WriteEntityMetadata(buf, player.EntityId, []proto.EntityMetadata{
+		{proto.EntityMetadataByte, 0, flags},
+	})
+
+	if shard, ok := player.chunkSubs.CurrentShardClient(); ok {
+		shard.ReqMulticastPlayers(player.chunkSubs.curChunkLoc, player.EntityId, buf.Bytes())
+	}
+}
+
+// useBed asks the game to put the player to sleep in the bed at bedLoc, if
+// they can reach it. It must be called with player.lock held.
+func (player *Player) useBed(bedLoc *BlockXyz) {
+	if !player.canUseBed(bedLoc) {
+		return
+	}
+
+	player.game.RequestSleep(player.EntityId, *bedLoc)
+}
+
+// enterBed puts the player to sleep in the bed at bedLoc, once the game has
+// agreed to it, and shows them in bed to other players nearby. It must be
+// called with player.lock held.
+func (player *Player) enterBed(bedLoc *BlockXyz) {
+	if !player.canUseBed(bedLoc) {
+		// The player has moved away or died since asking to sleep.
+		player.game.PlayerWokeUp(player.EntityId)
+		return
+	}
+
+	player.inBed = true
+	player.bedLoc = *bedLoc
+
+	buf := new(bytes.Buffer)
+	proto.WriteBedUse(buf, player.EntityId, true, bedLoc)
+	player.multicastToSelfAndNearby(buf.Bytes())
+}
+
+// canUseBed returns true if the player is awake and alive, and close enough to
+// the bed at bedLoc to get into it. It must be called with player.lock held.
+func (player *Player) canUseBed(bedLoc *BlockXyz) bool {
+	if player.dead || player.inBed {
+		return false
+	}
+
+	bedAbsPos := bedLoc.MidPointToAbsXyz()
+	if !bedAbsPos.IsWithinDistanceOf(&player.position, MaxInteractDistance) {
+		player.log().Debug("%v: Ignoring use of bed at %v (too far away)", player, bedLoc)
+		return false
+	}
+
+	return true
+}
+
+// wakeUp gets the player out of bed, if they are in one. This happens when
+// they leave the bed themselves, move away from it, are hurt, or when the night
+// is skipped. It must be called with player.lock held.
+func (player *Player) wakeUp() {
+	if !player.inBed {
+		return
+	}
+
+	player.inBed = false
+
+	buf := new(bytes.Buffer)
+	proto.WriteEntityAnimation(buf, player.EntityId, EntityAnimationLeaveBed)
+	player.multicastToSelfAndNearby(buf.Bytes())
+
+	player.game.PlayerWokeUp(player.EntityId)
+}
+
+// multicastToSelfAndNearby sends a packet about the player to them and to
+// other players nearby.
+func (player *Player) multicastToSelfAndNearby(packet []byte) {
+	player.TransmitPacket(packet)
+	if shard, ok := player.chunkSubs.CurrentShardClient(); ok {
+		shard.ReqMulticastPlayers(player.chunkSubs.curChunkLoc, player.EntityId, packet)
+	}
+}
+
+// setGameType changes the player's game mode, and tells the client about it.
+// It must be called with player.lock held.
+func (player *Player) setGameType(gameType GameType) {
+	if player.gameType == gameType {
+		return
+	}
+	player.gameType = gameType
+	player.fallDistance = 0
+
+	buf := new(bytes.Buffer)
+	proto.WriteState(buf, StateReasonChangeGameMode, byte(gameType))
+	player.TransmitPacket(buf.Bytes())
+}
+
+// applyDamage reduces the player's health by the given amount, and tells the
+// client about the new health. The player dies if their health reaches zero,
+// and remains dead until the client sends a respawn packet. It must be called
+// with player.lock held.
+func (player *Player) applyDamage(amount Health, cause string) {
+	if player.dead {
+		return
+	}
+
+	player.health -= amount
+	if player.health < 0 {
+		player.health = 0
+	} else if player.health > MaxHealth {
+		player.health = MaxHealth
+	}
+
+	player.sendHealth()
+
+	if amount > 0 {
+		player.wakeUp()
+		player.addExhaustion(ExhaustionDamage)
+	}
+
+	if player.health == 0 {
+		player.dead = true
+		player.fallDistance = 0
+		player.game.BroadcastMessage(fmt.Sprintf("%s %s and died", player.name, cause))
+	}
+}
+
+// respawn revives a dead player at their spawn position with full health. The
+// player's position and health are sent to the client by notifyChunkLoad once
+// the chunk at the spawn position has been resent. It must be called with
+// player.lock held.
+func (player *Player) respawn() {
+	player.dead = false
+	player.health = MaxHealth
+	player.foodLevel = MaxFoodUnits
+	player.saturation = InitialSaturation
+	player.exhaustion = 0
+	player.foodTimer = 0
+	player.eatTimer = 0
+	// Experience is lost on death.
+	player.experience = 0
+	player.level = 0
+	player.totalExperience = 0
+	player.fallDistance = 0
+	player.position = AbsXyz{
+		X: AbsCoord(player.spawnBlock.X),
+		Y: AbsCoord(player.spawnBlock.Y),
+		Z: AbsCoord(player.spawnBlock.Z),
+	}
+	player.height = StanceNormal
+	player.spawnComplete = false
+
+	// TODO pass proper dimension and map seed, as for the login packet.
+	buf := new(bytes.Buffer)
+	proto.WriteRespawn(buf, DimensionNormal, GameDifficultyNormal, player.gameType, MaxYCoord+1, 0)
+	player.TransmitPacket(buf.Bytes())
+
+	player.chunkSubs.Respawn()
+}
+
+// changeWorld moves the player to the spawn position of another world, whose
+// chunks are reached through shardConnecter. joinPackets are sent to the
+// client after it has been told about the move. It must be called with
+// player.lock held.
+func (player *Player) changeWorld(world string, shardConnecter gamerules.IShardConnecter, spawnBlock BlockXyz, joinPackets []byte) {
+	player.closeCurrentWindow(true)
+
+	player.world = world
+	player.shardConnecter = shardConnecter
+	player.spawnBlock = spawnBlock
+	player.fallDistance = 0
+	player.position = AbsXyz{
+		X: AbsCoord(spawnBlock.X),
+		Y: AbsCoord(spawnBlock.Y),
+		Z: AbsCoord(spawnBlock.Z),
+	}
+	player.height = StanceNormal
+	player.spawnComplete = false
+	// The game stops counting the player as asleep when they leave a world.
+	player.inBed = false
+
+	// The client discards its chunks on receiving a respawn packet.
+	buf := new(bytes.Buffer)
+	proto.WriteRespawn(buf, DimensionNormal, GameDifficultyNormal, player.gameType, MaxYCoord+1, 0)
+	proto.WriteSpawnPosition(buf, &player.spawnBlock)
+	buf.Write(joinPackets)
+	player.TransmitPacket(buf.Bytes())
+
+	player.chunkSubs.ChangeWorld(shardConnecter)
+}
+
 func (player *Player) inventorySubscribed(block *BlockXyz, invTypeId InvTypeId, slots []proto.WindowSlot) {
 	if player.remoteInv != nil {
 		player.closeCurrentWindow(true)
@@ -812,7 +1599,7 @@ func (player *Player) inventoryTxState(block *BlockXyz, txId TxId, accepted bool
 	}
 
 	buf := new(bytes.Buffer)
-	proto.WriteWindowTransaction(buf, player.curWindow.WindowId(), txId, accepted)
+	player.writeWindowTransaction(buf, player.curWindow.WindowId(), txId, accepted)
 	player.TransmitPacket(buf.Bytes())
 }
 
@@ -840,7 +1627,7 @@ func (player *Player) placeHeldItem(target *BlockXyz, wasHeld *gamerules.Slot) {
 
 		player.inventory.TakeOneHeldItem(&into)
 
-		shardClient.ReqPlaceItem(*target, into)
+		shardClient.ReqPlaceItem(*target, into, player.look)
 	}
 }
 
@@ -874,6 +1661,24 @@ func (player *Player) giveItem(atPosition *AbsXyz, item *gamerules.Slot) {
 	player.inventory.PutItem(item)
 }
 
+// World returns the name of the world that the player is in.
+func (player *Player) World() string {
+	player.lock.Lock()
+	defer player.lock.Unlock()
+	return player.world
+}
+
+// ChangeWorld moves the player to the spawn position of another world. The
+// player unsubscribes from the chunks of their old world, and subscribes to
+// the chunks around spawnBlock through shardConnecter. joinPackets are sent
+// once the client has been told about the move, as it forgets the old world's
+// state such as the weather.
+func (player *Player) ChangeWorld(world string, shardConnecter gamerules.IShardConnecter, spawnBlock BlockXyz, joinPackets []byte) {
+	player.Enqueue(func(player *Player) {
+		player.changeWorld(world, shardConnecter, spawnBlock, joinPackets)
+	})
+}
+
 // Enqueue queues a function to run with the player lock within the player's
 // mainloop.
 func (player *Player) Enqueue(f func(*Player)) {
@@ -883,21 +1688,32 @@ func (player *Player) Enqueue(f func(*Player)) {
 	player.mainQueue <- f
 }
 
-func (player *Player) sendChatMessage(message string, sendToSelf bool) {
-	buf := new(bytes.Buffer)
-	proto.WriteChatMessage(buf, message)
-
-	packet := buf.Bytes()
+// writeWindowTransaction writes the outcome of a window click, and records
+// rejected clicks until the client confirms them. It must be called with
+// player.lock held.
+func (player *Player) writeWindowTransaction(writer io.Writer, windowId WindowId, txId TxId, accepted bool) {
+	if !accepted {
+		player.rejectedTx.pending = true
+		player.rejectedTx.windowId = windowId
+		player.rejectedTx.txId = txId
+	}
+	proto.WriteWindowTransaction(writer, windowId, txId, accepted)
+}
 
-	if sendToSelf {
-		player.TransmitPacket(packet)
+// throwItem throws the item out into the world in the direction that the
+// player is looking. The item is emptied. It must be called with player.lock
+// held.
+func (player *Player) throwItem(shardClient gamerules.IPlayerShardClient, item *gamerules.Slot) {
+	if item.IsEmpty() {
+		return
 	}
 
-	player.chunkSubs.curShard.ReqMulticastPlayers(
-		player.chunkSubs.curChunkLoc,
-		player.EntityId,
-		packet,
-	)
+	velocity := physics.VelocityFromLook(player.look, 0.50)
+	position := player.position
+	position.Y += player.height
+	shardClient.ReqDropItem(*item, position, velocity, TicksPerSecond/2)
+
+	item.Clear()
 }
 
 // closeCurrentWindow closes any open window. It must be called with
@@ -916,6 +1732,14 @@ func (player *Player) closeCurrentWindow(sendClosePacket bool) {
 	player.inventory.Resubscribe()
 }
 
+// moveWithVehicle moves the player along with the vehicle that they are
+// riding. The client moves itself along with the vehicle, so isn't told about
+// the move.
+func (player *Player) moveWithVehicle(pos AbsXyz) {
+	player.position = pos
+	player.chunkSubs.Move(&player.position)
+}
+
 // setPositionLook sets the player's position and look angle. It also notifies
 // other players in the area of interest that the player has moved.
 func (player *Player) setPositionLook(pos AbsXyz, look LookDegrees) {
@@ -0,0 +1,103 @@
+package player
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+
+	"chunkymonkey/logging"
+	"chunkymonkey/record"
+)
+
+// packetCapture records the packets sent to and received from a player while
+// capturing is started. When not capturing, it records nothing.
+type packetCapture struct {
+	lock    sync.Mutex
+	player  *Player // For logging. May be nil.
+	capture *record.Capture
+}
+
+func (c *packetCapture) init(player *Player) {
+	c.player = player
+}
+
+// log returns the logger for the player being captured.
+func (c *packetCapture) log() logging.Logger {
+	if c.player == nil {
+		return logging.Default
+	}
+	return c.player.log()
+}
+
+func (c *packetCapture) start(capture *record.Capture) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.closeCapture()
+	c.capture = capture
+}
+
+func (c *packetCapture) stop() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.closeCapture()
+}
+
+func (c *packetCapture) enabled() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.capture != nil
+}
+
+// record writes data to the capture, if capturing. Capturing stops if the
+// capture cannot be written to.
+func (c *packetCapture) record(direction record.Direction, data []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.capture == nil {
+		return
+	}
+	if err := c.capture.Record(direction, data); err != nil {
+		c.log().Warn("Stopping packet capture: %v", err)
+		c.closeCapture()
+	}
+}
+
+// closeCapture must be called with c.lock held.
+func (c *packetCapture) closeCapture() {
+	if c.capture == nil {
+		return
+	}
+	if err := c.capture.Close(); err != nil {
+		c.log().Warn("Error closing packet capture: %v", err)
+	}
+	c.capture = nil
+}
+
+// captureReader keeps the data read from the client while capturing, so that
+// each received packet can be recorded in one piece.
+type captureReader struct {
+	reader  io.Reader
+	capture *packetCapture
+	buf     bytes.Buffer
+}
+
+func (r *captureReader) Read(p []byte) (n int, err os.Error) {
+	n, err = r.reader.Read(p)
+	if n > 0 && r.capture.enabled() {
+		r.buf.Write(p[:n])
+	}
+	return
+}
+
+// flush records the data read since the last flush as a received packet.
+func (r *captureReader) flush() {
+	if r.buf.Len() > 0 {
+		r.capture.record(record.DirectionClientToServer, r.buf.Bytes())
+		r.buf.Reset()
+	}
+}
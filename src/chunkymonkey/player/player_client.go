@@ -121,3 +121,57 @@ func (p *playerClient) SetPositionLook(pos AbsXyz, look LookDegrees) {
 		player.setPositionLook(pos, look)
 	})
 }
+
+func (p *playerClient) RejectMove(position AbsXyz) {
+	p.player.Enqueue(func(player *Player) {
+		player.rejectMove(position)
+	})
+}
+
+func (p *playerClient) ApplyDamage(amount Health, cause string) {
+	p.player.Enqueue(func(player *Player) {
+		player.applyDamage(amount, cause)
+	})
+}
+
+func (p *playerClient) UseBed(bedLoc BlockXyz) {
+	p.player.Enqueue(func(player *Player) {
+		player.useBed(&bedLoc)
+	})
+}
+
+func (p *playerClient) EnterBed(bedLoc BlockXyz) {
+	p.player.Enqueue(func(player *Player) {
+		player.enterBed(&bedLoc)
+	})
+}
+
+func (p *playerClient) WakeUp() {
+	p.player.Enqueue(func(player *Player) {
+		player.wakeUp()
+	})
+}
+
+func (p *playerClient) MoveWithVehicle(position AbsXyz) {
+	p.player.Enqueue(func(player *Player) {
+		player.moveWithVehicle(position)
+	})
+}
+
+func (p *playerClient) BlockBroken(target BlockXyz) {
+	p.player.Enqueue(func(player *Player) {
+		player.blockBroken()
+	})
+}
+
+func (p *playerClient) GiveExperience(amount int16) {
+	p.player.Enqueue(func(player *Player) {
+		player.giveExperience(amount)
+	})
+}
+
+func (p *playerClient) SetGameType(gameType GameType) {
+	p.player.Enqueue(func(player *Player) {
+		player.setGameType(gameType)
+	})
+}
@@ -1,8 +1,6 @@
 package player
 
 import (
-	"log"
-
 	"chunkymonkey/gamerules"
 	. "chunkymonkey/types"
 )
@@ -26,6 +24,7 @@ type chunkSubscriptions struct {
 	curShardLoc    ShardXz                      // Shard the player is currently in.
 	curChunkLoc    ChunkXz                      // Chunk the player is currently in.
 	curShard       gamerules.IPlayerShardClient // Shard the player is hosted on.
+	radius         ChunkCoord                   // Distance of subscribed chunks from curChunkLoc.
 	shardClients   map[uint64]*shardRef         // Connections to shards.
 }
 
@@ -34,12 +33,45 @@ func (sub *chunkSubscriptions) Init(player *Player) {
 	sub.playerClient = &player.playerClient
 	sub.shardConnecter = player.shardConnecter
 	sub.entityId = player.EntityId
+	sub.shardClients = make(map[uint64]*shardRef)
+
+	sub.subscribeAroundPlayer()
+}
+
+// Respawn should be called after the player's position has been reset on
+// respawning. The client discards its chunks on respawning, so all chunks
+// around the player's new position are subscribed to afresh, and the player
+// will receive a notifyChunkLoad when their chunk has been sent.
+func (sub *chunkSubscriptions) Respawn() {
+	if ref, ok := sub.shardClients[sub.curShardLoc.Key()]; ok {
+		ref.shard.ReqRemovePlayerData(sub.curChunkLoc, false)
+	}
+	sub.unsubscribeFromChunks(orderedChunkSquare(sub.curChunkLoc, sub.radius))
+
+	sub.subscribeAroundPlayer()
+}
+
+// ChangeWorld should be called after the player's position has been reset on
+// moving to another world. Chunks in the old world are unsubscribed from, and
+// chunks around the player's new position are subscribed to through
+// shardConnecter.
+func (sub *chunkSubscriptions) ChangeWorld(shardConnecter gamerules.IShardConnecter) {
+	// Respawn unsubscribes through the existing shard connections before
+	// connecting to the new world's shards.
+	sub.shardConnecter = shardConnecter
+	sub.Respawn()
+}
+
+// subscribeAroundPlayer subscribes to the chunks around the player's current
+// position, and adds the player to the chunk that they are in.
+func (sub *chunkSubscriptions) subscribeAroundPlayer() {
+	player := sub.player
 	sub.curShardLoc = player.position.ToShardXz()
 	sub.curChunkLoc = player.position.ToChunkXz()
-	sub.shardClients = make(map[uint64]*shardRef)
+	sub.radius = player.viewDistance
 
-	initialChunkLocs := orderedChunkSquare(sub.curChunkLoc, ChunkRadius)
-	sub.subscribeToChunks(sub.curChunkLoc, initialChunkLocs)
+	chunkLocs := orderedChunkSquare(sub.curChunkLoc, sub.radius)
+	sub.subscribeToChunks(sub.curChunkLoc, chunkLocs)
 
 	sub.curShard = sub.shardClients[sub.curShardLoc.Key()].shard
 	sub.curShard.ReqAddPlayerData(
@@ -72,6 +104,35 @@ func (sub *chunkSubscriptions) Move(newLoc *AbsXyz) (notify bool) {
 	return
 }
 
+// CheckMove requests that the current shard check that the player's move did
+// not pass through solid blocks.
+func (sub *chunkSubscriptions) CheckMove(from, to *AbsXyz) {
+	sub.curShard.ReqCheckPlayerMove(*from, *to)
+}
+
+// SetRadius changes the distance of subscribed chunks around the player,
+// subscribing to or unsubscribing from chunks at the edge of the area as
+// necessary. It does nothing before Init has been called, as Init uses the
+// player's view distance.
+func (sub *chunkSubscriptions) SetRadius(radius ChunkCoord) {
+	if sub.shardClients == nil {
+		return
+	}
+
+	// The chunks in orderedChunkSquare are ordered by distance, so those
+	// outside of the smaller square come last.
+	switch {
+	case radius > sub.radius:
+		chunkLocs := orderedChunkSquare(sub.curChunkLoc, radius)
+		sub.subscribeToChunks(sub.curChunkLoc, chunkLocs[squareArea(sub.radius):])
+	case radius < sub.radius:
+		chunkLocs := orderedChunkSquare(sub.curChunkLoc, sub.radius)
+		sub.unsubscribeFromChunks(chunkLocs[squareArea(radius):])
+	}
+
+	sub.radius = radius
+}
+
 // Close closes down all shard connections. Use when the player is
 // disconnected.
 func (sub *chunkSubscriptions) Close() {
@@ -91,8 +152,11 @@ func (sub *chunkSubscriptions) Close() {
 // exists.
 func (sub *chunkSubscriptions) CurrentShardClient() (conn gamerules.IPlayerShardClient, ok bool) {
 	curShardLoc := sub.curChunkLoc.ToShardXz()
-	shardRef, ok := sub.shardClients[curShardLoc.Key()]
-	return shardRef.shard, ok
+	ref, ok := sub.shardClients[curShardLoc.Key()]
+	if !ok {
+		return
+	}
+	return ref.shard, true
 }
 
 // ShardClientForBlockXyz is a convenience function to get the correct shard
@@ -157,6 +221,23 @@ func (sub *chunkSubscriptions) subscribeToChunks(destLoc ChunkXz, chunkLocs []Ch
 	return
 }
 
+// prefetchChunks requests that shards load the chunks at the locations given.
+// Chunks in shards that are not connected to are ignored.
+func (sub *chunkSubscriptions) prefetchChunks(chunkLocs []ChunkXz) {
+	shardChunkLocs := make(map[uint64][]ChunkXz)
+	for _, chunkLoc := range chunkLocs {
+		shardLoc := chunkLoc.ToShardXz()
+		shardKey := shardLoc.Key()
+		shardChunkLocs[shardKey] = append(shardChunkLocs[shardKey], chunkLoc)
+	}
+
+	for shardKey, locs := range shardChunkLocs {
+		if ref, ok := sub.shardClients[shardKey]; ok {
+			ref.shard.ReqPrefetchChunks(locs)
+		}
+	}
+}
+
 // unsubscribeFromChunks unsubscribes from chunks for the chunk locations
 // given, and disconnects from shards where there are no subscribed chunks.
 func (sub *chunkSubscriptions) unsubscribeFromChunks(chunkLocs []ChunkXz) {
@@ -172,7 +253,7 @@ func (sub *chunkSubscriptions) unsubscribeFromChunks(chunkLocs []ChunkXz) {
 			}
 		} else {
 			// Odd - we don't have a shard connection for that chunk.
-			log.Printf("chunkSubscriptions.unsubscribeFromChunks() attempted to "+
+			sub.player.log().Debug("chunkSubscriptions.unsubscribeFromChunks() attempted to "+
 				"unsubscribe from chunk @%v in unconnected shard @%v.", chunkLoc, shardLoc)
 		}
 	}
@@ -181,7 +262,7 @@ func (sub *chunkSubscriptions) unsubscribeFromChunks(chunkLocs []ChunkXz) {
 // moveToChunk subscribes to chunks that are newly in range, and unsubscribes
 // to those that have just left.
 func (sub *chunkSubscriptions) moveToChunk(newChunkLoc ChunkXz, newLoc *AbsXyz) (notify bool) {
-	addChunkLocs := squareDifference(newChunkLoc, sub.curChunkLoc, ChunkRadius)
+	addChunkLocs := squareDifference(newChunkLoc, sub.curChunkLoc, sub.radius)
 	notify = sub.subscribeToChunks(newChunkLoc, addChunkLocs)
 
 	newShardLoc := newChunkLoc.ToShardXz()
@@ -200,9 +281,14 @@ func (sub *chunkSubscriptions) moveToChunk(newChunkLoc ChunkXz, newLoc *AbsXyz)
 		ref.shard.ReqRemovePlayerData(sub.curChunkLoc, false)
 	}
 
-	delChunkLocs := squareDifference(sub.curChunkLoc, newChunkLoc, ChunkRadius)
+	delChunkLocs := squareDifference(sub.curChunkLoc, newChunkLoc, sub.radius)
 	sub.unsubscribeFromChunks(delChunkLocs)
 
+	// Start loading the chunks just beyond the new edge of the subscribed area,
+	// as those are the ones most likely to be needed next.
+	prefetchChunkLocs := squareDifference(newChunkLoc, sub.curChunkLoc, sub.radius+1)
+	sub.prefetchChunks(prefetchChunkLocs)
+
 	sub.curChunkLoc = newChunkLoc
 
 	return
@@ -251,6 +337,13 @@ func squareDifference(centerA, centerB ChunkXz, radius ChunkCoord) []ChunkXz {
 	return result
 }
 
+// squareArea returns the number of chunks in a square with sides radius
+// chunks away from its center.
+func squareArea(radius ChunkCoord) int {
+	edgeSize := int(radius*2 + 1)
+	return edgeSize * edgeSize
+}
+
 // orderedChunkSquare creates a slice of chunk locations in a square centered
 // on `center`, with sides `radius` chunks away from the center. The chunk
 // locations are output in approx this order for radius=2 (where lower numbered
@@ -75,6 +75,27 @@ func TestChunkOrder(t *testing.T) {
 	testChunkOrder(5, ChunkXz{3, 1})
 }
 
+func TestOrderedChunkSquare_Count(t *testing.T) {
+	type Test struct {
+		radius   ChunkCoord
+		expected int
+	}
+
+	tests := []Test{
+		{0, 1},
+		{1, 9},
+		{2, 25},
+		{ChunkRadius, (2*ChunkRadius + 1) * (2*ChunkRadius + 1)},
+	}
+
+	for _, test := range tests {
+		locs := orderedChunkSquare(ChunkXz{-4, 7}, test.radius)
+		if len(locs) != test.expected {
+			t.Errorf("radius %d: expected %d chunks but got %d", test.radius, test.expected, len(locs))
+		}
+	}
+}
+
 // Slow, dumb and simple implementation of squareDifference() that should be
 // easy to check by eye. We use this to generate the expected results for tests
 // on squareDifference().
@@ -0,0 +1,1064 @@
+package player
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"chunkymonkey/gamerules"
+	"chunkymonkey/logging"
+	"chunkymonkey/metrics"
+	"chunkymonkey/proto"
+	"chunkymonkey/record"
+	. "chunkymonkey/types"
+	"nbt"
+)
+
+func TestIsValidMove(t *testing.T) {
+	type Test struct {
+		desc     string
+		to       AbsXyz
+		expected bool
+	}
+
+	const maxMove = 10
+	const maxFall = 100
+
+	// Positions are fed in sequence, each move starting from the last accepted
+	// position.
+	tests := []Test{
+		{"standing still", AbsXyz{0, 64, 0}, true},
+		{"walking", AbsXyz{0.3, 64, 0.2}, true},
+		{"jumping", AbsXyz{0.5, 65.2, 0.4}, true},
+		{"impossible horizontal jump", AbsXyz{50, 65.2, 0.4}, false},
+		{"impossible upwards jump", AbsXyz{0.5, 80, 0.4}, false},
+		{"moving at the limit", AbsXyz{10.5, 65.2, 0.4}, true},
+		{"falling a long way", AbsXyz{10.5, 5, 0.4}, true},
+		{"falling too far", AbsXyz{10.5, -150, 0.4}, false},
+	}
+
+	from := AbsXyz{0, 64, 0}
+	for _, test := range tests {
+		result := isValidMove(&from, &test.to, maxMove, maxFall)
+		if result != test.expected {
+			t.Errorf("%s: isValidMove(%v, %v) expected %t but got %t",
+				test.desc, from, test.to, test.expected, result)
+		}
+		if result {
+			from = test.to
+		}
+	}
+}
+
+func TestStopTransmitLoop_DrainsQueue(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+
+	player := &Player{
+		conn:      serverConn,
+		txQueue:   make(chan []byte, 128),
+		txErrChan: make(chan os.Error, 1),
+		txDone:    make(chan bool),
+	}
+
+	received := make(chan []byte)
+	go func() {
+		bs, _ := ioutil.ReadAll(clientConn)
+		received <- bs
+	}()
+
+	go player.transmitLoop()
+
+	expected := new(bytes.Buffer)
+	for i := 0; i < 100; i++ {
+		packet := []byte{byte(i), 1, 2, 3}
+		expected.Write(packet)
+		player.TransmitPacket(packet)
+	}
+
+	player.stopTransmitLoop()
+	serverConn.Close()
+
+	if err := <-player.txErrChan; err != nil {
+		t.Errorf("unexpected error from transmitLoop: %v", err)
+	}
+
+	if bs := <-received; !bytes.Equal(expected.Bytes(), bs) {
+		t.Errorf("expected %d bytes written before close, got %d", expected.Len(), len(bs))
+	}
+}
+
+func TestTransmitLoop_CountsPacketsSent(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	go ioutil.ReadAll(clientConn)
+
+	player := &Player{
+		conn:      serverConn,
+		txQueue:   make(chan []byte, 128),
+		txErrChan: make(chan os.Error, 1),
+		txDone:    make(chan bool),
+	}
+	go player.transmitLoop()
+
+	before := metrics.Server.Snapshot()
+	player.TransmitPacket([]byte{proto.PacketIdKeepAlive, 0, 0, 0, 1})
+	player.TransmitPacket([]byte{proto.PacketIdKeepAlive, 0, 0, 0, 2})
+	player.TransmitPacket([]byte{proto.PacketIdTimeUpdate, 0, 0, 0, 0, 0, 0, 0, 0})
+	player.stopTransmitLoop()
+	serverConn.Close()
+	after := metrics.Server.Snapshot()
+
+	if sent := after.PacketsSent[proto.PacketIdKeepAlive] - before.PacketsSent[proto.PacketIdKeepAlive]; sent != 2 {
+		t.Errorf("expected 2 keep-alive packets counted, got %d", sent)
+	}
+	if sent := after.PacketsSent[proto.PacketIdTimeUpdate] - before.PacketsSent[proto.PacketIdTimeUpdate]; sent != 1 {
+		t.Errorf("expected 1 time update packet counted, got %d", sent)
+	}
+}
+
+// closingBuffer is an io.WriteCloser that records whether it was closed.
+type closingBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *closingBuffer) Close() os.Error {
+	b.closed = true
+	return nil
+}
+
+func TestStartCapture_RecordsTransmittedPackets(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	go ioutil.ReadAll(clientConn)
+
+	player := &Player{
+		conn:      serverConn,
+		txQueue:   make(chan []byte, 128),
+		txErrChan: make(chan os.Error, 1),
+		txDone:    make(chan bool),
+	}
+	go player.transmitLoop()
+
+	captureLog := new(closingBuffer)
+	player.StartCapture(record.NewCapture(captureLog))
+	player.TransmitPacket([]byte{4, 5})
+	player.stopTransmitLoop()
+	player.capture.stop()
+	serverConn.Close()
+
+	if !captureLog.closed {
+		t.Errorf("expected capture log to be closed")
+	}
+	rec, err := record.ReadCaptureRecord(captureLog)
+	if err != nil {
+		t.Fatalf("failed to read capture: %v", err)
+	}
+	if rec.Direction != record.DirectionServerToClient || !bytes.Equal([]byte{4, 5}, rec.Data) {
+		t.Errorf("expected transmitted packet to be captured, got %+v", rec)
+	}
+	if _, err = record.ReadCaptureRecord(captureLog); err != os.EOF {
+		t.Errorf("expected one captured packet, got err=%v", err)
+	}
+}
+
+// messageRecordingGame records the messages broadcast to all players.
+type messageRecordingGame struct {
+	gamerules.IGame
+	messages []string
+}
+
+func (game *messageRecordingGame) BroadcastMessage(msg string) {
+	game.messages = append(game.messages, msg)
+}
+
+func newDamageTestPlayer() (*Player, *messageRecordingGame) {
+	game := new(messageRecordingGame)
+	player := &Player{
+		name:         "Bob",
+		health:       MaxHealth,
+		foodLevel:    MaxFoodUnits,
+		saturation:   InitialSaturation,
+		viewDistance: ChunkRadius,
+		txQueue:      make(chan []byte, 128),
+		game:         game,
+	}
+	return player, game
+}
+
+func TestApplyDamage(t *testing.T) {
+	player, game := newDamageTestPlayer()
+
+	player.applyDamage(5, "was hit")
+
+	if player.health != MaxHealth-5 {
+		t.Errorf("expected health %d but got %d", MaxHealth-5, player.health)
+	}
+	if player.dead {
+		t.Errorf("expected player to be alive")
+	}
+	if len(player.txQueue) != 1 {
+		t.Errorf("expected 1 health update packet, got %d", len(player.txQueue))
+	}
+	if len(game.messages) != 0 {
+		t.Errorf("expected no messages, got %v", game.messages)
+	}
+}
+
+func TestApplyDamage_Death(t *testing.T) {
+	player, game := newDamageTestPlayer()
+
+	player.applyDamage(MaxHealth+10, "was hit")
+
+	if player.health != 0 {
+		t.Errorf("expected health 0 but got %d", player.health)
+	}
+	if !player.dead {
+		t.Errorf("expected player to be dead")
+	}
+	if len(game.messages) != 1 {
+		t.Errorf("expected 1 death message, got %v", game.messages)
+	}
+
+	// Dead players take no further damage.
+	player.applyDamage(1, "was hit")
+	if len(player.txQueue) != 1 {
+		t.Errorf("expected 1 health update packet, got %d", len(player.txQueue))
+	}
+}
+
+func TestUpdateFall(t *testing.T) {
+	type Test struct {
+		desc           string
+		drops          []AbsCoord
+		expectedHealth Health
+	}
+
+	tests := []Test{
+		{"no fall", []AbsCoord{}, MaxHealth},
+		{"safe fall", []AbsCoord{-1, -2}, MaxHealth},
+		{"jumping", []AbsCoord{1, -1}, MaxHealth},
+		{"large drop", []AbsCoord{-5, -5, -2.5}, MaxHealth - 10},
+		{"fatal drop", []AbsCoord{-30, -30}, 0},
+	}
+
+	for _, test := range tests {
+		player, _ := newDamageTestPlayer()
+		for _, dy := range test.drops {
+			player.updateFall(dy, false)
+		}
+		player.updateFall(0, true)
+
+		if player.health != test.expectedHealth {
+			t.Errorf("%s: expected health %d but got %d", test.desc, test.expectedHealth, player.health)
+		}
+		if player.fallDistance != 0 {
+			t.Errorf("%s: expected fall distance to be reset, got %v", test.desc, player.fallDistance)
+		}
+	}
+}
+
+// subscriptionRecordingShard records which chunks are subscribed to.
+type subscriptionRecordingShard struct {
+	gamerules.IPlayerShardClient
+	subscribed map[uint64]int
+	playerAt   *ChunkXz
+	multicast  []byte // Last packet multicast to players.
+	dropped    []gamerules.Slot
+	hits       []DigStatus
+}
+
+// singleShardConnecter connects players to the same shard for all locations.
+type singleShardConnecter struct {
+	gamerules.IShardConnecter
+	shard gamerules.IPlayerShardClient
+}
+
+func (connecter *singleShardConnecter) PlayerShardConnect(entityId EntityId, player gamerules.IPlayerClient, shardLoc ShardXz) gamerules.IPlayerShardClient {
+	return connecter.shard
+}
+
+func (shard *subscriptionRecordingShard) Disconnect() {
+}
+
+func (shard *subscriptionRecordingShard) ReqSubscribeChunk(chunkLoc ChunkXz, notify bool) {
+	shard.subscribed[chunkLoc.ChunkKey()]++
+}
+
+func (shard *subscriptionRecordingShard) ReqUnsubscribeChunk(chunkLoc ChunkXz) {
+	shard.subscribed[chunkLoc.ChunkKey()]--
+}
+
+func (shard *subscriptionRecordingShard) ReqMulticastPlayers(chunkLoc ChunkXz, exclude EntityId, packet []byte) {
+	shard.multicast = packet
+}
+
+func (shard *subscriptionRecordingShard) ReqHitBlock(held gamerules.Slot, target BlockXyz, digStatus DigStatus, face Face) {
+	shard.hits = append(shard.hits, digStatus)
+}
+
+func (shard *subscriptionRecordingShard) ReqDropItem(content gamerules.Slot, position AbsXyz, velocity AbsVelocity, pickupImmunity Ticks) {
+	shard.dropped = append(shard.dropped, content)
+}
+
+func (shard *subscriptionRecordingShard) ReqPrefetchChunks(chunkLocs []ChunkXz) {
+}
+
+func (shard *subscriptionRecordingShard) ReqCheckPlayerMove(from, to AbsXyz) {
+}
+
+func (shard *subscriptionRecordingShard) ReqSetPlayerPosition(chunkLoc ChunkXz, position AbsXyz) {
+}
+
+func (shard *subscriptionRecordingShard) ReqAddPlayerData(chunkLoc ChunkXz, name string, position AbsXyz, look LookBytes, held ItemTypeId) {
+	shard.playerAt = &chunkLoc
+}
+
+func (shard *subscriptionRecordingShard) ReqRemovePlayerData(chunkLoc ChunkXz, isDisconnect bool) {
+	shard.playerAt = nil
+}
+
+// newShardTestPlayer creates a player connected to a single shard, which
+// records the requests made to it.
+func newShardTestPlayer() (*Player, *subscriptionRecordingShard) {
+	shard := &subscriptionRecordingShard{subscribed: make(map[uint64]int)}
+	player, _ := newDamageTestPlayer()
+	player.EntityId = 5
+	player.shardConnecter = &singleShardConnecter{shard: shard}
+	player.inventory.Init(player.EntityId, player)
+	player.chunkSubs.Init(player)
+	return player, shard
+}
+
+func TestPacketRespawn(t *testing.T) {
+	shard := &subscriptionRecordingShard{subscribed: make(map[uint64]int)}
+	player, _ := newDamageTestPlayer()
+	player.spawnBlock = BlockXyz{0, 64, 0}
+	player.position = AbsXyz{500, 70, 500}
+	player.spawnComplete = true
+
+	player.shardConnecter = &singleShardConnecter{shard: shard}
+	player.inventory.Init(player.EntityId, player)
+	player.chunkSubs.Init(player)
+
+	// Living players may not respawn.
+	player.PacketRespawn(DimensionNormal, 0, GameTypeSurvival, MaxYCoord+1, 0)
+	if player.position.X != 500 {
+		t.Errorf("living player was respawned")
+	}
+
+	player.applyDamage(MaxHealth, "was hit")
+	player.PacketRespawn(DimensionNormal, 0, GameTypeSurvival, MaxYCoord+1, 0)
+
+	if player.dead {
+		t.Errorf("expected player to be alive after respawning")
+	}
+	if player.health != MaxHealth {
+		t.Errorf("expected health %d but got %d", MaxHealth, player.health)
+	}
+	if player.position.X != 0 || player.position.Y != 64 || player.position.Z != 0 {
+		t.Errorf("expected position at spawn but got %v", player.position)
+	}
+
+	spawnChunkLoc := ChunkXz{0, 0}
+	if shard.playerAt == nil || !shard.playerAt.Equals(spawnChunkLoc) {
+		t.Errorf("expected player data in chunk %v but got %v", spawnChunkLoc, shard.playerAt)
+	}
+	if !player.chunkSubs.curChunkLoc.Equals(spawnChunkLoc) {
+		t.Errorf("expected current chunk %v but got %v", spawnChunkLoc, player.chunkSubs.curChunkLoc)
+	}
+
+	numSubscribed := 0
+	for key, count := range shard.subscribed {
+		switch count {
+		case 0:
+		case 1:
+			numSubscribed++
+		default:
+			t.Errorf("chunk with key %x subscribed %d times", key, count)
+		}
+	}
+	expectedSubscribed := int((ChunkRadius*2 + 1) * (ChunkRadius*2 + 1))
+	if numSubscribed != expectedSubscribed {
+		t.Errorf("expected %d chunks subscribed but got %d", expectedSubscribed, numSubscribed)
+	}
+	if count := shard.subscribed[spawnChunkLoc.ChunkKey()]; count != 1 {
+		t.Errorf("expected spawn chunk to be subscribed, count = %d", count)
+	}
+}
+
+func TestPlayer_changeWorld(t *testing.T) {
+	player, oldShard := newShardTestPlayer()
+	player.world = "world"
+	player.position = AbsXyz{500, 70, 500}
+	player.spawnComplete = true
+	player.chunkSubs.Respawn()
+
+	newShard := &subscriptionRecordingShard{subscribed: make(map[uint64]int)}
+	player.changeWorld("nether", &singleShardConnecter{shard: newShard}, BlockXyz{100, 64, 100}, nil)
+
+	if player.world != "nether" {
+		t.Errorf("expected player to be in world %q but got %q", "nether", player.world)
+	}
+	if player.position.X != 100 || player.position.Y != 64 || player.position.Z != 100 {
+		t.Errorf("expected position at new world's spawn but got %v", player.position)
+	}
+	if player.spawnComplete {
+		t.Errorf("expected player to wait for their chunk to load in the new world")
+	}
+
+	for key, count := range oldShard.subscribed {
+		if count != 0 {
+			t.Errorf("chunk with key %x in old world still subscribed %d times", key, count)
+		}
+	}
+	if oldShard.playerAt != nil {
+		t.Errorf("expected player data to be removed from old world but was in %v", oldShard.playerAt)
+	}
+
+	spawnChunkLoc := ChunkXz{6, 6}
+	if newShard.playerAt == nil || !newShard.playerAt.Equals(spawnChunkLoc) {
+		t.Errorf("expected player data in new world chunk %v but got %v", spawnChunkLoc, newShard.playerAt)
+	}
+	numSubscribed := 0
+	for _, count := range newShard.subscribed {
+		numSubscribed += count
+	}
+	expectedSubscribed := int((ChunkRadius*2 + 1) * (ChunkRadius*2 + 1))
+	if numSubscribed != expectedSubscribed {
+		t.Errorf("expected %d chunks subscribed in new world but got %d", expectedSubscribed, numSubscribed)
+	}
+	if count := newShard.subscribed[spawnChunkLoc.ChunkKey()]; count != 1 {
+		t.Errorf("expected spawn chunk to be subscribed, count = %d", count)
+	}
+}
+
+func TestPlayer_maxMoveDistance(t *testing.T) {
+	player := &Player{}
+	from := AbsXyz{0, 64, 0}
+	to := AbsXyz{12, 64, 0}
+	now := int64(100 * NanosecondsInSecond)
+
+	if isValidMove(&from, &to, player.maxMoveDistance(now), 100) {
+		t.Errorf("expected walking player to not move %v in one update", to.X-from.X)
+	}
+
+	player.sprinting = true
+	if !isValidMove(&from, &to, player.maxMoveDistance(now), 100) {
+		t.Errorf("expected sprinting player to move %v in one update", to.X-from.X)
+	}
+}
+
+func TestPlayer_maxMoveDistance_ScalesWithTime(t *testing.T) {
+	player := &Player{lastMoveNs: 10 * NanosecondsInSecond}
+	speed := AbsCoord(*playerMaxMoveSpeed)
+
+	// Shortly after the last move, the player may only move a little.
+	halfSecond := int64(NanosecondsInSecond / 2)
+	if maxMove := player.maxMoveDistance(player.lastMoveNs + halfSecond); maxMove != speed/2 {
+		t.Errorf("expected max move of %v after 0.5s but got %v", speed/2, maxMove)
+	}
+
+	// Distance not moved is kept for later moves.
+	player.moveAllowance = 1
+	if maxMove := player.maxMoveDistance(player.lastMoveNs + halfSecond); maxMove != 1+speed/2 {
+		t.Errorf("expected max move of %v with allowance but got %v", 1+speed/2, maxMove)
+	}
+
+	// After a long time, the player may move as far as in any single update.
+	if maxMove := player.maxMoveDistance(player.lastMoveNs + 60*NanosecondsInSecond); maxMove != AbsCoord(*playerMaxMoveDistance) {
+		t.Errorf("expected max move of %v after a minute but got %v", *playerMaxMoveDistance, maxMove)
+	}
+}
+
+func TestPacketEntityAction(t *testing.T) {
+	player, shard := newShardTestPlayer()
+
+	type Test struct {
+		action        EntityAction
+		expectedFlags byte
+	}
+
+	tests := []Test{
+		{EntityActionCrouch, EntityFlagCrouched},
+		{EntityActionStartSprint, EntityFlagCrouched | EntityFlagSprinting},
+		{EntityActionUncrouch, EntityFlagSprinting},
+		{EntityActionStopSprint, 0},
+	}
+
+	for _, test := range tests {
+		shard.multicast = nil
+		player.PacketEntityAction(player.EntityId, test.action)
+
+		expected := new(bytes.Buffer)
+		proto.WriteEntityMetadata(expected, player.EntityId, []proto.EntityMetadata{
+			{proto.EntityMetadataByte, 0, test.expectedFlags},
+		})
+		if !bytes.Equal(expected.Bytes(), shard.multicast) {
+			t.Errorf("action %d: expected metadata packet %x but got %x",
+				test.action, expected.Bytes(), shard.multicast)
+		}
+	}
+
+	// Actions for other entities are ignored.
+	shard.multicast = nil
+	player.PacketEntityAction(player.EntityId+1, EntityActionCrouch)
+	if player.sneaking || shard.multicast != nil {
+		t.Errorf("expected action for another entity to be ignored")
+	}
+}
+
+func TestPacketEntityAnimation(t *testing.T) {
+	player, shard := newShardTestPlayer()
+
+	type Test struct {
+		entityId  EntityId
+		animation EntityAnimation
+		relayed   bool
+	}
+
+	tests := []Test{
+		{5, EntityAnimationSwingArm, true},
+		{5, EntityAnimationNone, false},
+		{5, EntityAnimationDamage, false},
+		{6, EntityAnimationSwingArm, false},
+	}
+
+	for _, test := range tests {
+		shard.multicast = nil
+		player.PacketEntityAnimation(test.entityId, test.animation)
+
+		var expected []byte
+		if test.relayed {
+			buf := new(bytes.Buffer)
+			proto.WriteEntityAnimation(buf, player.EntityId, test.animation)
+			expected = buf.Bytes()
+		}
+		if !bytes.Equal(expected, shard.multicast) {
+			t.Errorf("entity %d animation %d: expected packet %x but got %x",
+				test.entityId, test.animation, expected, shard.multicast)
+		}
+	}
+}
+
+func TestPacketWindowClose_ThrowsCursor(t *testing.T) {
+	player, shard := newShardTestPlayer()
+	player.cursor = gamerules.Slot{ItemTypeId: 1, Count: 10}
+
+	player.PacketWindowClose(WindowIdInventory)
+
+	if !player.cursor.IsEmpty() {
+		t.Errorf("expected cursor to be empty but got %+v", player.cursor)
+	}
+	if len(shard.dropped) != 1 || shard.dropped[0].ItemTypeId != 1 || shard.dropped[0].Count != 10 {
+		t.Errorf("expected cursor items to be dropped, got %+v", shard.dropped)
+	}
+
+	// Closing again with nothing on the cursor drops nothing.
+	player.PacketWindowClose(WindowIdInventory)
+	if len(shard.dropped) != 1 {
+		t.Errorf("expected no further drops, got %+v", shard.dropped)
+	}
+}
+
+func TestPacketWindowTransaction(t *testing.T) {
+	player, _ := newShardTestPlayer()
+
+	// Click on a slot that isn't in the inventory window, which is rejected.
+	expectedSlot := &proto.WindowSlot{ItemTypeId: -1}
+	player.PacketWindowClick(WindowIdInventory, 100, false, 7, false, expectedSlot)
+	if !player.rejectedTx.pending || player.rejectedTx.txId != 7 {
+		t.Fatalf("expected transaction 7 to await confirmation, got %+v", player.rejectedTx)
+	}
+
+	// Further clicks are ignored until the rejection is confirmed.
+	numPackets := len(player.txQueue)
+	player.PacketWindowClick(WindowIdInventory, 10, false, 8, false, expectedSlot)
+	if len(player.txQueue) != numPackets {
+		t.Errorf("expected click awaiting confirmation to be ignored")
+	}
+
+	// Confirmation of a different transaction is ignored.
+	player.PacketWindowTransaction(WindowIdInventory, 6, true)
+	if !player.rejectedTx.pending {
+		t.Errorf("expected transaction 7 to still await confirmation")
+	}
+
+	player.PacketWindowTransaction(WindowIdInventory, 7, true)
+	if player.rejectedTx.pending {
+		t.Errorf("expected transaction 7 to be confirmed")
+	}
+
+	player.PacketWindowClick(WindowIdInventory, 10, false, 9, false, expectedSlot)
+	if len(player.txQueue) == numPackets {
+		t.Errorf("expected click after confirmation to be handled")
+	}
+}
+
+func TestGiveItem_Partial(t *testing.T) {
+	defer func(items gamerules.ItemTypeMap) { gamerules.Items = items }(gamerules.Items)
+	gamerules.Items = gamerules.ItemTypeMap{
+		1: &gamerules.ItemType{Id: 1, Name: "stone", MaxStack: 64},
+	}
+
+	player, shard := newShardTestPlayer()
+	player.txQueue = make(chan []byte, 256)
+
+	// Fill the inventory, leaving space for only 4 more items.
+	for i := 0; i < 35; i++ {
+		player.inventory.PutItem(&gamerules.Slot{ItemTypeId: 1, Count: 64})
+	}
+	player.inventory.PutItem(&gamerules.Slot{ItemTypeId: 1, Count: 60})
+
+	item := gamerules.Slot{ItemTypeId: 1, Count: 10}
+	if !player.inventory.CanTakeItem(&item) {
+		t.Fatalf("expected the nearly full inventory to take some of the item")
+	}
+	player.giveItem(&AbsXyz{0.5, 64, 0.5}, &item)
+
+	// The remainder is thrown back to the chunk for later pickup.
+	if len(shard.dropped) != 1 || shard.dropped[0].Count != 6 {
+		t.Errorf("expected 6 items dropped back, got %v", shard.dropped)
+	}
+
+	full := gamerules.Slot{ItemTypeId: 1, Count: 1}
+	if player.inventory.CanTakeItem(&full) {
+		t.Errorf("expected the inventory to be full")
+	}
+}
+
+func TestChunkSubscriptions_ViewDistance(t *testing.T) {
+	type Test struct {
+		viewDistance ChunkCoord
+		expectedSide int
+	}
+
+	tests := []Test{
+		{3, 7},
+		{5, 11},
+		// View distances are limited to what the server allows.
+		{0, 2*MinChunkRadius + 1},
+		{ChunkRadius + 5, 2*ChunkRadius + 1},
+	}
+
+	for _, test := range tests {
+		shard := &subscriptionRecordingShard{subscribed: make(map[uint64]int)}
+		player, _ := newDamageTestPlayer()
+		player.position = AbsXyz{8, 64, 8}
+		player.viewDistance = clampViewDistance(test.viewDistance)
+		player.shardConnecter = &singleShardConnecter{shard: shard}
+		player.inventory.Init(player.EntityId, player)
+		player.chunkSubs.Init(player)
+
+		for x := ChunkCoord(-10 - ChunkRadius); x <= 10+ChunkRadius; x++ {
+			for z := ChunkCoord(-10 - ChunkRadius); z <= 10+ChunkRadius; z++ {
+				loc := ChunkXz{x, z}
+				count := shard.subscribed[loc.ChunkKey()]
+				radius := ChunkCoord(test.expectedSide / 2)
+				expected := 0
+				if x >= -radius && x <= radius && z >= -radius && z <= radius {
+					expected = 1
+				}
+				if count != expected {
+					t.Errorf("view distance %d: expected chunk %v subscribed %d times but got %d",
+						test.viewDistance, loc, expected, count)
+				}
+			}
+		}
+		if len(shard.subscribed) != test.expectedSide*test.expectedSide {
+			t.Errorf("view distance %d: expected %d chunks subscribed but got %d",
+				test.viewDistance, test.expectedSide*test.expectedSide, len(shard.subscribed))
+		}
+	}
+}
+
+func TestPacketClientSettings(t *testing.T) {
+	player, shard := newShardTestPlayer()
+	player.position = AbsXyz{8, 64, 8}
+
+	// Count the chunks that are subscribed to, and check that they are in a
+	// square around center.
+	checkSubscribed := func(desc string, center ChunkXz, radius ChunkCoord) {
+		numSubscribed := 0
+		for x := center.X - 20; x <= center.X+20; x++ {
+			for z := center.Z - 20; z <= center.Z+20; z++ {
+				loc := ChunkXz{x, z}
+				count := shard.subscribed[loc.ChunkKey()]
+				inSquare := (x-center.X).Abs() <= radius && (z-center.Z).Abs() <= radius
+				if (inSquare && count != 1) || (!inSquare && count != 0) {
+					t.Errorf("%s: chunk %v subscribed %d times", desc, loc, count)
+				}
+				numSubscribed += count
+			}
+		}
+		if expected := squareArea(radius); numSubscribed != expected {
+			t.Errorf("%s: expected %d chunks subscribed but got %d", desc, expected, numSubscribed)
+		}
+	}
+
+	checkSubscribed("initially", ChunkXz{0, 0}, ChunkRadius)
+
+	player.PacketClientSettings("en_US", ViewDistanceShort, 0)
+	if player.viewDistance != 4 || player.locale != "en_US" {
+		t.Errorf("expected view distance 4 and locale en_US, got %d and %q", player.viewDistance, player.locale)
+	}
+	checkSubscribed("short view distance", ChunkXz{0, 0}, 4)
+
+	player.position = AbsXyz{24, 64, 8}
+	player.chunkSubs.Move(&player.position)
+	checkSubscribed("after moving", ChunkXz{1, 0}, 4)
+
+	// The view distance is limited by the server.
+	player.PacketClientSettings("en_US", ViewDistanceFar, 0)
+	checkSubscribed("far view distance", ChunkXz{1, 0}, ChunkRadius)
+
+	// Bad view distances are ignored.
+	player.PacketClientSettings("en_US", ViewDistanceTiny+1, 0)
+	if player.viewDistance != ChunkRadius {
+		t.Errorf("expected bad view distance to be ignored, got %d", player.viewDistance)
+	}
+}
+
+func TestPacketCreativeInventoryAction(t *testing.T) {
+	defer func(items gamerules.ItemTypeMap) { gamerules.Items = items }(gamerules.Items)
+	gamerules.Items = gamerules.ItemTypeMap{
+		1: &gamerules.ItemType{Id: 1, Name: "stone", MaxStack: 64},
+	}
+
+	player, _ := newShardTestPlayer()
+	player.txQueue = make(chan []byte, 256)
+	stone := &proto.WindowSlot{ItemTypeId: 1, Count: 64}
+
+	// Players in survival mode have to find their own stone.
+	player.PacketCreativeInventoryAction(36, stone)
+	if held, _ := player.inventory.HeldItem(); !held.IsEmpty() {
+		t.Errorf("expected survival player's packet to be ignored, got %+v", held)
+	}
+
+	player.gameType = GameTypeCreative
+	player.PacketCreativeInventoryAction(36, stone)
+	if held, _ := player.inventory.HeldItem(); held.ItemTypeId != 1 || held.Count != 64 {
+		t.Errorf("expected creative player to be holding 64 stone, got %+v", held)
+	}
+
+	// Unknown items and overfull stacks can't be made.
+	player.PacketCreativeInventoryAction(37, &proto.WindowSlot{ItemTypeId: 2, Count: 1})
+	player.PacketCreativeInventoryAction(38, &proto.WindowSlot{ItemTypeId: 1, Count: 65})
+	for holding := SlotId(1); holding <= 2; holding++ {
+		player.inventory.SetHolding(holding)
+		if held, _ := player.inventory.HeldItem(); !held.IsEmpty() {
+			t.Errorf("expected bad item not to be put in slot %d, got %+v", 36+holding, held)
+		}
+	}
+
+	// Crafting slots and slots outside of the inventory can't be set.
+	player.PacketCreativeInventoryAction(0, stone)
+	player.PacketCreativeInventoryAction(100, stone)
+
+	// Slots can be emptied again.
+	player.inventory.SetHolding(0)
+	player.PacketCreativeInventoryAction(36, &proto.WindowSlot{ItemTypeId: -1})
+	if held, _ := player.inventory.HeldItem(); !held.IsEmpty() {
+		t.Errorf("expected held slot to be emptied, got %+v", held)
+	}
+}
+
+func TestSetGameType_CreativeSuppressesFallDamage(t *testing.T) {
+	player, _ := newDamageTestPlayer()
+
+	player.setGameType(GameTypeCreative)
+	if len(player.txQueue) != 1 {
+		t.Errorf("expected 1 game state packet, got %d", len(player.txQueue))
+	}
+
+	player.updateFall(-30, false)
+	player.updateFall(0, true)
+	if player.health != MaxHealth {
+		t.Errorf("expected no fall damage in creative mode, got health %d", player.health)
+	}
+
+	// Setting the same game type again doesn't tell the client.
+	player.setGameType(GameTypeCreative)
+	if len(player.txQueue) != 1 {
+		t.Errorf("expected no further game state packets, got %d", len(player.txQueue))
+	}
+
+	player.setGameType(GameTypeSurvival)
+	player.updateFall(-30, false)
+	player.updateFall(0, true)
+	if player.health != 0 {
+		t.Errorf("expected fatal fall damage in survival mode, got health %d", player.health)
+	}
+}
+
+func TestPacketPlayerBlockHit_GameType(t *testing.T) {
+	type Test struct {
+		gameType       GameType
+		status         DigStatus
+		expectedStatus []DigStatus
+	}
+
+	tests := []Test{
+		{GameTypeSurvival, DigBlockBroke, []DigStatus{DigBlockBroke}},
+		{GameTypeAdventure, DigStarted, nil},
+		{GameTypeAdventure, DigBlockBroke, nil},
+		{GameTypeCreative, DigStarted, []DigStatus{DigBlockBroke}},
+	}
+
+	for _, test := range tests {
+		player, shard := newShardTestPlayer()
+		player.position = AbsXyz{0.5, 64, 0.5}
+		player.gameType = test.gameType
+
+		player.PacketPlayerBlockHit(test.status, &BlockXyz{0, 63, 1}, FaceTop)
+
+		if len(shard.hits) != len(test.expectedStatus) {
+			t.Errorf("game type %d status %d: expected hits %v, got %v", test.gameType, test.status, test.expectedStatus, shard.hits)
+			continue
+		}
+		for i := range shard.hits {
+			if shard.hits[i] != test.expectedStatus[i] {
+				t.Errorf("game type %d status %d: expected hits %v, got %v", test.gameType, test.status, test.expectedStatus, shard.hits)
+			}
+		}
+	}
+}
+
+func TestPacketPlayerBlockHit_LogsIgnoredDigAtDebug(t *testing.T) {
+	player, shard := newShardTestPlayer()
+	logger := &logging.Recorder{}
+	player.logger = logger
+	player.position = AbsXyz{0.5, 64, 0.5}
+
+	// A dig at a block far out of reach is ignored.
+	player.PacketPlayerBlockHit(DigStarted, &BlockXyz{100, 63, 1}, FaceTop)
+
+	if len(shard.hits) != 0 {
+		t.Errorf("expected dig out of reach to be ignored, got hits %v", shard.hits)
+	}
+	if levels := logger.Levels(); len(levels) != 1 || levels[0] != logging.LevelDebug {
+		t.Errorf("expected one debug message, got %+v", logger.Entries)
+	}
+}
+
+func TestHunger_SprintingDepletesFood(t *testing.T) {
+	player, _ := newDamageTestPlayer()
+	player.saturation = 0
+	player.sprinting = true
+
+	// Sprinting 60 blocks makes the player 6 exhausted, costing one unit of
+	// food.
+	for i := 0; i < 12; i++ {
+		player.updateMoveExhaustion(3, 0, 4, true, true)
+	}
+	if player.foodLevel != MaxFoodUnits-1 {
+		t.Errorf("expected food %d, got %d", MaxFoodUnits-1, player.foodLevel)
+	}
+	if len(player.txQueue) != 1 {
+		t.Errorf("expected 1 health update packet, got %d", len(player.txQueue))
+	}
+
+	// Walking is free.
+	player.sprinting = false
+	for i := 0; i < 100; i++ {
+		player.updateMoveExhaustion(3, 0, 4, true, true)
+	}
+	if player.foodLevel != MaxFoodUnits-1 {
+		t.Errorf("expected walking not to use food, got %d", player.foodLevel)
+	}
+}
+
+func TestHunger_RegeneratesWhenFull(t *testing.T) {
+	player, _ := newDamageTestPlayer()
+	player.health = 10
+
+	for i := 0; i < FoodTickInterval-1; i++ {
+		player.tickFood()
+	}
+	if player.health != 10 {
+		t.Errorf("expected no healing before %d ticks, got health %d", FoodTickInterval, player.health)
+	}
+
+	player.tickFood()
+	if player.health != 11 {
+		t.Errorf("expected player to heal to 11, got health %d", player.health)
+	}
+	if player.exhaustion != ExhaustionRegen {
+		t.Errorf("expected healing to exhaust the player by %v, got %v", ExhaustionRegen, player.exhaustion)
+	}
+
+	// Hungry players don't heal.
+	player.foodLevel = RegenFoodUnits - 1
+	for i := 0; i < FoodTickInterval; i++ {
+		player.tickFood()
+	}
+	if player.health != 11 {
+		t.Errorf("expected hungry player not to heal, got health %d", player.health)
+	}
+}
+
+func TestHunger_StarvesWithoutFood(t *testing.T) {
+	player, game := newDamageTestPlayer()
+	player.foodLevel = 0
+	player.saturation = 0
+	player.health = 2
+
+	for i := 0; i < FoodTickInterval; i++ {
+		player.tickFood()
+	}
+	if player.health != 1 {
+		t.Errorf("expected starving player to lose 1 health, got health %d", player.health)
+	}
+
+	for i := 0; i < FoodTickInterval; i++ {
+		player.tickFood()
+	}
+	if !player.dead {
+		t.Errorf("expected player to starve to death")
+	}
+	if len(game.messages) != 1 || game.messages[0] != "Bob starved and died" {
+		t.Errorf("expected starvation message, got %v", game.messages)
+	}
+}
+
+func TestHunger_Eating(t *testing.T) {
+	defer func(items gamerules.ItemTypeMap) { gamerules.Items = items }(gamerules.Items)
+	gamerules.Items = gamerules.ItemTypeMap{
+		1:   &gamerules.ItemType{Id: 1, Name: "stone", MaxStack: 64},
+		297: &gamerules.ItemType{Id: 297, Name: "bread", MaxStack: 64, Food: 5, Saturation: 6},
+	}
+
+	player, _ := newShardTestPlayer()
+	player.txQueue = make(chan []byte, 256)
+	player.foodLevel = 10
+	player.saturation = 0
+	player.inventory.PutItem(&gamerules.Slot{ItemTypeId: 297, Count: 2})
+
+	// Letting go of the use button stops the player eating.
+	player.PacketPlayerBlockInteract(297, &BlockXyz{-1, -1, -1}, FaceNull, 2, 0)
+	player.PacketPlayerBlockHit(DigReleaseUseItem, &BlockXyz{}, 0)
+	for i := 0; i < EatTicks; i++ {
+		player.tickEating()
+	}
+	if player.foodLevel != 10 {
+		t.Errorf("expected player who stopped eating not to be fed, got food %d", player.foodLevel)
+	}
+
+	player.PacketPlayerBlockInteract(297, &BlockXyz{-1, -1, -1}, FaceNull, 2, 0)
+	for i := 0; i < EatTicks; i++ {
+		player.tickEating()
+	}
+	if player.foodLevel != 15 || player.saturation != 6 {
+		t.Errorf("expected food 15 and saturation 6, got %d and %v", player.foodLevel, player.saturation)
+	}
+	if held, _ := player.inventory.HeldItem(); held.ItemTypeId != 297 || held.Count != 1 {
+		t.Errorf("expected one bread to be eaten, got %+v", held)
+	}
+
+	// Stone isn't food.
+	player.inventory.SetSlot(37, &gamerules.Slot{ItemTypeId: 1, Count: 1})
+	player.inventory.SetHolding(1)
+	player.PacketPlayerBlockInteract(1, &BlockXyz{-1, -1, -1}, FaceNull, 1, 0)
+	if player.eatTimer != 0 {
+		t.Errorf("expected player not to eat stone")
+	}
+}
+
+func TestGiveExperience_LevelsUp(t *testing.T) {
+	player, _ := newDamageTestPlayer()
+
+	// 7 experience are needed for level 1, then 10 more for level 2, and 14
+	// more for level 3.
+	player.giveExperience(5)
+	if player.level != 0 || player.experience != 5 {
+		t.Errorf("expected level 0 with 5 experience, got level %d with %d", player.level, player.experience)
+	}
+
+	player.giveExperience(4)
+	if player.level != 1 || player.experience != 2 {
+		t.Errorf("expected level 1 with 2 experience, got level %d with %d", player.level, player.experience)
+	}
+
+	player.giveExperience(20)
+	if player.level != 2 || player.experience != 12 {
+		t.Errorf("expected level 2 with 12 experience, got level %d with %d", player.level, player.experience)
+	}
+	if player.totalExperience != 29 {
+		t.Errorf("expected 29 total experience, got %d", player.totalExperience)
+	}
+	if len(player.txQueue) != 3 {
+		t.Errorf("expected 3 experience packets, got %d", len(player.txQueue))
+	}
+}
+
+func TestMarshalNbt_RestoresWorld(t *testing.T) {
+	saved := NewPlayer(1, "nether", nil, nil, "alice", BlockXyz{0, 64, 0}, nil, nil, nil)
+	saved.position = AbsXyz{10, 70, 20}
+	tag := nbt.NewCompound()
+	if err := saved.MarshalNbt(tag); err != nil {
+		t.Fatalf("MarshalNbt: %v", err)
+	}
+
+	if world, ok := SavedWorld(tag); !ok || world != "nether" {
+		t.Errorf("expected saved world \"nether\" but got %q (ok=%t)", world, ok)
+	}
+
+	// Back in the same world, the saved position is restored.
+	loaded := NewPlayer(1, "nether", nil, nil, "alice", BlockXyz{0, 64, 0}, nil, nil, nil)
+	if err := loaded.UnmarshalNbt(tag); err != nil {
+		t.Fatalf("UnmarshalNbt: %v", err)
+	}
+	if loaded.position != saved.position {
+		t.Errorf("expected position %v but got %v", saved.position, loaded.position)
+	}
+
+	// In another world, the player starts at that world's spawn.
+	moved := NewPlayer(1, "world", nil, nil, "alice", BlockXyz{0, 64, 0}, nil, nil, nil)
+	if err := moved.UnmarshalNbt(tag); err != nil {
+		t.Fatalf("UnmarshalNbt: %v", err)
+	}
+	if expected := (AbsXyz{0, 64, 0}); moved.position != expected {
+		t.Errorf("expected position %v but got %v", expected, moved.position)
+	}
+}
+
+func TestTick_DropsExcessTicks(t *testing.T) {
+	player := NewPlayer(1, "world", nil, nil, "alice", BlockXyz{0, 64, 0}, nil, nil, nil)
+
+	// The player is not running, so ticks queue up until the queue is full.
+	for i := 0; i < maxQueuedTicks+5; i++ {
+		player.Tick()
+	}
+
+	if n := len(player.ticks); n != maxQueuedTicks {
+		t.Errorf("expected %d queued ticks, got %d", maxQueuedTicks, n)
+	}
+}
+
+// sleepRecordingGame records the beds that players ask to sleep in.
+type sleepRecordingGame struct {
+	gamerules.IGame
+	beds []BlockXyz
+}
+
+func (game *sleepRecordingGame) RequestSleep(entityId EntityId, bedLoc BlockXyz) {
+	game.beds = append(game.beds, bedLoc)
+}
+
+func TestUseBed_Reach(t *testing.T) {
+	game := new(sleepRecordingGame)
+	player := NewPlayer(1, "world", nil, nil, "alice", BlockXyz{0, 64, 0}, nil, game, nil)
+
+	// Beds out of reach are ignored.
+	player.useBed(&BlockXyz{20, 64, 0})
+	if len(game.beds) != 0 {
+		t.Errorf("expected no request to sleep in a bed out of reach, got %v", game.beds)
+	}
+
+	player.useBed(&BlockXyz{2, 64, 0})
+	if len(game.beds) != 1 {
+		t.Errorf("expected a request to sleep in a bed within reach, got %v", game.beds)
+	}
+}
@@ -0,0 +1,77 @@
+package chunkymonkey
+
+import (
+	"bytes"
+
+	"chunkymonkey/gamerules"
+	"chunkymonkey/proto"
+	. "chunkymonkey/types"
+)
+
+type playerListEntry struct {
+	name   string
+	pingMs int16
+	client gamerules.IPlayerClient
+}
+
+// playerList keeps the list of connected players that clients show when the
+// player list key is held, along with each player's latest ping. It must only
+// be used from the game goroutine.
+type playerList struct {
+	entries map[EntityId]*playerListEntry
+}
+
+func (list *playerList) init() {
+	list.entries = make(map[EntityId]*playerListEntry)
+}
+
+// add puts a newly joined player in the list. The new player is sent the whole
+// list, and everybody else is told about the new player.
+func (list *playerList) add(entityId EntityId, name string, client gamerules.IPlayerClient) {
+	entry := &playerListEntry{name: name, client: client}
+
+	buf := new(bytes.Buffer)
+	for _, other := range list.entries {
+		proto.WriteUserListItem(buf, other.name, true, other.pingMs)
+	}
+	proto.WriteUserListItem(buf, name, true, 0)
+	client.TransmitPacket(buf.Bytes())
+
+	buf = new(bytes.Buffer)
+	proto.WriteUserListItem(buf, name, true, 0)
+	list.multicast(buf.Bytes())
+
+	list.entries[entityId] = entry
+}
+
+// remove takes a player who has disconnected out of the list.
+func (list *playerList) remove(entityId EntityId) {
+	entry, ok := list.entries[entityId]
+	if !ok {
+		return
+	}
+	list.entries[entityId] = nil, false
+
+	buf := new(bytes.Buffer)
+	proto.WriteUserListItem(buf, entry.name, false, 0)
+	list.multicast(buf.Bytes())
+}
+
+// setPing updates a player's ping, as measured by keep-alive round trips.
+func (list *playerList) setPing(entityId EntityId, pingMs int16) {
+	entry, ok := list.entries[entityId]
+	if !ok {
+		return
+	}
+	entry.pingMs = pingMs
+
+	buf := new(bytes.Buffer)
+	proto.WriteUserListItem(buf, entry.name, true, pingMs)
+	list.multicast(buf.Bytes())
+}
+
+func (list *playerList) multicast(packet []byte) {
+	for _, entry := range list.entries {
+		entry.client.TransmitPacket(packet)
+	}
+}
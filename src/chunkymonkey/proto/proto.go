@@ -7,7 +7,7 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"utf8"
+	"reflect"
 	"regexp"
 
 	. "chunkymonkey/types"
@@ -17,8 +17,20 @@ const (
 	// Currently only this protocol version is supported.
 	protocolVersion = 17
 
-	maxUcs2Char  = 0xffff
-	ucs2ReplChar = 0xfffd
+	maxUcs2Char    = 0xffff
+	maxUnicodeChar = 0x10ffff
+	ucs2ReplChar   = 0xfffd
+
+	// UTF-16 surrogate pair ranges.
+	surrHigh = 0xd800
+	surrLow  = 0xdc00
+	surrEnd  = 0xe000
+	surrSelf = 0x10000
+
+	// Maximum lengths (in UCS-2 codepoints) of strings read from the network.
+	maxString16Length    = 0x7fff
+	maxChatMessageLength = 100
+	maxUsernameLength    = 16
 
 	// Packet type IDs
 	PacketIdKeepAlive            = 0x00
@@ -48,6 +60,7 @@ const (
 	PacketIdEntitySpawn          = 0x18
 	PacketIdPaintingSpawn        = 0x19
 	PacketIdExperienceOrb        = 0x1a
+	PacketIdStanceUpdate         = 0x1b
 	PacketIdEntityVelocity       = 0x1c
 	PacketIdEntityDestroy        = 0x1d
 	PacketIdEntity               = 0x1e
@@ -56,6 +69,7 @@ const (
 	PacketIdEntityLookAndRelMove = 0x21
 	PacketIdEntityTeleport       = 0x22
 	PacketIdEntityStatus         = 0x26
+	PacketIdAttachEntity         = 0x27
 	PacketIdEntityMetadata       = 0x28
 	PacketIdEntityEffect         = 0x29
 	PacketIdEntityRemoveEffect   = 0x2a
@@ -81,6 +95,7 @@ const (
 	PacketIdItemData             = 0x83
 	PacketIdIncrementStatistic   = 0xc8
 	PacketIdUserListItem         = 0xc9
+	PacketIdClientSettings       = 0xcc
 	PacketIdServerListPing       = 0xfe
 	PacketIdDisconnect           = 0xff
 )
@@ -91,12 +106,134 @@ func (err UnexpectedPacketIdError) String() string {
 	return fmt.Sprintf("unexpected packet ID: 0x%02x", byte(err))
 }
 
+// UnsupportedProtocolVersionError is returned when a client logs in using a
+// protocol version other than the one supported.
+type UnsupportedProtocolVersionError int32
+
+func (err UnsupportedProtocolVersionError) String() string {
+	return fmt.Sprintf("unsupported protocol version %d", int32(err))
+}
+
+// IsClientOutdated returns true if the client's protocol version is older
+// than the one supported.
+func (err UnsupportedProtocolVersionError) IsClientOutdated() bool {
+	return int32(err) < protocolVersion
+}
+
 type UnknownPacketIdError byte
 
 func (err UnknownPacketIdError) String() string {
 	return fmt.Sprintf("unknown packet ID: 0x%02x", byte(err))
 }
 
+// SkippedPacketIdError is returned when a packet that is not handled, but
+// whose length is known, has been read and discarded. The next packet may be
+// read as normal.
+type SkippedPacketIdError byte
+
+func (err SkippedPacketIdError) String() string {
+	return fmt.Sprintf("skipped unhandled packet ID: 0x%02x", byte(err))
+}
+
+// PacketError wraps an error that occurred while reading the body of a packet,
+// recording which packet was being read.
+type PacketError struct {
+	PacketId byte
+	Err      os.Error
+}
+
+func (err *PacketError) String() string {
+	return fmt.Sprintf("packet 0x%02x: %v", err.PacketId, err.Err)
+}
+
+func wrapPacketError(packetId byte, err os.Error) os.Error {
+	if err == nil {
+		return nil
+	}
+	return &PacketError{packetId, err}
+}
+
+// PacketReadLimiter wraps a reader from an untrusted source, and limits the
+// number of bytes that may be read for each packet. This stops a malicious
+// peer from claiming huge lengths for strings and arrays. ResetLimit must be
+// called before reading each packet.
+type PacketReadLimiter struct {
+	reader    io.Reader
+	limit     int
+	remaining int
+}
+
+func NewPacketReadLimiter(reader io.Reader, limit int) *PacketReadLimiter {
+	return &PacketReadLimiter{
+		reader:    reader,
+		limit:     limit,
+		remaining: limit,
+	}
+}
+
+// ResetLimit allows the full limit of bytes to be read for the next packet.
+func (l *PacketReadLimiter) ResetLimit() {
+	l.remaining = l.limit
+}
+
+// Read implements io.Reader. It returns ErrorPacketTooLarge once the limit for
+// the current packet has been used.
+func (l *PacketReadLimiter) Read(p []byte) (n int, err os.Error) {
+	if l.remaining <= 0 {
+		return 0, ErrorPacketTooLarge
+	}
+	if len(p) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err = l.reader.Read(p)
+	l.remaining -= n
+	return
+}
+
+// checkReadLength should be called before allocating space for numBytes of
+// data that are about to be read. It returns ErrorPacketTooLarge if reader is
+// a PacketReadLimiter that would not allow that many bytes to be read, and
+// ErrorBadPacketData if numBytes is negative.
+func checkReadLength(reader io.Reader, numBytes int) os.Error {
+	if numBytes < 0 {
+		return ErrorBadPacketData
+	}
+	if l, ok := reader.(*PacketReadLimiter); ok && numBytes > l.remaining {
+		return ErrorPacketTooLarge
+	}
+	return nil
+}
+
+// readCountedSlice reads an int32 count followed by that many fixed-size
+// records into the slice pointed to by slicePtr. elemSize is the encoded size
+// of each record, and is used to check the count before allocating space.
+func readCountedSlice(reader io.Reader, slicePtr interface{}, elemSize int) (err os.Error) {
+	var count int32
+	if err = binary.Read(reader, binary.BigEndian, &count); err != nil {
+		return
+	}
+
+	if err = checkReadLength(reader, elemSize*int(count)); err != nil {
+		return
+	}
+
+	slice := reflect.ValueOf(slicePtr).Elem()
+	slice.Set(reflect.MakeSlice(slice.Type(), int(count), int(count)))
+
+	return binary.Read(reader, binary.BigEndian, slice.Interface())
+}
+
+// writeCountedSlice writes an int32 count of the records in slice, followed
+// by the records themselves. The records must be of a fixed size.
+func writeCountedSlice(writer io.Writer, slice interface{}) (err os.Error) {
+	count := int32(reflect.ValueOf(slice).Len())
+	if err = binary.Write(writer, binary.BigEndian, &count); err != nil {
+		return
+	}
+
+	return binary.Write(writer, binary.BigEndian, slice)
+}
+
 // Regexp for ChatMessages
 var checkChatMessageRegexp = regexp.MustCompile("[ !\"#$%&'()*+,-./0123456789:;<=>?@ABCDEFGHIJKLMNOPQRSTUVWXYZ[\\]^_abcdefghijklmnopqrstuvwxyz{|}~⌂ÇüéâäàåçêëèïîìÄÅÉæÆôöòûùÿÖÜø£Ø×ƒáíóúñÑªº¿®¬½¼¡«»]*")
 var checkColorsRegexp = regexp.MustCompile("§.$")
@@ -104,6 +241,10 @@ var checkColorsRegexp = regexp.MustCompile("§.$")
 // Errors
 var illegalCharErr = os.NewError("Found one or more illegal characters. This could crash clients.")
 var colorTagEndErr = os.NewError("Found a color tag at the end of a message. This could crash clients.")
+var ErrorStrTooLong = os.NewError("string exceeds maximum length")
+var ErrorBadPacketData = os.NewError("bad packet data")
+var ErrorPacketTooLarge = os.NewError("packet exceeds maximum size")
+var ErrorRelMoveOutOfRange = os.NewError("relative move out of range")
 
 // Packets commonly received by both client and server
 type IPacketHandler interface {
@@ -132,6 +273,8 @@ type IServerPacketHandler interface {
 	PacketWindowClose(windowId WindowId)
 	PacketWindowClick(windowId WindowId, slot SlotId, rightClick bool, txId TxId, shiftClick bool, expectedSlot *WindowSlot)
 	PacketServerListPing()
+	PacketClientSettings(locale string, viewDistance byte, chatFlags byte)
+	PacketCreativeInventoryAction(slotId SlotId, slot *WindowSlot)
 }
 
 // Clients to the protocol must implement this interface to receive packets
@@ -140,7 +283,7 @@ type IClientPacketHandler interface {
 	PacketClientLogin(entityId EntityId, mapSeed RandomSeed, serverMode int32, dimension DimensionId, unknown int8, worldHeight, maxPlayers byte)
 	PacketClientHandshake(serverId string)
 	PacketTimeUpdate(time Ticks)
-	PacketBedUse(flag bool, bedLoc *BlockXyz)
+	PacketBedUse(entityId EntityId, inBed bool, bedLoc *BlockXyz)
 	PacketNamedEntitySpawn(entityId EntityId, name string, position *AbsIntXyz, look *LookBytes, currentItem ItemTypeId)
 	PacketEntityEquipment(entityId EntityId, slot SlotId, itemTypeId ItemTypeId, data ItemData)
 	PacketSpawnPosition(position *BlockXyz)
@@ -158,12 +301,15 @@ type IClientPacketHandler interface {
 	PacketEntityLook(entityId EntityId, look *LookBytes)
 	PacketEntityTeleport(entityId EntityId, position *AbsIntXyz, look *LookBytes)
 	PacketEntityStatus(entityId EntityId, status EntityStatus)
+	PacketAttachEntity(entityId EntityId, vehicleId EntityId)
 	PacketEntityMetadata(entityId EntityId, metadata []EntityMetadata)
 	PacketEntityEffect(entityId EntityId, effect EntityEffect, value int8, duration int16)
 	PacketEntityRemoveEffect(entityId EntityId, effect EntityEffect)
 	PacketPlayerExperience(experience, level int8, totalExperience int16)
 
 	PacketPreChunk(position *ChunkXz, mode ChunkLoadMode)
+	// PacketMapChunk receives the decompressed blocks, block data, block light
+	// and sky light, one after the other.
 	PacketMapChunk(position *BlockXyz, size *SubChunkSize, data []byte)
 	PacketBlockChangeMulti(chunkLoc *ChunkXz, blockCoords []SubChunkXyz, blockTypes []BlockId, blockMetaData []byte)
 	PacketBlockChange(blockLoc *BlockXyz, blockType BlockId, blockMetaData byte)
@@ -199,54 +345,88 @@ func byteToBool(b byte) bool {
 	return b != 0
 }
 
-// Conversion between UTF-8 and UCS-2.
-
-func encodeUtf8(codepoints []uint16) string {
-	bytesRequired := 0
+// Conversion between UTF-8 and UTF-16.
 
-	for _, cp := range codepoints {
-		bytesRequired += utf8.RuneLen(int(cp))
-	}
+func encodeUtf8(codepoints []uint16) (s string, err os.Error) {
+	runes := make([]int, 0, len(codepoints))
 
-	bs := make([]byte, bytesRequired)
-	curByte := 0
-	for _, cp := range codepoints {
-		curByte += utf8.EncodeRune(bs[curByte:], int(cp))
+	for i := 0; i < len(codepoints); i++ {
+		cp := int(codepoints[i])
+		switch {
+		case surrHigh <= cp && cp < surrLow:
+			// The first half of a surrogate pair must be followed by the second.
+			if i+1 >= len(codepoints) {
+				return "", ErrorBadPacketData
+			}
+			cp2 := int(codepoints[i+1])
+			if cp2 < surrLow || cp2 >= surrEnd {
+				return "", ErrorBadPacketData
+			}
+			cp = (cp-surrHigh)<<10 | (cp2 - surrLow) + surrSelf
+			i++
+		case surrLow <= cp && cp < surrEnd:
+			// Unpaired second half of a surrogate pair.
+			return "", ErrorBadPacketData
+		}
+		runes = append(runes, cp)
 	}
 
-	return string(bs)
+	return string(runes), nil
 }
 
 func decodeUtf8(s string) []uint16 {
 	codepoints := make([]uint16, 0, len(s))
 
 	for _, cp := range s {
-		// We only encode chars in the range U+0000 to U+FFFF.
-		if cp > maxUcs2Char || cp < 0 {
-			cp = ucs2ReplChar
+		switch {
+		case cp < 0 || cp > maxUnicodeChar || (surrHigh <= cp && cp < surrEnd):
+			// Not a character that can be represented in UTF-16.
+			codepoints = append(codepoints, ucs2ReplChar)
+		case cp > maxUcs2Char:
+			// Encode as a surrogate pair.
+			cp -= surrSelf
+			codepoints = append(codepoints,
+				uint16(surrHigh+(cp>>10)&0x3ff),
+				uint16(surrLow+cp&0x3ff))
+		default:
+			codepoints = append(codepoints, uint16(cp))
 		}
-		codepoints = append(codepoints, uint16(cp))
 	}
 
 	return codepoints
 }
 
-// 16-bit encoded strings. (UCS-2)
+// 16-bit encoded strings. (UTF-16)
 
 func readString16(reader io.Reader) (s string, err os.Error) {
+	return readString16Max(reader, maxString16Length)
+}
+
+// readString16Max reads a string, but returns ErrorStrTooLong without reading
+// the string data if its length is greater than maxLength.
+func readString16Max(reader io.Reader, maxLength int) (s string, err os.Error) {
 	var length uint16
 	err = binary.Read(reader, binary.BigEndian, &length)
 	if err != nil {
 		return
 	}
 
+	if int(length) > maxLength {
+		err = ErrorStrTooLong
+		return
+	}
+
+	if err = checkReadLength(reader, 2*int(length)); err != nil {
+		return
+	}
+
 	bs := make([]uint16, length)
 	err = binary.Read(reader, binary.BigEndian, bs)
 	if err != nil {
 		return
 	}
 
-	return encodeUtf8(bs), err
+	return encodeUtf8(bs)
 }
 
 func writeString16(writer io.Writer, s string) (err os.Error) {
@@ -261,12 +441,136 @@ func writeString16(writer io.Writer, s string) (err os.Error) {
 	return
 }
 
+// Variable-length integers. (LEB128)
+
+// VarInt is an int32 encoded in seven bit groups, least significant first,
+// with the top bit of each byte set if another byte follows. Negative values
+// are encoded as their two's complement, and so take the maximum of 5 bytes.
+type VarInt int32
+
+// VarLong is an int64 encoded in the same way as VarInt, in at most 10 bytes.
+type VarLong int64
+
+func readVarInt(reader io.Reader) (v VarInt, err os.Error) {
+	u, err := readUvarint(reader, 32)
+	return VarInt(int32(uint32(u))), err
+}
+
+func writeVarInt(writer io.Writer, v VarInt) os.Error {
+	return writeUvarint(writer, uint64(uint32(v)))
+}
+
+func readVarLong(reader io.Reader) (v VarLong, err os.Error) {
+	u, err := readUvarint(reader, 64)
+	return VarLong(int64(u)), err
+}
+
+func writeVarLong(writer io.Writer, v VarLong) os.Error {
+	return writeUvarint(writer, uint64(v))
+}
+
+// readUvarint reads an unsigned value of at most numBits bits. It returns
+// ErrorBadPacketData if the encoding sets bits beyond numBits, or is longer
+// than necessary.
+func readUvarint(reader io.Reader, numBits uint) (v uint64, err os.Error) {
+	var b [1]byte
+
+	for shift := uint(0); shift < numBits; shift += 7 {
+		if _, err = io.ReadFull(reader, b[:]); err != nil {
+			if err == os.EOF && shift > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+
+		group := uint64(b[0] & 0x7f)
+		if numBits-shift < 7 && group>>(numBits-shift) != 0 {
+			return 0, ErrorBadPacketData
+		}
+		v |= group << shift
+
+		if b[0]&0x80 == 0 {
+			if b[0] == 0 && shift > 0 {
+				// The final zero byte should have been left off.
+				return 0, ErrorBadPacketData
+			}
+			return v, nil
+		}
+	}
+
+	// The last byte that may hold value bits had its continuation bit set.
+	return 0, ErrorBadPacketData
+}
+
+func writeUvarint(writer io.Writer, v uint64) (err os.Error) {
+	var buf [10]byte
+
+	n := 0
+	for v >= 0x80 {
+		buf[n] = byte(v) | 0x80
+		v >>= 7
+		n++
+	}
+	buf[n] = byte(v)
+
+	_, err = writer.Write(buf[:n+1])
+	return
+}
+
 type WindowSlot struct {
 	ItemTypeId ItemTypeId
 	Count      ItemCount
 	Data       ItemData
 }
 
+// writeWindowSlot writes a slot as it appears in window packets. Empty slots
+// are written as a single item type ID of -1.
+func writeWindowSlot(writer io.Writer, slot *WindowSlot) os.Error {
+	if slot.ItemTypeId > 0 {
+		return binary.Write(writer, binary.BigEndian, slot)
+	}
+	return binary.Write(writer, binary.BigEndian, ItemTypeId(-1))
+}
+
+// readWindowSlot reads a slot as written by writeWindowSlot. Empty slots are
+// returned with an item type ID of zero, which we use as the null item
+// internally.
+func readWindowSlot(reader io.Reader) (slot WindowSlot, err os.Error) {
+	if err = binary.Read(reader, binary.BigEndian, &slot.ItemTypeId); err != nil {
+		return
+	}
+
+	if slot.ItemTypeId > 0 {
+		var itemInfo struct {
+			Count ItemCount
+			Data  ItemData
+		}
+		if err = binary.Read(reader, binary.BigEndian, &itemInfo); err != nil {
+			return
+		}
+		slot.Count = itemInfo.Count
+		slot.Data = itemInfo.Data
+	} else if slot.ItemTypeId == 0 {
+		err = os.NewError("Invalid item ID 0 in window")
+	} else {
+		slot.ItemTypeId = 0
+	}
+
+	return
+}
+
+// Entity metadata value types, as stored in EntityMetadata.Field1.
+const (
+	EntityMetadataByte   = 0 // Field3 is a byte.
+	EntityMetadataShort  = 1 // Field3 is an int16.
+	EntityMetadataInt    = 2 // Field3 is an int32.
+	EntityMetadataFloat  = 3 // Field3 is a float32.
+	EntityMetadataString = 4 // Field3 is a string.
+	EntityMetadataSlot   = 5 // Field3 is a WindowSlot.
+)
+
+// EntityMetadata is a single entry in the metadata of an entity. Field1 is the
+// value type, Field2 is the index of the entry, and Field3 is its value.
 type EntityMetadata struct {
 	Field1 byte
 	Field2 byte
@@ -274,35 +578,39 @@ type EntityMetadata struct {
 }
 
 func writeEntityMetadataField(writer io.Writer, data []EntityMetadata) (err os.Error) {
-	// NOTE that no checking is done upon the form of the data, so it's
-	// possible to form bad data packets with this.
 	var entryType byte
 
 	for _, item := range data {
 		entryType = (item.Field1 << 5) & 0xe0
 		entryType |= (item.Field2 & 0x1f)
 
+		// Check that the value matches its type before writing anything.
+		ok := false
+		switch item.Field1 {
+		case EntityMetadataByte:
+			_, ok = item.Field3.(byte)
+		case EntityMetadataShort:
+			_, ok = item.Field3.(int16)
+		case EntityMetadataInt:
+			_, ok = item.Field3.(int32)
+		case EntityMetadataFloat:
+			_, ok = item.Field3.(float32)
+		case EntityMetadataString:
+			_, ok = item.Field3.(string)
+		case EntityMetadataSlot:
+			_, ok = item.Field3.(WindowSlot)
+		}
+		if !ok {
+			return ErrorBadPacketData
+		}
+
 		if err = binary.Write(writer, binary.BigEndian, entryType); err != nil {
 			return
 		}
-		switch item.Field1 {
-		case 0:
-			err = binary.Write(writer, binary.BigEndian, item.Field3.(byte))
-		case 1:
-			err = binary.Write(writer, binary.BigEndian, item.Field3.(int16))
-		case 2:
-			err = binary.Write(writer, binary.BigEndian, item.Field3.(int32))
-		case 3:
-			err = binary.Write(writer, binary.BigEndian, item.Field3.(float32))
-		case 4:
+		if item.Field1 == EntityMetadataString {
 			err = writeString16(writer, item.Field3.(string))
-		case 5:
-			type position struct {
-				X int16
-				Y byte
-				Z int16
-			}
-			err = binary.Write(writer, binary.BigEndian, item.Field3.(position))
+		} else {
+			err = binary.Write(writer, binary.BigEndian, item.Field3)
 		}
 		if err != nil {
 			return
@@ -330,44 +638,43 @@ func readEntityMetadataField(reader io.Reader) (data []EntityMetadata, err os.Er
 		if entryType == 127 {
 			break
 		}
+		field1 = (entryType & 0xe0) >> 5
 		field2 = entryType & 0x1f
 
-		switch field1 := (entryType & 0xe0) >> 5; field1 {
-		case 0:
+		switch field1 {
+		case EntityMetadataByte:
 			var byteVal byte
 			err = binary.Read(reader, binary.BigEndian, &byteVal)
 			field3 = byteVal
-		case 1:
+		case EntityMetadataShort:
 			var int16Val int16
 			err = binary.Read(reader, binary.BigEndian, &int16Val)
 			field3 = int16Val
-		case 2:
+		case EntityMetadataInt:
 			var int32Val int32
 			err = binary.Read(reader, binary.BigEndian, &int32Val)
 			field3 = int32Val
-		case 3:
+		case EntityMetadataFloat:
 			var floatVal float32
 			err = binary.Read(reader, binary.BigEndian, &floatVal)
 			field3 = floatVal
-		case 4:
+		case EntityMetadataString:
 			var stringVal string
 			stringVal, err = readString16(reader)
 			field3 = stringVal
-		case 5:
-			var position struct {
-				X int16
-				Y byte
-				Z int16
-			}
-			err = binary.Read(reader, binary.BigEndian, &position)
-			field3 = position
+		case EntityMetadataSlot:
+			var slotVal WindowSlot
+			err = binary.Read(reader, binary.BigEndian, &slotVal)
+			field3 = slotVal
+		default:
+			err = ErrorBadPacketData
 		}
 
-		data = append(data, EntityMetadata{field1, field2, field3})
-
 		if err != nil {
 			return
 		}
+
+		data = append(data, EntityMetadata{field1, field2, field3})
 	}
 	return
 }
@@ -450,7 +757,7 @@ func commonReadLogin(reader io.Reader) (versionOrEntityId int32, str string, map
 	if err = binary.Read(reader, binary.BigEndian, &versionOrEntityId); err != nil {
 		return
 	}
-	if str, err = readString16(reader); err != nil {
+	if str, err = readString16Max(reader, maxUsernameLength); err != nil {
 		return
 	}
 
@@ -483,7 +790,7 @@ func serverReadLogin(reader io.Reader, handler IServerPacketHandler) (err os.Err
 	}
 
 	if version != protocolVersion {
-		err = fmt.Errorf("serverLogin: unsupported protocol version %#x", version)
+		err = UnsupportedProtocolVersionError(version)
 		return
 	}
 
@@ -515,7 +822,7 @@ func ServerWriteHandshake(writer io.Writer, reply string) (err os.Error) {
 
 func serverReadHandshake(reader io.Reader, handler IServerPacketHandler) (err os.Error) {
 	var username string
-	if username, err = readString16(reader); err != nil {
+	if username, err = readString16Max(reader, maxUsernameLength); err != nil {
 		return
 	}
 
@@ -556,8 +863,18 @@ func WriteChatMessage(writer io.Writer, message string) (err os.Error) {
 	return illegalCharErr
 }
 
-func readChatMessage(reader io.Reader, handler IPacketHandler) (err os.Error) {
-	message, err := readString16(reader)
+// Clients may only send chat messages of up to maxChatMessageLength
+// characters, but the server sends longer ones.
+func serverReadChatMessage(reader io.Reader, handler IServerPacketHandler) os.Error {
+	return readChatMessage(reader, handler, maxChatMessageLength)
+}
+
+func clientReadChatMessage(reader io.Reader, handler IClientPacketHandler) os.Error {
+	return readChatMessage(reader, handler, maxString16Length)
+}
+
+func readChatMessage(reader io.Reader, handler IPacketHandler, maxLength int) (err os.Error) {
+	message, err := readString16Max(reader, maxLength)
 	if err != nil {
 		return
 	}
@@ -1115,16 +1432,18 @@ func readHoldingChange(reader io.Reader, handler IServerPacketHandler) (err os.E
 
 // PacketIdBedUse
 
-func WriteBedUse(writer io.Writer, flag bool, bedLoc *BlockXyz) (err os.Error) {
+func WriteBedUse(writer io.Writer, entityId EntityId, inBed bool, bedLoc *BlockXyz) (err os.Error) {
 	var packet = struct {
 		PacketId byte
-		Flag     byte
+		EntityId EntityId
+		InBed    byte
 		X        BlockCoord
 		Y        BlockYCoord
 		Z        BlockCoord
 	}{
 		PacketIdBedUse,
-		boolToByte(flag),
+		entityId,
+		boolToByte(inBed),
 		bedLoc.X,
 		bedLoc.Y,
 		bedLoc.Z,
@@ -1135,18 +1454,22 @@ func WriteBedUse(writer io.Writer, flag bool, bedLoc *BlockXyz) (err os.Error) {
 
 func readBedUse(reader io.Reader, handler IClientPacketHandler) (err os.Error) {
 	var packet struct {
-		Flag byte
-		X    BlockCoord
-		Y    BlockYCoord
-		Z    BlockCoord
+		EntityId EntityId
+		InBed    byte
+		X        BlockCoord
+		Y        BlockYCoord
+		Z        BlockCoord
 	}
 
 	if err = binary.Read(reader, binary.BigEndian, &packet); err != nil {
-		handler.PacketBedUse(
-			byteToBool(packet.Flag),
-			&BlockXyz{packet.X, packet.Y, packet.Z})
+		return
 	}
 
+	handler.PacketBedUse(
+		packet.EntityId,
+		byteToBool(packet.InBed),
+		&BlockXyz{packet.X, packet.Y, packet.Z})
+
 	return
 }
 
@@ -1703,6 +2026,42 @@ func WriteEntityRelMove(writer io.Writer, entityId EntityId, movement *RelMove)
 	return
 }
 
+// RelMoveInRange returns true if a move by the given deltas fits in a relative
+// move packet, which holds deltas of -128 to 127 pixels (about ±4 blocks).
+func RelMoveInRange(dx, dy, dz AbsIntCoord) bool {
+	inRange := func(d AbsIntCoord) bool {
+		return d >= -128 && d <= 127
+	}
+	return inRange(dx) && inRange(dy) && inRange(dz)
+}
+
+// WriteEntityMove writes a relative move of the entity by the given deltas.
+// Nothing is written and ErrorRelMoveOutOfRange is returned if the deltas do
+// not fit in the packet, in which case callers should send a teleport
+// instead.
+func WriteEntityMove(writer io.Writer, entityId EntityId, dx, dy, dz AbsIntCoord) os.Error {
+	if !RelMoveInRange(dx, dy, dz) {
+		return ErrorRelMoveOutOfRange
+	}
+	return WriteEntityRelMove(
+		writer, entityId,
+		&RelMove{RelMoveCoord(dx), RelMoveCoord(dy), RelMoveCoord(dz)})
+}
+
+// WriteEntityMoveOrTeleport writes the move of an entity from lastPosition to
+// position, as a relative move if it is small enough, or else as a teleport.
+func WriteEntityMoveOrTeleport(writer io.Writer, entityId EntityId, lastPosition, position *AbsIntXyz, look *LookBytes) os.Error {
+	err := WriteEntityMove(
+		writer, entityId,
+		position.X-lastPosition.X,
+		position.Y-lastPosition.Y,
+		position.Z-lastPosition.Z)
+	if err == ErrorRelMoveOutOfRange {
+		return WriteEntityTeleport(writer, entityId, position, look)
+	}
+	return err
+}
+
 func readEntityRelMove(reader io.Reader, handler IClientPacketHandler) (err os.Error) {
 	var packet struct {
 		EntityId EntityId
@@ -1884,6 +2243,40 @@ func readEntityStatus(reader io.Reader, handler IClientPacketHandler) (err os.Er
 	return
 }
 
+// PacketIdAttachEntity
+
+// WriteAttachEntity tells clients that an entity is riding a vehicle, or that
+// it has left its vehicle if vehicleId is -1.
+func WriteAttachEntity(writer io.Writer, entityId EntityId, vehicleId EntityId) (err os.Error) {
+	var packet = struct {
+		PacketId  byte
+		EntityId  EntityId
+		VehicleId EntityId
+	}{
+		PacketIdAttachEntity,
+		entityId,
+		vehicleId,
+	}
+
+	return binary.Write(writer, binary.BigEndian, &packet)
+}
+
+func readAttachEntity(reader io.Reader, handler IClientPacketHandler) (err os.Error) {
+	var packet struct {
+		EntityId  EntityId
+		VehicleId EntityId
+	}
+
+	err = binary.Read(reader, binary.BigEndian, &packet)
+	if err != nil {
+		return
+	}
+
+	handler.PacketAttachEntity(packet.EntityId, packet.VehicleId)
+
+	return
+}
+
 // PacketIdEntityMetadata
 
 func WriteEntityMetadata(writer io.Writer, entityId EntityId, data []EntityMetadata) (err os.Error) {
@@ -2057,19 +2450,60 @@ func readPreChunk(reader io.Reader, handler IClientPacketHandler) (err os.Error)
 
 // PacketIdMapChunk
 
-func WriteMapChunk(writer io.Writer, chunkLoc *ChunkXz, blocks, blockData, blockLight, skyLight []byte) (err os.Error) {
+// compressChunkData zlib compresses the parts of a chunk's data, in the order
+// that they are sent in a map chunk packet.
+func compressChunkData(parts ...[]byte) (compressed []byte, err os.Error) {
 	buf := &bytes.Buffer{}
-	compressed, err := zlib.NewWriter(buf)
+	zlibWriter, err := zlib.NewWriter(buf)
 	if err != nil {
 		return
 	}
 
-	compressed.Write(blocks)
-	compressed.Write(blockData)
-	compressed.Write(blockLight)
-	compressed.Write(skyLight)
-	compressed.Close()
-	bs := buf.Bytes()
+	for _, part := range parts {
+		if _, err = zlibWriter.Write(part); err != nil {
+			zlibWriter.Close()
+			return
+		}
+	}
+	if err = zlibWriter.Close(); err != nil {
+		return
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decompressChunkData reverses compressChunkData. The data must decompress to
+// exactly size bytes.
+func decompressChunkData(compressed []byte, size int) (data []byte, err os.Error) {
+	zlibReader, err := zlib.NewReader(bytes.NewBuffer(compressed))
+	if err != nil {
+		return nil, ErrorBadPacketData
+	}
+	defer zlibReader.Close()
+
+	// Read one byte more than expected to detect too much data.
+	data = make([]byte, size+1)
+	n, err := io.ReadFull(zlibReader, data)
+	if err != io.ErrUnexpectedEOF || n != size {
+		return nil, ErrorBadPacketData
+	}
+
+	return data[:size], nil
+}
+
+// chunkDataSize returns the uncompressed size of the data for the given
+// volume of blocks: one byte of block type, and half a byte each of block
+// data, block light and sky light per block.
+func chunkDataSize(size *SubChunkSize) int {
+	numBlocks := (int(size.X) + 1) * (int(size.Y) + 1) * (int(size.Z) + 1)
+	return numBlocks * 5 / 2
+}
+
+func WriteMapChunk(writer io.Writer, chunkLoc *ChunkXz, blocks, blockData, blockLight, skyLight []byte) (err os.Error) {
+	bs, err := compressChunkData(blocks, blockData, blockLight, skyLight)
+	if err != nil {
+		return
+	}
 
 	chunkCornerLoc := chunkLoc.ChunkCornerBlockXY()
 
@@ -2117,16 +2551,25 @@ func readMapChunk(reader io.Reader, handler IClientPacketHandler) (err os.Error)
 		return
 	}
 
-	// TODO extract block data from raw data field, and pass on to handler
-	data := make([]byte, packet.CompressedLength)
-	_, err = io.ReadFull(reader, data)
+	if err = checkReadLength(reader, int(packet.CompressedLength)); err != nil {
+		return
+	}
+
+	compressed := make([]byte, packet.CompressedLength)
+	_, err = io.ReadFull(reader, compressed)
+	if err != nil {
+		return
+	}
+
+	size := &SubChunkSize{packet.SizeX, packet.SizeY, packet.SizeZ}
+	data, err := decompressChunkData(compressed, chunkDataSize(size))
 	if err != nil {
 		return
 	}
 
 	handler.PacketMapChunk(
 		&BlockXyz{packet.X, BlockYCoord(packet.Y), packet.Z},
-		&SubChunkSize{packet.SizeX, packet.SizeY, packet.SizeZ},
+		size,
 		data)
 	return
 }
@@ -2177,6 +2620,11 @@ func readBlockChangeMulti(reader io.Reader, handler IClientPacketHandler) (err o
 		return
 	}
 
+	// Each block has a 2 byte location, a block ID and metadata.
+	if err = checkReadLength(reader, 4*int(packet.Count)); err != nil {
+		return
+	}
+
 	rawBlockLocs := make([]int16, packet.Count)
 	blockTypes := make([]BlockId, packet.Count)
 	// blockMetadata array appears to represent one block per byte
@@ -2304,20 +2752,18 @@ func WriteExplosion(writer io.Writer, position *AbsXyz, power float32, blockOffs
 		// NOTE AbsCoord is just a guess for now
 		X, Y, Z AbsCoord
 		// NOTE Power isn't known to be a good name for this field
-		Power     float32
-		NumBlocks int32
+		Power float32
 	}{
 		PacketIdExplosion,
 		position.X, position.Y, position.Z,
 		power,
-		int32(len(blockOffsets)),
 	}
 
 	if err = binary.Write(writer, binary.BigEndian, &packet); err != nil {
 		return
 	}
 
-	return binary.Write(writer, binary.BigEndian, blockOffsets)
+	return writeCountedSlice(writer, blockOffsets)
 }
 
 func readExplosion(reader io.Reader, handler IClientPacketHandler) (err os.Error) {
@@ -2325,19 +2771,15 @@ func readExplosion(reader io.Reader, handler IClientPacketHandler) (err os.Error
 		// NOTE AbsCoord is just a guess for now
 		X, Y, Z AbsCoord
 		// NOTE Power isn't known to be a good name for this field
-		Power     float32
-		NumBlocks int32
+		Power float32
 	}
 
 	if err = binary.Read(reader, binary.BigEndian, &packet); err != nil {
 		return
 	}
 
-	// TODO put sensible size limits on how big arrays read from network could
-	// be, both here and in other places
-	blockOffsets := make([]ExplosionOffsetXyz, packet.NumBlocks)
-
-	if err = binary.Read(reader, binary.BigEndian, blockOffsets); err != nil {
+	var blockOffsets []ExplosionOffsetXyz
+	if err = readCountedSlice(reader, &blockOffsets, 3); err != nil {
 		return
 	}
 
@@ -2711,14 +3153,7 @@ func WriteWindowItems(writer io.Writer, windowId WindowId, items []WindowSlot) (
 	}
 
 	for i := range items {
-		slot := &items[i]
-		if slot.ItemTypeId > 0 {
-			err = binary.Write(writer, binary.BigEndian, slot)
-		} else {
-			err = binary.Write(writer, binary.BigEndian, ItemTypeId(-1))
-		}
-
-		if err != nil {
+		if err = writeWindowSlot(writer, &items[i]); err != nil {
 			return
 		}
 	}
@@ -2737,39 +3172,19 @@ func readWindowItems(reader io.Reader, handler IClientPacketHandler) (err os.Err
 		return
 	}
 
-	var itemTypeId ItemTypeId
+	// Each slot is at least 2 bytes long.
+	if err = checkReadLength(reader, 2*int(packetStart.Count)); err != nil {
+		return
+	}
 
 	items := make([]WindowSlot, 0, packetStart.Count)
 
-	var itemInfo struct {
-		Count ItemCount
-		Data  ItemData
-	}
-
 	for i := int16(0); i < packetStart.Count; i++ {
-		err = binary.Read(reader, binary.BigEndian, &itemTypeId)
-		if err != nil {
+		var slot WindowSlot
+		if slot, err = readWindowSlot(reader); err != nil {
 			return
 		}
-
-		if itemTypeId > 0 {
-			err = binary.Read(reader, binary.BigEndian, &itemInfo)
-			if err != nil {
-				return
-			}
-		} else if itemTypeId == 0 {
-			err = os.NewError("Invalid item ID 0 in window")
-			return
-		} else {
-			// We use zero as the null item internally.
-			itemTypeId = 0
-		}
-
-		items = append(items, WindowSlot{
-			ItemTypeId: itemTypeId,
-			Count:      itemInfo.Count,
-			Data:       itemInfo.Data,
-		})
+		items = append(items, slot)
 	}
 
 	handler.PacketWindowItems(
@@ -2867,6 +3282,29 @@ func WriteQuickbarSlotUpdate(writer io.Writer, slot SlotId, itemId ItemTypeId, c
 	return binary.Write(writer, binary.BigEndian, &packet)
 }
 
+// serverReadCreativeInventoryAction reads a quickbar slot update sent by a
+// client in creative mode, which sets the contents of an inventory slot.
+func serverReadCreativeInventoryAction(reader io.Reader, handler IServerPacketHandler) (err os.Error) {
+	var packet struct {
+		Slot   SlotId
+		ItemId ItemTypeId
+		Count  ItemCount
+		Data   ItemData
+	}
+
+	if err = binary.Read(reader, binary.BigEndian, &packet); err != nil {
+		return
+	}
+
+	handler.PacketCreativeInventoryAction(packet.Slot, &WindowSlot{
+		ItemTypeId: packet.ItemId,
+		Count:      packet.Count,
+		Data:       packet.Data,
+	})
+
+	return
+}
+
 func readQuickbarSlotUpdate(reader io.Reader, handler IClientPacketHandler) (err os.Error) {
 	var packet struct {
 		Slot   SlotId
@@ -3053,6 +3491,51 @@ func readUserListItem(reader io.Reader, handler IClientPacketHandler) (err os.Er
 	return
 }
 
+// PacketIdClientSettings
+
+func WriteClientSettings(writer io.Writer, locale string, viewDistance byte, chatFlags byte) (err os.Error) {
+	if err = binary.Write(writer, binary.BigEndian, byte(PacketIdClientSettings)); err != nil {
+		return
+	}
+
+	if err = writeString16(writer, locale); err != nil {
+		return
+	}
+
+	var packetEnd = struct {
+		ViewDistance byte
+		ChatFlags    byte
+	}{
+		viewDistance,
+		chatFlags,
+	}
+
+	return binary.Write(writer, binary.BigEndian, &packetEnd)
+}
+
+func readClientSettings(reader io.Reader, handler IServerPacketHandler) (err os.Error) {
+	locale, err := readString16(reader)
+	if err != nil {
+		return
+	}
+
+	var packetEnd struct {
+		ViewDistance byte
+		ChatFlags    byte
+	}
+	if err = binary.Read(reader, binary.BigEndian, &packetEnd); err != nil {
+		return
+	}
+
+	if packetEnd.ViewDistance > ViewDistanceTiny {
+		return ErrorBadPacketData
+	}
+
+	handler.PacketClientSettings(locale, packetEnd.ViewDistance, packetEnd.ChatFlags)
+
+	return
+}
+
 // PacketIdServerListPing
 
 func WriteServerListPing(writer io.Writer) (err os.Error) {
@@ -3098,7 +3581,6 @@ type clientPacketReaderMap map[byte]clientPacketHandler
 // Common packet mapping
 var commonReadFns = commonPacketReaderMap{
 	PacketIdKeepAlive:           readKeepAlive,
-	PacketIdChatMessage:         readChatMessage,
 	PacketIdEntityAction:        readEntityAction,
 	PacketIdUseEntity:           readUseEntity,
 	PacketIdRespawn:             readRespawn,
@@ -3116,18 +3598,31 @@ var commonReadFns = commonPacketReaderMap{
 var serverReadFns = serverPacketReaderMap{
 	PacketIdLogin:              serverReadLogin,
 	PacketIdHandshake:          serverReadHandshake,
+	PacketIdChatMessage:        serverReadChatMessage,
 	PacketIdPlayer:             readPlayer,
 	PacketIdPlayerPositionLook: serverReadPlayerPositionLook,
 	PacketIdWindowClick:        readWindowClick,
 	PacketIdHoldingChange:      readHoldingChange,
 	PacketIdWindowClose:        readWindowClose,
+	PacketIdClientSettings:     readClientSettings,
 	PacketIdServerListPing:     readServerListPing,
+	PacketIdQuickbarSlotUpdate: serverReadCreativeInventoryAction,
+}
+
+// Lengths of the bodies of packets that clients may send, but which are not
+// handled. These packets are skipped rather than causing the connection to be
+// dropped.
+var serverSkippedPacketLengths = map[byte]int{
+	PacketIdStanceUpdate:       18,
+	PacketIdAttachEntity:       8,
+	PacketIdIncrementStatistic: 5,
 }
 
 // Server->client specific packet mapping
 var clientReadFns = clientPacketReaderMap{
 	PacketIdLogin:                clientReadLogin,
 	PacketIdHandshake:            clientReadHandshake,
+	PacketIdChatMessage:          clientReadChatMessage,
 	PacketIdTimeUpdate:           readTimeUpdate,
 	PacketIdEntityEquipment:      readEntityEquipment,
 	PacketIdSpawnPosition:        readSpawnPosition,
@@ -3149,6 +3644,7 @@ var clientReadFns = clientPacketReaderMap{
 	PacketIdEntityLookAndRelMove: readEntityLookAndRelMove,
 	PacketIdEntityTeleport:       readEntityTeleport,
 	PacketIdEntityStatus:         readEntityStatus,
+	PacketIdAttachEntity:         readAttachEntity,
 	PacketIdEntityMetadata:       readEntityMetadata,
 	PacketIdEntityEffect:         readEntityEffect,
 	PacketIdEntityRemoveEffect:   readEntityRemoveEffect,
@@ -3178,11 +3674,18 @@ func readPacketId(reader io.Reader) (packetId byte, err os.Error) {
 
 func serverHandlePacket(reader io.Reader, handler IServerPacketHandler, packetId byte) os.Error {
 	if commonFn, ok := commonReadFns[packetId]; ok {
-		return commonFn(reader, handler)
+		return wrapPacketError(packetId, commonFn(reader, handler))
 	}
 
 	if serverFn, ok := serverReadFns[packetId]; ok {
-		return serverFn(reader, handler)
+		return wrapPacketError(packetId, serverFn(reader, handler))
+	}
+
+	if length, ok := serverSkippedPacketLengths[packetId]; ok {
+		if _, err := io.ReadFull(reader, make([]byte, length)); err != nil {
+			return wrapPacketError(packetId, err)
+		}
+		return SkippedPacketIdError(packetId)
 	}
 
 	return UnknownPacketIdError(packetId)
@@ -3206,21 +3709,29 @@ func ServerReadPacketExpect(reader io.Reader, handler IServerPacketHandler, expe
 // A server should call this to receive a single packet from a client. It will
 // block until a packet was successfully handled, or there was an error.
 func ServerReadPacket(reader io.Reader, handler IServerPacketHandler) (err os.Error) {
-	var packetId byte
+	_, err = ServerReadPacketId(reader, handler)
+	return
+}
+
+// ServerReadPacketId is like ServerReadPacket, but also returns the ID of the
+// packet, which is set if the ID could be read even if the packet could not be
+// handled.
+func ServerReadPacketId(reader io.Reader, handler IServerPacketHandler) (packetId byte, err os.Error) {
 	if packetId, err = readPacketId(reader); err != nil {
 		return
 	}
 
-	return serverHandlePacket(reader, handler, packetId)
+	err = serverHandlePacket(reader, handler, packetId)
+	return
 }
 
 func clientHandlePacket(reader io.Reader, handler IClientPacketHandler, packetId byte) os.Error {
 	if commonFn, ok := commonReadFns[packetId]; ok {
-		return commonFn(reader, handler)
+		return wrapPacketError(packetId, commonFn(reader, handler))
 	}
 
 	if clientFn, ok := clientReadFns[packetId]; ok {
-		return clientFn(reader, handler)
+		return wrapPacketError(packetId, clientFn(reader, handler))
 	}
 
 	return UnknownPacketIdError(packetId)
@@ -1,8 +1,15 @@
 package proto
 
 import (
-	"testing"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
 	"os"
+	"testing"
+
+	. "chunkymonkey/types"
 )
 
 type NullWriter struct{}
@@ -39,3 +46,751 @@ func TestWriteChatMessage(t *testing.T) {
 		t.Errorf("correctColorTagMsg shouldn't generate any errors: %s", err)
 	}
 }
+
+// makeString16 creates the wire encoding of a string with the given number of
+// 'a' characters.
+func makeString16(length int) *bytes.Buffer {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.BigEndian, uint16(length))
+	for i := 0; i < length; i++ {
+		binary.Write(buf, binary.BigEndian, uint16('a'))
+	}
+	return buf
+}
+
+func TestReadString16Max(t *testing.T) {
+	type Test struct {
+		desc      string
+		length    int
+		maxLength int
+		expected  os.Error
+	}
+
+	tests := []Test{
+		{"chat message at limit", 100, maxChatMessageLength, nil},
+		{"chat message too long", 101, maxChatMessageLength, ErrorStrTooLong},
+		{"username at limit", 16, maxUsernameLength, nil},
+		{"username too long", 17, maxUsernameLength, ErrorStrTooLong},
+	}
+
+	for _, test := range tests {
+		s, err := readString16Max(makeString16(test.length), test.maxLength)
+		if err != test.expected {
+			t.Errorf("%s: expected error %v but got %v", test.desc, test.expected, err)
+		} else if err == nil && len(s) != test.length {
+			t.Errorf("%s: expected string of length %d but got %d", test.desc, test.length, len(s))
+		}
+	}
+}
+
+func TestReadTooLongStrings(t *testing.T) {
+	// The handler is never called for a string that is too long, so a nil
+	// handler is sufficient here.
+	if err := serverReadChatMessage(makeString16(101), nil); err != ErrorStrTooLong {
+		t.Errorf("serverReadChatMessage: expected ErrorStrTooLong but got %v", err)
+	}
+
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.BigEndian, int32(protocolVersion))
+	buf.Write(makeString16(17).Bytes())
+	if err := serverReadLogin(buf, nil); err != ErrorStrTooLong {
+		t.Errorf("serverReadLogin: expected ErrorStrTooLong but got %v", err)
+	}
+}
+
+// loginHandler records the username from a login packet. Other packets cause
+// a panic.
+type loginHandler struct {
+	IServerPacketHandler
+	username string
+}
+
+func (h *loginHandler) PacketServerLogin(username string) {
+	h.username = username
+}
+
+func TestServerReadLogin_ProtocolVersion(t *testing.T) {
+	type Test struct {
+		desc            string
+		version         int32
+		clientOutdated  bool
+		expectSupported bool
+	}
+
+	tests := []Test{
+		{"matching version", protocolVersion, false, true},
+		{"older client", protocolVersion - 1, true, false},
+		{"newer client", protocolVersion + 1, false, false},
+	}
+
+	for _, test := range tests {
+		buf := new(bytes.Buffer)
+		commonWriteLogin(buf, test.version, "Notch", 0, 0, 0, 0, 0, 0)
+
+		handler := &loginHandler{}
+		err := serverReadLogin(buf, handler)
+
+		if test.expectSupported {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", test.desc, err)
+			} else if handler.username != "Notch" {
+				t.Errorf("%s: expected username %q but got %q", test.desc, "Notch", handler.username)
+			}
+			continue
+		}
+
+		versionErr, ok := err.(UnsupportedProtocolVersionError)
+		if !ok {
+			t.Errorf("%s: expected UnsupportedProtocolVersionError but got %v", test.desc, err)
+		} else if versionErr.IsClientOutdated() != test.clientOutdated {
+			t.Errorf("%s: expected IsClientOutdated()=%t", test.desc, test.clientOutdated)
+		}
+		if handler.username != "" {
+			t.Errorf("%s: handler should not have been called", test.desc)
+		}
+	}
+}
+
+func TestServerReadPacket_PacketError(t *testing.T) {
+	type Test struct {
+		desc     string
+		packet   []byte
+		expected os.Error
+	}
+
+	tests := []Test{
+		{
+			"chat message too long",
+			append([]byte{PacketIdChatMessage}, makeString16(101).Bytes()...),
+			ErrorStrTooLong,
+		},
+		{
+			"truncated chat message",
+			[]byte{PacketIdChatMessage, 0x00, 0x05, 0x00},
+			io.ErrUnexpectedEOF,
+		},
+	}
+
+	for _, test := range tests {
+		err := ServerReadPacket(bytes.NewBuffer(test.packet), nil)
+		packetErr, ok := err.(*PacketError)
+		if !ok {
+			t.Errorf("%s: expected *PacketError but got %T: %v", test.desc, err, err)
+			continue
+		}
+		if packetErr.PacketId != PacketIdChatMessage || packetErr.Err != test.expected {
+			t.Errorf("%s: expected error %v for packet 0x%02x but got %v", test.desc, test.expected, PacketIdChatMessage, packetErr)
+		}
+	}
+}
+
+// chatHandler records chat messages. Other packets cause a panic.
+type chatHandler struct {
+	IClientPacketHandler
+	messages []string
+}
+
+func (h *chatHandler) PacketChatMessage(message string) {
+	h.messages = append(h.messages, message)
+}
+
+func TestClientReadPacket_LongChatMessage(t *testing.T) {
+	// The server sends chat messages longer than clients may send.
+	packet := append([]byte{PacketIdChatMessage}, makeString16(119).Bytes()...)
+
+	handler := &chatHandler{}
+	if err := ClientReadPacket(bytes.NewBuffer(packet), handler); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(handler.messages) != 1 || len(handler.messages[0]) != 119 {
+		t.Errorf("expected one chat message of length 119, got %v", handler.messages)
+	}
+}
+
+// keepAliveHandler records the IDs of keep-alive packets. Other packets cause
+// a panic.
+type keepAliveHandler struct {
+	IServerPacketHandler
+	ids []int32
+}
+
+func (h *keepAliveHandler) PacketKeepAlive(id int32) {
+	h.ids = append(h.ids, id)
+}
+
+func TestServerReadPacket_SkipUnhandled(t *testing.T) {
+	buf := new(bytes.Buffer)
+	WriteKeepAlive(buf, 1)
+	WriteIncrementStatistic(buf, 1000, 1)
+	WriteKeepAlive(buf, 2)
+	buf.Write([]byte{PacketIdStanceUpdate, 0x00}) // Truncated.
+
+	handler := &keepAliveHandler{}
+
+	if err := ServerReadPacket(buf, handler); err != nil {
+		t.Fatalf("first packet: unexpected error %v", err)
+	}
+	if err := ServerReadPacket(buf, handler); err != SkippedPacketIdError(PacketIdIncrementStatistic) {
+		t.Fatalf("second packet: expected to be skipped but got %v", err)
+	}
+	if err := ServerReadPacket(buf, handler); err != nil {
+		t.Fatalf("third packet: unexpected error %v", err)
+	}
+	if len(handler.ids) != 2 || handler.ids[0] != 1 || handler.ids[1] != 2 {
+		t.Errorf("expected keep-alives 1 and 2 but got %v", handler.ids)
+	}
+
+	// A truncated packet that would otherwise be skipped is an error.
+	if err := ServerReadPacket(buf, handler); err == nil {
+		t.Errorf("truncated packet: expected an error")
+	}
+
+	if err := ServerReadPacket(bytes.NewBuffer([]byte{0xf0}), handler); err != UnknownPacketIdError(0xf0) {
+		t.Errorf("unknown packet: expected UnknownPacketIdError but got %v", err)
+	}
+}
+
+// clientSettingsHandler records client settings packets. Other packets cause
+// a panic.
+type clientSettingsHandler struct {
+	IServerPacketHandler
+	locale       string
+	viewDistance byte
+	chatFlags    byte
+}
+
+func (h *clientSettingsHandler) PacketClientSettings(locale string, viewDistance byte, chatFlags byte) {
+	h.locale = locale
+	h.viewDistance = viewDistance
+	h.chatFlags = chatFlags
+}
+
+func TestServerReadPacket_ClientSettings(t *testing.T) {
+	buf := new(bytes.Buffer)
+	WriteClientSettings(buf, "en_GB", ViewDistanceShort, 8)
+
+	handler := &clientSettingsHandler{}
+	if err := ServerReadPacket(buf, handler); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if handler.locale != "en_GB" || handler.viewDistance != ViewDistanceShort || handler.chatFlags != 8 {
+		t.Errorf("expected settings (en_GB, %d, 8) but got %#v", ViewDistanceShort, handler)
+	}
+
+	buf.Reset()
+	WriteClientSettings(buf, "en_GB", ViewDistanceTiny+1, 0)
+	err := ServerReadPacket(buf, handler)
+	if packetErr, ok := err.(*PacketError); !ok || packetErr.Err != ErrorBadPacketData {
+		t.Errorf("bad view distance: expected ErrorBadPacketData but got %v", err)
+	}
+}
+
+func TestPacketReadLimiter(t *testing.T) {
+	// A string that claims to be as long as is allowed, but is not followed by
+	// any data. It must be rejected before any attempt to read the data.
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.BigEndian, uint16(maxString16Length))
+	reader := NewPacketReadLimiter(buf, 1024)
+	if _, err := readString16(reader); err != ErrorPacketTooLarge {
+		t.Errorf("absurd string length: expected ErrorPacketTooLarge but got %v", err)
+	}
+
+	// Reads beyond the limit fail, until the limit is reset.
+	reader = NewPacketReadLimiter(bytes.NewBuffer(make([]byte, 16)), 4)
+	data := make([]byte, 6)
+	if _, err := io.ReadFull(reader, data); err != ErrorPacketTooLarge {
+		t.Errorf("read beyond limit: expected ErrorPacketTooLarge but got %v", err)
+	}
+	reader.ResetLimit()
+	if _, err := io.ReadFull(reader, data[:4]); err != nil {
+		t.Errorf("read after reset: unexpected error %v", err)
+	}
+}
+
+func TestCountedSlice_RoundTrip(t *testing.T) {
+	offsets := []ExplosionOffsetXyz{{1, -2, 3}, {-4, 5, -6}}
+	buf := new(bytes.Buffer)
+	if err := writeCountedSlice(buf, offsets); err != nil {
+		t.Fatalf("unexpected error writing structs: %v", err)
+	}
+	expectedBytes := []byte{0, 0, 0, 2, 1, 0xfe, 3, 0xfc, 5, 0xfa}
+	if !bytes.Equal(expectedBytes, buf.Bytes()) {
+		t.Errorf("expected structs written as %x but got %x", expectedBytes, buf.Bytes())
+	}
+	var readOffsets []ExplosionOffsetXyz
+	if err := readCountedSlice(buf, &readOffsets, 3); err != nil {
+		t.Fatalf("unexpected error reading structs: %v", err)
+	}
+	if fmt.Sprintf("%v", offsets) != fmt.Sprintf("%v", readOffsets) {
+		t.Errorf("expected structs %v but got %v", offsets, readOffsets)
+	}
+
+	values := []int16{-1, 0, 300}
+	buf.Reset()
+	if err := writeCountedSlice(buf, values); err != nil {
+		t.Fatalf("unexpected error writing int16s: %v", err)
+	}
+	var readValues []int16
+	if err := readCountedSlice(buf, &readValues, 2); err != nil {
+		t.Fatalf("unexpected error reading int16s: %v", err)
+	}
+	if fmt.Sprintf("%v", values) != fmt.Sprintf("%v", readValues) {
+		t.Errorf("expected int16s %v but got %v", values, readValues)
+	}
+
+	// Empty slices are just a count.
+	buf.Reset()
+	writeCountedSlice(buf, []int16{})
+	if !bytes.Equal([]byte{0, 0, 0, 0}, buf.Bytes()) {
+		t.Errorf("expected empty slice written as a zero count, got %x", buf.Bytes())
+	}
+
+	// Counts are checked before allocating.
+	buf.Reset()
+	binary.Write(buf, binary.BigEndian, int32(1000))
+	if err := readCountedSlice(NewPacketReadLimiter(buf, 100), &readValues, 2); err != ErrorPacketTooLarge {
+		t.Errorf("large count: expected ErrorPacketTooLarge but got %v", err)
+	}
+	buf.Reset()
+	binary.Write(buf, binary.BigEndian, int32(-1))
+	if err := readCountedSlice(buf, &readValues, 2); err != ErrorBadPacketData {
+		t.Errorf("negative count: expected ErrorBadPacketData but got %v", err)
+	}
+}
+
+// mapChunkHandler records map chunk packets. Other packets cause a panic.
+type mapChunkHandler struct {
+	IClientPacketHandler
+	position *BlockXyz
+	size     *SubChunkSize
+	data     []byte
+}
+
+func (h *mapChunkHandler) PacketMapChunk(position *BlockXyz, size *SubChunkSize, data []byte) {
+	h.position = position
+	h.size = size
+	h.data = data
+}
+
+func TestMapChunk_RoundTrip(t *testing.T) {
+	blocks := make([]byte, ChunkSizeH*ChunkSizeH*ChunkSizeY)
+	nibbles := make([]byte, len(blocks)/2)
+	for i := range blocks {
+		blocks[i] = byte(i % 97)
+	}
+	for i := range nibbles {
+		nibbles[i] = byte(i % 251)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := WriteMapChunk(buf, &ChunkXz{2, -3}, blocks, nibbles, nibbles, nibbles); err != nil {
+		t.Fatalf("unexpected error writing map chunk: %v", err)
+	}
+	if buf.Len() >= len(blocks) {
+		t.Errorf("expected chunk data to be compressed, but packet is %d bytes", buf.Len())
+	}
+
+	handler := &mapChunkHandler{}
+	if err := ClientReadPacket(buf, handler); err != nil {
+		t.Fatalf("unexpected error reading map chunk: %v", err)
+	}
+
+	expectedPos := BlockXyz{32, 0, -48}
+	if *handler.position != expectedPos {
+		t.Errorf("expected position %v but got %v", expectedPos, *handler.position)
+	}
+	expectedSize := SubChunkSize{ChunkSizeH - 1, ChunkSizeY - 1, ChunkSizeH - 1}
+	if *handler.size != expectedSize {
+		t.Errorf("expected size %v but got %v", expectedSize, *handler.size)
+	}
+
+	expectedData := make([]byte, 0, len(blocks)+3*len(nibbles))
+	expectedData = append(expectedData, blocks...)
+	for i := 0; i < 3; i++ {
+		expectedData = append(expectedData, nibbles...)
+	}
+	if !bytes.Equal(expectedData, handler.data) {
+		t.Errorf("decompressed chunk data differs from the original")
+	}
+}
+
+func TestDecompressChunkData_BadSize(t *testing.T) {
+	compressed, err := compressChunkData([]byte{1, 2, 3, 4})
+	if err != nil {
+		t.Fatalf("unexpected error compressing: %v", err)
+	}
+
+	if _, err = decompressChunkData(compressed, 3); err != ErrorBadPacketData {
+		t.Errorf("too much data: expected ErrorBadPacketData but got %v", err)
+	}
+	if _, err = decompressChunkData(compressed, 5); err != ErrorBadPacketData {
+		t.Errorf("too little data: expected ErrorBadPacketData but got %v", err)
+	}
+	if _, err = decompressChunkData([]byte{1, 2, 3}, 4); err != ErrorBadPacketData {
+		t.Errorf("not compressed: expected ErrorBadPacketData but got %v", err)
+	}
+}
+
+func TestUtf16RoundTrip(t *testing.T) {
+	type Test struct {
+		desc       string
+		input      string
+		codepoints []uint16
+	}
+
+	tests := []Test{
+		{"ASCII", "abc", []uint16{'a', 'b', 'c'}},
+		{"BMP", "§1é", []uint16{0xa7, '1', 0xe9}},
+		{"emoji", "\U0001f600", []uint16{0xd83d, 0xde00}},
+		{"CJK extension B", "x\U00020000y", []uint16{'x', 0xd840, 0xdc00, 'y'}},
+	}
+
+	for _, test := range tests {
+		codepoints := decodeUtf8(test.input)
+		if len(codepoints) != len(test.codepoints) {
+			t.Errorf("%s: decodeUtf8 expected %#v but got %#v", test.desc, test.codepoints, codepoints)
+			continue
+		}
+		for i := range codepoints {
+			if codepoints[i] != test.codepoints[i] {
+				t.Errorf("%s: decodeUtf8 expected %#v but got %#v", test.desc, test.codepoints, codepoints)
+				break
+			}
+		}
+
+		s, err := encodeUtf8(test.codepoints)
+		if err != nil {
+			t.Errorf("%s: encodeUtf8 returned error: %v", test.desc, err)
+		} else if s != test.input {
+			t.Errorf("%s: encodeUtf8 expected %q but got %q", test.desc, test.input, s)
+		}
+	}
+}
+
+func TestEncodeUtf8_UnpairedSurrogates(t *testing.T) {
+	tests := [][]uint16{
+		{0xd83d},
+		{0xd83d, 'a'},
+		{0xde00},
+		{'a', 0xde00, 0xd83d},
+	}
+
+	for _, test := range tests {
+		if _, err := encodeUtf8(test); err != ErrorBadPacketData {
+			t.Errorf("encodeUtf8(%#v) expected ErrorBadPacketData but got %v", test, err)
+		}
+	}
+}
+
+// countingWriter discards data written to it, counting the number of calls to
+// Write.
+type countingWriter struct {
+	writes int
+}
+
+func (w *countingWriter) Write(p []byte) (n int, err os.Error) {
+	w.writes++
+	return len(p), nil
+}
+
+func writeChunkSizedPackets(writer io.Writer, blocks, nibbles []byte) {
+	WriteMapChunk(writer, &ChunkXz{0, 0}, blocks, nibbles, nibbles, nibbles)
+	for i := 0; i < 32; i++ {
+		WriteEntityRelMove(writer, EntityId(i), &RelMove{1, 0, 1})
+	}
+}
+
+func benchmarkPacketWrites(b *testing.B, buffered bool) {
+	b.StopTimer()
+	blocks := make([]byte, ChunkSizeH*ChunkSizeH*ChunkSizeY)
+	nibbles := make([]byte, len(blocks)/2)
+	conn := &countingWriter{}
+	b.StartTimer()
+
+	for i := 0; i < b.N; i++ {
+		if buffered {
+			writer := bufio.NewWriter(conn)
+			writeChunkSizedPackets(writer, blocks, nibbles)
+			writer.Flush()
+		} else {
+			writeChunkSizedPackets(conn, blocks, nibbles)
+		}
+	}
+}
+
+func BenchmarkPacketWritesUnbuffered(b *testing.B) {
+	benchmarkPacketWrites(b, false)
+}
+
+func BenchmarkPacketWritesBuffered(b *testing.B) {
+	benchmarkPacketWrites(b, true)
+}
+
+func TestVarInt_RoundTrip(t *testing.T) {
+	type Test struct {
+		value   VarInt
+		encoded []byte
+	}
+
+	tests := []Test{
+		{0, []byte{0x00}},
+		{1, []byte{0x01}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{300, []byte{0xac, 0x02}},
+		{2147483647, []byte{0xff, 0xff, 0xff, 0xff, 0x07}},
+		{-1, []byte{0xff, 0xff, 0xff, 0xff, 0x0f}},
+		{-2147483648, []byte{0x80, 0x80, 0x80, 0x80, 0x08}},
+	}
+
+	for _, test := range tests {
+		buf := new(bytes.Buffer)
+		if err := writeVarInt(buf, test.value); err != nil {
+			t.Errorf("%d: write returned error: %v", test.value, err)
+			continue
+		}
+		if !bytes.Equal(test.encoded, buf.Bytes()) {
+			t.Errorf("%d: expected encoding %x but got %x", test.value, test.encoded, buf.Bytes())
+		}
+
+		value, err := readVarInt(bytes.NewBuffer(test.encoded))
+		if err != nil {
+			t.Errorf("%d: read returned error: %v", test.value, err)
+		} else if value != test.value {
+			t.Errorf("%x: expected %d but got %d", test.encoded, test.value, value)
+		}
+	}
+}
+
+func TestVarLong_RoundTrip(t *testing.T) {
+	type Test struct {
+		value   VarLong
+		encoded []byte
+	}
+
+	tests := []Test{
+		{0, []byte{0x00}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{2147483648, []byte{0x80, 0x80, 0x80, 0x80, 0x08}},
+		{9223372036854775807, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}},
+		{-1, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}},
+		{-9223372036854775808, []byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x01}},
+	}
+
+	for _, test := range tests {
+		buf := new(bytes.Buffer)
+		if err := writeVarLong(buf, test.value); err != nil {
+			t.Errorf("%d: write returned error: %v", test.value, err)
+			continue
+		}
+		if !bytes.Equal(test.encoded, buf.Bytes()) {
+			t.Errorf("%d: expected encoding %x but got %x", test.value, test.encoded, buf.Bytes())
+		}
+
+		value, err := readVarLong(bytes.NewBuffer(test.encoded))
+		if err != nil {
+			t.Errorf("%d: read returned error: %v", test.value, err)
+		} else if value != test.value {
+			t.Errorf("%x: expected %d but got %d", test.encoded, test.value, value)
+		}
+	}
+}
+
+func TestVarInt_BadEncodings(t *testing.T) {
+	type Test struct {
+		desc     string
+		encoded  []byte
+		expected os.Error
+	}
+
+	tests := []Test{
+		{"overlong zero", []byte{0x80, 0x00}, ErrorBadPacketData},
+		{"overlong one", []byte{0x81, 0x80, 0x00}, ErrorBadPacketData},
+		{"six bytes", []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0x01}, ErrorBadPacketData},
+		{"more than 32 bits", []byte{0xff, 0xff, 0xff, 0xff, 0x1f}, ErrorBadPacketData},
+		{"truncated", []byte{0x80}, io.ErrUnexpectedEOF},
+	}
+
+	for _, test := range tests {
+		if _, err := readVarInt(bytes.NewBuffer(test.encoded)); err != test.expected {
+			t.Errorf("%s: expected error %v but got %v", test.desc, test.expected, err)
+		}
+	}
+
+	tooLong := []byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x01}
+	if _, err := readVarLong(bytes.NewBuffer(tooLong)); err != ErrorBadPacketData {
+		t.Errorf("eleven byte VarLong: expected ErrorBadPacketData but got %v", err)
+	}
+	overflow := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x03}
+	if _, err := readVarLong(bytes.NewBuffer(overflow)); err != ErrorBadPacketData {
+		t.Errorf("VarLong over 64 bits: expected ErrorBadPacketData but got %v", err)
+	}
+}
+
+func TestEntityMetadata_RoundTrip(t *testing.T) {
+	data := []EntityMetadata{
+		{EntityMetadataByte, 0, byte(1)},
+		{EntityMetadataShort, 1, int16(-300)},
+		{EntityMetadataInt, 2, int32(70000)},
+		{EntityMetadataFloat, 3, float32(1.5)},
+		{EntityMetadataString, 4, "Notch"},
+		{EntityMetadataSlot, 5, WindowSlot{ItemTypeId: 276, Count: 1, Data: 10}},
+	}
+
+	buf := new(bytes.Buffer)
+	if err := writeEntityMetadataField(buf, data); err != nil {
+		t.Fatalf("unexpected error writing metadata: %v", err)
+	}
+
+	result, err := readEntityMetadataField(buf)
+	if err != nil {
+		t.Fatalf("unexpected error reading metadata: %v", err)
+	}
+
+	if len(result) != len(data) {
+		t.Fatalf("expected %d entries but got %d", len(data), len(result))
+	}
+	for i := range data {
+		// Values are compared by their printed form, as structs cannot be compared.
+		if fmt.Sprintf("%#v", data[i]) != fmt.Sprintf("%#v", result[i]) {
+			t.Errorf("entry %d: expected %#v but got %#v", i, data[i], result[i])
+		}
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected all data to be read, %d bytes remain", buf.Len())
+	}
+}
+
+func TestEntityMetadata_BadData(t *testing.T) {
+	// Value does not match its type.
+	badValue := []EntityMetadata{{EntityMetadataShort, 0, byte(1)}}
+	if err := writeEntityMetadataField(new(bytes.Buffer), badValue); err != ErrorBadPacketData {
+		t.Errorf("expected ErrorBadPacketData writing mismatched value but got %v", err)
+	}
+
+	// Unknown type tag 6.
+	buf := bytes.NewBuffer([]byte{6 << 5, 0, 127})
+	if _, err := readEntityMetadataField(buf); err != ErrorBadPacketData {
+		t.Errorf("expected ErrorBadPacketData reading unknown type but got %v", err)
+	}
+}
+
+func TestWindowSlot_RoundTrip(t *testing.T) {
+	slots := []WindowSlot{
+		{ItemTypeId: 1, Count: 64, Data: 0},
+		{},
+		{ItemTypeId: 276, Count: 1, Data: 10},
+		{},
+		{},
+		{ItemTypeId: 35, Count: 3, Data: 14},
+	}
+
+	buf := new(bytes.Buffer)
+	for i := range slots {
+		if err := writeWindowSlot(buf, &slots[i]); err != nil {
+			t.Fatalf("slot %d: unexpected error writing: %v", i, err)
+		}
+	}
+
+	// Filled slots take 5 bytes, and empty ones 2 bytes.
+	if expectedLen := 3*5 + 3*2; buf.Len() != expectedLen {
+		t.Errorf("expected %d bytes written but got %d", expectedLen, buf.Len())
+	}
+
+	for i := range slots {
+		slot, err := readWindowSlot(buf)
+		if err != nil {
+			t.Fatalf("slot %d: unexpected error reading: %v", i, err)
+		}
+		if slot.ItemTypeId != slots[i].ItemTypeId || slot.Count != slots[i].Count || slot.Data != slots[i].Data {
+			t.Errorf("slot %d: expected %#v but got %#v", i, slots[i], slot)
+		}
+	}
+}
+
+func TestWriteEntityMove(t *testing.T) {
+	type Test struct {
+		dx, dy, dz AbsIntCoord
+		inRange    bool
+	}
+
+	tests := []Test{
+		{0, 0, 0, true},
+		{127, 127, 127, true},
+		{-128, -128, -128, true},
+		{128, 0, 0, false},
+		{0, 128, 0, false},
+		{0, 0, 128, false},
+		{-129, 0, 0, false},
+		{0, -129, 0, false},
+		{0, 0, -129, false},
+	}
+
+	for _, test := range tests {
+		buf := new(bytes.Buffer)
+		err := WriteEntityMove(buf, 5, test.dx, test.dy, test.dz)
+
+		if !test.inRange {
+			if err != ErrorRelMoveOutOfRange {
+				t.Errorf("%+v: expected ErrorRelMoveOutOfRange, got %v", test, err)
+			}
+			if buf.Len() != 0 {
+				t.Errorf("%+v: expected nothing written, got % x", test, buf.Bytes())
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%+v: unexpected error: %v", test, err)
+			continue
+		}
+		expected := []byte{
+			PacketIdEntityRelMove,
+			0, 0, 0, 5,
+			byte(test.dx), byte(test.dy), byte(test.dz),
+		}
+		if !bytes.Equal(expected, buf.Bytes()) {
+			t.Errorf("%+v: expected % x, got % x", test, expected, buf.Bytes())
+		}
+	}
+}
+
+func TestWriteEntityMoveOrTeleport(t *testing.T) {
+	type Test struct {
+		position   AbsIntXyz
+		expectedId byte
+	}
+
+	lastPosition := &AbsIntXyz{1000, 2000, 3000}
+	look := &LookBytes{10, 20}
+
+	tests := []Test{
+		{AbsIntXyz{1127, 2000, 3000}, PacketIdEntityRelMove},
+		{AbsIntXyz{1000, 1872, 3000}, PacketIdEntityRelMove},
+		{AbsIntXyz{1128, 2000, 3000}, PacketIdEntityTeleport},
+		{AbsIntXyz{1000, 2000, 2871}, PacketIdEntityTeleport},
+	}
+
+	for _, test := range tests {
+		buf := new(bytes.Buffer)
+		if err := WriteEntityMoveOrTeleport(buf, 5, lastPosition, &test.position, look); err != nil {
+			t.Errorf("%+v: unexpected error: %v", test, err)
+			continue
+		}
+
+		expected := new(bytes.Buffer)
+		if test.expectedId == PacketIdEntityTeleport {
+			WriteEntityTeleport(expected, 5, &test.position, look)
+		} else {
+			WriteEntityMove(
+				expected, 5,
+				test.position.X-lastPosition.X,
+				test.position.Y-lastPosition.Y,
+				test.position.Z-lastPosition.Z)
+		}
+		if !bytes.Equal(expected.Bytes(), buf.Bytes()) {
+			t.Errorf("%+v: expected % x, got % x", test, expected.Bytes(), buf.Bytes())
+		}
+	}
+}
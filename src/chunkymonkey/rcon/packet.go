@@ -0,0 +1,80 @@
+package rcon
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Packet types. Note that packetTypeExecCommand and packetTypeAuthResponse
+// share a value, and are distinguished by the direction that they are sent
+// in.
+const (
+	packetTypeResponseValue = 0
+	packetTypeExecCommand   = 2
+	packetTypeAuthResponse  = 2
+	packetTypeAuth          = 3
+)
+
+const (
+	// The size of the request ID and type fields, and the two null bytes
+	// terminating the body.
+	packetOverhead = 4 + 4 + 2
+
+	// The largest body that is sent or accepted in a single packet. Longer
+	// responses are split across several packets.
+	maxBodyLength = 4096
+
+	// The request ID sent in an auth response when authentication fails.
+	authFailedId = -1
+)
+
+type packet struct {
+	id         int32
+	packetType int32
+	body       string
+}
+
+// readPacket reads a single packet. Packets are a little-endian int32 size,
+// followed by the request ID, the type, and a null-terminated body and an
+// empty null-terminated string.
+func readPacket(reader io.Reader) (pkt *packet, err os.Error) {
+	var size int32
+	if err = binary.Read(reader, binary.LittleEndian, &size); err != nil {
+		return
+	}
+	if size < packetOverhead || size > packetOverhead+maxBodyLength {
+		return nil, fmt.Errorf("rcon packet has bad size %d", size)
+	}
+
+	data := make([]byte, size)
+	if _, err = io.ReadFull(reader, data); err != nil {
+		return
+	}
+
+	if data[size-2] != 0 || data[size-1] != 0 {
+		return nil, os.NewError("rcon packet body is not null-terminated")
+	}
+
+	pkt = &packet{
+		id:         int32(binary.LittleEndian.Uint32(data[0:4])),
+		packetType: int32(binary.LittleEndian.Uint32(data[4:8])),
+		body:       string(data[8 : size-2]),
+	}
+	return
+}
+
+// writePacket writes a single packet. The body must be no longer than
+// maxBodyLength.
+func writePacket(writer io.Writer, pkt *packet) (err os.Error) {
+	size := packetOverhead + len(pkt.body)
+	data := make([]byte, 4+size)
+	binary.LittleEndian.PutUint32(data[0:4], uint32(size))
+	binary.LittleEndian.PutUint32(data[4:8], uint32(pkt.id))
+	binary.LittleEndian.PutUint32(data[8:12], uint32(pkt.packetType))
+	copy(data[12:], pkt.body)
+
+	_, err = writer.Write(data)
+	return
+}
@@ -0,0 +1,232 @@
+// Package rcon implements the Source RCON protocol, which allows operators to
+// run commands on the server without being logged in as a player.
+package rcon
+
+import (
+	"crypto/subtle"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+
+	"chunkymonkey/gamerules"
+	"chunkymonkey/proto"
+	. "chunkymonkey/types"
+)
+
+var errNotAuthenticated = os.NewError("rcon command sent before authentication")
+
+// Server accepts RCON connections, and runs their commands through a command
+// framework as if they had been typed by a player.
+type Server struct {
+	password  string
+	framework gamerules.ICommandFramework
+	game      gamerules.IGame
+}
+
+func NewServer(password string, framework gamerules.ICommandFramework, game gamerules.IGame) *Server {
+	return &Server{
+		password:  password,
+		framework: framework,
+		game:      game,
+	}
+}
+
+// Serve accepts connections on the listener until it is closed.
+func (s *Server) Serve(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Printf("rcon: stopped accepting connections: %v", err)
+			return
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	if err := s.handleSession(conn); err != nil && err != os.EOF {
+		log.Printf("rcon: closing connection from %v: %v", conn.RemoteAddr(), err)
+	}
+}
+
+// handleSession reads packets until the connection is closed. The first
+// packet must authenticate with the correct password. The session ends
+// immediately if authentication fails, or if a command is sent first.
+func (s *Server) handleSession(conn io.ReadWriter) (err os.Error) {
+	authenticated := false
+
+	for {
+		var pkt *packet
+		if pkt, err = readPacket(conn); err != nil {
+			return
+		}
+
+		switch {
+		case pkt.packetType == packetTypeAuth:
+			authenticated = s.checkPassword(pkt.body)
+			if err = s.writeAuthResponse(conn, pkt.id, authenticated); err != nil {
+				return
+			}
+			if !authenticated {
+				return os.NewError("rcon authentication failed")
+			}
+
+		case !authenticated:
+			s.writeAuthResponse(conn, pkt.id, false)
+			return errNotAuthenticated
+
+		case pkt.packetType == packetTypeExecCommand:
+			if err = s.writeResponse(conn, pkt.id, s.runCommand(pkt.body)); err != nil {
+				return
+			}
+
+		default:
+			log.Printf("rcon: ignoring packet with unknown type %d", pkt.packetType)
+		}
+	}
+
+	return
+}
+
+func (s *Server) checkPassword(password string) bool {
+	return s.password != "" &&
+		subtle.ConstantTimeCompare([]byte(password), []byte(s.password)) == 1
+}
+
+// writeAuthResponse tells the client whether it authenticated. As the Source
+// server does, an empty response value is sent first.
+func (s *Server) writeAuthResponse(writer io.Writer, id int32, authenticated bool) (err os.Error) {
+	if err = writePacket(writer, &packet{id, packetTypeResponseValue, ""}); err != nil {
+		return
+	}
+	if !authenticated {
+		id = authFailedId
+	}
+	return writePacket(writer, &packet{id, packetTypeAuthResponse, ""})
+}
+
+// writeResponse writes the output of a command, split across several packets
+// if it is too long for one.
+func (s *Server) writeResponse(writer io.Writer, id int32, output string) (err os.Error) {
+	for {
+		body := output
+		if len(body) > maxBodyLength {
+			body = body[:maxBodyLength]
+		}
+		output = output[len(body):]
+
+		if err = writePacket(writer, &packet{id, packetTypeResponseValue, body}); err != nil {
+			return
+		}
+		if len(output) == 0 {
+			return
+		}
+	}
+	return
+}
+
+// runCommand runs a command through the command framework, and returns the
+// messages echoed by the command. The command may be given with or without
+// the framework's prefix.
+func (s *Server) runCommand(command string) string {
+	prefix := s.framework.Prefix()
+	if !strings.HasPrefix(command, prefix) {
+		command = prefix + command
+	}
+
+	log.Printf("rcon: running command %q", command)
+
+	client := &commandClient{}
+	s.framework.Process(client, command, s.game)
+
+	return strings.Join(client.messages, "\n")
+}
+
+// commandClient stands in for a player running commands from RCON. Messages
+// echoed to it are collected as the command's output. It is not in the world,
+// so requests that affect the player are ignored.
+type commandClient struct {
+	messages []string
+}
+
+func (c *commandClient) GetEntityId() EntityId {
+	return 0
+}
+
+func (c *commandClient) TransmitPacket(packet []byte) {
+}
+
+func (c *commandClient) NotifyChunkLoad() {
+}
+
+func (c *commandClient) InventorySubscribed(block BlockXyz, invTypeId InvTypeId, slots []proto.WindowSlot) {
+}
+
+func (c *commandClient) InventorySlotUpdate(block BlockXyz, slot gamerules.Slot, slotId SlotId) {
+}
+
+func (c *commandClient) InventoryProgressUpdate(block BlockXyz, prgBarId PrgBarId, value PrgBarValue) {
+}
+
+func (c *commandClient) InventoryCursorUpdate(block BlockXyz, cursor gamerules.Slot) {
+}
+
+func (c *commandClient) InventoryTxState(block BlockXyz, txId TxId, accepted bool) {
+}
+
+func (c *commandClient) InventoryUnsubscribed(block BlockXyz) {
+}
+
+func (c *commandClient) PlaceHeldItem(target BlockXyz, wasHeld gamerules.Slot) {
+}
+
+func (c *commandClient) OfferItem(fromChunk ChunkXz, entityId EntityId, item gamerules.Slot) {
+}
+
+func (c *commandClient) GiveItemAtPosition(atPosition AbsXyz, item gamerules.Slot) {
+}
+
+func (c *commandClient) GiveItem(item gamerules.Slot) {
+}
+
+func (c *commandClient) PositionLook() (AbsXyz, LookDegrees) {
+	return AbsXyz{}, LookDegrees{}
+}
+
+func (c *commandClient) SetPositionLook(position AbsXyz, look LookDegrees) {
+}
+
+func (c *commandClient) RejectMove(position AbsXyz) {
+}
+
+func (c *commandClient) EchoMessage(msg string) {
+	c.messages = append(c.messages, msg)
+}
+
+func (c *commandClient) ApplyDamage(amount Health, cause string) {
+}
+
+func (c *commandClient) UseBed(bedLoc BlockXyz) {
+}
+
+func (c *commandClient) EnterBed(bedLoc BlockXyz) {
+}
+
+func (c *commandClient) WakeUp() {
+}
+
+func (c *commandClient) MoveWithVehicle(position AbsXyz) {
+}
+
+func (c *commandClient) SetGameType(gameType GameType) {
+}
+
+func (c *commandClient) GiveExperience(amount int16) {
+}
+
+func (c *commandClient) BlockBroken(target BlockXyz) {
+}
@@ -0,0 +1,126 @@
+package rcon
+
+import (
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"chunkymonkey/command"
+	"chunkymonkey/gamerules"
+)
+
+// recordingFramework records the commands passed through to a real command
+// framework.
+type recordingFramework struct {
+	gamerules.ICommandFramework
+	commands []string
+}
+
+func (f *recordingFramework) Process(player gamerules.IPlayerClient, cmd string, game gamerules.IGame) {
+	f.commands = append(f.commands, cmd)
+	f.ICommandFramework.Process(player, cmd, game)
+}
+
+// startTestSession runs an RCON session on one end of a pipe, and returns the
+// other end. The session's result is sent on the returned channel.
+func startTestSession(password string) (client net.Conn, framework *recordingFramework, result chan os.Error) {
+	framework = &recordingFramework{ICommandFramework: command.NewCommandFramework("/")}
+	server := NewServer(password, framework, nil)
+
+	serverConn, client := net.Pipe()
+	result = make(chan os.Error, 1)
+	go func() {
+		result <- server.handleSession(serverConn)
+		serverConn.Close()
+	}()
+
+	return
+}
+
+func sendPacket(t *testing.T, conn net.Conn, pkt *packet) {
+	if err := writePacket(conn, pkt); err != nil {
+		t.Fatalf("failed to write packet: %v", err)
+	}
+}
+
+func expectPacket(t *testing.T, conn net.Conn, id, packetType int32) *packet {
+	pkt, err := readPacket(conn)
+	if err != nil {
+		t.Fatalf("failed to read packet: %v", err)
+	}
+	if pkt.id != id || pkt.packetType != packetType {
+		t.Fatalf("expected packet with id %d and type %d but got id %d and type %d",
+			id, packetType, pkt.id, pkt.packetType)
+	}
+	return pkt
+}
+
+func TestServer_CorrectPassword(t *testing.T) {
+	client, framework, result := startTestSession("secret")
+
+	sendPacket(t, client, &packet{1, packetTypeAuth, "secret"})
+	expectPacket(t, client, 1, packetTypeResponseValue)
+	expectPacket(t, client, 1, packetTypeAuthResponse)
+
+	sendPacket(t, client, &packet{2, packetTypeExecCommand, "help"})
+	response := expectPacket(t, client, 2, packetTypeResponseValue)
+	if !strings.HasPrefix(response.body, "Commands:") {
+		t.Errorf("expected list of commands but got %q", response.body)
+	}
+
+	if len(framework.commands) != 1 || framework.commands[0] != "/help" {
+		t.Errorf("expected /help to be run but got %v", framework.commands)
+	}
+
+	client.Close()
+	if err := <-result; err != os.EOF {
+		t.Errorf("expected session to end when the client disconnected but got %v", err)
+	}
+}
+
+func TestServer_WrongPassword(t *testing.T) {
+	client, framework, result := startTestSession("secret")
+
+	sendPacket(t, client, &packet{1, packetTypeAuth, "guess"})
+	expectPacket(t, client, 1, packetTypeResponseValue)
+	expectPacket(t, client, authFailedId, packetTypeAuthResponse)
+
+	if err := <-result; err == nil {
+		t.Errorf("expected session to end after failing authentication")
+	}
+	if len(framework.commands) != 0 {
+		t.Errorf("expected no commands to be run but got %v", framework.commands)
+	}
+}
+
+func TestServer_CommandBeforeAuth(t *testing.T) {
+	client, framework, result := startTestSession("secret")
+
+	sendPacket(t, client, &packet{1, packetTypeExecCommand, "help"})
+	expectPacket(t, client, 1, packetTypeResponseValue)
+	expectPacket(t, client, authFailedId, packetTypeAuthResponse)
+
+	if err := <-result; err != errNotAuthenticated {
+		t.Errorf("expected %v but got %v", errNotAuthenticated, err)
+	}
+	if len(framework.commands) != 0 {
+		t.Errorf("expected no commands to be run but got %v", framework.commands)
+	}
+}
+
+func TestServer_writeResponse_SplitsLongOutput(t *testing.T) {
+	client, server := net.Pipe()
+	output := strings.Repeat("x", maxBodyLength+10)
+	go func() {
+		(&Server{}).writeResponse(server, 3, output)
+		server.Close()
+	}()
+
+	first := expectPacket(t, client, 3, packetTypeResponseValue)
+	second := expectPacket(t, client, 3, packetTypeResponseValue)
+	if len(first.body) != maxBodyLength || len(second.body) != 10 {
+		t.Errorf("expected bodies of length %d and 10 but got %d and %d",
+			maxBodyLength, len(first.body), len(second.body))
+	}
+}
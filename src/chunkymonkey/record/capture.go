@@ -0,0 +1,160 @@
+package record
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Direction is the direction that captured data was sent in.
+type Direction byte
+
+const (
+	DirectionClientToServer = Direction(0)
+	DirectionServerToClient = Direction(1)
+)
+
+// Capture log record header
+type captureHeader struct {
+	Timestamp int64 // time since the capture started, in nanoseconds
+	Direction Direction
+	Length    int32 // length of data bytes
+}
+
+// CaptureRecord is a single packet (or group of packets) in a capture log.
+type CaptureRecord struct {
+	Timestamp int64
+	Direction Direction
+	Data      []byte
+}
+
+// Capture records the data sent in both directions on a connection, with
+// timestamps, to a log. It is safe to record from several goroutines.
+type Capture struct {
+	lock           sync.Mutex
+	log            io.WriteCloser
+	startTimestamp int64
+}
+
+func NewCapture(log io.WriteCloser) *Capture {
+	return &Capture{
+		log:            log,
+		startTimestamp: time.Nanoseconds(),
+	}
+}
+
+// Record writes a record of data sent in the given direction to the log.
+func (capture *Capture) Record(direction Direction, data []byte) (err os.Error) {
+	capture.lock.Lock()
+	defer capture.lock.Unlock()
+
+	err = binary.Write(capture.log, binary.BigEndian, &captureHeader{
+		time.Nanoseconds() - capture.startTimestamp,
+		direction,
+		int32(len(data)),
+	})
+	if err != nil {
+		return
+	}
+	_, err = capture.log.Write(data)
+	return
+}
+
+func (capture *Capture) Close() os.Error {
+	capture.lock.Lock()
+	defer capture.lock.Unlock()
+
+	return capture.log.Close()
+}
+
+// CaptureConn is a net.Conn that records the data read from and written to it
+// in a Capture.
+type CaptureConn struct {
+	net.Conn
+	capture *Capture
+}
+
+func NewCaptureConn(conn net.Conn, capture *Capture) *CaptureConn {
+	return &CaptureConn{
+		Conn:    conn,
+		capture: capture,
+	}
+}
+
+func (conn *CaptureConn) Read(b []byte) (n int, err os.Error) {
+	n, err = conn.Conn.Read(b)
+	if n > 0 {
+		if recErr := conn.capture.Record(DirectionClientToServer, b[:n]); recErr != nil && err == nil {
+			err = recErr
+		}
+	}
+	return
+}
+
+func (conn *CaptureConn) Write(b []byte) (n int, err os.Error) {
+	if err = conn.capture.Record(DirectionServerToClient, b); err != nil {
+		return
+	}
+	return conn.Conn.Write(b)
+}
+
+// ReadCaptureRecord reads the next record from a capture log. It returns
+// os.EOF at the end of the log.
+func ReadCaptureRecord(reader io.Reader) (record *CaptureRecord, err os.Error) {
+	var header captureHeader
+	if err = binary.Read(reader, binary.BigEndian, &header); err != nil {
+		return
+	}
+	if header.Length < 0 {
+		return nil, os.NewError("capture record has negative length")
+	}
+
+	record = &CaptureRecord{
+		Timestamp: header.Timestamp,
+		Direction: header.Direction,
+		Data:      make([]byte, header.Length),
+	}
+	if _, err = io.ReadFull(reader, record.Data); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// ReplayFile re-sends the client data from the capture log at path on conn,
+// with the same timing as when it was captured. Data sent by the server in the
+// capture is skipped, and nothing is read from conn.
+func ReplayFile(path string, conn net.Conn) (err os.Error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	startTimestamp := time.Nanoseconds()
+	for {
+		var record *CaptureRecord
+		if record, err = ReadCaptureRecord(file); err != nil {
+			if err == os.EOF {
+				err = nil
+			}
+			return
+		}
+		if record.Direction != DirectionClientToServer {
+			continue
+		}
+
+		// Wait until recorded time has passed
+		if delay := record.Timestamp - (time.Nanoseconds() - startTimestamp); delay > 0 {
+			time.Sleep(delay)
+		}
+
+		if _, err = conn.Write(record.Data); err != nil {
+			return
+		}
+	}
+
+	return
+}
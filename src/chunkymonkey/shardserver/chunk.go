@@ -3,16 +3,20 @@ package shardserver
 import (
 	"bytes"
 	"fmt"
-	"log"
 	"rand"
 	"time"
 
 	"chunkymonkey/chunkstore"
 	"chunkymonkey/gamerules"
+	"chunkymonkey/logging"
 	"chunkymonkey/proto"
 	. "chunkymonkey/types"
 )
 
+// chunkSectionHeight is the height of the vertical sections of a chunk that
+// are tracked for changes.
+const chunkSectionHeight = 16
+
 // A chunk is slice of the world map.
 type Chunk struct {
 	shard        *ChunkShard
@@ -29,11 +33,15 @@ type Chunk struct {
 	subscribers  map[EntityId]gamerules.IPlayerClient   // Players getting updates from the chunk.
 	playersData  map[EntityId]*playerData               // Some player data for player(s) in the chunk.
 	onUnsub      map[EntityId][]gamerules.IUnsubscribed // Functions to be called when unsubscribed.
+	signEditors  map[BlockIndex]EntityId                // Players who placed signs, which they may write on.
 	storeDirty   bool                                   // Is the chunk store copy of this chunk dirty?
+	dirtyMask    uint8                                  // Bitmap of vertical sections changed since the last save.
 
-	activeBlocks    map[BlockIndex]bool // Blocks that need to "tick".
-	newActiveBlocks map[BlockIndex]bool // Blocks added as active for next "tick".
-	tickAll         bool                // Whether or not all blocks should be allowed to "tick" once
+	activeBlocks    map[BlockIndex]bool  // Blocks that need to "tick".
+	newActiveBlocks map[BlockIndex]bool  // Blocks added as active for next "tick".
+	tickAll         bool                 // Whether or not all blocks should be allowed to "tick" once
+	scheduledBlocks map[BlockIndex]Ticks // Blocks to become active at the given tick.
+	ticks           Ticks                // Number of ticks the chunk has run for.
 }
 
 func newChunkFromReader(reader chunkstore.IChunkReader, shard *ChunkShard) (chunk *Chunk) {
@@ -51,11 +59,19 @@ func newChunkFromReader(reader chunkstore.IChunkReader, shard *ChunkShard) (chun
 		subscribers:  make(map[EntityId]gamerules.IPlayerClient),
 		playersData:  make(map[EntityId]*playerData),
 		onUnsub:      make(map[EntityId][]gamerules.IUnsubscribed),
+		signEditors:  make(map[BlockIndex]EntityId),
 		storeDirty:   false,
 
 		activeBlocks:    make(map[BlockIndex]bool),
 		newActiveBlocks: make(map[BlockIndex]bool),
 		tickAll:         true,
+		scheduledBlocks: make(map[BlockIndex]Ticks),
+	}
+
+	// Freshly generated chunks must be written out to the store, even if they
+	// are never modified.
+	if generated, ok := reader.(chunkstore.IGeneratedChunkReader); ok && generated.IsGenerated() {
+		chunk.storeDirty = true
 	}
 
 	entities := reader.Entities()
@@ -71,9 +87,9 @@ func newChunkFromReader(reader chunkstore.IChunkReader, shard *ChunkShard) (chun
 		blockLoc := tileEntity.Block()
 		chunkLoc, subChunk := blockLoc.ToChunkLocal()
 		if !chunk.loc.Equals(*chunkLoc) {
-			log.Printf("%v: loaded tile entity not in this chunk, but at location %#v", chunk, blockLoc)
+			chunk.log().Warn("%v: loaded tile entity not in this chunk, but at location %#v", chunk, blockLoc)
 		} else if index, ok := subChunk.BlockIndex(); !ok {
-			log.Printf("%v: loaded tile entity at bad location %#v", chunk, blockLoc)
+			chunk.log().Warn("%v: loaded tile entity at bad location %#v", chunk, blockLoc)
 		} else {
 			tileEntity.SetChunk(chunk)
 			chunk.tileEntities[index] = tileEntity
@@ -96,13 +112,38 @@ func (chunk *Chunk) save(chunkStore chunkstore.IChunkStore) {
 		writer.SetTileEntities(chunk.tileEntities)
 		chunkStore.WriteChunk(writer)
 		chunk.storeDirty = false
+		chunk.dirtyMask = 0
 	}
 }
 
+// markSectionDirty records that blocks in the vertical section of the chunk
+// containing height y have changed since the chunk was last saved. The
+// region file format stores whole chunks, so the chunk is written out in full
+// when saved, but chunks with no changes are not written. The mask is kept for
+// chunk stores that can write single sections.
+func (chunk *Chunk) markSectionDirty(y SubChunkCoord) {
+	chunk.storeDirty = true
+	chunk.dirtyMask |= 1 << (uint(y) / chunkSectionHeight)
+}
+
+// isIdle returns true if no players are subscribed to or present in the
+// chunk, so it can be unloaded.
+func (chunk *Chunk) isIdle() bool {
+	return len(chunk.subscribers) == 0 && len(chunk.playersData) == 0
+}
+
 func (chunk *Chunk) String() string {
 	return fmt.Sprintf("Chunk[%d,%d]", chunk.loc.X, chunk.loc.Z)
 }
 
+// log returns the logger for the chunk's shard.
+func (chunk *Chunk) log() logging.Logger {
+	if chunk.shard == nil {
+		return logging.Default
+	}
+	return chunk.shard.log()
+}
+
 // Sets a block and its data. Returns true if the block was not changed.
 func (chunk *Chunk) setBlock(blockLoc *BlockXyz, subLoc *SubChunkXyz, index BlockIndex, blockType BlockId, blockData byte) {
 
@@ -110,13 +151,22 @@ func (chunk *Chunk) setBlock(blockLoc *BlockXyz, subLoc *SubChunkXyz, index Bloc
 	chunk.cachedPacket = nil
 
 	// Invalidate currently stored chunk data.
-	chunk.storeDirty = true
+	chunk.markSectionDirty(subLoc.Y)
 
+	oldBlockType := chunk.blockId(index)
 	index.SetBlockId(chunk.blocks, blockType)
 	index.SetBlockData(chunk.blockData, blockData)
 
 	chunk.tileEntities[index] = nil, false
 
+	if chunk.shard != nil {
+		chunk.shard.relightBlock(blockLoc)
+		chunk.shard.scheduleFluidTicks(blockLoc)
+		if gamerules.IsRedstoneBlock(oldBlockType) || gamerules.IsRedstoneBlock(blockType) {
+			chunk.shard.scheduleRedstoneTicks(blockLoc)
+		}
+	}
+
 	// Tell players that the block changed.
 	packet := new(bytes.Buffer)
 	proto.WriteBlockChange(packet, blockLoc, blockType, blockData)
@@ -126,7 +176,7 @@ func (chunk *Chunk) setBlock(blockLoc *BlockXyz, subLoc *SubChunkXyz, index Bloc
 }
 
 func (chunk *Chunk) blockId(index BlockIndex) BlockId {
-	return BlockId(index.BlockData(chunk.blocks))
+	return index.BlockId(chunk.blocks)
 }
 
 func (chunk *Chunk) SetBlockByIndex(blockIndex BlockIndex, blockId BlockId, blockData byte) {
@@ -141,6 +191,29 @@ func (chunk *Chunk) SetBlockByIndex(blockIndex BlockIndex, blockId BlockId, bloc
 		blockData)
 }
 
+// BlockAt returns the block at blockLoc, which may be in a neighbouring chunk
+// in the shard if it is loaded.
+func (chunk *Chunk) BlockAt(blockLoc *BlockXyz) (blockId BlockId, blockData byte, ok bool) {
+	other, index, ok := chunk.shard.loadedChunkForBlock(blockLoc)
+	if !ok {
+		return
+	}
+	return other.blockId(index), index.BlockData(other.blockData), true
+}
+
+// SetBlockAt sets the block at blockLoc, which may be in a neighbouring chunk
+// in the shard if it is loaded.
+func (chunk *Chunk) SetBlockAt(blockLoc *BlockXyz, blockId BlockId, blockData byte) bool {
+	other, index, ok := chunk.shard.loadedChunkForBlock(blockLoc)
+	if !ok {
+		return false
+	}
+
+	subLoc := index.ToSubChunkXyz()
+	other.setBlock(blockLoc, &subLoc, index, blockId, blockData)
+	return true
+}
+
 func (chunk *Chunk) Rand() *rand.Rand {
 	return chunk.rand
 }
@@ -199,7 +272,7 @@ func (chunk *Chunk) getBlockIndexByBlockXyz(blockLoc *BlockXyz) (index BlockInde
 	chunkLoc, subLoc := blockLoc.ToChunkLocal()
 
 	if chunkLoc.X != chunk.loc.X || chunkLoc.Z != chunk.loc.Z {
-		log.Printf(
+		chunk.log().Warn(
 			"%v.getBlockIndexByBlockXyz: position (%T%#v) is not within chunk",
 			chunk, blockLoc, blockLoc)
 		return 0, nil, false
@@ -207,7 +280,7 @@ func (chunk *Chunk) getBlockIndexByBlockXyz(blockLoc *BlockXyz) (index BlockInde
 
 	index, ok = subLoc.BlockIndex()
 	if !ok {
-		log.Printf(
+		chunk.log().Warn(
 			"%v.getBlockIndexByBlockXyz: invalid position (%T%#v) within chunk",
 			chunk, blockLoc, blockLoc)
 	}
@@ -220,7 +293,7 @@ func (chunk *Chunk) blockTypeAndData(index BlockIndex) (blockType *gamerules.Blo
 
 	blockType, ok = gamerules.Blocks.Get(blockTypeId)
 	if !ok {
-		log.Printf(
+		chunk.log().Warn(
 			"%v.blockTypeAndData: unknown block type %d at index %d",
 			chunk, blockTypeId, index,
 		)
@@ -262,8 +335,11 @@ func (chunk *Chunk) reqHitBlock(player gamerules.IPlayerClient, held gamerules.S
 	}
 
 	if blockType.Destructable && blockType.Aspect.Hit(blockInstance, player, digStatus) {
-		blockType.Aspect.Destroy(blockInstance)
+		blockType.Aspect.Destroy(blockInstance, &held)
 		chunk.setBlock(target, &blockInstance.SubLoc, blockInstance.Index, BlockIdAir, 0)
+		if digStatus == DigBlockBroke {
+			player.BlockBroken(*target)
+		}
 	}
 
 	return
@@ -280,7 +356,10 @@ func (chunk *Chunk) reqInteractBlock(player gamerules.IPlayerClient, held gameru
 		return
 	}
 
-	if _, isBlockHeld := held.ItemTypeId.ToBlockId(); isBlockHeld && blockType.Attachable {
+	if _, isRail := blockType.Aspect.(*gamerules.RailAspect); isRail && held.ItemTypeId == gamerules.ItemTypeIdMinecart {
+		// The player is putting a minecart on the rail.
+		player.PlaceHeldItem(*target, held)
+	} else if _, isBlockHeld := held.ItemTypeId.ToBlockId(); isBlockHeld && blockType.Attachable {
 		// The player is interacting with a block that can be attached to.
 
 		// Work out the position to put the block at.
@@ -303,9 +382,22 @@ func (chunk *Chunk) reqInteractBlock(player gamerules.IPlayerClient, held gameru
 // placeBlock attempts to place a block. This is called by PlayerBlockInteract
 // in the situation where the player interacts with an attachable block
 // (potentially in a different chunk to the one where the block gets placed).
-func (chunk *Chunk) reqPlaceItem(player gamerules.IPlayerClient, target *BlockXyz, slot *gamerules.Slot) {
-	// TODO defer a check for remaining items in slot, and do something with them
-	// (send to player or drop on the ground).
+func (chunk *Chunk) reqPlaceItem(player gamerules.IPlayerClient, target *BlockXyz, slot *gamerules.Slot, look *LookDegrees) {
+	defer func() {
+		// The item was taken from the player's inventory before it was sent here,
+		// so give back anything that was not placed.
+		if slot.Count > 0 {
+			player.GiveItem(*slot)
+		}
+	}()
+
+	if slot.ItemTypeId == gamerules.ItemTypeIdMinecart {
+		if cart, ok := gamerules.NewMinecartOnRail(chunk, target); ok && slot.Count > 0 {
+			chunk.AddEntity(cart)
+			slot.Decrement(1)
+		}
+		return
+	}
 
 	// TODO more flexible item checking for block placement (e.g placing seed
 	// items on farmland doesn't fit this current simplistic model). The block
@@ -329,12 +421,59 @@ func (chunk *Chunk) reqPlaceItem(player gamerules.IPlayerClient, target *BlockXy
 		return
 	}
 
+	// Some blocks are turned to face a direction depending on the way that the
+	// player is facing, rather than taking their data from the item.
+	blockData := byte(slot.Data)
+	placedType, placedTypeOk := gamerules.Blocks.Get(heldBlockType)
+	if placedTypeOk {
+		if placement, ok := placedType.Aspect.(gamerules.IPlacementAspect); ok {
+			blockData = placement.PlacementData(look)
+		}
+	}
+
 	// Safe to replace block.
-	chunk.setBlock(target, subLoc, index, heldBlockType, byte(slot.Data))
+	chunk.setBlock(target, subLoc, index, heldBlockType, blockData)
+
+	// The player who places a sign writes on it next.
+	if placedTypeOk {
+		if _, isSign := placedType.Aspect.(*gamerules.SignAspect); isSign {
+			chunk.signEditors[index] = player.GetEntityId()
+		}
+	}
 	// Allow this block to tick once
 	chunk.AddActiveBlockIndex(index)
 
-	slot.Decrement()
+	slot.Decrement(1)
+}
+
+func (chunk *Chunk) reqSetSignText(player gamerules.IPlayerClient, target *BlockXyz, lines [4]string) {
+	blockInstance, blockType, ok := chunk.blockInstanceAndType(target)
+	if !ok {
+		return
+	}
+
+	signAspect, ok := blockType.Aspect.(*gamerules.SignAspect)
+	if !ok {
+		chunk.log().Debug("%v: Ignoring sign text for %v, which is not a sign", chunk, *target)
+		return
+	}
+
+	// Only the player who placed the sign may write on it, and only once.
+	if editor, ok := chunk.signEditors[blockInstance.Index]; !ok || editor != player.GetEntityId() {
+		chunk.log().Debug("%v: Ignoring sign text for %v from player %d, who did not place it", chunk, *target, player.GetEntityId())
+		return
+	}
+
+	sign, ok := signAspect.SetText(blockInstance, lines)
+	if !ok {
+		chunk.log().Debug("%v: Ignoring disallowed sign text %q from player %d", chunk, lines, player.GetEntityId())
+		return
+	}
+	chunk.signEditors[blockInstance.Index] = 0, false
+
+	buf := new(bytes.Buffer)
+	sign.SendUpdate(buf)
+	chunk.reqMulticastPlayers(-1, buf.Bytes())
 }
 
 func (chunk *Chunk) reqTakeItem(player gamerules.IPlayerClient, entityId EntityId) {
@@ -397,7 +536,7 @@ func (chunk *Chunk) BlockQuery(blockLoc BlockXyz) (isSolid bool, isWithinChunk b
 		// The item is asking about this chunk.
 		index, ok := subLoc.BlockIndex()
 		if !ok {
-			log.Printf("%s.PhysicsBlockQuery(%#v) got bad block index", chunk, blockLoc)
+			chunk.log().Warn("%s.PhysicsBlockQuery(%#v) got bad block index", chunk, blockLoc)
 			isSolid = true
 			return
 		}
@@ -420,7 +559,7 @@ func (chunk *Chunk) BlockQuery(blockLoc BlockXyz) (isSolid bool, isWithinChunk b
 	if blockType, ok := gamerules.Blocks.Get(blockTypeId); ok {
 		isSolid = blockType.Solid
 	} else {
-		log.Printf(
+		chunk.log().Warn(
 			"%s.PhysicsBlockQuery found unknown block type Id %d at %+v",
 			chunk, blockTypeId, blockLoc)
 		// The block type isn't known.
@@ -430,8 +569,79 @@ func (chunk *Chunk) BlockQuery(blockLoc BlockXyz) (isSolid bool, isWithinChunk b
 	return
 }
 
+// useEntity has the player use (or hit, if leftClick is true) an entity in the
+// chunk. Using a minecart gets into it, or out of it if the player is already
+// riding it, and hitting a minecart breaks it. Returns false if the entity is
+// not in the chunk.
+func (chunk *Chunk) useEntity(player gamerules.IPlayerClient, entityId EntityId, leftClick bool) bool {
+	entity, ok := chunk.entities[entityId]
+	if !ok {
+		return false
+	}
+
+	cart, ok := entity.(*gamerules.Minecart)
+	if !ok {
+		return true
+	}
+
+	rider := cart.Rider()
+	switch {
+	case leftClick:
+		chunk.destroyMinecart(cart)
+	case rider == nil:
+		if cart.Mount(player, chunk) {
+			buf := new(bytes.Buffer)
+			cart.WriteAttach(buf, player)
+			chunk.reqMulticastPlayers(-1, buf.Bytes())
+		}
+	case rider.GetEntityId() == player.GetEntityId():
+		chunk.dismount(cart)
+	}
+
+	return true
+}
+
+// dismount takes the rider (if any) out of the minecart, and tells players
+// that they have left it.
+func (chunk *Chunk) dismount(cart *gamerules.Minecart) {
+	rider := cart.Dismount()
+	if rider == nil {
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	cart.WriteDetach(buf, rider)
+	chunk.reqMulticastPlayers(-1, buf.Bytes())
+}
+
+// dismountRider takes the player with the given entityId out of any minecart
+// in the chunk that they are riding.
+func (chunk *Chunk) dismountRider(entityId EntityId) {
+	for _, e := range chunk.entities {
+		if cart, ok := e.(*gamerules.Minecart); ok {
+			if rider := cart.Rider(); rider != nil && rider.GetEntityId() == entityId {
+				chunk.dismount(cart)
+			}
+		}
+	}
+}
+
+// destroyMinecart breaks a minecart, dropping it as an item.
+func (chunk *Chunk) destroyMinecart(cart *gamerules.Minecart) {
+	chunk.dismount(cart)
+	chunk.removeEntity(cart)
+
+	chunk.AddEntity(gamerules.NewItem(
+		gamerules.ItemTypeIdMinecart, 1, 0,
+		cart.Position(), &AbsVelocity{}, 0))
+}
+
 func (chunk *Chunk) tick() {
+	chunk.ticks++
+	chunk.activateScheduledBlocks()
 	chunk.spawnTick()
+	chunk.itemPickupTick()
+	chunk.experienceOrbPickupTick()
 	if chunk.tickAll {
 		chunk.tickAll = false
 		chunk.blockTickAll()
@@ -482,6 +692,55 @@ func (chunk *Chunk) spawnTick() {
 	chunk.storeDirty = true
 }
 
+// itemPickupTick offers items to any players that overlap them. Items that
+// have only recently been spawned cannot be picked up until their pickup
+// immunity has worn off.
+func (chunk *Chunk) itemPickupTick() {
+	for _, item := range chunk.items() {
+		if item.PickupImmunity > 0 {
+			item.PickupImmunity--
+			continue
+		}
+
+		for entityId, data := range chunk.playersData {
+			if !data.OverlapsEntity(item) {
+				continue
+			}
+			if player, ok := chunk.subscribers[entityId]; ok {
+				player.OfferItem(chunk.loc, item.EntityId, *item.GetSlot())
+				// Only one player is offered the item at a time.
+				break
+			}
+		}
+	}
+}
+
+// experienceOrbPickupTick gives the experience from orbs to players that
+// overlap them.
+func (chunk *Chunk) experienceOrbPickupTick() {
+	for _, orb := range chunk.experienceOrbs() {
+		if orb.PickupImmunity > 0 {
+			orb.PickupImmunity--
+			continue
+		}
+
+		for entityId, data := range chunk.playersData {
+			if !data.OverlapsEntity(orb) {
+				continue
+			}
+			if player, ok := chunk.subscribers[entityId]; ok {
+				player.GiveExperience(orb.Value)
+
+				buf := new(bytes.Buffer)
+				proto.WriteItemCollect(buf, orb.EntityId, entityId)
+				chunk.reqMulticastPlayers(-1, buf.Bytes())
+				chunk.removeEntity(orb)
+				break
+			}
+		}
+	}
+}
+
 // blockTick runs any blocks that need to do something each tick.
 func (chunk *Chunk) blockTick() {
 	if len(chunk.activeBlocks) == 0 && len(chunk.newActiveBlocks) == 0 {
@@ -502,6 +761,7 @@ func (chunk *Chunk) blockTick() {
 		if !ok {
 			// Invalid block.
 			chunk.activeBlocks[blockIndex] = false, false
+			continue
 		}
 
 		blockInstance.SubLoc = blockIndex.ToSubChunkXyz()
@@ -559,12 +819,31 @@ func (chunk *Chunk) AddActiveBlockIndex(blockIndex BlockIndex) {
 	chunk.newActiveBlocks[blockIndex] = true
 }
 
+func (chunk *Chunk) ScheduleBlockTick(blockIndex BlockIndex, delay Ticks) {
+	at := chunk.ticks + delay
+	if existing, ok := chunk.scheduledBlocks[blockIndex]; ok && existing <= at {
+		// Already scheduled to tick sooner.
+		return
+	}
+	chunk.scheduledBlocks[blockIndex] = at
+}
+
+// activateScheduledBlocks makes active the blocks whose scheduled tick has
+// arrived.
+func (chunk *Chunk) activateScheduledBlocks() {
+	for blockIndex, at := range chunk.scheduledBlocks {
+		if at <= chunk.ticks {
+			chunk.newActiveBlocks[blockIndex] = true
+			chunk.scheduledBlocks[blockIndex] = 0, false
+		}
+	}
+}
+
 func (chunk *Chunk) mobs() (s []*gamerules.Mob) {
 	s = make([]*gamerules.Mob, 0, 3)
 	for _, e := range chunk.entities {
-		switch e.(type) {
-		case *gamerules.Mob:
-			s = append(s, e.(*gamerules.Mob))
+		if mob, ok := e.(gamerules.IMob); ok {
+			s = append(s, mob.GetMob())
 		}
 	}
 	return
@@ -581,6 +860,15 @@ func (chunk *Chunk) items() (s []*gamerules.Item) {
 	return
 }
 
+func (chunk *Chunk) experienceOrbs() (s []*gamerules.ExperienceOrb) {
+	for _, e := range chunk.entities {
+		if orb, ok := e.(*gamerules.ExperienceOrb); ok {
+			s = append(s, orb)
+		}
+	}
+	return
+}
+
 func (chunk *Chunk) reqSubscribeChunk(entityId EntityId, player gamerules.IPlayerClient, notify bool) {
 	if _, ok := chunk.subscribers[entityId]; ok {
 		// Already subscribed.
@@ -607,6 +895,17 @@ func (chunk *Chunk) reqSubscribeChunk(entityId EntityId, player gamerules.IPlaye
 		player.TransmitPacket(buf.Bytes())
 	}
 
+	// Send the state of tile entities that clients show, such as sign text.
+	tileEntitiesPacket := new(bytes.Buffer)
+	for _, tileEntity := range chunk.tileEntities {
+		if visible, ok := tileEntity.(gamerules.IVisibleTileEntity); ok {
+			visible.SendUpdate(tileEntitiesPacket)
+		}
+	}
+	if tileEntitiesPacket.Len() > 0 {
+		player.TransmitPacket(tileEntitiesPacket.Bytes())
+	}
+
 	// Spawn existing players for new player.
 	if len(chunk.playersData) > 0 {
 		playersPacket := new(bytes.Buffer)
@@ -633,8 +932,19 @@ func (chunk *Chunk) reqUnsubscribeChunk(entityId EntityId, sendPacket bool) {
 
 		if sendPacket {
 			buf := new(bytes.Buffer)
+
+			// Remove the entities and other players in this chunk from the
+			// client's view.
+			for e := range chunk.entities {
+				proto.WriteEntityDestroy(buf, e)
+			}
+			for _, existing := range chunk.playersData {
+				if existing.entityId != entityId {
+					proto.WriteEntityDestroy(buf, existing.entityId)
+				}
+			}
+
 			proto.WritePreChunk(buf, &chunk.loc, ChunkUnload)
-			// TODO send PacketEntityDestroy packets for spawns in this chunk.
 			player.TransmitPacket(buf.Bytes())
 		}
 	}
@@ -682,11 +992,13 @@ func (chunk *Chunk) reqMulticastPlayers(exclude EntityId, packet []byte) {
 func (chunk *Chunk) reqAddPlayerData(entityId EntityId, name string, pos AbsXyz, look LookBytes, held ItemTypeId) {
 	// TODO add other initial data in here.
 	newPlayerData := &playerData{
-		entityId:   entityId,
-		name:       name,
-		position:   pos,
-		look:       look,
-		heldItemId: held,
+		entityId:         entityId,
+		name:             name,
+		position:         pos,
+		look:             look,
+		heldItemId:       held,
+		lastSentPosition: *pos.ToAbsIntXyz(),
+		lastSentLook:     look,
 	}
 	chunk.playersData[entityId] = newPlayerData
 
@@ -700,6 +1012,9 @@ func (chunk *Chunk) reqRemovePlayerData(entityId EntityId, isDisconnect bool) {
 	chunk.playersData[entityId] = nil, false
 
 	if isDisconnect {
+		// Minecarts must not carry players who have left the game.
+		chunk.shard.dismountRider(entityId)
+
 		buf := new(bytes.Buffer)
 		proto.WriteEntityDestroy(buf, entityId)
 		chunk.reqMulticastPlayers(entityId, buf.Bytes())
@@ -710,7 +1025,7 @@ func (chunk *Chunk) reqSetPlayerPosition(entityId EntityId, pos AbsXyz) {
 	data, ok := chunk.playersData[entityId]
 
 	if !ok {
-		log.Printf(
+		chunk.log().Warn(
 			"%v.reqSetPlayerPosition: called for EntityId (%d) not present as playerData.",
 			chunk, entityId,
 		)
@@ -723,30 +1038,13 @@ func (chunk *Chunk) reqSetPlayerPosition(entityId EntityId, pos AbsXyz) {
 	buf := new(bytes.Buffer)
 	data.sendPositionLook(buf)
 	chunk.reqMulticastPlayers(entityId, buf.Bytes())
-
-	player, ok := chunk.subscribers[entityId]
-
-	if ok {
-		// Does the player overlap with any items?
-		for _, item := range chunk.items() {
-			if item.PickupImmunity > 0 {
-				item.PickupImmunity--
-				continue
-			}
-			// TODO This check should be performed when items move as well.
-			if data.OverlapsItem(item) {
-				slot := item.GetSlot()
-				player.OfferItem(chunk.loc, item.EntityId, *slot)
-			}
-		}
-	}
 }
 
 func (chunk *Chunk) reqSetPlayerLook(entityId EntityId, look LookBytes) {
 	data, ok := chunk.playersData[entityId]
 
 	if !ok {
-		log.Printf(
+		chunk.log().Warn(
 			"%v.reqSetPlayerLook: called for EntityId (%d) not present as playerData.",
 			chunk, entityId,
 		)
@@ -761,6 +1059,25 @@ func (chunk *Chunk) reqSetPlayerLook(entityId EntityId, look LookBytes) {
 	chunk.reqMulticastPlayers(entityId, buf.Bytes())
 }
 
+func (chunk *Chunk) reqSetPlayerHeldItem(entityId EntityId, held *gamerules.Slot) {
+	data, ok := chunk.playersData[entityId]
+
+	if !ok {
+		chunk.log().Warn(
+			"%v.reqSetPlayerHeldItem: called for EntityId (%d) not present as playerData.",
+			chunk, entityId,
+		)
+		return
+	}
+
+	data.heldItemId = held.ItemTypeId
+
+	// Update subscribers.
+	buf := new(bytes.Buffer)
+	held.SendEquipmentUpdate(buf, entityId, 0)
+	chunk.reqMulticastPlayers(entityId, buf.Bytes())
+}
+
 func (chunk *Chunk) chunkPacket() []byte {
 	if chunk.cachedPacket == nil {
 		buf := new(bytes.Buffer)
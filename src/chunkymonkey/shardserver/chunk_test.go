@@ -0,0 +1,584 @@
+package shardserver
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"chunkymonkey/chunkstore"
+	"chunkymonkey/entity"
+	"chunkymonkey/gamerules"
+	"chunkymonkey/proto"
+	. "chunkymonkey/types"
+	"nbt"
+)
+
+// recordingPlayerClient records packets transmitted to it, and items offered
+// and given to it. Other methods cause a panic.
+type recordingPlayerClient struct {
+	gamerules.IPlayerClient
+	entityId   EntityId
+	packets    [][]byte
+	offered    []EntityId
+	given      []gamerules.Slot
+	experience int16
+	broken     []BlockXyz
+}
+
+func (p *recordingPlayerClient) GetEntityId() EntityId {
+	return p.entityId
+}
+
+func (p *recordingPlayerClient) TransmitPacket(packet []byte) {
+	p.packets = append(p.packets, packet)
+}
+
+func (p *recordingPlayerClient) OfferItem(fromChunk ChunkXz, entityId EntityId, item gamerules.Slot) {
+	p.offered = append(p.offered, entityId)
+}
+
+func (p *recordingPlayerClient) GiveItemAtPosition(atPosition AbsXyz, item gamerules.Slot) {
+	p.given = append(p.given, item)
+}
+
+func (p *recordingPlayerClient) GiveExperience(amount int16) {
+	p.experience += amount
+}
+
+func (p *recordingPlayerClient) BlockBroken(target BlockXyz) {
+	p.broken = append(p.broken, target)
+}
+
+func TestChunk_ScheduleBlockTick(t *testing.T) {
+	chunk := &Chunk{
+		newActiveBlocks: make(map[BlockIndex]bool),
+		scheduledBlocks: make(map[BlockIndex]Ticks),
+	}
+
+	chunk.ScheduleBlockTick(10, 3)
+	chunk.ScheduleBlockTick(20, 1)
+	// Rescheduling later than an existing schedule has no effect.
+	chunk.ScheduleBlockTick(20, 5)
+
+	type Test struct {
+		tick     Ticks
+		expected []BlockIndex
+	}
+
+	tests := []Test{
+		{1, []BlockIndex{20}},
+		{2, []BlockIndex{}},
+		{3, []BlockIndex{10}},
+		{4, []BlockIndex{}},
+	}
+
+	for _, test := range tests {
+		chunk.ticks++
+		chunk.activateScheduledBlocks()
+
+		if chunk.ticks != test.tick {
+			t.Fatalf("expected tick %d, got %d", test.tick, chunk.ticks)
+		}
+		if len(chunk.newActiveBlocks) != len(test.expected) {
+			t.Errorf("tick %d: expected %d blocks activated, got %v", test.tick, len(test.expected), chunk.newActiveBlocks)
+		}
+		for _, blockIndex := range test.expected {
+			if !chunk.newActiveBlocks[blockIndex] {
+				t.Errorf("tick %d: expected block %d to be activated", test.tick, blockIndex)
+			}
+		}
+
+		// Clear out as blockTick would.
+		chunk.newActiveBlocks = make(map[BlockIndex]bool)
+	}
+
+	if len(chunk.scheduledBlocks) != 0 {
+		t.Errorf("expected no blocks still scheduled, got %v", chunk.scheduledBlocks)
+	}
+}
+
+func TestChunk_reqSetPlayerHeldItem(t *testing.T) {
+	self := &recordingPlayerClient{}
+	other := &recordingPlayerClient{}
+	data := &playerData{entityId: 1}
+
+	chunk := &Chunk{
+		subscribers: map[EntityId]gamerules.IPlayerClient{1: self, 2: other},
+		playersData: map[EntityId]*playerData{1: data},
+	}
+
+	held := gamerules.Slot{ItemTypeId: 276, Count: 1, Data: 0}
+	chunk.reqSetPlayerHeldItem(1, &held)
+
+	if data.heldItemId != 276 {
+		t.Errorf("expected held item 276 but got %d", data.heldItemId)
+	}
+	if len(self.packets) != 0 {
+		t.Errorf("expected no packets sent to the player changing item, got %d", len(self.packets))
+	}
+	if len(other.packets) != 1 || other.packets[0][0] != proto.PacketIdEntityEquipment {
+		t.Errorf("expected one equipment packet sent to other player, got %#v", other.packets)
+	}
+
+	// Players not in the chunk are ignored.
+	chunk.reqSetPlayerHeldItem(3, &held)
+	if len(other.packets) != 1 {
+		t.Errorf("expected no packets sent for unknown player, got %d", len(other.packets)-1)
+	}
+}
+
+func TestChunk_reqRemovePlayerData(t *testing.T) {
+	leaver := &recordingPlayerClient{}
+	viewer := &recordingPlayerClient{}
+
+	chunk := &Chunk{
+		shard:       &ChunkShard{},
+		subscribers: map[EntityId]gamerules.IPlayerClient{1: leaver, 2: viewer},
+		playersData: map[EntityId]*playerData{
+			1: &playerData{entityId: 1},
+			2: &playerData{entityId: 2},
+		},
+	}
+
+	chunk.reqRemovePlayerData(1, true)
+
+	if _, ok := chunk.playersData[1]; ok {
+		t.Errorf("expected player data for disconnected player to be removed")
+	}
+	if len(leaver.packets) != 0 {
+		t.Errorf("expected no packets sent to the disconnecting player, got %d", len(leaver.packets))
+	}
+	if len(viewer.packets) != 1 || viewer.packets[0][0] != proto.PacketIdEntityDestroy {
+		t.Fatalf("expected one entity destroy packet sent to other player, got %#v", viewer.packets)
+	}
+	expected := []byte{proto.PacketIdEntityDestroy, 0, 0, 0, 1}
+	if string(viewer.packets[0]) != string(expected) {
+		t.Errorf("expected destroy packet %x but got %x", expected, viewer.packets[0])
+	}
+
+	// Moving between chunks does not destroy the entity for other players.
+	chunk.reqRemovePlayerData(2, false)
+	if len(leaver.packets) != 0 {
+		t.Errorf("expected no packets sent when a player leaves the chunk, got %d", len(leaver.packets))
+	}
+}
+
+func TestChunk_itemPickupTick(t *testing.T) {
+	player := &recordingPlayerClient{entityId: 1}
+
+	nearItem := gamerules.NewItem(1, 5, 0, &AbsXyz{1.5, 64, 1.5}, &AbsVelocity{}, 2)
+	nearItem.EntityId = 10
+	farItem := gamerules.NewItem(1, 5, 0, &AbsXyz{8.5, 64, 8.5}, &AbsVelocity{}, 0)
+	farItem.EntityId = 11
+
+	chunk := &Chunk{
+		entities: map[EntityId]gamerules.INonPlayerEntity{
+			10: nearItem,
+			11: farItem,
+		},
+		subscribers: map[EntityId]gamerules.IPlayerClient{1: player},
+		playersData: map[EntityId]*playerData{
+			1: &playerData{entityId: 1, position: AbsXyz{1.5, 64, 1.5}},
+		},
+	}
+
+	// The item cannot be picked up until its pickup immunity has worn off.
+	for i := 0; i < 2; i++ {
+		chunk.itemPickupTick()
+		if len(player.offered) != 0 {
+			t.Fatalf("tick %d: expected no items offered during pickup immunity, got %v", i, player.offered)
+		}
+	}
+
+	chunk.itemPickupTick()
+	if len(player.offered) != 1 || player.offered[0] != 10 {
+		t.Errorf("expected item 10 to be offered, got %v", player.offered)
+	}
+}
+
+func TestChunk_reqTakeItem(t *testing.T) {
+	entityMgr := new(entity.EntityManager)
+	entityMgr.Init()
+
+	player := &recordingPlayerClient{entityId: 1}
+	viewer := &recordingPlayerClient{entityId: 2}
+
+	item := gamerules.NewItem(1, 5, 0, &AbsXyz{1.5, 64, 1.5}, &AbsVelocity{}, 0)
+	item.EntityId = 10
+
+	chunk := &Chunk{
+		shard:       &ChunkShard{entityMgr: entityMgr},
+		entities:    map[EntityId]gamerules.INonPlayerEntity{10: item},
+		subscribers: map[EntityId]gamerules.IPlayerClient{1: player, 2: viewer},
+	}
+
+	chunk.reqTakeItem(player, 10)
+
+	if len(player.given) != 1 || player.given[0].Count != 5 {
+		t.Errorf("expected the whole item to be given to the player, got %v", player.given)
+	}
+	if _, ok := chunk.entities[10]; ok {
+		t.Errorf("expected collected item to be removed from the chunk")
+	}
+	if len(viewer.packets) != 2 ||
+		viewer.packets[0][0] != proto.PacketIdItemCollect ||
+		viewer.packets[1][0] != proto.PacketIdEntityDestroy {
+		t.Errorf("expected item collect and destroy packets, got %#v", viewer.packets)
+	}
+
+	// An item that has already been taken cannot be taken again.
+	chunk.reqTakeItem(viewer, 10)
+	if len(viewer.given) != 0 {
+		t.Errorf("expected no item given for an already collected item, got %v", viewer.given)
+	}
+}
+
+func TestChunk_experienceOrbPickupTick(t *testing.T) {
+	entityMgr := new(entity.EntityManager)
+	entityMgr.Init()
+
+	player := &recordingPlayerClient{entityId: 1}
+
+	nearOrb := gamerules.NewExperienceOrb(3, &AbsXyz{1.5, 64, 1.5}, &AbsVelocity{})
+	nearOrb.EntityId = 10
+	farOrb := gamerules.NewExperienceOrb(5, &AbsXyz{8.5, 64, 8.5}, &AbsVelocity{})
+	farOrb.EntityId = 11
+
+	chunk := &Chunk{
+		shard: &ChunkShard{entityMgr: entityMgr},
+		entities: map[EntityId]gamerules.INonPlayerEntity{
+			10: nearOrb,
+			11: farOrb,
+		},
+		subscribers: map[EntityId]gamerules.IPlayerClient{1: player},
+		playersData: map[EntityId]*playerData{
+			1: &playerData{entityId: 1, position: AbsXyz{1.5, 64, 1.5}},
+		},
+	}
+
+	for i := Ticks(0); i < gamerules.ExperienceOrbPickupImmunity; i++ {
+		chunk.experienceOrbPickupTick()
+	}
+	if player.experience != 0 {
+		t.Fatalf("expected no experience during pickup immunity, got %d", player.experience)
+	}
+
+	chunk.experienceOrbPickupTick()
+	if player.experience != 3 {
+		t.Errorf("expected 3 experience from the nearby orb, got %d", player.experience)
+	}
+	if _, ok := chunk.entities[10]; ok {
+		t.Errorf("expected collected orb to be removed from the chunk")
+	}
+	if _, ok := chunk.entities[11]; !ok {
+		t.Errorf("expected distant orb to remain in the chunk")
+	}
+	if len(player.packets) != 2 || player.packets[0][0] != proto.PacketIdItemCollect {
+		t.Errorf("expected collect and destroy packets, got %#v", player.packets)
+	}
+}
+
+func TestChunk_setBlock_DirtySection(t *testing.T) {
+	chunk := newTestChunk(ChunkXz{0, 0})
+
+	blockLoc := BlockXyz{3, 70, 5}
+	_, subLoc := blockLoc.ToChunkLocal()
+	index, _ := subLoc.BlockIndex()
+	chunk.setBlock(&blockLoc, subLoc, index, 1, 0)
+
+	if !chunk.storeDirty {
+		t.Errorf("expected chunk to be dirty after a block change")
+	}
+	// y=70 is in the fifth 16 block high section.
+	if expected := uint8(1 << 4); chunk.dirtyMask != expected {
+		t.Errorf("expected dirty sections %08b but got %08b", expected, chunk.dirtyMask)
+	}
+
+	chunk.save(&countingChunkStore{})
+	if chunk.storeDirty || chunk.dirtyMask != 0 {
+		t.Errorf("expected chunk to be clean after saving, got dirty sections %08b", chunk.dirtyMask)
+	}
+}
+
+func TestChunk_AddEntity_Mob(t *testing.T) {
+	entityMgr := new(entity.EntityManager)
+	entityMgr.Init()
+
+	player := &recordingPlayerClient{entityId: 1}
+
+	chunk := &Chunk{
+		shard:       &ChunkShard{entityMgr: entityMgr},
+		entities:    make(map[EntityId]gamerules.INonPlayerEntity),
+		subscribers: map[EntityId]gamerules.IPlayerClient{1: player},
+	}
+
+	mob := gamerules.NewPig().(*gamerules.Pig)
+	mob.PointObject.Init(&AbsXyz{1.5, 64, 1.5}, &AbsVelocity{})
+	chunk.AddEntity(mob)
+
+	if _, ok := chunk.entities[mob.GetEntityId()]; !ok {
+		t.Errorf("expected mob to be added to the chunk")
+	}
+	if len(player.packets) != 1 || player.packets[0][0] != proto.PacketIdEntitySpawn {
+		t.Fatalf("expected a mob spawn packet, got %#v", player.packets)
+	}
+
+	chunk.removeEntity(mob)
+	if len(player.packets) != 2 || player.packets[1][0] != proto.PacketIdEntityDestroy {
+		t.Errorf("expected an entity destroy packet, got %#v", player.packets)
+	}
+}
+
+func TestChunk_useEntity_Minecart(t *testing.T) {
+	entityMgr := new(entity.EntityManager)
+	entityMgr.Init()
+
+	shard, chunk := newExplosionTestShard()
+	shard.entityMgr = entityMgr
+	chunk.shard = shard
+	chunk.entities = make(map[EntityId]gamerules.INonPlayerEntity)
+
+	rider := &recordingPlayerClient{entityId: 1}
+	viewer := &recordingPlayerClient{entityId: 2}
+	chunk.subscribers[1] = rider
+	chunk.subscribers[2] = viewer
+
+	cart := gamerules.NewMinecart().(*gamerules.Minecart)
+	cart.EntityId = 10
+	chunk.entities[10] = cart
+
+	attach := new(bytes.Buffer)
+	proto.WriteAttachEntity(attach, 1, 10)
+	detach := new(bytes.Buffer)
+	proto.WriteAttachEntity(detach, 1, -1)
+
+	// Using the minecart gets into it, which all players see.
+	if !chunk.useEntity(rider, 10, false) {
+		t.Fatalf("expected the minecart to be found in the chunk")
+	}
+	if cart.Rider() != rider {
+		t.Errorf("expected player to be riding the minecart")
+	}
+	for _, p := range []*recordingPlayerClient{rider, viewer} {
+		if len(p.packets) != 1 || !bytes.Equal(attach.Bytes(), p.packets[0]) {
+			t.Errorf("expected attach packet %x, got %x", attach.Bytes(), p.packets)
+		}
+	}
+
+	// Other players cannot get in while it is ridden.
+	chunk.useEntity(viewer, 10, false)
+	if cart.Rider() != rider || len(viewer.packets) != 1 {
+		t.Errorf("expected a ridden minecart to keep its rider")
+	}
+
+	// Breaking the minecart throws the rider out before it is destroyed.
+	viewer.packets = nil
+	chunk.useEntity(viewer, 10, true)
+	if cart.Rider() != nil {
+		t.Errorf("expected the rider to be taken out of a broken minecart")
+	}
+	if _, ok := chunk.entities[10]; ok {
+		t.Errorf("expected the broken minecart to be removed from the chunk")
+	}
+	if len(viewer.packets) < 2 ||
+		!bytes.Equal(detach.Bytes(), viewer.packets[0]) ||
+		viewer.packets[1][0] != proto.PacketIdEntityDestroy {
+		t.Errorf("expected detach and destroy packets, got %x", viewer.packets)
+	}
+
+	if chunk.useEntity(viewer, 10, false) {
+		t.Errorf("expected a broken minecart not to be found")
+	}
+}
+
+const placementTestBlocks = `{
+  "0": {
+    "Aspect": "Void",
+    "AspectArgs": {},
+    "Name": "air",
+    "Replaceable": true
+  },
+  "53": {
+    "Aspect": "Oriented",
+    "AspectArgs": {"Orientations": [2, 1, 3, 0]},
+    "Name": "wooden stairs",
+    "Solid": true
+  }
+}`
+
+func TestChunk_reqPlaceItem_StairsFacing(t *testing.T) {
+	type Test struct {
+		yaw      AngleDegrees
+		expected byte
+	}
+
+	defer func(blocks gamerules.BlockTypeList) { gamerules.Blocks = blocks }(gamerules.Blocks)
+	blocks, err := gamerules.LoadBlockDefs(strings.NewReader(placementTestBlocks))
+	if err != nil {
+		t.Fatalf("failed to load block types: %v", err)
+	}
+	gamerules.Blocks = blocks
+
+	dir, err := ioutil.TempDir("", "placement")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	levelData := &nbt.Compound{map[string]nbt.ITag{
+		"Data": &nbt.Compound{map[string]nbt.ITag{
+			"version": &nbt.Int{19132},
+		}},
+	}}
+	store, err := chunkstore.ChunkStoreForLevel(dir, levelData, DimensionNormal)
+	if err != nil {
+		t.Fatalf("failed to create chunk store: %v", err)
+	}
+	service := chunkstore.NewChunkService(store)
+	go service.Serve()
+
+	shard, chunk := newExplosionTestShard()
+	chunk.newActiveBlocks = make(map[BlockIndex]bool)
+	player := &recordingPlayerClient{entityId: 1}
+
+	// Stairs rise in the direction that the player faces.
+	tests := []Test{
+		{0, 2},
+		{90, 1},
+		{180, 3},
+		{270, 0},
+		{-90, 0},
+		{40, 2},
+		{50, 1},
+	}
+
+	for i, r := range tests {
+		target := BlockXyz{BlockCoord(i), 64, 0}
+		slot := gamerules.Slot{ItemTypeId: 53, Count: 1}
+		chunk.reqPlaceItem(player, &target, &slot, &LookDegrees{r.yaw, 0})
+
+		if blockId, data, _ := chunk.BlockAt(&target); blockId != 53 || data != r.expected {
+			t.Errorf("yaw %v: expected stairs with data %d, got block %d with data %d",
+				r.yaw, r.expected, blockId, data)
+		}
+	}
+
+	// The facing is kept when the chunk is saved and loaded again.
+	chunk.save(service)
+	result := <-service.ReadChunk(chunk.loc)
+	if result.Err != nil {
+		t.Fatalf("failed to read saved chunk: %v", result.Err)
+	}
+	loaded := newChunkFromReader(result.Reader, shard)
+
+	for i, r := range tests {
+		target := BlockXyz{BlockCoord(i), 64, 0}
+		_, subLoc := target.ToChunkLocal()
+		index, _ := subLoc.BlockIndex()
+		if blockId, data := loaded.blockId(index), index.BlockData(loaded.blockData); blockId != 53 || data != r.expected {
+			t.Errorf("yaw %v: expected loaded stairs with data %d, got block %d with data %d",
+				r.yaw, r.expected, blockId, data)
+		}
+	}
+}
+
+const signTestBlocks = `{
+  "0": {
+    "Aspect": "Void",
+    "AspectArgs": {},
+    "Name": "air",
+    "Replaceable": true
+  },
+  "63": {
+    "Aspect": "Sign",
+    "AspectArgs": {},
+    "Name": "sign post"
+  }
+}`
+
+func TestChunk_reqSetSignText(t *testing.T) {
+	defer func(blocks gamerules.BlockTypeList) { gamerules.Blocks = blocks }(gamerules.Blocks)
+	blocks, err := gamerules.LoadBlockDefs(strings.NewReader(signTestBlocks))
+	if err != nil {
+		t.Fatalf("failed to load block types: %v", err)
+	}
+	gamerules.Blocks = blocks
+
+	_, chunk := newExplosionTestShard()
+	chunk.newActiveBlocks = make(map[BlockIndex]bool)
+	target := BlockXyz{2, 64, 3}
+	_, subLoc := target.ToChunkLocal()
+	index, _ := subLoc.BlockIndex()
+
+	writer := &recordingPlayerClient{entityId: 1}
+	chunk.subscribers[1] = writer
+	other := &recordingPlayerClient{entityId: 3}
+	chunk.subscribers[3] = other
+
+	// The writer places the sign.
+	chunk.reqPlaceItem(writer, &target, &gamerules.Slot{ItemTypeId: 63, Count: 1}, &LookDegrees{0, 0})
+	if blockId, _, _ := chunk.BlockAt(&target); blockId != 63 {
+		t.Fatalf("expected sign to be placed, got block %d", blockId)
+	}
+	writer.packets = nil
+
+	// Lines that are too long are rejected.
+	chunk.reqSetSignText(writer, &target, [4]string{"", "this line is too long", "", ""})
+	if len(writer.packets) != 0 {
+		t.Errorf("expected overlong sign text to be rejected, got %x", writer.packets)
+	}
+
+	// Other players can't write on the sign.
+	chunk.reqSetSignText(other, &target, [4]string{"graffiti", "", "", ""})
+	if len(writer.packets) != 0 {
+		t.Errorf("expected text from a player who did not place the sign to be rejected, got %x", writer.packets)
+	}
+
+	// Control characters are taken out of the text.
+	chunk.reqSetSignText(writer, &target, [4]string{"Hello", "\x07world\n", "", "line four"})
+	expected := new(bytes.Buffer)
+	proto.WriteSignUpdate(expected, &target, [4]string{"Hello", "world", "", "line four"})
+	if len(writer.packets) != 1 || !bytes.Equal(expected.Bytes(), writer.packets[0]) {
+		t.Errorf("expected sign update %x, got %x", expected.Bytes(), writer.packets)
+	}
+
+	// Once written, the text can't be changed.
+	writer.packets = nil
+	chunk.reqSetSignText(writer, &target, [4]string{"Goodbye", "", "", ""})
+	if len(writer.packets) != 0 {
+		t.Errorf("expected text for a sign already written on to be rejected, got %x", writer.packets)
+	}
+
+	// Text can only be put on signs.
+	air := BlockXyz{3, 64, 3}
+	chunk.reqSetSignText(writer, &air, [4]string{"not", "a", "sign", ""})
+	if len(writer.packets) != 0 || len(chunk.tileEntities) != 1 {
+		t.Errorf("expected text for a block that is not a sign to be rejected")
+	}
+
+	// The text is kept when the chunk is saved and loaded again, and is sent to
+	// players when they load the chunk.
+	tag := nbt.NewCompound()
+	if err = chunk.tileEntities[index].MarshalNbt(tag); err != nil {
+		t.Fatalf("failed to save sign: %v", err)
+	}
+	loaded := gamerules.NewSignTileEntity()
+	if err = loaded.UnmarshalNbt(tag); err != nil {
+		t.Fatalf("failed to load sign: %v", err)
+	}
+	chunk.tileEntities[index] = loaded
+
+	reader := &recordingPlayerClient{entityId: 2}
+	chunk.reqSubscribeChunk(2, reader, false)
+	found := false
+	for _, packet := range reader.packets {
+		if bytes.Equal(expected.Bytes(), packet) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected sign text %x to be sent to subscriber, got %x", expected.Bytes(), reader.packets)
+	}
+}
@@ -0,0 +1,127 @@
+package shardserver
+
+import (
+	"math"
+
+	"chunkymonkey/gamerules"
+	. "chunkymonkey/types"
+)
+
+const (
+	// Size of the player's bounding box for collisions with blocks. This is
+	// smaller than the bounding box used for picking up items.
+	playerCollisionH = AbsCoord(0.3) // Each side of player.
+	playerCollisionY = AbsCoord(1.8) // From player's feet position upwards.
+
+	// Players can step up onto blocks this high (e.g slabs) without jumping,
+	// so the lowest part of the bounding box is not checked for collisions.
+	playerStepHeight = AbsCoord(0.5)
+
+	// Distance between the points on a movement path at which the player's
+	// bounding box is checked for collisions.
+	collisionSampleStep = AbsCoord(0.25)
+
+	// Shrinks the bounding box slightly, so that a player standing against a
+	// block is not counted as being inside it.
+	collisionEpsilon = AbsCoord(0.001)
+)
+
+// Blocks that players may move through, even though they are solid. Their
+// collision boxes are smaller than the block (or, for open doors and gates,
+// depend on the block data), so a move through them cannot be checked by
+// treating them as whole blocks. Cobwebs and vines only slow players down.
+var playerPassableBlocks = map[BlockId]bool{
+	26:  true, // bed
+	27:  true, // powered rail
+	28:  true, // detector rail
+	30:  true, // web
+	44:  true, // slab
+	53:  true, // wooden stairs
+	64:  true, // wooden door
+	66:  true, // rail
+	67:  true, // cobblestone stairs
+	71:  true, // iron door
+	81:  true, // cactus
+	85:  true, // fence
+	96:  true, // trapdoor
+	101: true, // iron bars
+	102: true, // glass pane
+	106: true, // vines
+	107: true, // fence gate
+}
+
+// isSolidBlock returns true if the block cannot be moved through. Blocks that
+// are outside the world, in another shard, or in unloaded chunks are assumed
+// to be passable, as a move cannot be checked against them.
+func (shard *ChunkShard) isSolidBlock(blockLoc *BlockXyz) bool {
+	if blockLoc.Y < 0 || int(blockLoc.Y) >= ChunkSizeY {
+		return false
+	}
+
+	chunkLoc, subLoc := blockLoc.ToChunkLocal()
+	blockTypeId, known := shard.blockQuery(*chunkLoc, subLoc)
+	if !known {
+		return false
+	}
+
+	if playerPassableBlocks[blockTypeId] {
+		return false
+	}
+
+	blockType, ok := gamerules.Blocks.Get(blockTypeId)
+	return ok && blockType.Solid
+}
+
+// isPlayerBoxClear returns true if a player standing at pos does not overlap
+// any solid blocks.
+func (shard *ChunkShard) isPlayerBoxClear(pos *AbsXyz) bool {
+	minX := blockCoordFloor(pos.X - playerCollisionH + collisionEpsilon)
+	maxX := blockCoordFloor(pos.X + playerCollisionH - collisionEpsilon)
+	minY := blockCoordFloor(pos.Y + playerStepHeight)
+	maxY := blockCoordFloor(pos.Y + playerCollisionY - collisionEpsilon)
+	minZ := blockCoordFloor(pos.Z - playerCollisionH + collisionEpsilon)
+	maxZ := blockCoordFloor(pos.Z + playerCollisionH - collisionEpsilon)
+
+	// Blocks above and below the world are passable.
+	if minY < 0 {
+		minY = 0
+	}
+	if maxY >= ChunkSizeY {
+		maxY = ChunkSizeY - 1
+	}
+
+	for x := minX; x <= maxX; x++ {
+		for y := minY; y <= maxY; y++ {
+			for z := minZ; z <= maxZ; z++ {
+				blockLoc := BlockXyz{BlockCoord(x), BlockYCoord(y), BlockCoord(z)}
+				if shard.isSolidBlock(&blockLoc) {
+					return false
+				}
+			}
+		}
+	}
+
+	return true
+}
+
+// isPlayerPathClear returns true if a player can move in a straight line from
+// one position to another without passing through solid blocks. The starting
+// position itself is not checked, so that a player who has become stuck inside
+// a block (e.g one placed on them) can move out of it.
+func (shard *ChunkShard) isPlayerPathClear(from, to *AbsXyz) bool {
+	move := to.Sub(from)
+
+	steps := int(math.Ceil(float64(move.Length() / collisionSampleStep)))
+	for i := 1; i <= steps; i++ {
+		pos := from.Add(move.Scale(AbsCoord(i) / AbsCoord(steps)))
+		if !shard.isPlayerBoxClear(pos) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func blockCoordFloor(c AbsCoord) int {
+	return int(math.Floor(float64(c)))
+}
@@ -0,0 +1,169 @@
+package shardserver
+
+import (
+	"strings"
+	"testing"
+
+	"chunkymonkey/gamerules"
+	. "chunkymonkey/types"
+)
+
+const collisionTestBlocks = `{
+  "0": {
+    "Aspect": "Void",
+    "AspectArgs": {},
+    "Name": "air",
+    "Solid": false
+  },
+  "1": {
+    "Aspect": "Void",
+    "AspectArgs": {},
+    "Name": "stone",
+    "Solid": true
+  },
+  "64": {
+    "Aspect": "Void",
+    "AspectArgs": {},
+    "Name": "wooden door",
+    "Solid": true
+  },
+  "66": {
+    "Aspect": "Void",
+    "AspectArgs": {},
+    "Name": "rail",
+    "Solid": true
+  }
+}`
+
+// newCollisionTestShard creates a shard with a stone floor at y=63 and a wall
+// two blocks high along x=8. The wall has an empty doorway in it at z=4, a
+// wooden door at z=6, and rails in front of it at z=12.
+func newCollisionTestShard(t *testing.T) *ChunkShard {
+	shardLoc := ShardXz{0, 0}
+	shard := &ChunkShard{
+		loc:            shardLoc,
+		originChunkLoc: shardLoc.ToChunkXz(),
+		chunkStore:     &countingChunkStore{},
+	}
+	chunkLoc := ChunkXz{0, 0}
+	index, _, _, _ := shard.chunkIndexAndRelLoc(chunkLoc)
+	shard.chunks[index] = newTestChunk(chunkLoc)
+
+	setBlock := func(loc BlockXyz, blockId BlockId) {
+		chunk, index, ok := shard.loadedChunkForBlock(&loc)
+		if !ok {
+			t.Fatalf("block %v not loaded", loc)
+		}
+		index.SetBlockId(chunk.blocks, blockId)
+	}
+
+	for x := BlockCoord(0); x < ChunkSizeH; x++ {
+		for z := BlockCoord(0); z < ChunkSizeH; z++ {
+			setBlock(BlockXyz{x, 63, z}, 1)
+		}
+	}
+	for z := BlockCoord(0); z < ChunkSizeH; z++ {
+		switch z {
+		case 4:
+		case 6:
+			setBlock(BlockXyz{8, 64, z}, 64)
+			setBlock(BlockXyz{8, 65, z}, 64)
+		default:
+			setBlock(BlockXyz{8, 64, z}, 1)
+			setBlock(BlockXyz{8, 65, z}, 1)
+		}
+	}
+	setBlock(BlockXyz{6, 64, 12}, 66)
+
+	return shard
+}
+
+// loadCollisionTestBlocks replaces the block types with those used in
+// collision tests, and returns a function that restores them.
+func loadCollisionTestBlocks(t *testing.T) (restore func()) {
+	oldBlocks := gamerules.Blocks
+	blocks, err := gamerules.LoadBlockDefs(strings.NewReader(collisionTestBlocks))
+	if err != nil {
+		t.Fatalf("failed to load block types: %v", err)
+	}
+	gamerules.Blocks = blocks
+	return func() { gamerules.Blocks = oldBlocks }
+}
+
+func TestChunkShard_isPlayerPathClear(t *testing.T) {
+	defer loadCollisionTestBlocks(t)()
+	shard := newCollisionTestShard(t)
+
+	type Test struct {
+		desc     string
+		from, to AbsXyz
+		expected bool
+	}
+
+	tests := []Test{
+		{"walking across the floor", AbsXyz{2.5, 64, 10.5}, AbsXyz{6.5, 64, 10.5}, true},
+		{"walking up to the wall", AbsXyz{6.5, 64, 10.5}, AbsXyz{7.7, 64, 10.5}, true},
+		{"walking into the wall", AbsXyz{7.5, 64, 10.5}, AbsXyz{8.5, 64, 10.5}, false},
+		{"walking through the wall", AbsXyz{7.5, 64, 10.5}, AbsXyz{9.5, 64, 10.5}, false},
+		{"walking through the doorway", AbsXyz{7.5, 64, 4.5}, AbsXyz{9.5, 64, 4.5}, true},
+		{"walking through the door", AbsXyz{7.5, 64, 6.5}, AbsXyz{9.5, 64, 6.5}, true},
+		{"walking along the rails", AbsXyz{5.5, 64, 12.5}, AbsXyz{7.5, 64, 12.5}, true},
+		{"walking over the wall", AbsXyz{7.5, 66, 10.5}, AbsXyz{9.5, 66, 10.5}, true},
+		{"sinking into the floor", AbsXyz{2.5, 64, 10.5}, AbsXyz{2.5, 62.5, 10.5}, false},
+	}
+
+	for _, test := range tests {
+		if result := shard.isPlayerPathClear(&test.from, &test.to); result != test.expected {
+			t.Errorf("%s: expected %t but got %t", test.desc, test.expected, result)
+		}
+	}
+}
+
+// rejectRecordingPlayerClient records the positions that it is told to return
+// to by RejectMove.
+type rejectRecordingPlayerClient struct {
+	gamerules.IPlayerClient
+	rejectedTo []AbsXyz
+}
+
+func (p *rejectRecordingPlayerClient) RejectMove(position AbsXyz) {
+	p.rejectedTo = append(p.rejectedTo, position)
+}
+
+func TestLocalPlayerShardClient_checkMove(t *testing.T) {
+	defer loadCollisionTestBlocks(t)()
+
+	player := &rejectRecordingPlayerClient{}
+	conn := newLocalPlayerShardClient(1, player, newCollisionTestShard(t))
+
+	moves := []AbsXyz{
+		{5.5, 64, 10.5},
+		{6.5, 64, 10.5},
+		{7.5, 64, 10.5},
+		// Through the wall, and on beyond it before the check is made.
+		{9.5, 64, 10.5},
+		{10.5, 64, 10.5},
+	}
+	for i := 1; i < len(moves); i++ {
+		conn.checkMove(&moves[i-1], &moves[i])
+	}
+
+	// Both moves beyond the wall are rejected, back to the last position before
+	// it, rather than to the start of the later move.
+	expected := []AbsXyz{moves[2], moves[2]}
+	if len(player.rejectedTo) != len(expected) {
+		t.Fatalf("expected rejections to %v, got %v", expected, player.rejectedTo)
+	}
+	for i := range expected {
+		if player.rejectedTo[i] != expected[i] {
+			t.Errorf("expected rejections to %v, got %v", expected, player.rejectedTo)
+		}
+	}
+
+	// Once back, the player can move on from there.
+	player.rejectedTo = nil
+	conn.checkMove(&moves[2], &AbsXyz{7.5, 64, 9.5})
+	if len(player.rejectedTo) != 0 {
+		t.Errorf("expected move after returning to be accepted, got rejections to %v", player.rejectedTo)
+	}
+}
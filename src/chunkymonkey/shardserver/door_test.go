@@ -0,0 +1,132 @@
+package shardserver
+
+import (
+	"strings"
+	"testing"
+
+	"chunkymonkey/gamerules"
+	. "chunkymonkey/types"
+)
+
+const doorTestBlocks = `{
+  "0": {
+    "Aspect": "Void",
+    "AspectArgs": {},
+    "Name": "air"
+  },
+  "64": {
+    "Aspect": "Door",
+    "AspectArgs": {"HandOperated": true, "TwoHigh": true, "BreakOn": 2},
+    "Name": "wooden door"
+  },
+  "69": {
+    "Aspect": "Lever",
+    "AspectArgs": {},
+    "Name": "lever"
+  },
+  "71": {
+    "Aspect": "Door",
+    "AspectArgs": {"TwoHigh": true},
+    "Name": "iron door"
+  }
+}`
+
+func loadDoorTestBlocks(t *testing.T) {
+	blocks, err := gamerules.LoadBlockDefs(strings.NewReader(doorTestBlocks))
+	if err != nil {
+		t.Fatalf("failed to load block types: %v", err)
+	}
+	gamerules.Blocks = blocks
+}
+
+func TestDoor_InteractTogglesBothHalves(t *testing.T) {
+	defer func(blocks gamerules.BlockTypeList) { gamerules.Blocks = blocks }(gamerules.Blocks)
+	loadDoorTestBlocks(t)
+
+	_, chunks := newRedstoneTestShard()
+	chunk := chunks[0]
+	bottom := BlockXyz{4, 64, 4}
+	top := BlockXyz{4, 65, 4}
+	chunk.SetBlockAt(&bottom, 64, 0x1)
+	chunk.SetBlockAt(&top, 64, 0x9)
+
+	checkDoor := func(desc string, open bool) {
+		var openBit byte
+		if open {
+			openBit = 0x4
+		}
+		if blockId, data, _ := chunk.BlockAt(&bottom); blockId != 64 || data != 0x1|openBit {
+			t.Errorf("%s: expected bottom half with data %#x, got block %d with data %#x", desc, 0x1|openBit, blockId, data)
+		}
+		if blockId, data, _ := chunk.BlockAt(&top); blockId != 64 || data != 0x9|openBit {
+			t.Errorf("%s: expected top half with data %#x, got block %d with data %#x", desc, 0x9|openBit, blockId, data)
+		}
+	}
+
+	player := &recordingPlayerClient{entityId: 1}
+
+	chunk.reqInteractBlock(player, gamerules.Slot{}, &bottom, FaceEast)
+	checkDoor("opened from the bottom", true)
+
+	chunk.reqInteractBlock(player, gamerules.Slot{}, &top, FaceEast)
+	checkDoor("closed from the top", false)
+
+	chunk.reqInteractBlock(player, gamerules.Slot{}, &top, FaceEast)
+	checkDoor("opened from the top", true)
+
+	// Opening and closing doors by hand isn't undone by later ticks.
+	tickRedstoneTestShard(chunks, 10)
+	checkDoor("after ticking", true)
+
+	// Breaking one half breaks the other.
+	chunk.reqHitBlock(player, gamerules.Slot{}, DigBlockBroke, &top, FaceEast)
+	if blockId, _, _ := chunk.BlockAt(&bottom); blockId != BlockIdAir {
+		t.Errorf("expected bottom half to be broken with the top, got block %d", blockId)
+	}
+	if len(player.broken) != 1 || player.broken[0] != top {
+		t.Errorf("expected the player to be told that %v was broken, got %v", top, player.broken)
+	}
+}
+
+func TestDoor_RedstoneOpensIronDoor(t *testing.T) {
+	defer func(blocks gamerules.BlockTypeList) { gamerules.Blocks = blocks }(gamerules.Blocks)
+	loadDoorTestBlocks(t)
+
+	_, chunks := newRedstoneTestShard()
+	chunk := chunks[0]
+	bottom := BlockXyz{4, 64, 4}
+	top := BlockXyz{4, 65, 4}
+	lever := BlockXyz{5, 64, 4}
+	chunk.SetBlockAt(&bottom, 71, 0x0)
+	chunk.SetBlockAt(&top, 71, 0x8)
+	chunk.SetBlockAt(&lever, 69, 0x0)
+	tickRedstoneTestShard(chunks, 10)
+
+	isOpen := func() bool {
+		_, bottomData, _ := chunk.BlockAt(&bottom)
+		_, topData, _ := chunk.BlockAt(&top)
+		if bottomData&0x4 != topData&0x4 {
+			t.Fatalf("door halves out of sync, bottom data %#x, top data %#x", bottomData, topData)
+		}
+		return bottomData&0x4 != 0
+	}
+
+	// Players can't open iron doors.
+	player := &recordingPlayerClient{entityId: 1}
+	chunk.reqInteractBlock(player, gamerules.Slot{}, &bottom, FaceEast)
+	if isOpen() {
+		t.Errorf("expected iron door to stay closed when used")
+	}
+
+	chunk.reqInteractBlock(player, gamerules.Slot{}, &lever, FaceTop)
+	tickRedstoneTestShard(chunks, 10)
+	if !isOpen() {
+		t.Errorf("expected lever to open the door")
+	}
+
+	chunk.reqInteractBlock(player, gamerules.Slot{}, &lever, FaceTop)
+	tickRedstoneTestShard(chunks, 10)
+	if isOpen() {
+		t.Errorf("expected door to close when the lever is switched off")
+	}
+}
@@ -0,0 +1,171 @@
+package shardserver
+
+import (
+	"bytes"
+	"math"
+	"rand"
+
+	"chunkymonkey/gamerules"
+	"chunkymonkey/proto"
+	. "chunkymonkey/types"
+)
+
+const (
+	// Explosions cast rays outwards from their center, through the points on
+	// the surface of a cube with this many points along each edge.
+	explosionRayGrid = 16
+
+	// Distance moved along a ray at each step.
+	explosionRayStep = 0.3
+
+	// Fraction of destroyed blocks that drop items.
+	explosionDropChance = 0.3
+)
+
+// explode destroys the blocks around center that are not strong enough to
+// resist an explosion of the given power, and hurts the players nearby. Only
+// blocks in loaded chunks within this shard are affected.
+func (shard *ChunkShard) explode(center *AbsXyz, power float32) {
+	centerChunk := shard.chunkAt(center.ToChunkXz())
+	if centerChunk == nil {
+		return
+	}
+	rand := centerChunk.Rand()
+
+	destroyed := shard.explosionBlocks(center, power, rand)
+
+	offsets := make([]proto.ExplosionOffsetXyz, 0, len(destroyed))
+	centerBlock := center.ToBlockXyz()
+	for _, blockLoc := range destroyed {
+		chunk, index, ok := shard.loadedChunkForBlock(&blockLoc)
+		if !ok {
+			continue
+		}
+		blockType, blockData, ok := chunk.blockTypeAndData(index)
+		if !ok {
+			continue
+		}
+
+		if rand.Float32() < explosionDropChance {
+			blockType.Aspect.Destroy(&gamerules.BlockInstance{
+				Chunk:     chunk,
+				BlockLoc:  blockLoc,
+				SubLoc:    index.ToSubChunkXyz(),
+				Index:     index,
+				BlockType: blockType,
+				Data:      blockData,
+			}, nil)
+		}
+		subLoc := index.ToSubChunkXyz()
+		chunk.setBlock(&blockLoc, &subLoc, index, BlockIdAir, 0)
+
+		offsets = append(offsets, proto.ExplosionOffsetXyz{
+			X: int8(blockLoc.X - centerBlock.X),
+			Y: int8(blockLoc.Y - centerBlock.Y),
+			Z: int8(blockLoc.Z - centerBlock.Z),
+		})
+	}
+
+	shard.explosionDamage(center, power)
+
+	packet := new(bytes.Buffer)
+	proto.WriteExplosion(packet, center, power, offsets)
+	centerChunk.reqMulticastPlayers(-1, packet.Bytes())
+}
+
+// explosionBlocks returns the blocks that are destroyed by an explosion. Rays
+// are cast outwards from the center, each with an intensity that is reduced
+// by distance and by the blast resistance of the blocks that it passes
+// through. A block is destroyed if any ray reaches it with some intensity
+// left.
+func (shard *ChunkShard) explosionBlocks(center *AbsXyz, power float32, rand *rand.Rand) (destroyed []BlockXyz) {
+	seen := make(map[BlockXyz]bool)
+
+	const last = explosionRayGrid - 1
+	for i := 0; i < explosionRayGrid; i++ {
+		for j := 0; j < explosionRayGrid; j++ {
+			for k := 0; k < explosionRayGrid; k++ {
+				if i != 0 && i != last && j != 0 && j != last && k != 0 && k != last {
+					// Only cast rays through the surface of the cube.
+					continue
+				}
+
+				dx := float64(i)/last*2 - 1
+				dy := float64(j)/last*2 - 1
+				dz := float64(k)/last*2 - 1
+				length := math.Sqrt(dx*dx + dy*dy + dz*dz)
+				dx, dy, dz = dx/length*explosionRayStep, dy/length*explosionRayStep, dz/length*explosionRayStep
+
+				intensity := power * (0.7 + rand.Float32()*0.6)
+				x, y, z := float64(center.X), float64(center.Y), float64(center.Z)
+				for ; intensity > 0; intensity -= explosionRayStep * 0.75 {
+					blockY := math.Floor(y)
+					blockLoc := BlockXyz{
+						BlockCoord(math.Floor(x)),
+						BlockYCoord(blockY),
+						BlockCoord(math.Floor(z)),
+					}
+					x, y, z = x+dx, y+dy, z+dz
+
+					if blockY < 0 || blockY >= ChunkSizeY {
+						continue
+					}
+
+					chunk, index, ok := shard.loadedChunkForBlock(&blockLoc)
+					if !ok {
+						continue
+					}
+					blockId := chunk.blockId(index)
+					if blockId == BlockIdAir {
+						continue
+					}
+					blockType, ok := gamerules.Blocks.Get(blockId)
+					if !ok {
+						continue
+					}
+
+					intensity -= (blockType.BlastResistance/5 + explosionRayStep) * explosionRayStep
+					if intensity > 0 && blockType.Destructable && !seen[blockLoc] {
+						seen[blockLoc] = true
+						destroyed = append(destroyed, blockLoc)
+					}
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// explosionDamage hurts the players within twice the power of the explosion
+// from its center. The damage falls off with distance.
+func (shard *ChunkShard) explosionDamage(center *AbsXyz, power float32) {
+	radius := 2 * float64(power)
+
+	for _, chunk := range shard.chunks {
+		if chunk == nil {
+			continue
+		}
+		for entityId, data := range chunk.playersData {
+			player, ok := chunk.subscribers[entityId]
+			if !ok {
+				continue
+			}
+			if damage := explosionDamageAt(center, &data.position, radius); damage > 0 {
+				player.ApplyDamage(damage, "exploded")
+			}
+		}
+	}
+}
+
+// explosionDamageAt returns the damage done to a player at pos by an explosion
+// that hurts players within the given radius.
+func explosionDamageAt(center, pos *AbsXyz, radius float64) Health {
+	distance := float64(pos.DistanceTo(center))
+	if distance >= radius {
+		return 0
+	}
+
+	impact := 1 - distance/radius
+	return Health((impact*impact+impact)/2*8*radius + 1)
+}
@@ -0,0 +1,175 @@
+package shardserver
+
+import (
+	"rand"
+	"strings"
+	"testing"
+
+	"chunkymonkey/gamerules"
+	. "chunkymonkey/types"
+)
+
+const explosionTestBlocks = `{
+  "0": {
+    "Aspect": "Void",
+    "AspectArgs": {},
+    "Name": "air"
+  },
+  "3": {
+    "Aspect": "Void",
+    "AspectArgs": {},
+    "Name": "dirt",
+    "BlastResistance": 2.5,
+    "Destructable": true
+  },
+  "49": {
+    "Aspect": "Void",
+    "AspectArgs": {},
+    "Name": "obsidian",
+    "BlastResistance": 6000,
+    "Destructable": true
+  }
+}`
+
+// damageRecordingPlayerClient records the damage applied to it.
+type damageRecordingPlayerClient struct {
+	recordingPlayerClient
+	damage Health
+}
+
+func (p *damageRecordingPlayerClient) ApplyDamage(amount Health, cause string) {
+	p.damage += amount
+}
+
+func newExplosionTestShard() (shard *ChunkShard, chunk *Chunk) {
+	shardLoc := ShardXz{0, 0}
+	shard = &ChunkShard{
+		loc:            shardLoc,
+		originChunkLoc: shardLoc.ToChunkXz(),
+		chunkStore:     &countingChunkStore{},
+	}
+	chunkLoc := ChunkXz{0, 0}
+	index, _, _, _ := shard.chunkIndexAndRelLoc(chunkLoc)
+	chunk = newTestChunk(chunkLoc)
+	chunk.rand = rand.New(rand.NewSource(1))
+	chunk.subscribers = make(map[EntityId]gamerules.IPlayerClient)
+	chunk.playersData = make(map[EntityId]*playerData)
+	shard.chunks[index] = chunk
+	return
+}
+
+func TestChunkShard_explode_DestroysBlocks(t *testing.T) {
+	defer func(blocks gamerules.BlockTypeList) { gamerules.Blocks = blocks }(gamerules.Blocks)
+	blocks, err := gamerules.LoadBlockDefs(strings.NewReader(explosionTestBlocks))
+	if err != nil {
+		t.Fatalf("failed to load block types: %v", err)
+	}
+	gamerules.Blocks = blocks
+
+	shard, _ := newExplosionTestShard()
+
+	blockId := func(loc BlockXyz) BlockId {
+		chunk, index, ok := shard.loadedChunkForBlock(&loc)
+		if !ok {
+			t.Fatalf("block %v not loaded", loc)
+		}
+		return chunk.blockId(index)
+	}
+	setBlock := func(loc BlockXyz, blockId BlockId) {
+		chunk, index, _ := shard.loadedChunkForBlock(&loc)
+		index.SetBlockId(chunk.blocks, blockId)
+	}
+
+	// Fill the chunk with dirt between y=56 and y=71, with a pillar of obsidian
+	// next to the center of the explosion.
+	for x := BlockCoord(0); x < ChunkSizeH; x++ {
+		for y := BlockYCoord(56); y < 72; y++ {
+			for z := BlockCoord(0); z < ChunkSizeH; z++ {
+				setBlock(BlockXyz{x, y, z}, 3)
+			}
+		}
+	}
+	for y := BlockYCoord(62); y < 66; y++ {
+		setBlock(BlockXyz{9, y, 8}, 49)
+	}
+
+	shard.explode(&AbsXyz{8.5, 64.5, 8.5}, 4)
+
+	type Test struct {
+		desc     string
+		loc      BlockXyz
+		expected BlockId
+	}
+
+	tests := []Test{
+		{"center", BlockXyz{8, 64, 8}, 0},
+		{"next to the center", BlockXyz{7, 64, 8}, 0},
+		{"two blocks from the center", BlockXyz{8, 66, 8}, 0},
+		{"outside the radius", BlockXyz{0, 64, 0}, 3},
+		{"far below", BlockXyz{8, 56, 8}, 3},
+		{"obsidian", BlockXyz{9, 64, 8}, 49},
+	}
+
+	for _, test := range tests {
+		if result := blockId(test.loc); result != test.expected {
+			t.Errorf("%s: expected block %d at %v but got %d", test.desc, test.expected, test.loc, result)
+		}
+	}
+}
+
+func TestChunkShard_explode_DamagesPlayers(t *testing.T) {
+	defer func(blocks gamerules.BlockTypeList) { gamerules.Blocks = blocks }(gamerules.Blocks)
+	blocks, err := gamerules.LoadBlockDefs(strings.NewReader(explosionTestBlocks))
+	if err != nil {
+		t.Fatalf("failed to load block types: %v", err)
+	}
+	gamerules.Blocks = blocks
+
+	shard, chunk := newExplosionTestShard()
+
+	positions := []AbsXyz{
+		{8.5, 64, 8.5},
+		{8.5, 64, 11.5},
+		{8.5, 64, 14.5},
+	}
+	players := make([]*damageRecordingPlayerClient, len(positions))
+	for i := range positions {
+		entityId := EntityId(i + 1)
+		players[i] = &damageRecordingPlayerClient{}
+		players[i].entityId = entityId
+		chunk.subscribers[entityId] = players[i]
+		chunk.playersData[entityId] = &playerData{entityId: entityId, position: positions[i]}
+	}
+
+	shard.explode(&AbsXyz{8.5, 64, 8.5}, 4)
+
+	for i := 1; i < len(players); i++ {
+		if players[i].damage >= players[i-1].damage {
+			t.Errorf(
+				"expected less damage at %v than at %v, but got %d and %d",
+				positions[i], positions[i-1], players[i].damage, players[i-1].damage)
+		}
+	}
+
+	if len(players[0].packets) != 1 {
+		t.Errorf("expected 1 explosion packet but got %d", len(players[0].packets))
+	}
+}
+
+func Test_explosionDamageAt(t *testing.T) {
+	center := AbsXyz{0, 64, 0}
+	radius := float64(8)
+
+	last := explosionDamageAt(&center, &center, radius)
+	for distance := AbsCoord(1); distance < 8; distance++ {
+		damage := explosionDamageAt(&center, &AbsXyz{distance, 64, 0}, radius)
+		if damage >= last {
+			t.Errorf("expected damage at distance %v to be less than %d but got %d", distance, last, damage)
+		}
+		last = damage
+	}
+
+	if damage := explosionDamageAt(&center, &AbsXyz{8, 64, 0}, radius); damage != 0 {
+		t.Errorf("expected no damage at the edge of the radius but got %d", damage)
+	}
+}
@@ -0,0 +1,57 @@
+package shardserver
+
+import (
+	. "chunkymonkey/types"
+)
+
+// floodFill finds the blocks connected to start whose type matches, in
+// breadth-first order, crossing between the loaded chunks of the shard. It
+// stops after visiting limit blocks, and returns the blocks visited. Blocks
+// in chunks that are not loaded are treated as not matching, so the search
+// never causes chunks to load.
+//
+// The search does not cross into other shards, as their chunks belong to
+// another goroutine. Blocks past the edge of the shard are treated as not
+// matching too, so callers that need whole structures should keep them well
+// within a shard, or treat a search that reaches the edge as incomplete.
+func (shard *ChunkShard) floodFill(start BlockXyz, match func(BlockId) bool, limit int) (visited []BlockXyz) {
+	seen := make(map[*Chunk]map[BlockIndex]bool)
+
+	// markSeen returns true if the block matches and has not been seen before.
+	markSeen := func(loc *BlockXyz) bool {
+		chunk, index, ok := shard.loadedChunkForBlock(loc)
+		if !ok || !match(chunk.blockId(index)) {
+			return false
+		}
+
+		chunkSeen, ok := seen[chunk]
+		if !ok {
+			chunkSeen = make(map[BlockIndex]bool)
+			seen[chunk] = chunkSeen
+		}
+		if chunkSeen[index] {
+			return false
+		}
+		chunkSeen[index] = true
+		return true
+	}
+
+	if limit <= 0 || !markSeen(&start) {
+		return
+	}
+
+	queue := []BlockXyz{start}
+	for len(queue) > 0 && len(visited) < limit {
+		loc := queue[0]
+		queue = queue[1:]
+		visited = append(visited, loc)
+
+		for face := Face(FaceMinValid); face <= FaceMaxValid; face++ {
+			if neighbourLoc := loc.AddXyz(face.Dxyz()); neighbourLoc != nil && markSeen(neighbourLoc) {
+				queue = append(queue, *neighbourLoc)
+			}
+		}
+	}
+
+	return
+}
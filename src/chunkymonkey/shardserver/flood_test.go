@@ -0,0 +1,125 @@
+package shardserver
+
+import (
+	"testing"
+
+	. "chunkymonkey/types"
+)
+
+const floodTestWater = BlockId(9)
+
+// newFloodTestShard creates a shard with two neighbouring chunks of air
+// loaded.
+func newFloodTestShard() *ChunkShard {
+	shardLoc := ShardXz{0, 0}
+	shard := &ChunkShard{
+		loc:            shardLoc,
+		originChunkLoc: shardLoc.ToChunkXz(),
+	}
+	for _, loc := range []ChunkXz{{0, 0}, {1, 0}} {
+		index, _, _, _ := shard.chunkIndexAndRelLoc(loc)
+		shard.chunks[index] = newTestChunk(loc)
+	}
+	return shard
+}
+
+func setFloodTestBlock(t *testing.T, shard *ChunkShard, loc BlockXyz, blockId BlockId) {
+	chunk, index, ok := shard.loadedChunkForBlock(&loc)
+	if !ok {
+		t.Fatalf("block %v not loaded", loc)
+	}
+	chunk.blocks[index] = byte(blockId)
+}
+
+func isFloodTestWater(blockId BlockId) bool {
+	return blockId == floodTestWater
+}
+
+func TestChunkShard_floodFill_AcrossChunks(t *testing.T) {
+	shard := newFloodTestShard()
+
+	// A pool of water 4 blocks long and 2 wide, half in each chunk, with a
+	// separate puddle nearby.
+	for x := BlockCoord(14); x < 18; x++ {
+		for z := BlockCoord(8); z < 10; z++ {
+			setFloodTestBlock(t, shard, BlockXyz{x, 64, z}, floodTestWater)
+		}
+	}
+	setFloodTestBlock(t, shard, BlockXyz{20, 64, 8}, floodTestWater)
+
+	visited := shard.floodFill(BlockXyz{14, 64, 8}, isFloodTestWater, 100)
+
+	if len(visited) != 8 {
+		t.Fatalf("expected 8 blocks of water in the pool, got %d: %v", len(visited), visited)
+	}
+	if visited[0].X != 14 || visited[0].Z != 8 {
+		t.Errorf("expected the search to start at the start block, got %v", visited[0])
+	}
+	crossed := false
+	for _, loc := range visited {
+		if loc.Y != 64 || loc.X < 14 || loc.X >= 18 || loc.Z < 8 || loc.Z >= 10 {
+			t.Errorf("unexpected block %v visited", loc)
+		}
+		if loc.X >= 16 {
+			crossed = true
+		}
+	}
+	if !crossed {
+		t.Errorf("expected the search to cross into the neighbouring chunk")
+	}
+
+	if visited := shard.floodFill(BlockXyz{13, 64, 8}, isFloodTestWater, 100); len(visited) != 0 {
+		t.Errorf("expected nothing visited when starting outside the water, got %v", visited)
+	}
+}
+
+func TestChunkShard_floodFill_Limit(t *testing.T) {
+	shard := newFloodTestShard()
+
+	// A large lake covering both chunks.
+	for x := BlockCoord(0); x < 32; x++ {
+		for z := BlockCoord(0); z < 16; z++ {
+			setFloodTestBlock(t, shard, BlockXyz{x, 64, z}, floodTestWater)
+		}
+	}
+
+	visited := shard.floodFill(BlockXyz{8, 64, 8}, isFloodTestWater, 50)
+
+	if len(visited) != 50 {
+		t.Fatalf("expected the search to stop at 50 blocks, got %d", len(visited))
+	}
+	// Breadth-first search visits the blocks nearest the start first.
+	for _, loc := range visited {
+		dx, dz := loc.X-8, loc.Z-8
+		if dx < 0 {
+			dx = -dx
+		}
+		if dz < 0 {
+			dz = -dz
+		}
+		if dx+dz > 5 {
+			t.Errorf("expected only blocks near the start to be visited, got %v", loc)
+		}
+	}
+}
+
+func TestChunkShard_floodFill_StopsAtShardEdge(t *testing.T) {
+	shard := newFloodTestShard()
+
+	// A strip of water running west to the edge of the shard at X=0. The
+	// water carries on in the shard to the west, which this shard can't see.
+	for x := BlockCoord(0); x < 4; x++ {
+		setFloodTestBlock(t, shard, BlockXyz{x, 64, 8}, floodTestWater)
+	}
+
+	visited := shard.floodFill(BlockXyz{3, 64, 8}, isFloodTestWater, 100)
+
+	if len(visited) != 4 {
+		t.Fatalf("expected the 4 blocks of water in the shard, got %d: %v", len(visited), visited)
+	}
+	for _, loc := range visited {
+		if loc.X < 0 {
+			t.Errorf("expected the search to stop at the shard edge, got %v", loc)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package shardserver
+
+import (
+	"chunkymonkey/gamerules"
+	. "chunkymonkey/types"
+)
+
+// scheduleFluidTicks schedules flow updates for the fluid blocks at and
+// around a block that has changed, so that fluids flow into the space left by
+// a removed block, and flowing blocks update as their neighbours change.
+// Neighbouring blocks are only updated if their chunk is loaded.
+func (shard *ChunkShard) scheduleFluidTicks(blockLoc *BlockXyz) {
+	shard.scheduleFluidTick(blockLoc)
+
+	for face := Face(FaceMinValid); face <= FaceMaxValid; face++ {
+		if neighbourLoc := blockLoc.AddXyz(face.Dxyz()); neighbourLoc != nil {
+			shard.scheduleFluidTick(neighbourLoc)
+		}
+	}
+}
+
+func (shard *ChunkShard) scheduleFluidTick(blockLoc *BlockXyz) {
+	chunk, index, ok := shard.loadedChunkForBlock(blockLoc)
+	if !ok {
+		return
+	}
+
+	blockType, ok := gamerules.Blocks.Get(chunk.blockId(index))
+	if !ok {
+		return
+	}
+
+	if fluid, ok := blockType.Aspect.(*gamerules.FluidAspect); ok {
+		chunk.ScheduleBlockTick(index, fluid.TickDelay)
+	}
+}
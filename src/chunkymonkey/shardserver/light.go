@@ -0,0 +1,295 @@
+package shardserver
+
+import (
+	"chunkymonkey/gamerules"
+	. "chunkymonkey/types"
+)
+
+const (
+	maxLightLevel = 15
+
+	// maxLightUpdates bounds the number of blocks that are visited by each
+	// phase of relighting after a block change, so that opening up a large
+	// cavern to the sky cannot stall the shard.
+	maxLightUpdates = 16384
+)
+
+// blockLightAttrs returns the opacity and brightness of the given block type.
+// Unknown block types are treated as opaque.
+func blockLightAttrs(blockId BlockId) (opacity, brightness int8) {
+	blockType, ok := gamerules.Blocks.Get(blockId)
+	if !ok {
+		return maxLightLevel, 0
+	}
+	return blockType.Opacity, blockType.Brightness
+}
+
+// loadedChunkForBlock returns the chunk containing the given block and the
+// block's index within it. Unlike chunkForBlock, it does not load chunks. ok
+// is false if the block is outside of the world or the shard, or its chunk is
+// not loaded.
+func (shard *ChunkShard) loadedChunkForBlock(blockLoc *BlockXyz) (chunk *Chunk, index BlockIndex, ok bool) {
+	chunkLoc, subLoc := blockLoc.ToChunkLocal()
+
+	if index, ok = subLoc.BlockIndex(); !ok {
+		return
+	}
+
+	chunkIndex, _, _, ok := shard.chunkIndexAndRelLoc(*chunkLoc)
+	if !ok {
+		return
+	}
+
+	chunk = shard.chunks[chunkIndex]
+	ok = chunk != nil
+
+	return
+}
+
+// relightBlock recalculates the block light and sky light around a block
+// that has changed. Light spreads into neighbouring chunks within the shard
+// that are loaded.
+func (shard *ChunkShard) relightBlock(blockLoc *BlockXyz) {
+	chunk, index, ok := shard.loadedChunkForBlock(blockLoc)
+	if !ok {
+		return
+	}
+
+	_, brightness := blockLightAttrs(chunk.blockId(index))
+	blockLight := lightUpdater{shard: shard, sky: false}
+	blockLight.relight([]lightNode{{*blockLoc, brightness}})
+
+	skyLight := lightUpdater{shard: shard, sky: true}
+	skyLight.relight(chunk.skyLightColumn(blockLoc))
+}
+
+// skyLightColumn recalculates the height map for the column of blocks
+// containing blockLoc, and returns the sky light level that each block in the
+// column receives directly from above.
+func (chunk *Chunk) skyLightColumn(blockLoc *BlockXyz) (nodes []lightNode) {
+	nodes = make([]lightNode, 0, ChunkSizeY)
+
+	_, subLoc := blockLoc.ToChunkLocal()
+	subLoc.Y = 0
+	baseIndex, _ := subLoc.BlockIndex()
+
+	level := int8(maxLightLevel)
+	height := 0
+	for y := ChunkSizeY - 1; y >= 0; y-- {
+		opacity, _ := blockLightAttrs(chunk.blockId(baseIndex + BlockIndex(y)))
+		if opacity > 0 && height == 0 {
+			height = y + 1
+		}
+
+		level -= opacity
+		if level < 0 {
+			level = 0
+		}
+
+		loc := *blockLoc
+		loc.Y = BlockYCoord(y)
+		nodes = append(nodes, lightNode{loc, level})
+	}
+
+	if len(chunk.heightMap) == ChunkSizeH*ChunkSizeH {
+		chunk.heightMap[int(subLoc.X)*ChunkSizeH+int(subLoc.Z)] = byte(height)
+	}
+
+	return
+}
+
+// isUnderSky returns true if the block has an unobstructed view of the sky.
+func (chunk *Chunk) isUnderSky(subLoc *SubChunkXyz) bool {
+	if len(chunk.heightMap) != ChunkSizeH*ChunkSizeH {
+		return false
+	}
+	return int(subLoc.Y) >= int(chunk.heightMap[int(subLoc.X)*ChunkSizeH+int(subLoc.Z)])
+}
+
+// lightNode is a block and its light level.
+type lightNode struct {
+	loc   BlockXyz
+	level int8
+}
+
+// lightUpdater recalculates one kind of light (block light or sky light)
+// within the loaded chunks of a shard. Light is first removed from blocks
+// that may have been lit by the changed blocks, and then spread again from
+// the light sources and from the lit blocks around the darkened area. Each
+// phase has its own budget of updates, so that darkening a large area cannot
+// leave it without the budget to be lit again.
+type lightUpdater struct {
+	shard         *ChunkShard
+	sky           bool
+	darken        []lightNode
+	spread        []BlockXyz
+	darkenUpdates int
+	spreadUpdates int
+}
+
+// relight sets the given blocks to be lit at the given source light levels,
+// and updates the light around them.
+func (u *lightUpdater) relight(sources []lightNode) {
+	for _, source := range sources {
+		if level, ok := u.level(&source.loc); ok && level != source.level {
+			u.setLevel(&source.loc, 0)
+			u.darken = append(u.darken, lightNode{source.loc, level})
+		}
+	}
+	u.darkenAll()
+
+	for _, source := range sources {
+		if level, ok := u.level(&source.loc); ok && source.level > level {
+			u.setLevel(&source.loc, source.level)
+		}
+		u.spread = append(u.spread, source.loc)
+
+		// The changed blocks may now let in light from their neighbours.
+		for face := Face(FaceMinValid); face <= FaceMaxValid; face++ {
+			if neighbourLoc := source.loc.AddXyz(face.Dxyz()); neighbourLoc != nil {
+				u.spread = append(u.spread, *neighbourLoc)
+			}
+		}
+	}
+	u.spreadAll()
+}
+
+// darkenAll removes light from the blocks that may have been lit by the
+// blocks in the darken queue.
+func (u *lightUpdater) darkenAll() {
+	for len(u.darken) > 0 && u.darkenUpdates < maxLightUpdates {
+		node := u.darken[0]
+		u.darken = u.darken[1:]
+		u.darkenUpdates++
+
+		for face := Face(FaceMinValid); face <= FaceMaxValid; face++ {
+			neighbourLoc := node.loc.AddXyz(face.Dxyz())
+			if neighbourLoc == nil {
+				continue
+			}
+			level, ok := u.level(neighbourLoc)
+			if !ok || level == 0 {
+				continue
+			}
+
+			if level < node.level {
+				u.setLevel(neighbourLoc, 0)
+				u.darken = append(u.darken, lightNode{*neighbourLoc, level})
+				if source := u.sourceLevel(neighbourLoc); source > 0 {
+					u.setLevel(neighbourLoc, source)
+					u.spread = append(u.spread, *neighbourLoc)
+				}
+			} else {
+				// Lit from elsewhere, so it can relight the darkened blocks.
+				u.spread = append(u.spread, *neighbourLoc)
+			}
+		}
+	}
+
+	if len(u.darken) > 0 {
+		u.shard.log().Warn("%v: light update limit reached while darkening", u.shard)
+
+		// The blocks left in the queue have already been darkened. Spread light
+		// back into them from their neighbours, rather than leave them dark.
+		for _, node := range u.darken {
+			for face := Face(FaceMinValid); face <= FaceMaxValid; face++ {
+				if neighbourLoc := node.loc.AddXyz(face.Dxyz()); neighbourLoc != nil {
+					u.spread = append(u.spread, *neighbourLoc)
+				}
+			}
+		}
+		u.darken = nil
+	}
+}
+
+// spreadAll spreads light outwards from the blocks in the spread queue.
+func (u *lightUpdater) spreadAll() {
+	for len(u.spread) > 0 && u.spreadUpdates < maxLightUpdates {
+		loc := u.spread[0]
+		u.spread = u.spread[1:]
+		u.spreadUpdates++
+
+		level, ok := u.level(&loc)
+		if !ok || level <= 1 {
+			continue
+		}
+
+		for face := Face(FaceMinValid); face <= FaceMaxValid; face++ {
+			neighbourLoc := loc.AddXyz(face.Dxyz())
+			if neighbourLoc == nil {
+				continue
+			}
+			chunk, index, ok := u.shard.loadedChunkForBlock(neighbourLoc)
+			if !ok {
+				continue
+			}
+
+			opacity, _ := blockLightAttrs(chunk.blockId(index))
+			newLevel := level - 1 - opacity
+			if u.sky && face == FaceBottom && level == maxLightLevel && opacity == 0 {
+				// Full sky light travels straight down without dimming.
+				newLevel = maxLightLevel
+			}
+
+			if newLevel > int8(index.BlockData(u.lightData(chunk))) {
+				u.setLevel(neighbourLoc, newLevel)
+				u.spread = append(u.spread, *neighbourLoc)
+			}
+		}
+	}
+
+	if len(u.spread) > 0 {
+		u.shard.log().Warn("%v: light update limit reached while spreading", u.shard)
+		u.spread = nil
+	}
+}
+
+// sourceLevel returns the light emitted by, or falling directly on, the
+// block.
+func (u *lightUpdater) sourceLevel(loc *BlockXyz) int8 {
+	chunk, index, ok := u.shard.loadedChunkForBlock(loc)
+	if !ok {
+		return 0
+	}
+
+	if u.sky {
+		subLoc := index.ToSubChunkXyz()
+		if chunk.isUnderSky(&subLoc) {
+			return maxLightLevel
+		}
+		return 0
+	}
+
+	_, brightness := blockLightAttrs(chunk.blockId(index))
+	return brightness
+}
+
+func (u *lightUpdater) lightData(chunk *Chunk) []byte {
+	if u.sky {
+		return chunk.skyLight
+	}
+	return chunk.blockLight
+}
+
+func (u *lightUpdater) level(loc *BlockXyz) (level int8, ok bool) {
+	chunk, index, ok := u.shard.loadedChunkForBlock(loc)
+	if !ok {
+		return
+	}
+	return int8(index.BlockData(u.lightData(chunk))), true
+}
+
+func (u *lightUpdater) setLevel(loc *BlockXyz, level int8) {
+	chunk, index, ok := u.shard.loadedChunkForBlock(loc)
+	if !ok {
+		return
+	}
+
+	if level < 0 {
+		level = 0
+	}
+	index.SetBlockData(u.lightData(chunk), byte(level))
+
+	chunk.cachedPacket = nil
+	chunk.markSectionDirty(index.ToSubChunkXyz().Y)
+}
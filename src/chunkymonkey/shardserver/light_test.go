@@ -0,0 +1,143 @@
+package shardserver
+
+import (
+	"strings"
+	"testing"
+
+	"chunkymonkey/gamerules"
+	. "chunkymonkey/types"
+)
+
+const lightTestBlocks = `{
+  "0": {
+    "Aspect": "Void",
+    "AspectArgs": {},
+    "Name": "air",
+    "Opacity": 0
+  },
+  "1": {
+    "Aspect": "Void",
+    "AspectArgs": {},
+    "Name": "stone",
+    "Opacity": 15
+  },
+  "50": {
+    "Aspect": "Void",
+    "AspectArgs": {},
+    "Name": "torch",
+    "Opacity": 0,
+    "Brightness": 14
+  }
+}`
+
+func TestChunkShard_relightBlock(t *testing.T) {
+	defer func(blocks gamerules.BlockTypeList) { gamerules.Blocks = blocks }(gamerules.Blocks)
+	blocks, err := gamerules.LoadBlockDefs(strings.NewReader(lightTestBlocks))
+	if err != nil {
+		t.Fatalf("failed to load block types: %v", err)
+	}
+	gamerules.Blocks = blocks
+
+	shardLoc := ShardXz{0, 0}
+	shard := &ChunkShard{
+		loc:            shardLoc,
+		originChunkLoc: shardLoc.ToChunkXz(),
+		chunkStore:     &countingChunkStore{},
+	}
+	// Two neighbouring chunks of air, lit by the sky.
+	for _, loc := range []ChunkXz{{0, 0}, {1, 0}} {
+		index, _, _, _ := shard.chunkIndexAndRelLoc(loc)
+		chunk := newTestChunk(loc)
+		for i := range chunk.skyLight {
+			chunk.skyLight[i] = 0xff
+		}
+		shard.chunks[index] = chunk
+	}
+
+	blockLightAt := func(loc BlockXyz) int8 {
+		chunk, index, ok := shard.loadedChunkForBlock(&loc)
+		if !ok {
+			t.Fatalf("block %v not loaded", loc)
+		}
+		return int8(index.BlockData(chunk.blockLight))
+	}
+
+	type Test struct {
+		loc      BlockXyz
+		expected int8
+	}
+
+	torchLoc := BlockXyz{12, 64, 8}
+	shard.setBlockAt(&torchLoc, 50, 0)
+
+	tests := []Test{
+		{BlockXyz{12, 64, 8}, 14},
+		{BlockXyz{12, 65, 8}, 13},
+		{BlockXyz{11, 64, 8}, 13},
+		{BlockXyz{10, 64, 8}, 12},
+		{BlockXyz{10, 62, 8}, 10},
+		// Light spreads into the neighbouring chunk.
+		{BlockXyz{16, 64, 8}, 10},
+		{BlockXyz{20, 64, 8}, 6},
+		{BlockXyz{12, 64, 0}, 6},
+		{BlockXyz{0, 64, 8}, 2},
+		{BlockXyz{0, 64, 0}, 0},
+	}
+	for _, test := range tests {
+		if level := blockLightAt(test.loc); level != test.expected {
+			t.Errorf("with torch: expected light %d at %v but got %d", test.expected, test.loc, level)
+		}
+	}
+
+	// A wall of stone blocks the light.
+	wallLoc := BlockXyz{11, 64, 8}
+	shard.setBlockAt(&wallLoc, 1, 0)
+	if level := blockLightAt(wallLoc); level != 0 {
+		t.Errorf("expected no light inside stone but got %d", level)
+	}
+	if level := blockLightAt(BlockXyz{10, 64, 8}); level != 10 {
+		t.Errorf("expected light 10 behind stone but got %d", level)
+	}
+
+	// Removing the torch darkens its surroundings again.
+	shard.setBlockAt(&torchLoc, 0, 0)
+	for _, test := range tests {
+		if level := blockLightAt(test.loc); level != 0 {
+			t.Errorf("without torch: expected no light at %v but got %d", test.loc, level)
+		}
+	}
+
+	// The stone casts a shadow from the sky below it.
+	chunk, index, _ := shard.loadedChunkForBlock(&BlockXyz{11, 63, 8})
+	if level := index.BlockData(chunk.skyLight); level >= maxLightLevel {
+		t.Errorf("expected block below stone to be in shadow, but got sky light %d", level)
+	}
+}
+
+func TestLightUpdater_SpreadsAfterDarkenLimit(t *testing.T) {
+	defer func(blocks gamerules.BlockTypeList) { gamerules.Blocks = blocks }(gamerules.Blocks)
+	blocks, err := gamerules.LoadBlockDefs(strings.NewReader(lightTestBlocks))
+	if err != nil {
+		t.Fatalf("failed to load block types: %v", err)
+	}
+	gamerules.Blocks = blocks
+
+	shardLoc := ShardXz{0, 0}
+	shard := &ChunkShard{
+		loc:            shardLoc,
+		originChunkLoc: shardLoc.ToChunkXz(),
+		chunkStore:     &countingChunkStore{},
+	}
+	index, _, _, _ := shard.chunkIndexAndRelLoc(ChunkXz{0, 0})
+	shard.chunks[index] = newTestChunk(ChunkXz{0, 0})
+
+	// Darkening has used up its budget, but light still spreads.
+	torchLoc := BlockXyz{8, 64, 8}
+	u := lightUpdater{shard: shard, sky: false, darkenUpdates: maxLightUpdates}
+	u.relight([]lightNode{{torchLoc, 14}})
+
+	neighbourLoc := BlockXyz{9, 64, 8}
+	if level, _ := u.level(&neighbourLoc); level != 13 {
+		t.Errorf("expected light 13 next to torch but got %d", level)
+	}
+}
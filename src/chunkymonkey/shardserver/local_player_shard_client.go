@@ -10,6 +10,13 @@ type localPlayerShardClient struct {
 	entityId EntityId
 	player   gamerules.IPlayerClient
 	shard    *ChunkShard
+
+	// The end of the last move checked, and the latest position that the
+	// player reached without passing through solid blocks. Only used from the
+	// shard's goroutine.
+	moveChecked   bool
+	lastMoveTo    AbsXyz
+	clearPosition AbsXyz
 }
 
 func newLocalPlayerShardClient(entityId EntityId, player gamerules.IPlayerClient, shard *ChunkShard) *localPlayerShardClient {
@@ -34,6 +41,14 @@ func (conn *localPlayerShardClient) ReqSubscribeChunk(chunkLoc ChunkXz, notify b
 	})
 }
 
+func (conn *localPlayerShardClient) ReqPrefetchChunks(chunkLocs []ChunkXz) {
+	conn.shard.enqueue(func() {
+		for _, chunkLoc := range chunkLocs {
+			conn.shard.prefetchChunk(chunkLoc)
+		}
+	})
+}
+
 func (conn *localPlayerShardClient) ReqUnsubscribeChunk(chunkLoc ChunkXz) {
 	conn.shard.enqueueOnChunk(chunkLoc, func(chunk *Chunk) {
 		chunk.reqUnsubscribeChunk(conn.entityId, true)
@@ -70,6 +85,39 @@ func (conn *localPlayerShardClient) ReqSetPlayerLook(chunkLoc ChunkXz, look Look
 	})
 }
 
+func (conn *localPlayerShardClient) ReqCheckPlayerMove(from, to AbsXyz) {
+	conn.shard.enqueue(func() {
+		conn.checkMove(&from, &to)
+	})
+}
+
+// checkMove checks a move by the player, and puts them back to the latest
+// position that they reached without passing through solid blocks if it is
+// not clear. The player may have moved further by the time that the check is
+// made, so later moves are checked from that position too, until the player
+// is back there.
+func (conn *localPlayerShardClient) checkMove(from, to *AbsXyz) {
+	if !conn.moveChecked || *from != conn.lastMoveTo {
+		// The first move checked in this shard, or the player has been moved
+		// since the last move, e.g. by a teleport or a rejected move.
+		conn.clearPosition = *from
+		conn.moveChecked = true
+	}
+	conn.lastMoveTo = *to
+
+	if conn.shard.isPlayerPathClear(&conn.clearPosition, to) {
+		conn.clearPosition = *to
+	} else {
+		conn.player.RejectMove(conn.clearPosition)
+	}
+}
+
+func (conn *localPlayerShardClient) ReqSetPlayerHeldItem(chunkLoc ChunkXz, held gamerules.Slot) {
+	conn.shard.enqueueOnChunk(chunkLoc, func(chunk *Chunk) {
+		chunk.reqSetPlayerHeldItem(conn.entityId, &held)
+	})
+}
+
 func (conn *localPlayerShardClient) ReqHitBlock(held gamerules.Slot, target BlockXyz, digStatus DigStatus, face Face) {
 	chunkLoc := target.ToChunkXz()
 
@@ -86,11 +134,11 @@ func (conn *localPlayerShardClient) ReqInteractBlock(held gamerules.Slot, target
 	})
 }
 
-func (conn *localPlayerShardClient) ReqPlaceItem(target BlockXyz, slot gamerules.Slot) {
+func (conn *localPlayerShardClient) ReqPlaceItem(target BlockXyz, slot gamerules.Slot, look LookDegrees) {
 	chunkLoc, _ := target.ToChunkLocal()
 
 	conn.shard.enqueueOnChunk(*chunkLoc, func(chunk *Chunk) {
-		chunk.reqPlaceItem(conn.player, &target, &slot)
+		chunk.reqPlaceItem(conn.player, &target, &slot, &look)
 	})
 }
 
@@ -120,3 +168,17 @@ func (conn *localPlayerShardClient) ReqInventoryUnsubscribed(block BlockXyz) {
 		chunk.reqInventoryUnsubscribed(conn.player, &block)
 	})
 }
+
+func (conn *localPlayerShardClient) ReqUseEntity(chunkLoc ChunkXz, entityId EntityId, leftClick bool) {
+	conn.shard.enqueue(func() {
+		conn.shard.useEntity(conn.player, chunkLoc, entityId, leftClick)
+	})
+}
+
+func (conn *localPlayerShardClient) ReqSetSignText(target BlockXyz, lines [4]string) {
+	chunkLoc := target.ToChunkXz()
+
+	conn.shard.enqueueOnChunk(*chunkLoc, func(chunk *Chunk) {
+		chunk.reqSetSignText(conn.player, &target, lines)
+	})
+}
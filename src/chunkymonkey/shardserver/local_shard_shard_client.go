@@ -33,3 +33,9 @@ func (client *localShardShardClient) ReqTransferEntity(loc ChunkXz, entity gamer
 		}
 	})
 }
+
+func (client *localShardShardClient) ReqExplode(center AbsXyz, power float32) {
+	client.serverShard.enqueue(func() {
+		client.serverShard.explode(&center, power)
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"chunkymonkey/chunkstore"
 	"chunkymonkey/entity"
 	"chunkymonkey/gamerules"
+	"chunkymonkey/logging"
 	. "chunkymonkey/types"
 )
 
@@ -16,14 +17,16 @@ type LocalShardManager struct {
 	entityMgr  *entity.EntityManager
 	chunkStore chunkstore.IChunkStore
 	shards     map[uint64]*ChunkShard
+	logger     logging.Logger
 	lock       sync.Mutex
 }
 
-func NewLocalShardManager(chunkStore chunkstore.IChunkStore, entityMgr *entity.EntityManager) *LocalShardManager {
+func NewLocalShardManager(chunkStore chunkstore.IChunkStore, entityMgr *entity.EntityManager, logger logging.Logger) *LocalShardManager {
 	return &LocalShardManager{
 		entityMgr:  entityMgr,
 		chunkStore: chunkStore,
 		shards:     make(map[uint64]*ChunkShard),
+		logger:     logger,
 	}
 }
 
@@ -39,7 +42,7 @@ func (mgr *LocalShardManager) getShard(loc ShardXz, create bool) *ChunkShard {
 	}
 
 	// Create shard.
-	shard := NewChunkShard(mgr, mgr.chunkStore, mgr.entityMgr, loc)
+	shard := NewChunkShard(mgr, mgr.chunkStore, mgr.entityMgr, loc, mgr.logger)
 	mgr.shards[shardKey] = shard
 	go shard.serve()
 
@@ -67,6 +70,29 @@ func (mgr *LocalShardManager) ShardShardConnect(shardLoc ShardXz) gamerules.ISha
 	return newLocalShardShardClient(shard)
 }
 
+// SaveAll writes all loaded chunks with unsaved changes to the chunk store. It
+// blocks until all shards have done so.
+func (mgr *LocalShardManager) SaveAll() {
+	done := make(chan bool)
+
+	mgr.lock.Lock()
+	numShards := len(mgr.shards)
+	for _, shard := range mgr.shards {
+		s := shard
+		s.enqueue(func() {
+			s.saveAllChunks()
+			done <- true
+		})
+	}
+	// Don't hold the lock while waiting, shards may need it to connect to each
+	// other.
+	mgr.lock.Unlock()
+
+	for i := 0; i < numShards; i++ {
+		<-done
+	}
+}
+
 // TODO remove Enqueue* methods
 
 // EnqueueAllChunks runs a given function on all loaded chunks.
@@ -88,3 +114,28 @@ func (mgr *LocalShardManager) EnqueueOnChunk(loc ChunkXz, fn func(chunk *Chunk))
 	shard := mgr.getShard(loc.ToShardXz(), true)
 	shard.enqueueOnChunk(loc, fn)
 }
+
+// Tick runs a tick on all shards. The shards are ticked by the game's tick
+// loop, so that they run at the same rate as the rest of the game.
+func (mgr *LocalShardManager) Tick() {
+	mgr.lock.Lock()
+	defer mgr.lock.Unlock()
+
+	for _, shard := range mgr.shards {
+		shard.enqueueTick()
+	}
+}
+
+// SetSkyDarkness tells all shards how much darker sky light is than at
+// midday, which changes with the time of day.
+func (mgr *LocalShardManager) SetSkyDarkness(darkness int8) {
+	mgr.lock.Lock()
+	defer mgr.lock.Unlock()
+
+	for _, shard := range mgr.shards {
+		s := shard
+		s.enqueue(func() {
+			s.skyDarkness = darkness
+		})
+	}
+}
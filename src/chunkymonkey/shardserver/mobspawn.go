@@ -0,0 +1,129 @@
+package shardserver
+
+import (
+	"chunkymonkey/gamerules"
+	. "chunkymonkey/types"
+)
+
+const (
+	// Maximum number of mobs that are spawned into a single chunk.
+	mobSpawnChunkCap = 4
+
+	// The number of mobs spawned across the shard is capped at one for every
+	// mobSpawnChunksPerMob loaded chunks, so that mobs are spread out between
+	// chunks.
+	mobSpawnChunksPerMob = 4
+
+	// Each loaded chunk has a one in mobSpawnChance chance of trying to spawn a
+	// mob each tick.
+	mobSpawnChance = 100
+
+	// Mobs only spawn in blocks with at most this light level.
+	mobSpawnMaxLight = 7
+)
+
+// hostileMobMakers creates the types of mob that spawn in the dark.
+var hostileMobMakers = []func() gamerules.INonPlayerEntity{
+	gamerules.NewCreeper,
+	gamerules.NewSkeleton,
+	gamerules.NewSpider,
+	gamerules.NewZombie,
+}
+
+// spawnMobs occasionally spawns hostile mobs in dark places within the loaded
+// chunks, while the number of mobs in each chunk and in the shard as a whole
+// is below the caps.
+func (shard *ChunkShard) spawnMobs() {
+	loaded := 0
+	total := 0
+	for _, chunk := range shard.chunks {
+		if chunk != nil {
+			loaded++
+			total += len(chunk.mobs())
+		}
+	}
+
+	shardCap := (loaded + mobSpawnChunksPerMob - 1) / mobSpawnChunksPerMob
+	for _, chunk := range shard.chunks {
+		if total >= shardCap {
+			return
+		}
+		if chunk == nil || chunk.rand.Intn(mobSpawnChance) != 0 {
+			continue
+		}
+		if len(chunk.mobs()) >= mobSpawnChunkCap {
+			continue
+		}
+
+		if chunk.trySpawnMob() {
+			total++
+		}
+	}
+}
+
+// trySpawnMob attempts to spawn a mob at a random location in the chunk.
+// Returns true if a mob was spawned.
+func (chunk *Chunk) trySpawnMob() bool {
+	subLoc := SubChunkXyz{
+		X: SubChunkCoord(chunk.rand.Intn(ChunkSizeH)),
+		Y: SubChunkCoord(1 + chunk.rand.Intn(ChunkSizeY-2)),
+		Z: SubChunkCoord(chunk.rand.Intn(ChunkSizeH)),
+	}
+	if !chunk.canSpawnMobAt(&subLoc) {
+		return false
+	}
+
+	blockLoc := chunk.loc.ToBlockXyz(&subLoc)
+	entity := hostileMobMakers[chunk.rand.Intn(len(hostileMobMakers))]()
+	entity.(gamerules.IMob).GetMob().PointObject.Init(
+		&AbsXyz{AbsCoord(blockLoc.X) + 0.5, AbsCoord(blockLoc.Y), AbsCoord(blockLoc.Z) + 0.5},
+		&AbsVelocity{})
+	chunk.AddEntity(entity)
+
+	return true
+}
+
+// canSpawnMobAt returns true if a mob can spawn standing in the given block.
+// The block must be dark, have a solid block below it, and have room for the
+// mob above it.
+func (chunk *Chunk) canSpawnMobAt(subLoc *SubChunkXyz) bool {
+	below := *subLoc
+	below.Y--
+	above := *subLoc
+	above.Y++
+
+	if !chunk.isSolidAt(&below) || chunk.isSolidAt(subLoc) || chunk.isSolidAt(&above) {
+		return false
+	}
+
+	return chunk.lightLevelAt(subLoc) <= mobSpawnMaxLight
+}
+
+func (chunk *Chunk) isSolidAt(subLoc *SubChunkXyz) bool {
+	index, ok := subLoc.BlockIndex()
+	if !ok {
+		return false
+	}
+	blockType, ok := gamerules.Blocks.Get(chunk.blockId(index))
+	return ok && blockType.Solid
+}
+
+// lightLevelAt returns the light level of the block, taking into account the
+// time of day.
+func (chunk *Chunk) lightLevelAt(subLoc *SubChunkXyz) int8 {
+	index, ok := subLoc.BlockIndex()
+	if !ok {
+		return 0
+	}
+
+	level := int8(index.BlockData(chunk.blockLight))
+	skyLevel := int8(index.BlockData(chunk.skyLight))
+	if chunk.shard != nil {
+		skyLevel -= chunk.shard.skyDarkness
+	}
+	if skyLevel > level {
+		level = skyLevel
+	}
+
+	return level
+}
@@ -0,0 +1,142 @@
+package shardserver
+
+import (
+	"rand"
+	"strings"
+	"testing"
+
+	"chunkymonkey/entity"
+	"chunkymonkey/gamerules"
+	. "chunkymonkey/types"
+)
+
+// newMobSpawnTestShard creates a shard with numChunks loaded chunks. Each
+// chunk is filled by fill.
+func newMobSpawnTestShard(numChunks int, fill func(chunk *Chunk)) *ChunkShard {
+	entityMgr := new(entity.EntityManager)
+	entityMgr.Init()
+
+	shardLoc := ShardXz{0, 0}
+	shard := &ChunkShard{
+		loc:            shardLoc,
+		originChunkLoc: shardLoc.ToChunkXz(),
+		chunkStore:     &countingChunkStore{},
+		entityMgr:      entityMgr,
+	}
+
+	for i := 0; i < numChunks; i++ {
+		chunkLoc := ChunkXz{ChunkCoord(i / ShardSize), ChunkCoord(i % ShardSize)}
+		index, _, _, _ := shard.chunkIndexAndRelLoc(chunkLoc)
+		chunk := newTestChunk(chunkLoc)
+		chunk.shard = shard
+		chunk.rand = rand.New(rand.NewSource(int64(i)))
+		chunk.entities = make(map[EntityId]gamerules.INonPlayerEntity)
+		fill(chunk)
+		shard.chunks[index] = chunk
+	}
+
+	return shard
+}
+
+// fillCaves fills a chunk with layers of stone, with two blocks of dark air
+// between each layer.
+func fillCaves(chunk *Chunk) {
+	for i := range chunk.blocks {
+		index := BlockIndex(i)
+		if index.ToSubChunkXyz().Y%3 == 0 {
+			index.SetBlockId(chunk.blocks, 1)
+		}
+	}
+}
+
+// fillSurface fills a chunk with stone up to y=63, with full sky light above.
+func fillSurface(chunk *Chunk) {
+	for i := range chunk.blocks {
+		index := BlockIndex(i)
+		if index.ToSubChunkXyz().Y < 64 {
+			index.SetBlockId(chunk.blocks, 1)
+		} else {
+			index.SetBlockData(chunk.skyLight, maxLightLevel)
+		}
+	}
+}
+
+func countMobs(shard *ChunkShard) (count int) {
+	for _, chunk := range shard.chunks {
+		if chunk != nil {
+			count += len(chunk.mobs())
+		}
+	}
+	return
+}
+
+func TestChunkShard_spawnMobs_ChunkCap(t *testing.T) {
+	defer func(blocks gamerules.BlockTypeList) { gamerules.Blocks = blocks }(gamerules.Blocks)
+	blocks, err := gamerules.LoadBlockDefs(strings.NewReader(collisionTestBlocks))
+	if err != nil {
+		t.Fatalf("failed to load block types: %v", err)
+	}
+	gamerules.Blocks = blocks
+
+	// Only the first chunk has caves to spawn in, and it is already full.
+	// The other chunks allow the shard's cap to be reached.
+	const numChunks = 32
+	shard := newMobSpawnTestShard(numChunks, func(chunk *Chunk) {
+		if chunk.loc.X == 0 && chunk.loc.Z == 0 {
+			fillCaves(chunk)
+		}
+	})
+	full := shard.chunks[0]
+	for i := 0; i < mobSpawnChunkCap; i++ {
+		mob := gamerules.NewZombie()
+		mob.(gamerules.IMob).GetMob().PointObject.Init(&AbsXyz{0.5, 1, 0.5}, &AbsVelocity{})
+		full.AddEntity(mob)
+	}
+
+	for i := 0; i < 20000; i++ {
+		shard.spawnMobs()
+	}
+
+	if count := len(full.mobs()); count != mobSpawnChunkCap {
+		t.Errorf("expected %d mobs in the full chunk but got %d", mobSpawnChunkCap, count)
+	}
+
+	// Once there is room in the chunk, mobs spawn in its caves.
+	for _, mob := range full.mobs() {
+		full.removeEntity(mob)
+		break
+	}
+	for i := 0; i < 20000; i++ {
+		shard.spawnMobs()
+	}
+	if count := len(full.mobs()); count != mobSpawnChunkCap {
+		t.Errorf("expected a mob to spawn to refill the chunk, but it has %d mobs", count)
+	}
+}
+
+func TestChunkShard_spawnMobs_Daylight(t *testing.T) {
+	defer func(blocks gamerules.BlockTypeList) { gamerules.Blocks = blocks }(gamerules.Blocks)
+	blocks, err := gamerules.LoadBlockDefs(strings.NewReader(collisionTestBlocks))
+	if err != nil {
+		t.Fatalf("failed to load block types: %v", err)
+	}
+	gamerules.Blocks = blocks
+
+	shard := newMobSpawnTestShard(8, fillSurface)
+
+	for i := 0; i < 20000; i++ {
+		shard.spawnMobs()
+	}
+	if count := countMobs(shard); count != 0 {
+		t.Errorf("expected no mobs to spawn in daylight but got %d", count)
+	}
+
+	// At night, mobs spawn on the surface.
+	shard.skyDarkness = 11
+	for i := 0; i < 100000; i++ {
+		shard.spawnMobs()
+	}
+	if count := countMobs(shard); count == 0 {
+		t.Errorf("expected mobs to spawn at night")
+	}
+}
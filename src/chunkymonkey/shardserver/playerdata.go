@@ -25,6 +25,10 @@ type playerData struct {
 	look       LookBytes
 	heldItemId ItemTypeId
 	// TODO Armor data.
+
+	// The position and look last sent to subscribers of the chunk.
+	lastSentPosition AbsIntXyz
+	lastSentLook     LookBytes
 }
 
 func (player *playerData) sendSpawn(writer io.Writer) os.Error {
@@ -38,15 +42,47 @@ func (player *playerData) sendSpawn(writer io.Writer) os.Error {
 	// TODO Armor packet(s).
 }
 
-func (player *playerData) sendPositionLook(writer io.Writer) os.Error {
-	return proto.WriteEntityTeleport(
-		writer,
-		player.entityId,
-		player.position.ToAbsIntXyz(),
-		&player.look)
+// sendPositionLook writes the packet to update subscribers with the player's
+// position and look since they were last sent. Relative moves are used where
+// possible, falling back to a teleport for large moves.
+func (player *playerData) sendPositionLook(writer io.Writer) (err os.Error) {
+	curPosition := player.position.ToAbsIntXyz()
+
+	dx := curPosition.X - player.lastSentPosition.X
+	dy := curPosition.Y - player.lastSentPosition.Y
+	dz := curPosition.Z - player.lastSentPosition.Z
+
+	moved := dx != 0 || dy != 0 || dz != 0
+	looked := player.look.Yaw != player.lastSentLook.Yaw || player.look.Pitch != player.lastSentLook.Pitch
+
+	if !moved && !looked {
+		return
+	}
+
+	relMove := &RelMove{RelMoveCoord(dx), RelMoveCoord(dy), RelMoveCoord(dz)}
+
+	switch {
+	case !proto.RelMoveInRange(dx, dy, dz):
+		err = proto.WriteEntityTeleport(writer, player.entityId, curPosition, &player.look)
+	case !moved:
+		err = proto.WriteEntityLook(writer, player.entityId, &player.look)
+	case !looked:
+		err = proto.WriteEntityRelMove(writer, player.entityId, relMove)
+	default:
+		err = proto.WriteEntityLookAndRelMove(writer, player.entityId, relMove, &player.look)
+	}
+
+	if err == nil {
+		player.lastSentPosition = *curPosition
+		player.lastSentLook = player.look
+	}
+
+	return
 }
 
-func (player *playerData) OverlapsItem(item *gamerules.Item) bool {
+// OverlapsEntity returns true if the entity is within the player's bounding
+// box, such that the player can pick it up.
+func (player *playerData) OverlapsEntity(entity gamerules.IEntity) bool {
 	// TODO note that calling this function repeatedly is not as efficient as it
 	// could be.
 
@@ -57,7 +93,7 @@ func (player *playerData) OverlapsItem(item *gamerules.Item) bool {
 	minY := player.position.Y
 	maxY := player.position.Y + playerAabY
 
-	pos := item.Position()
+	pos := entity.Position()
 
 	return pos.X >= minX && pos.X <= maxX && pos.Y >= minY && pos.Y <= maxY && pos.Z >= minZ && pos.Z <= maxZ
 }
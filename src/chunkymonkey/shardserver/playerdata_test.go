@@ -0,0 +1,54 @@
+package shardserver
+
+import (
+	"bytes"
+	"testing"
+
+	"chunkymonkey/proto"
+	. "chunkymonkey/types"
+)
+
+func TestPlayerData_sendPositionLook(t *testing.T) {
+	type Test struct {
+		desc     string
+		position AbsXyz
+		look     LookBytes
+		expected []byte // Expected packet IDs, in order.
+	}
+
+	tests := []Test{
+		{"no change", AbsXyz{0, 64, 0}, LookBytes{0, 0}, []byte{}},
+		{"small move", AbsXyz{1, 64, 0.5}, LookBytes{0, 0}, []byte{proto.PacketIdEntityRelMove}},
+		{"look only", AbsXyz{1, 64, 0.5}, LookBytes{64, 0}, []byte{proto.PacketIdEntityLook}},
+		{"small move and look", AbsXyz{2, 65, 0.5}, LookBytes{32, 10}, []byte{proto.PacketIdEntityLookAndRelMove}},
+		{"large move", AbsXyz{20, 65, 0.5}, LookBytes{32, 10}, []byte{proto.PacketIdEntityTeleport}},
+		{"small move after large move", AbsXyz{21, 65, 0.5}, LookBytes{32, 10}, []byte{proto.PacketIdEntityRelMove}},
+	}
+
+	start := AbsXyz{0, 64, 0}
+	data := &playerData{
+		entityId:         5,
+		position:         start,
+		lastSentPosition: *start.ToAbsIntXyz(),
+	}
+
+	for _, test := range tests {
+		data.position = test.position
+		data.look = test.look
+
+		buf := new(bytes.Buffer)
+		if err := data.sendPositionLook(buf); err != nil {
+			t.Errorf("%s: unexpected error: %v", test.desc, err)
+			continue
+		}
+
+		bs := buf.Bytes()
+		if len(test.expected) == 0 {
+			if len(bs) != 0 {
+				t.Errorf("%s: expected no packet, but got %d bytes", test.desc, len(bs))
+			}
+		} else if len(bs) == 0 || bs[0] != test.expected[0] {
+			t.Errorf("%s: expected packet ID 0x%02x, but got %#v", test.desc, test.expected[0], bs)
+		}
+	}
+}
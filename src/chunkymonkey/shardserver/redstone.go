@@ -0,0 +1,47 @@
+package shardserver
+
+import (
+	"chunkymonkey/gamerules"
+	. "chunkymonkey/types"
+)
+
+// scheduleRedstoneTicks schedules updates for the blocks that react to
+// redstone power at and around a redstone block that has changed, such as a
+// lever being switched or wire changing power level. Wire also connects to
+// wire diagonally above and below it, so those blocks are updated too. Blocks
+// in neighbouring chunks are only updated if their chunk is loaded, which lets
+// power travel along wire that crosses chunk boundaries.
+func (shard *ChunkShard) scheduleRedstoneTicks(blockLoc *BlockXyz) {
+	shard.scheduleRedstoneTick(blockLoc)
+
+	for face := Face(FaceMinValid); face <= FaceMaxValid; face++ {
+		dx, dy, dz := face.Dxyz()
+		if neighbourLoc := blockLoc.AddXyz(dx, dy, dz); neighbourLoc != nil {
+			shard.scheduleRedstoneTick(neighbourLoc)
+		}
+		if dy != 0 {
+			continue
+		}
+		for _, slope := range []BlockYCoord{-1, 1} {
+			if neighbourLoc := blockLoc.AddXyz(dx, slope, dz); neighbourLoc != nil {
+				shard.scheduleRedstoneTick(neighbourLoc)
+			}
+		}
+	}
+}
+
+func (shard *ChunkShard) scheduleRedstoneTick(blockLoc *BlockXyz) {
+	chunk, index, ok := shard.loadedChunkForBlock(blockLoc)
+	if !ok {
+		return
+	}
+
+	blockType, ok := gamerules.Blocks.Get(chunk.blockId(index))
+	if !ok {
+		return
+	}
+
+	if aspect, ok := blockType.Aspect.(gamerules.IRedstoneAspect); ok {
+		chunk.ScheduleBlockTick(index, aspect.RedstoneTickDelay())
+	}
+}
@@ -0,0 +1,140 @@
+package shardserver
+
+import (
+	"strings"
+	"testing"
+
+	"chunkymonkey/gamerules"
+	. "chunkymonkey/types"
+)
+
+const redstoneTestBlocks = `{
+  "0": {
+    "Aspect": "Void",
+    "AspectArgs": {},
+    "Name": "air"
+  },
+  "55": {
+    "Aspect": "RedstoneWire",
+    "AspectArgs": {},
+    "Name": "redstone wire"
+  },
+  "69": {
+    "Aspect": "Lever",
+    "AspectArgs": {},
+    "Name": "lever"
+  }
+}`
+
+// newRedstoneTestShard creates a shard with two neighbouring chunks of air
+// loaded, ready to be ticked.
+func newRedstoneTestShard() (shard *ChunkShard, chunks []*Chunk) {
+	shardLoc := ShardXz{0, 0}
+	shard = &ChunkShard{
+		loc:            shardLoc,
+		originChunkLoc: shardLoc.ToChunkXz(),
+	}
+	for _, loc := range []ChunkXz{{0, 0}, {1, 0}} {
+		index, _, _, _ := shard.chunkIndexAndRelLoc(loc)
+		chunk := newTestChunk(loc)
+		chunk.shard = shard
+		chunk.activeBlocks = make(map[BlockIndex]bool)
+		chunk.newActiveBlocks = make(map[BlockIndex]bool)
+		chunk.scheduledBlocks = make(map[BlockIndex]Ticks)
+		shard.chunks[index] = chunk
+		chunks = append(chunks, chunk)
+	}
+	return
+}
+
+func tickRedstoneTestShard(chunks []*Chunk, ticks int) {
+	for i := 0; i < ticks; i++ {
+		for _, chunk := range chunks {
+			chunk.tick()
+		}
+	}
+}
+
+func TestRedstone_LeverPowersWire(t *testing.T) {
+	defer func(blocks gamerules.BlockTypeList) { gamerules.Blocks = blocks }(gamerules.Blocks)
+	blocks, err := gamerules.LoadBlockDefs(strings.NewReader(redstoneTestBlocks))
+	if err != nil {
+		t.Fatalf("failed to load block types: %v", err)
+	}
+	gamerules.Blocks = blocks
+
+	_, chunks := newRedstoneTestShard()
+
+	// A lever next to a run of wire that crosses into the neighbouring chunk.
+	lever := BlockXyz{10, 64, 8}
+	chunks[0].SetBlockAt(&lever, 69, 0)
+	for x := BlockCoord(11); x < 32; x++ {
+		chunks[0].SetBlockAt(&BlockXyz{x, 64, 8}, 55, 0)
+	}
+	tickRedstoneTestShard(chunks, 100)
+
+	wirePower := func(x BlockCoord) byte {
+		blockId, data, ok := chunks[0].BlockAt(&BlockXyz{x, 64, 8})
+		if !ok || blockId != 55 {
+			t.Fatalf("expected wire at x=%d, got block %d", x, blockId)
+		}
+		return data
+	}
+
+	for x := BlockCoord(11); x < 32; x++ {
+		if power := wirePower(x); power != 0 {
+			t.Errorf("expected unpowered wire at x=%d, got power %d", x, power)
+		}
+	}
+
+	// Switch on the lever.
+	player := &recordingPlayerClient{entityId: 1}
+	chunks[0].reqInteractBlock(player, gamerules.Slot{}, &lever, FaceTop)
+	tickRedstoneTestShard(chunks, 100)
+
+	for x := BlockCoord(11); x < 26; x++ {
+		expected := byte(gamerules.RedstoneMaxPower - (x - 11))
+		if power := wirePower(x); power != expected {
+			t.Errorf("expected wire at x=%d to have power %d, got %d", x, expected, power)
+		}
+	}
+
+	// Switch it off again, and the power drains out of the wire.
+	chunks[0].reqInteractBlock(player, gamerules.Slot{}, &lever, FaceTop)
+	tickRedstoneTestShard(chunks, 400)
+
+	for x := BlockCoord(11); x < 32; x++ {
+		if power := wirePower(x); power != 0 {
+			t.Errorf("expected wire at x=%d to lose its power, got %d", x, power)
+		}
+	}
+}
+
+func TestRedstone_PowerDecaysPast15Blocks(t *testing.T) {
+	defer func(blocks gamerules.BlockTypeList) { gamerules.Blocks = blocks }(gamerules.Blocks)
+	blocks, err := gamerules.LoadBlockDefs(strings.NewReader(redstoneTestBlocks))
+	if err != nil {
+		t.Fatalf("failed to load block types: %v", err)
+	}
+	gamerules.Blocks = blocks
+
+	_, chunks := newRedstoneTestShard()
+
+	// A switched on lever at the start of a run of 20 wires.
+	chunks[0].SetBlockAt(&BlockXyz{5, 64, 8}, 69, 0x8)
+	for x := BlockCoord(6); x < 26; x++ {
+		chunks[0].SetBlockAt(&BlockXyz{x, 64, 8}, 55, 0)
+	}
+	tickRedstoneTestShard(chunks, 100)
+
+	// Power falls by one per block, so the wire is dead after 15 blocks.
+	for x := BlockCoord(6); x < 26; x++ {
+		var expected byte
+		if x < 6+gamerules.RedstoneMaxPower {
+			expected = byte(gamerules.RedstoneMaxPower - (x - 6))
+		}
+		if _, power, _ := chunks[0].BlockAt(&BlockXyz{x, 64, 8}); power != expected {
+			t.Errorf("expected wire at x=%d to have power %d, got %d", x, expected, power)
+		}
+	}
+}
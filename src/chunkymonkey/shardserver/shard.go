@@ -1,20 +1,39 @@
 package shardserver
 
 import (
+	"flag"
 	"fmt"
-	"log"
-	"time"
 
 	"chunkymonkey/chunkstore"
 	"chunkymonkey/entity"
 	"chunkymonkey/gamerules"
+	"chunkymonkey/logging"
+	"chunkymonkey/metrics"
 	. "chunkymonkey/types"
 )
 
 const chunksPerShard = ShardSize * ShardSize
 
-// TODO Allow configuration of this.
-const ticksBetweenSaves = TicksPerSecond * 60
+var shardMaxLoadedChunks = flag.Int(
+	"shard_max_loaded_chunks", 0,
+	"Maximum number of chunks each shard keeps loaded. When exceeded, the "+
+		"least recently used chunk without players in it is unloaded. Zero "+
+		"means no limit.")
+
+// TODO Allow configuration of these.
+const (
+	ticksBetweenSaves   = TicksPerSecond * 60
+	ticksBetweenUnloads = TicksPerSecond * 30
+
+	// Maximum number of chunk reads that a shard has outstanding for
+	// prefetching at any time.
+	maxPrefetchReads = 16
+
+	// Maximum number of ticks that a shard queues up while it is busy. Ticks
+	// beyond this are dropped, in the same way that the game drops ticks that
+	// it cannot catch up on.
+	maxQueuedTicks = 10
+)
 
 // chunkXzToChunkIndex assumes that locDelta is offset relative to the shard
 // origin.
@@ -32,18 +51,35 @@ type ChunkShard struct {
 	originChunkLoc   ChunkXz // The lowest X and Z located chunk in the shard.
 	chunks           [chunksPerShard]*Chunk
 	requests         chan iShardRequest
+	ticks            chan bool
 	ticksSinceUpdate Ticks
 	ticksSinceSave   Ticks
+	ticksSinceUnload Ticks
 	saveChunks       bool
 
+	// Limits the number of loaded chunks if non-zero. chunkAccess records the
+	// value of accessCount when each chunk was last looked up.
+	maxLoadedChunks int
+	accessCount     uint64
+	chunkAccess     [chunksPerShard]uint64
+
+	// Outstanding reads of chunks that have been prefetched, keyed by ChunkKey.
+	prefetchReads map[uint64]*prefetchRead
+
 	newActiveBlocks []BlockXyz
 	newActiveShards map[uint64]*destActiveShard
 
+	// How much darker sky light is than at midday, from the time of day.
+	skyDarkness int8
+
 	shardClients map[uint64]gamerules.IShardShardClient
 	selfClient   shardSelfClient
+
+	// The logger for the shard and its chunks. If nil, logging.Default is used.
+	logger logging.Logger
 }
 
-func NewChunkShard(shardConnecter gamerules.IShardConnecter, chunkStore chunkstore.IChunkStore, entityMgr *entity.EntityManager, loc ShardXz) (shard *ChunkShard) {
+func NewChunkShard(shardConnecter gamerules.IShardConnecter, chunkStore chunkstore.IChunkStore, entityMgr *entity.EntityManager, loc ShardXz, logger logging.Logger) (shard *ChunkShard) {
 	shard = &ChunkShard{
 		shardConnecter:   shardConnecter,
 		chunkStore:       chunkStore,
@@ -51,8 +87,10 @@ func NewChunkShard(shardConnecter gamerules.IShardConnecter, chunkStore chunksto
 		loc:              loc,
 		originChunkLoc:   loc.ToChunkXz(),
 		requests:         make(chan iShardRequest, 256),
+		ticks:            make(chan bool, maxQueuedTicks),
 		ticksSinceUpdate: 0,
 		saveChunks:       chunkStore.SupportsWrite(),
+		maxLoadedChunks:  *shardMaxLoadedChunks,
 
 		// Offset shard saves.
 		ticksSinceSave: (31 * Ticks(loc.Key())) % ticksBetweenSaves,
@@ -60,6 +98,10 @@ func NewChunkShard(shardConnecter gamerules.IShardConnecter, chunkStore chunksto
 		newActiveShards: make(map[uint64]*destActiveShard),
 
 		shardClients: make(map[uint64]gamerules.IShardShardClient),
+
+		prefetchReads: make(map[uint64]*prefetchRead),
+
+		logger: logger,
 	}
 
 	shard.selfClient.shard = shard
@@ -67,13 +109,11 @@ func NewChunkShard(shardConnecter gamerules.IShardConnecter, chunkStore chunksto
 	return
 }
 
-// serve services shard requests in the foreground.
+// serve services shard requests and ticks in the foreground.
 func (shard *ChunkShard) serve() {
-	ticker := time.NewTicker(NanosecondsInSecond / TicksPerSecond)
-
 	for {
 		select {
-		case <-ticker.C:
+		case <-shard.ticks:
 			shard.tick()
 
 		case request := <-shard.requests:
@@ -82,6 +122,16 @@ func (shard *ChunkShard) serve() {
 	}
 }
 
+// enqueueTick queues a tick for the shard to run. It does not block, so that a
+// busy shard does not hold up the game's tick loop.
+func (shard *ChunkShard) enqueueTick() {
+	select {
+	case shard.ticks <- true:
+	default:
+		// The shard is too far behind, drop the tick.
+	}
+}
+
 // tick runs the shard for a single tick.
 func (shard *ChunkShard) tick() {
 	shard.ticksSinceUpdate++
@@ -104,20 +154,127 @@ func (shard *ChunkShard) tick() {
 	if shard.saveChunks && shard.chunkStore.SupportsWrite() {
 		shard.ticksSinceSave++
 		if shard.ticksSinceSave > ticksBetweenSaves {
-			log.Printf("%s: Writing chunks.", shard)
+			shard.log().Debug("%s: Writing chunks.", shard)
 			// TODO Stagger the per-chunk saves over multiple ticks.
-			for _, chunk := range shard.chunks {
-				if chunk != nil {
-					chunk.save(shard.chunkStore)
-				}
-			}
+			shard.saveAllChunks()
 			shard.ticksSinceSave = 0
 		}
 	}
 
+	shard.collectPrefetchedChunks()
+	shard.evictExcessChunks()
+
+	shard.spawnMobs()
+
+	shard.ticksSinceUnload++
+	if shard.ticksSinceUnload > ticksBetweenUnloads {
+		shard.unloadIdleChunks()
+		shard.ticksSinceUnload = 0
+	}
+
 	shard.transferActiveBlocks()
 }
 
+// canUnloadChunk returns true if the chunk can be unloaded without losing
+// changes or affecting players.
+func (shard *ChunkShard) canUnloadChunk(chunk *Chunk) bool {
+	canSave := shard.saveChunks && shard.chunkStore.SupportsWrite()
+	return chunk.isIdle() && (canSave || !chunk.storeDirty)
+}
+
+// evictChunk unloads the least recently accessed chunk that can be unloaded,
+// to make space for another chunk. It returns false if there was no such
+// chunk.
+func (shard *ChunkShard) evictChunk() bool {
+	evictIndex := -1
+	for index, chunk := range shard.chunks {
+		if chunk == nil || !shard.canUnloadChunk(chunk) {
+			continue
+		}
+		if evictIndex == -1 || shard.chunkAccess[index] < shard.chunkAccess[evictIndex] {
+			evictIndex = index
+		}
+	}
+
+	if evictIndex == -1 {
+		return false
+	}
+
+	shard.unloadChunk(evictIndex)
+	return true
+}
+
+// evictExcessChunks evicts chunks until no more than maxLoadedChunks are
+// loaded, or no more can be evicted. Chunks are only evicted here, between
+// requests and ticks, as code that loads a chunk part way through may still
+// hold on to others in the shard.
+func (shard *ChunkShard) evictExcessChunks() {
+	if shard.maxLoadedChunks <= 0 {
+		return
+	}
+	for shard.numLoadedChunks() > shard.maxLoadedChunks {
+		if !shard.evictChunk() {
+			// None of the remaining chunks can be unloaded.
+			return
+		}
+	}
+}
+
+func (shard *ChunkShard) numLoadedChunks() (count int) {
+	for _, chunk := range shard.chunks {
+		if chunk != nil {
+			count++
+		}
+	}
+	return
+}
+
+// saveAllChunks writes all loaded chunks with unsaved changes to the chunk
+// store.
+func (shard *ChunkShard) saveAllChunks() {
+	if !shard.saveChunks || !shard.chunkStore.SupportsWrite() {
+		return
+	}
+
+	for _, chunk := range shard.chunks {
+		if chunk != nil {
+			chunk.save(shard.chunkStore)
+		}
+	}
+}
+
+// unloadIdleChunks unloads all chunks in the shard that have no players
+// subscribed to them, to bound the memory used by a roaming player. Chunks
+// with unsaved changes are kept if the chunk store cannot write them.
+func (shard *ChunkShard) unloadIdleChunks() {
+	for index, chunk := range shard.chunks {
+		if chunk != nil && shard.canUnloadChunk(chunk) {
+			shard.unloadChunk(index)
+		}
+	}
+}
+
+// unloadChunk removes the chunk at the given index from the shard, first
+// saving it if it has changed since it was last written.
+func (shard *ChunkShard) unloadChunk(index int) {
+	chunk := shard.chunks[index]
+	if chunk == nil {
+		return
+	}
+
+	if shard.saveChunks && shard.chunkStore.SupportsWrite() {
+		chunk.save(shard.chunkStore)
+	}
+
+	// Entity IDs are allocated afresh when the chunk is next loaded.
+	for entityId := range chunk.entities {
+		shard.entityMgr.RemoveEntityById(entityId)
+	}
+
+	shard.chunks[index] = nil
+	metrics.Server.ChunkUnloaded()
+}
+
 // clientForShard is used to get a IShardShardClient for a given shard, reusing
 // IShardShardClient connections for use within the shard. Returns nil if the
 // shard does not exist.
@@ -166,6 +323,79 @@ func (shard *ChunkShard) blockQuery(chunkLoc ChunkXz, subLoc *SubChunkXyz) (bloc
 	return
 }
 
+// chunkForBlock returns the chunk containing the given block, loading it if
+// necessary, and the block's position within the chunk. ok is false if the
+// block is outside of the world or the shard, or the chunk could not be
+// loaded.
+func (shard *ChunkShard) chunkForBlock(blockLoc *BlockXyz) (chunk *Chunk, subLoc *SubChunkXyz, index BlockIndex, ok bool) {
+	chunkLoc, subLoc := blockLoc.ToChunkLocal()
+
+	if index, ok = subLoc.BlockIndex(); !ok {
+		return
+	}
+
+	if _, _, _, ok = shard.chunkIndexAndRelLoc(*chunkLoc); !ok {
+		return
+	}
+
+	if chunk = shard.chunkAt(*chunkLoc); chunk == nil {
+		ok = false
+	}
+
+	return
+}
+
+// blockAt returns the ID and data of the block at the given world location,
+// loading its chunk if necessary. ok is false if the block could not be read.
+func (shard *ChunkShard) blockAt(blockLoc *BlockXyz) (blockId BlockId, blockData byte, ok bool) {
+	chunk, _, index, ok := shard.chunkForBlock(blockLoc)
+	if !ok {
+		return
+	}
+
+	return chunk.blockId(index), index.BlockData(chunk.blockData), true
+}
+
+// setBlockAt sets the block at the given world location, loading its chunk if
+// necessary. It returns false if the block could not be set.
+func (shard *ChunkShard) setBlockAt(blockLoc *BlockXyz, blockId BlockId, blockData byte) bool {
+	chunk, subLoc, index, ok := shard.chunkForBlock(blockLoc)
+	if !ok {
+		return false
+	}
+
+	chunk.setBlock(blockLoc, subLoc, index, blockId, blockData)
+
+	return true
+}
+
+// useEntity has the player use (or hit, if leftClick is true) an entity in the
+// loaded chunk at chunkLoc or in one of the loaded chunks next to it. Only
+// minecarts can be used.
+func (shard *ChunkShard) useEntity(player gamerules.IPlayerClient, chunkLoc ChunkXz, entityId EntityId, leftClick bool) {
+	for dx := ChunkCoord(-1); dx <= 1; dx++ {
+		for dz := ChunkCoord(-1); dz <= 1; dz++ {
+			index, _, _, ok := shard.chunkIndexAndRelLoc(ChunkXz{chunkLoc.X + dx, chunkLoc.Z + dz})
+			if !ok {
+				continue
+			}
+			if chunk := shard.chunks[index]; chunk != nil && chunk.useEntity(player, entityId, leftClick) {
+				return
+			}
+		}
+	}
+}
+
+// dismountRider takes the player with the given entityId out of any minecart
+// in the shard that they are riding.
+func (shard *ChunkShard) dismountRider(entityId EntityId) {
+	for _, chunk := range shard.chunks {
+		if chunk != nil {
+			chunk.dismountRider(entityId)
+		}
+	}
+}
+
 // transferActiveBlocks takes blocks marked as newly active by addActiveBlock,
 // and informs the chunk in the destination shards.
 func (shard *ChunkShard) transferActiveBlocks() {
@@ -224,6 +454,14 @@ func (shard *ChunkShard) String() string {
 	return fmt.Sprintf("ChunkShard[%#v/%#v]", shard.loc, shard.originChunkLoc)
 }
 
+// log returns the logger for the shard.
+func (shard *ChunkShard) log() logging.Logger {
+	if shard.logger == nil {
+		return logging.Default
+	}
+	return shard.logger
+}
+
 func (shard *ChunkShard) chunkIndexAndRelLoc(loc ChunkXz) (index int, x, z ChunkCoord, ok bool) {
 	x = loc.X - shard.originChunkLoc.X
 	z = loc.Z - shard.originChunkLoc.Z
@@ -244,17 +482,22 @@ func (shard *ChunkShard) chunkIndexAndRelLoc(loc ChunkXz) (index int, x, z Chunk
 func (shard *ChunkShard) chunkAt(loc ChunkXz) *Chunk {
 	chunkIndex, dx, dz, ok := shard.chunkIndexAndRelLoc(loc)
 	if !ok {
-		log.Printf("%v.Get(%#v): ChunkXz outside of shard", shard, loc)
+		shard.log().Error("%v.Get(%#v): ChunkXz outside of shard", shard, loc)
 		return nil
 	}
 
+	shard.accessCount++
+
 	chunk := shard.chunks[chunkIndex]
 
 	// Chunk already loaded.
 	if chunk != nil {
+		shard.chunkAccess[chunkIndex] = shard.accessCount
 		return chunk
 	}
 
+	// Loading the chunk may take the shard over maxLoadedChunks. The excess is
+	// evicted on the next tick, as the caller may still be using other chunks.
 	chunk = shard.loadChunk(loc, ChunkXz{dx, dz})
 
 	if chunk == nil {
@@ -264,19 +507,82 @@ func (shard *ChunkShard) chunkAt(loc ChunkXz) *Chunk {
 	}
 
 	shard.chunks[chunkIndex] = chunk
+	shard.chunkAccess[chunkIndex] = shard.accessCount
 
 	return chunk
 }
 
+// prefetchChunk starts reading the given chunk from the store in the
+// background, so that it is loaded by the time that it is needed. It does
+// nothing if the chunk is already loaded or being read, or if too many reads
+// are already outstanding.
+func (shard *ChunkShard) prefetchChunk(loc ChunkXz) {
+	chunkIndex, _, _, ok := shard.chunkIndexAndRelLoc(loc)
+	if !ok || shard.chunks[chunkIndex] != nil || len(shard.prefetchReads) >= maxPrefetchReads {
+		return
+	}
+
+	key := loc.ChunkKey()
+	if _, pending := shard.prefetchReads[key]; pending {
+		return
+	}
+
+	shard.prefetchReads[key] = &prefetchRead{loc, shard.chunkStore.ReadChunk(loc)}
+}
+
+// collectPrefetchedChunks adds chunks whose prefetch reads have completed to
+// the shard, without waiting for those that have not.
+func (shard *ChunkShard) collectPrefetchedChunks() {
+	for key, read := range shard.prefetchReads {
+		select {
+		case chunkResult := <-read.result:
+			shard.prefetchReads[key] = nil, false
+			chunkIndex, _, _, ok := shard.chunkIndexAndRelLoc(read.loc)
+			if !ok || shard.chunks[chunkIndex] != nil {
+				continue
+			}
+			if shard.maxLoadedChunks > 0 && shard.numLoadedChunks() >= shard.maxLoadedChunks && !shard.evictChunk() {
+				// There is no space for the chunk. It is read again if it is
+				// needed.
+				continue
+			}
+			chunk := shard.chunkFromReadResult(read.loc, &chunkResult)
+			if chunk == nil {
+				continue
+			}
+			shard.chunks[chunkIndex] = chunk
+			shard.chunkAccess[chunkIndex] = shard.accessCount
+		default:
+		}
+	}
+}
+
 // loadChunk loads the specified chunk from store, and returns it.
 // loc - The absolute world position of the chunk.
 // locDelta - The relative position of the chunk within the shard.
 func (shard *ChunkShard) loadChunk(loc ChunkXz, locDelta ChunkXz) *Chunk {
-	chunkResult := <-shard.chunkStore.ReadChunk(loc)
+	// Use the result of a prefetch if one is underway.
+	var resultChan <-chan chunkstore.ChunkReadResult
+	key := loc.ChunkKey()
+	if read, ok := shard.prefetchReads[key]; ok {
+		shard.prefetchReads[key] = nil, false
+		resultChan = read.result
+	} else {
+		resultChan = shard.chunkStore.ReadChunk(loc)
+	}
+
+	chunkResult := <-resultChan
+
+	return shard.chunkFromReadResult(loc, &chunkResult)
+}
+
+// chunkFromReadResult creates a Chunk from the result of reading it from the
+// chunk store. It returns nil if the chunk could not be read.
+func (shard *ChunkShard) chunkFromReadResult(loc ChunkXz, chunkResult *chunkstore.ChunkReadResult) *Chunk {
 	chunkReader, err := chunkResult.Reader, chunkResult.Err
 	if err != nil {
 		if _, ok := err.(chunkstore.NoSuchChunkError); !ok {
-			log.Printf("%v.load(%#v): chunk loading error: %v", shard, loc, err)
+			shard.log().Error("%v.load(%#v): chunk loading error: %v", shard, loc, err)
 			return nil
 		} else {
 			// Chunk doesn't exist in store.
@@ -286,6 +592,9 @@ func (shard *ChunkShard) loadChunk(loc ChunkXz, locDelta ChunkXz) *Chunk {
 
 	chunk := newChunkFromReader(chunkReader, shard)
 
+	generated, ok := chunkReader.(chunkstore.IGeneratedChunkReader)
+	metrics.Server.ChunkLoaded(ok && generated.IsGenerated())
+
 	return chunk
 }
 
@@ -308,6 +617,12 @@ func (shard *ChunkShard) enqueueRequest(req iShardRequest) {
 	shard.requests <- req
 }
 
+// prefetchRead is an outstanding read of a chunk from the chunk store.
+type prefetchRead struct {
+	loc    ChunkXz
+	result <-chan chunkstore.ChunkReadResult
+}
+
 type destActiveShard struct {
 	loc    ShardXz
 	blocks []BlockXyz
@@ -332,3 +647,7 @@ func (client *shardSelfClient) ReqTransferEntity(loc ChunkXz, entity gamerules.I
 		chunk.transferEntity(entity)
 	}
 }
+
+func (client *shardSelfClient) ReqExplode(center AbsXyz, power float32) {
+	client.shard.explode(&center, power)
+}
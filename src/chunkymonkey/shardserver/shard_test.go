@@ -0,0 +1,399 @@
+package shardserver
+
+import (
+	"os"
+	"testing"
+
+	"chunkymonkey/chunkstore"
+	"chunkymonkey/gamerules"
+	"chunkymonkey/logging"
+	"chunkymonkey/metrics"
+	. "chunkymonkey/types"
+	"nbt"
+)
+
+// countingChunkStore records the locations of chunks written to it, and the
+// number of chunks read from it.
+type countingChunkStore struct {
+	exists  bool // Set to have reads succeed.
+	reads   int
+	written []ChunkXz
+}
+
+func (store *countingChunkStore) Serve() {
+}
+
+func (store *countingChunkStore) ReadChunk(chunkLoc ChunkXz) (result <-chan chunkstore.ChunkReadResult) {
+	store.reads++
+	resultChan := make(chan chunkstore.ChunkReadResult, 1)
+	if store.exists {
+		resultChan <- chunkstore.ChunkReadResult{&emptyChunkReader{chunkLoc}, nil}
+	} else {
+		resultChan <- chunkstore.ChunkReadResult{nil, chunkstore.NoSuchChunkError(false)}
+	}
+	return resultChan
+}
+
+// emptyChunkReader reads a chunk with no data in it.
+type emptyChunkReader struct {
+	loc ChunkXz
+}
+
+func (r *emptyChunkReader) ChunkLoc() ChunkXz                      { return r.loc }
+func (r *emptyChunkReader) Blocks() []byte                         { return nil }
+func (r *emptyChunkReader) BlockData() []byte                      { return nil }
+func (r *emptyChunkReader) BlockLight() []byte                     { return nil }
+func (r *emptyChunkReader) SkyLight() []byte                       { return nil }
+func (r *emptyChunkReader) HeightMap() []byte                      { return nil }
+func (r *emptyChunkReader) Entities() []gamerules.INonPlayerEntity { return nil }
+func (r *emptyChunkReader) TileEntities() []gamerules.ITileEntity  { return nil }
+func (r *emptyChunkReader) RootTag() nbt.ITag                      { return nil }
+
+func (store *countingChunkStore) SupportsWrite() bool {
+	return true
+}
+
+func (store *countingChunkStore) Writer() chunkstore.IChunkWriter {
+	return &nullChunkWriter{}
+}
+
+func (store *countingChunkStore) WriteChunk(writer chunkstore.IChunkWriter) {
+	store.written = append(store.written, writer.ChunkLoc())
+}
+
+// nullChunkWriter keeps only the location of the chunk written to it.
+type nullChunkWriter struct {
+	loc ChunkXz
+}
+
+func (w *nullChunkWriter) ChunkLoc() ChunkXz                                                 { return w.loc }
+func (w *nullChunkWriter) SetChunkLoc(loc ChunkXz)                                           { w.loc = loc }
+func (w *nullChunkWriter) SetBlocks(blocks []byte)                                           {}
+func (w *nullChunkWriter) SetBlockData(blockData []byte)                                     {}
+func (w *nullChunkWriter) SetBlockLight(blockLight []byte)                                   {}
+func (w *nullChunkWriter) SetSkyLight(skyLight []byte)                                       {}
+func (w *nullChunkWriter) SetHeightMap(heightMap []byte)                                     {}
+func (w *nullChunkWriter) SetEntities(entities map[EntityId]gamerules.INonPlayerEntity)      {}
+func (w *nullChunkWriter) SetTileEntities(tileEntities map[BlockIndex]gamerules.ITileEntity) {}
+
+func TestChunkShard_saveAllChunks(t *testing.T) {
+	store := &countingChunkStore{}
+	shard := &ChunkShard{
+		chunkStore: store,
+		saveChunks: true,
+	}
+
+	shard.chunks[0] = &Chunk{loc: ChunkXz{0, 0}, storeDirty: true}
+	shard.chunks[1] = &Chunk{loc: ChunkXz{0, 1}, storeDirty: false}
+	shard.chunks[5] = &Chunk{loc: ChunkXz{1, 1}, storeDirty: true}
+
+	shard.saveAllChunks()
+
+	if len(store.written) != 2 {
+		t.Fatalf("expected 2 dirty chunks written, but got %d: %v", len(store.written), store.written)
+	}
+	if !store.written[0].Equals(ChunkXz{0, 0}) || !store.written[1].Equals(ChunkXz{1, 1}) {
+		t.Errorf("expected chunks (0,0) and (1,1) written, but got %v", store.written)
+	}
+	for i, chunk := range shard.chunks {
+		if chunk != nil && chunk.storeDirty {
+			t.Errorf("chunk %d still dirty after saving", i)
+		}
+	}
+
+	// Nothing is dirty any more, so saving again writes nothing.
+	shard.saveAllChunks()
+	if len(store.written) != 2 {
+		t.Errorf("expected no further chunks written, but got %d", len(store.written)-2)
+	}
+}
+
+func TestChunkShard_evictChunk(t *testing.T) {
+	shard := &ChunkShard{
+		chunkStore: &countingChunkStore{},
+		saveChunks: true,
+	}
+
+	// Chunk 0 is the least recently accessed, but has a player in it.
+	shard.chunks[0] = &Chunk{playersData: map[EntityId]*playerData{1: &playerData{}}}
+	shard.chunkAccess[0] = 1
+	shard.chunks[1] = &Chunk{}
+	shard.chunkAccess[1] = 3
+	shard.chunks[2] = &Chunk{}
+	shard.chunkAccess[2] = 2
+
+	if !shard.evictChunk() {
+		t.Fatalf("expected a chunk to be evicted")
+	}
+	if shard.chunks[0] == nil {
+		t.Errorf("chunk with player in it was evicted")
+	}
+	if shard.chunks[2] != nil {
+		t.Errorf("expected least recently accessed chunk without players to be evicted")
+	}
+	if shard.chunks[1] == nil {
+		t.Errorf("expected more recently accessed chunk to remain loaded")
+	}
+
+	if !shard.evictChunk() || shard.chunks[1] != nil {
+		t.Errorf("expected remaining chunk without players to be evicted")
+	}
+
+	if shard.evictChunk() {
+		t.Errorf("expected no chunk to be evicted when all have players")
+	}
+	if n := shard.numLoadedChunks(); n != 1 {
+		t.Errorf("expected 1 chunk to remain loaded, got %d", n)
+	}
+}
+
+func TestChunkShard_unloadIdleChunks(t *testing.T) {
+	store := &countingChunkStore{exists: true}
+	shard := NewChunkShard(nil, store, nil, ShardXz{0, 0}, nil)
+
+	subscribedLoc, idleLoc := ChunkXz{1, 2}, ChunkXz{3, 4}
+	subscribed := shard.chunkAt(subscribedLoc)
+	subscribed.subscribers[1] = &recordingPlayerClient{entityId: 1}
+	idle := shard.chunkAt(idleLoc)
+	idle.storeDirty = true
+
+	shard.unloadIdleChunks()
+
+	if index, _, _, _ := shard.chunkIndexAndRelLoc(subscribedLoc); shard.chunks[index] != subscribed {
+		t.Errorf("expected chunk with a subscriber to stay loaded")
+	}
+	if index, _, _, _ := shard.chunkIndexAndRelLoc(idleLoc); shard.chunks[index] != nil {
+		t.Errorf("expected chunk without subscribers to be unloaded")
+	}
+	if len(store.written) != 1 || !store.written[0].Equals(idleLoc) {
+		t.Errorf("expected the unloaded chunk to be saved first, got %v written", store.written)
+	}
+
+	// The unloaded chunk is read from the store again when next needed.
+	reads := store.reads
+	if chunk := shard.chunkAt(idleLoc); chunk == nil || chunk == idle {
+		t.Errorf("expected the unloaded chunk to be loaded afresh, got %v", chunk)
+	}
+	if store.reads != reads+1 {
+		t.Errorf("expected the unloaded chunk to be read from the store, got %d reads", store.reads-reads)
+	}
+}
+
+func newTestChunk(loc ChunkXz) *Chunk {
+	return &Chunk{
+		loc:          loc,
+		blocks:       make([]byte, ChunkSizeH*ChunkSizeH*ChunkSizeY),
+		blockData:    make([]byte, ChunkSizeH*ChunkSizeH*ChunkSizeY/2),
+		blockLight:   make([]byte, ChunkSizeH*ChunkSizeH*ChunkSizeY/2),
+		skyLight:     make([]byte, ChunkSizeH*ChunkSizeH*ChunkSizeY/2),
+		heightMap:    make([]byte, ChunkSizeH*ChunkSizeH),
+		tileEntities: make(map[BlockIndex]gamerules.ITileEntity),
+		signEditors:  make(map[BlockIndex]EntityId),
+	}
+}
+
+func TestChunkShard_blockAt(t *testing.T) {
+	type Test struct {
+		desc     string
+		blockLoc BlockXyz
+		ok       bool
+	}
+
+	// A shard with negative coordinates, with chunks (-1,-1) and (-1,-2) loaded.
+	shardLoc := ShardXz{-1, -1}
+	shard := &ChunkShard{
+		loc:            shardLoc,
+		originChunkLoc: shardLoc.ToChunkXz(),
+		chunkStore:     &countingChunkStore{},
+	}
+	for _, loc := range []ChunkXz{{-1, -1}, {-1, -2}} {
+		index, _, _, _ := shard.chunkIndexAndRelLoc(loc)
+		shard.chunks[index] = newTestChunk(loc)
+	}
+
+	tests := []Test{
+		{"chunk corner nearest the origin", BlockXyz{-1, 64, -1}, true},
+		{"far corner of chunk", BlockXyz{-16, 0, -16}, true},
+		{"neighbouring chunk", BlockXyz{-16, 127, -17}, true},
+		{"below the world", BlockXyz{-1, -1, -1}, false},
+		{"another shard", BlockXyz{0, 64, 0}, false},
+		{"chunk that does not exist", BlockXyz{-33, 64, -1}, false},
+	}
+
+	for i, test := range tests {
+		blockId := BlockId(i + 1)
+		if ok := shard.setBlockAt(&test.blockLoc, blockId, 5); ok != test.ok {
+			t.Errorf("%s: setBlockAt expected ok=%t but got %t", test.desc, test.ok, ok)
+			continue
+		}
+		if !test.ok {
+			continue
+		}
+
+		gotId, gotData, ok := shard.blockAt(&test.blockLoc)
+		if !ok || gotId != blockId || gotData != 5 {
+			t.Errorf("%s: blockAt expected (%d, 5, true) but got (%d, %d, %t)", test.desc, blockId, gotId, gotData, ok)
+		}
+
+		// Check that the block was written where expected within the chunk.
+		chunkLoc, subLoc := test.blockLoc.ToChunkLocal()
+		chunk := shard.chunkAt(*chunkLoc)
+		index, _ := subLoc.BlockIndex()
+		if BlockId(chunk.blocks[index]) != blockId {
+			t.Errorf("%s: block not found at expected index in chunk %v", test.desc, *chunkLoc)
+		}
+	}
+}
+
+func TestChunkShard_chunkFromReadResult_LogsLoadFailureAtError(t *testing.T) {
+	logger := &logging.Recorder{}
+	shard := NewChunkShard(nil, &countingChunkStore{}, nil, ShardXz{0, 0}, logger)
+	loc := ChunkXz{1, 2}
+
+	result := chunkstore.ChunkReadResult{nil, os.NewError("corrupt chunk")}
+	if chunk := shard.chunkFromReadResult(loc, &result); chunk != nil {
+		t.Errorf("expected no chunk from a failed read, got %v", chunk)
+	}
+	if levels := logger.Levels(); len(levels) != 1 || levels[0] != logging.LevelError {
+		t.Errorf("expected one error message, got %+v", logger.Entries)
+	}
+
+	// Chunks that haven't been generated yet are not an error.
+	logger.Entries = nil
+	result = chunkstore.ChunkReadResult{nil, chunkstore.NoSuchChunkError(false)}
+	if chunk := shard.chunkFromReadResult(loc, &result); chunk != nil {
+		t.Errorf("expected no chunk from a missing chunk, got %v", chunk)
+	}
+	if len(logger.Entries) != 0 {
+		t.Errorf("expected nothing logged for a missing chunk, got %+v", logger.Entries)
+	}
+}
+
+func TestChunkShard_CountsLoadedChunks(t *testing.T) {
+	store := &countingChunkStore{exists: true}
+	shard := NewChunkShard(nil, store, nil, ShardXz{0, 0}, nil)
+
+	before := metrics.Server.Snapshot()
+	shard.chunkAt(ChunkXz{1, 2})
+	shard.chunkAt(ChunkXz{3, 4})
+	// Looking up a loaded chunk doesn't load it again.
+	shard.chunkAt(ChunkXz{1, 2})
+	loaded := metrics.Server.Snapshot()
+
+	if count := loaded.ChunksLoaded - before.ChunksLoaded; count != 2 {
+		t.Errorf("expected 2 chunks counted as loaded, got %d", count)
+	}
+	if count := loaded.ChunksGenerated - before.ChunksGenerated; count != 0 {
+		t.Errorf("expected no chunks counted as generated, got %d", count)
+	}
+
+	shard.unloadIdleChunks()
+	unloaded := metrics.Server.Snapshot()
+
+	if count := unloaded.ChunksUnloaded - loaded.ChunksUnloaded; count != 2 {
+		t.Errorf("expected 2 chunks counted as unloaded, got %d", count)
+	}
+}
+
+func TestChunkShard_prefetchChunk(t *testing.T) {
+	store := &countingChunkStore{exists: true}
+	shard := NewChunkShard(nil, store, nil, ShardXz{0, 0}, nil)
+
+	loc := ChunkXz{1, 2}
+	shard.prefetchChunk(loc)
+	// Prefetching again while the read is outstanding does nothing.
+	shard.prefetchChunk(loc)
+	// Chunks outside of the shard are ignored.
+	shard.prefetchChunk(ChunkXz{-1, 0})
+
+	if store.reads != 1 {
+		t.Errorf("expected 1 read from the store after prefetching, got %d", store.reads)
+	}
+
+	shard.collectPrefetchedChunks()
+	if len(shard.prefetchReads) != 0 {
+		t.Errorf("expected no outstanding prefetches, got %d", len(shard.prefetchReads))
+	}
+
+	chunk := shard.chunkAt(loc)
+	if chunk == nil || !chunk.loc.Equals(loc) {
+		t.Fatalf("expected prefetched chunk at %v, got %v", loc, chunk)
+	}
+	if store.reads != 1 {
+		t.Errorf("expected chunkAt not to read from store after prefetching, got %d reads", store.reads)
+	}
+
+	// Prefetching a chunk that is loaded does nothing.
+	shard.prefetchChunk(loc)
+	if store.reads != 1 {
+		t.Errorf("expected loaded chunk not to be prefetched, got %d reads", store.reads)
+	}
+}
+
+func TestChunkShard_chunkAt_DefersEviction(t *testing.T) {
+	store := &countingChunkStore{exists: true}
+	shard := NewChunkShard(nil, store, nil, ShardXz{0, 0}, nil)
+	shard.maxLoadedChunks = 1
+
+	first := shard.chunkAt(ChunkXz{1, 2})
+	second := shard.chunkAt(ChunkXz{3, 4})
+
+	// The first chunk might still be in use, so it stays loaded until the
+	// shard next ticks.
+	if index, _, _, _ := shard.chunkIndexAndRelLoc(ChunkXz{1, 2}); shard.chunks[index] != first {
+		t.Fatalf("expected chunk to stay loaded while another is loaded")
+	}
+	if n := shard.numLoadedChunks(); n != 2 {
+		t.Errorf("expected 2 chunks loaded before eviction, got %d", n)
+	}
+
+	shard.evictExcessChunks()
+
+	if n := shard.numLoadedChunks(); n != 1 {
+		t.Errorf("expected 1 chunk loaded after eviction, got %d", n)
+	}
+	if index, _, _, _ := shard.chunkIndexAndRelLoc(ChunkXz{3, 4}); shard.chunks[index] != second {
+		t.Errorf("expected the most recently accessed chunk to stay loaded")
+	}
+}
+
+func TestChunkShard_collectPrefetchedChunks_HonoursLimit(t *testing.T) {
+	store := &countingChunkStore{exists: true}
+	shard := NewChunkShard(nil, store, nil, ShardXz{0, 0}, nil)
+	shard.maxLoadedChunks = 1
+
+	// The only loaded chunk has a player in it, so there is no space for the
+	// prefetched chunk.
+	occupied := shard.chunkAt(ChunkXz{1, 2})
+	occupied.playersData = map[EntityId]*playerData{1: &playerData{}}
+
+	shard.prefetchChunk(ChunkXz{3, 4})
+	shard.collectPrefetchedChunks()
+	if n := shard.numLoadedChunks(); n != 1 {
+		t.Errorf("expected prefetched chunk to be dropped at the limit, got %d loaded", n)
+	}
+
+	// Once the player has left, the idle chunk is evicted to make space.
+	occupied.playersData = nil
+	shard.prefetchChunk(ChunkXz{3, 4})
+	shard.collectPrefetchedChunks()
+	if n := shard.numLoadedChunks(); n != 1 {
+		t.Errorf("expected 1 chunk loaded at the limit, got %d", n)
+	}
+	if index, _, _, _ := shard.chunkIndexAndRelLoc(ChunkXz{3, 4}); shard.chunks[index] == nil {
+		t.Errorf("expected prefetched chunk to be loaded in place of the idle chunk")
+	}
+}
+
+func TestChunkShard_enqueueTick_DropsExcessTicks(t *testing.T) {
+	shard := NewChunkShard(nil, &countingChunkStore{}, nil, ShardXz{0, 0}, nil)
+
+	// The shard is not serving, so ticks queue up until the queue is full.
+	for i := 0; i < maxQueuedTicks+5; i++ {
+		shard.enqueueTick()
+	}
+
+	if n := len(shard.ticks); n != maxQueuedTicks {
+		t.Errorf("expected %d queued ticks, got %d", maxQueuedTicks, n)
+	}
+}
@@ -0,0 +1,64 @@
+package chunkymonkey
+
+import (
+	"http"
+	"json"
+	"sort"
+	"time"
+
+	"chunkymonkey/metrics"
+	. "chunkymonkey/types"
+)
+
+// GameStatus is the state of the game reported by the status page.
+type GameStatus struct {
+	Players        []string // Names of the connected players, sorted.
+	LoadedChunks   int64
+	TicksPerSecond float64
+	UptimeSeconds  int64
+}
+
+// Status returns the current state of the game. It may be called from any
+// goroutine.
+func (game *Game) Status() (status GameStatus) {
+	result := game.EnqueueWithResult(func(game *Game) interface{} {
+		names := make([]string, 0, len(game.players))
+		for _, player := range game.players {
+			names = append(names, player.Name())
+		}
+		return names
+	})
+	status.Players = result.([]string)
+	sort.Strings(status.Players)
+
+	snapshot := metrics.Server.Snapshot()
+	status.LoadedChunks = snapshot.ChunksLoaded - snapshot.ChunksUnloaded
+	status.TicksPerSecond = game.MeasuredTps()
+	status.UptimeSeconds = (time.Nanoseconds() - game.startTime) / NanosecondsInSecond
+
+	return
+}
+
+// HandleStatus adds handlers to mux that serve the game's status as JSON at
+// /status, and the server's metrics in the Prometheus text format at
+// /metrics.
+func (game *Game) HandleStatus(mux *http.ServeMux) {
+	mux.HandleFunc("/status", game.serveStatus)
+	mux.HandleFunc("/metrics", serveMetrics)
+}
+
+func (game *Game) serveStatus(w http.ResponseWriter, req *http.Request) {
+	data, err := json.Marshal(game.Status())
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func serveMetrics(w http.ResponseWriter, req *http.Request) {
+	snapshot := metrics.Server.Snapshot()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	snapshot.WriteText(w)
+}
@@ -0,0 +1,81 @@
+package chunkymonkey
+
+import (
+	"http"
+	"http/httptest"
+	"json"
+	"strings"
+	"testing"
+	"time"
+
+	"chunkymonkey/metrics"
+	"chunkymonkey/player"
+	. "chunkymonkey/types"
+)
+
+func TestGame_serveStatus(t *testing.T) {
+	bob := player.NewPlayer(1, defaultWorldName, nil, nil, "bob", BlockXyz{0, 64, 0}, nil, nil, nil)
+	alice := player.NewPlayer(2, defaultWorldName, nil, nil, "alice", BlockXyz{0, 64, 0}, nil, nil, nil)
+	game := &Game{
+		players:   map[EntityId]*player.Player{1: bob, 2: alice},
+		workQueue: make(chan func(*Game), 1),
+		startTime: time.Nanoseconds() - 90*NanosecondsInSecond,
+	}
+	game.tps.set(19.5)
+	go serveWork(game, 1)
+
+	mux := http.NewServeMux()
+	game.HandleStatus(mux)
+	req, err := http.NewRequest("GET", "/status", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	snapshot := metrics.Server.Snapshot()
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status OK, got %d", recorder.Code)
+	}
+	if contentType := recorder.HeaderMap.Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("expected JSON content type, got %q", contentType)
+	}
+
+	var status GameStatus
+	if err = json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+		t.Fatalf("failed to decode status %q: %v", recorder.Body.String(), err)
+	}
+	if len(status.Players) != 2 || status.Players[0] != "alice" || status.Players[1] != "bob" {
+		t.Errorf("expected players [alice bob], got %v", status.Players)
+	}
+	if status.TicksPerSecond != 19.5 {
+		t.Errorf("expected 19.5 ticks per second, got %v", status.TicksPerSecond)
+	}
+	if status.UptimeSeconds < 90 || status.UptimeSeconds > 100 {
+		t.Errorf("expected uptime of about 90 seconds, got %d", status.UptimeSeconds)
+	}
+	if expected := snapshot.ChunksLoaded - snapshot.ChunksUnloaded; status.LoadedChunks != expected {
+		t.Errorf("expected %d loaded chunks, got %d", expected, status.LoadedChunks)
+	}
+}
+
+func TestGame_serveMetrics(t *testing.T) {
+	game := &Game{}
+	mux := http.NewServeMux()
+	game.HandleStatus(mux)
+
+	metrics.Server.SetTicksPerSecond(20)
+	req, err := http.NewRequest("GET", "/metrics", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status OK, got %d", recorder.Code)
+	}
+	if body := recorder.Body.String(); !strings.Contains(body, "\nchunkymonkey_ticks_per_second 20\n") {
+		t.Errorf("expected tick rate in metrics, got:\n%s", body)
+	}
+}
@@ -0,0 +1,167 @@
+package chunkymonkey
+
+import (
+	"expvar"
+	"sync"
+	"time"
+
+	"chunkymonkey/logging"
+	"chunkymonkey/metrics"
+	. "chunkymonkey/types"
+)
+
+const (
+	// The most ticks that are run back to back to catch up after ticks have
+	// overrun. If the game falls further behind than this, the excess ticks are
+	// dropped rather than letting the game run ever faster to catch up.
+	maxCatchUpTicks = 10
+
+	// The period over which the tick rate is measured.
+	tpsMeasurePeriod = NanosecondsInSecond
+)
+
+var (
+	expVarTickOverrunCount *expvar.Int
+	expVarTickSkipCount    *expvar.Int
+)
+
+func init() {
+	expVarTickOverrunCount = expvar.NewInt("game-tick-overrun-count")
+	expVarTickSkipCount = expvar.NewInt("game-tick-skip-count")
+}
+
+// clock is the source of time for the tick loop, so that it can be replaced
+// in tests.
+type clock interface {
+	Nanoseconds() int64
+	Sleep(ns int64)
+}
+
+type systemClock struct{}
+
+func (systemClock) Nanoseconds() int64 {
+	return time.Nanoseconds()
+}
+
+func (systemClock) Sleep(ns int64) {
+	time.Sleep(ns)
+}
+
+// tickRate holds the measured rate of ticks per second, which is read from
+// goroutines other than the one running the ticks.
+type tickRate struct {
+	lock sync.Mutex
+	tps  float64
+}
+
+func (rate *tickRate) set(tps float64) {
+	metrics.Server.SetTicksPerSecond(tps)
+
+	rate.lock.Lock()
+	defer rate.lock.Unlock()
+	rate.tps = tps
+}
+
+func (rate *tickRate) get() float64 {
+	rate.lock.Lock()
+	defer rate.lock.Unlock()
+	return rate.tps
+}
+
+// tickLoop schedules ticks at a fixed rate. When ticks take longer than their
+// budget, it makes up the lost time by running ticks back to back until the
+// game has caught up.
+type tickLoop struct {
+	clock    clock
+	logger   logging.Logger
+	interval int64 // Nanoseconds between ticks.
+	nextTick int64 // When the next tick is due.
+
+	measured     *tickRate
+	measureStart int64
+	measureTicks int
+}
+
+func newTickLoop(clock clock, ratePerSecond int, measured *tickRate, logger logging.Logger) *tickLoop {
+	if ratePerSecond < 1 {
+		ratePerSecond = 1
+	}
+	now := clock.Nanoseconds()
+	interval := NanosecondsInSecond / int64(ratePerSecond)
+	return &tickLoop{
+		clock:        clock,
+		logger:       logger,
+		interval:     interval,
+		nextTick:     now + interval,
+		measured:     measured,
+		measureStart: now,
+	}
+}
+
+// next waits until the next tick is due, and returns the number of ticks that
+// should be run straight away. This is more than one if previous ticks overran.
+func (loop *tickLoop) next() (ticks int) {
+	now := loop.clock.Nanoseconds()
+	if now < loop.nextTick {
+		loop.clock.Sleep(loop.nextTick - now)
+		now = loop.clock.Nanoseconds()
+	}
+
+	ticks = int((now-loop.nextTick)/loop.interval) + 1
+	if ticks > 1 {
+		expVarTickOverrunCount.Add(1)
+	}
+	if ticks > maxCatchUpTicks {
+		skipped := ticks - maxCatchUpTicks
+		loop.logger.Warn("Game is running %d ticks behind, skipping %d ticks.", ticks-1, skipped)
+		expVarTickSkipCount.Add(int64(skipped))
+		ticks = maxCatchUpTicks
+		loop.nextTick = now + loop.interval
+	} else {
+		loop.nextTick += int64(ticks) * loop.interval
+	}
+
+	loop.measure(now, ticks)
+	return
+}
+
+// measure counts ticks, updating the measured tick rate once per measurement
+// period.
+func (loop *tickLoop) measure(now int64, ticks int) {
+	loop.measureTicks += ticks
+	if elapsed := now - loop.measureStart; elapsed >= tpsMeasurePeriod {
+		loop.measured.set(float64(loop.measureTicks) * NanosecondsInSecond / float64(elapsed))
+		loop.measureStart = now
+		loop.measureTicks = 0
+	}
+}
+
+// RunTicks runs the game's scheduled logic at ratePerSecond ticks per second,
+// until the game is shut down. Ticks that overrun their time are caught up by
+// running the following ticks without waiting between them.
+func (game *Game) RunTicks(ratePerSecond int) {
+	game.runTicks(newTickLoop(systemClock{}, ratePerSecond, &game.tps, game.log()))
+}
+
+func (game *Game) runTicks(loop *tickLoop) {
+	tick := func(game *Game) interface{} {
+		game.onTick()
+		return nil
+	}
+
+	for {
+		for ticks := loop.next(); ticks > 0; ticks-- {
+			select {
+			case <-game.EnqueueAsync(tick):
+			case <-game.stopped:
+				return
+			}
+		}
+	}
+}
+
+// MeasuredTps returns the number of ticks per second that the game has been
+// running at recently.
+func (game *Game) MeasuredTps() float64 {
+	return game.tps.get()
+}
@@ -41,8 +41,34 @@ const (
 type GameType byte
 
 const (
-	GameTypeSurvival = GameType(0)
-	GameTypeCreative = GameType(1)
+	GameTypeSurvival  = GameType(0)
+	GameTypeCreative  = GameType(1)
+	GameTypeAdventure = GameType(2)
+)
+
+// Weather in a world. Thunder storms are also rainy.
+type Weather byte
+
+const (
+	WeatherClear   = Weather(0)
+	WeatherRain    = Weather(1)
+	WeatherThunder = Weather(2)
+)
+
+// Reasons for a change of state, sent in the state packet.
+const (
+	StateReasonInvalidBed     = 0
+	StateReasonBeginRain      = 1
+	StateReasonEndRain        = 2
+	StateReasonChangeGameMode = 3
+)
+
+// View distances that a player may choose, from the furthest to the nearest.
+const (
+	ViewDistanceFar    = 0
+	ViewDistanceNormal = 1
+	ViewDistanceShort  = 2
+	ViewDistanceTiny   = 3
 )
 
 // Player/mob health.
@@ -126,12 +152,17 @@ var MobNameByType = map[EntityMobType]string{}
 
 type EntityStatus byte
 
+const (
+	EntityStatusEatingAccepted = EntityStatus(9)
+)
+
 type EntityAnimation byte
 
 const (
 	EntityAnimationNone     = EntityAnimation(0)
 	EntityAnimationSwingArm = EntityAnimation(1)
 	EntityAnimationDamage   = EntityAnimation(2)
+	EntityAnimationLeaveBed = EntityAnimation(3)
 	EntityAnimationUnknown1 = EntityAnimation(102)
 	EntityAnimationCrouch   = EntityAnimation(104)
 	EntityAnimationUncrouch = EntityAnimation(105)
@@ -165,8 +196,19 @@ const (
 type EntityAction byte
 
 const (
-	EntityActionCrouch   = EntityAction(1)
-	EntityActionUncrouch = EntityAction(2)
+	EntityActionCrouch      = EntityAction(1)
+	EntityActionUncrouch    = EntityAction(2)
+	EntityActionLeaveBed    = EntityAction(3)
+	EntityActionStartSprint = EntityAction(4)
+	EntityActionStopSprint  = EntityAction(5)
+)
+
+// Bit flags held in entry 0 of an entity's metadata.
+const (
+	EntityFlagOnFire    = byte(0x01)
+	EntityFlagCrouched  = byte(0x02)
+	EntityFlagRiding    = byte(0x04)
+	EntityFlagSprinting = byte(0x08)
 )
 
 type ObjTypeId int8
@@ -288,6 +330,10 @@ const (
 	DigStarted    = DigStatus(0)
 	DigBlockBroke = DigStatus(2)
 	DigDropItem   = DigStatus(4)
+
+	// DigReleaseUseItem is sent when the player lets go of the use button,
+	// for instance to stop eating.
+	DigReleaseUseItem = DigStatus(5)
 )
 
 const (
@@ -438,6 +484,14 @@ type OrientationDegrees struct {
 	Yaw, Pitch, Roll AngleDegrees
 }
 
+func (o *OrientationDegrees) ToOrientationBytes() *OrientationBytes {
+	return &OrientationBytes{
+		o.Yaw.ToAngleBytes(),
+		o.Pitch.ToAngleBytes(),
+		o.Roll.ToAngleBytes(),
+	}
+}
+
 type OrientationBytes struct {
 	Yaw, Pitch, Roll AngleBytes
 }
@@ -474,6 +528,12 @@ const (
 // Specifies exact world distance in blocks (floating point)
 type AbsCoord float64
 
+// ToAbsIntCoord converts to the fixed-point form used in packets. The
+// fraction of a pixel is truncated.
+func (c AbsCoord) ToAbsIntCoord() AbsIntCoord {
+	return AbsIntCoord(c * PixelsPerBlock)
+}
+
 type AbsXyz struct {
 	X, Y, Z AbsCoord
 }
@@ -494,9 +554,9 @@ func (p *AbsXyz) ApplyVelocity(dt TickTime, v *AbsVelocity) {
 
 func (p *AbsXyz) ToAbsIntXyz() *AbsIntXyz {
 	return &AbsIntXyz{
-		AbsIntCoord(p.X * PixelsPerBlock),
-		AbsIntCoord(p.Y * PixelsPerBlock),
-		AbsIntCoord(p.Z * PixelsPerBlock),
+		p.X.ToAbsIntCoord(),
+		p.Y.ToAbsIntCoord(),
+		p.Z.ToAbsIntCoord(),
 	}
 }
 
@@ -516,19 +576,70 @@ func (p *AbsXyz) ToShardXz() ShardXz {
 }
 
 func (p *AbsXyz) IsWithinDistanceOf(other *AbsXyz, maxDistance AbsCoord) bool {
-	dx := p.X - other.X
-	dy := p.Y - other.Y
-	dz := p.Z - other.Z
-	return (dx*dx + dy*dy + dz*dz) <= maxDistance*maxDistance
+	return p.Sub(other).LengthSquared() <= maxDistance*maxDistance
+}
+
+// Add returns the sum of p and other.
+func (p *AbsXyz) Add(other *AbsXyz) *AbsXyz {
+	return &AbsXyz{p.X + other.X, p.Y + other.Y, p.Z + other.Z}
+}
+
+// Sub returns the vector from other to p.
+func (p *AbsXyz) Sub(other *AbsXyz) *AbsXyz {
+	return &AbsXyz{p.X - other.X, p.Y - other.Y, p.Z - other.Z}
+}
+
+// Scale returns p multiplied by f.
+func (p *AbsXyz) Scale(f AbsCoord) *AbsXyz {
+	return &AbsXyz{p.X * f, p.Y * f, p.Z * f}
+}
+
+// LengthSquared returns the square of the length of p. It is cheaper than
+// Length for comparing distances.
+func (p *AbsXyz) LengthSquared() AbsCoord {
+	return p.X*p.X + p.Y*p.Y + p.Z*p.Z
+}
+
+func (p *AbsXyz) Length() AbsCoord {
+	return AbsCoord(math.Sqrt(float64(p.LengthSquared())))
+}
+
+// DistanceTo returns the straight line distance between p and other.
+func (p *AbsXyz) DistanceTo(other *AbsXyz) AbsCoord {
+	return p.Sub(other).Length()
+}
+
+// Normalize returns a vector of length 1 in the direction of p. The zero
+// vector is returned unchanged.
+func (p *AbsXyz) Normalize() *AbsXyz {
+	length := p.Length()
+	if length == 0 {
+		return &AbsXyz{}
+	}
+	return p.Scale(1 / length)
 }
 
 // Specifies approximate world distance in pixels (absolute / PixelsPerBlock)
+// This fixed-point form is used for positions in packets.
 type AbsIntCoord int32
 
+// ToAbsCoord converts to a floating point distance in blocks.
+func (c AbsIntCoord) ToAbsCoord() AbsCoord {
+	return AbsCoord(c) / PixelsPerBlock
+}
+
 type AbsIntXyz struct {
 	X, Y, Z AbsIntCoord
 }
 
+func (p *AbsIntXyz) ToAbsXyz() *AbsXyz {
+	return &AbsXyz{
+		p.X.ToAbsCoord(),
+		p.Y.ToAbsCoord(),
+		p.Z.ToAbsCoord(),
+	}
+}
+
 func (p *AbsIntXyz) ToBlockXyz() *BlockXyz {
 	return &BlockXyz{
 		BlockCoord(p.X / PixelsPerBlock),
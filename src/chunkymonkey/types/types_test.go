@@ -1,6 +1,9 @@
 package types
 
 import (
+	"bytes"
+	"encoding/binary"
+	"math"
 	"testing"
 )
 
@@ -62,6 +65,9 @@ func TestAbsXyz_ToChunkXz(t *testing.T) {
 		{AbsXyz{0, 0, -16}, ChunkXz{0, -1}},
 		{AbsXyz{-16, 0, 0}, ChunkXz{-1, 0}},
 		{AbsXyz{-1, 0, -1}, ChunkXz{-1, -1}},
+		{AbsXyz{-0.5, 0, -15.5}, ChunkXz{-1, -1}},
+		{AbsXyz{-16.5, 0, -32}, ChunkXz{-2, -2}},
+		{AbsXyz{-32.5, 0, 15.5}, ChunkXz{-3, 0}},
 	}
 
 	for _, test := range tests {
@@ -157,6 +163,78 @@ func Test_AbsXyz_IsWithinDistanceOf(t *testing.T) {
 	}
 }
 
+func TestAbsXyz_DistanceTo(t *testing.T) {
+	type Test struct {
+		a, b     AbsXyz
+		expected AbsCoord
+	}
+
+	tests := []Test{
+		{AbsXyz{0, 0, 0}, AbsXyz{0, 0, 0}, 0},
+		{AbsXyz{0, 0, 0}, AbsXyz{3, 4, 0}, 5},
+		{AbsXyz{1, 2, 3}, AbsXyz{1, 2, 3}, 0},
+		{AbsXyz{-1, -2, -2}, AbsXyz{0, 0, 0}, 3},
+		{AbsXyz{-10, 64, -10}, AbsXyz{-12, 65, -8}, 3},
+	}
+
+	for _, test := range tests {
+		if result := test.a.DistanceTo(&test.b); result != test.expected {
+			t.Errorf("%v.DistanceTo(%v) expected %v got %v", test.a, test.b, test.expected, result)
+		}
+		if result := test.b.DistanceTo(&test.a); result != test.expected {
+			t.Errorf("%v.DistanceTo(%v) expected %v got %v", test.b, test.a, test.expected, result)
+		}
+		expectedSquared := test.expected * test.expected
+		if result := test.a.Sub(&test.b).LengthSquared(); result != expectedSquared {
+			t.Errorf("%v.Sub(%v).LengthSquared() expected %v got %v", test.a, test.b, expectedSquared, result)
+		}
+	}
+}
+
+func TestAbsXyz_AddSub(t *testing.T) {
+	a := AbsXyz{1.5, -2, 3}
+	b := AbsXyz{-0.5, 4, 10}
+
+	if sum := a.Add(&b); *sum != (AbsXyz{1, 2, 13}) {
+		t.Errorf("%v.Add(%v) got %v", a, b, sum)
+	}
+	if diff := a.Sub(&b); *diff != (AbsXyz{2, -6, -7}) {
+		t.Errorf("%v.Sub(%v) got %v", a, b, diff)
+	}
+	if result := a.Sub(&b).Add(&b); *result != a {
+		t.Errorf("expected a - b + b = %v, got %v", a, result)
+	}
+}
+
+func TestAbsXyz_Normalize(t *testing.T) {
+	type Test struct {
+		input    AbsXyz
+		expected AbsXyz
+	}
+
+	tests := []Test{
+		{AbsXyz{0, 0, 0}, AbsXyz{0, 0, 0}},
+		{AbsXyz{0, -5, 0}, AbsXyz{0, -1, 0}},
+		{AbsXyz{3, 0, 4}, AbsXyz{0.6, 0, 0.8}},
+	}
+
+	for _, test := range tests {
+		result := test.input.Normalize()
+		if result.Sub(&test.expected).Length() > 1e-9 {
+			t.Errorf("%v.Normalize() expected %v got %v", test.input, test.expected, result)
+		}
+	}
+}
+
+func TestOrientationDegrees_ToOrientationBytes(t *testing.T) {
+	input := OrientationDegrees{90, -90, 180}
+	expected := OrientationBytes{64, 192, 128}
+	if result := input.ToOrientationBytes(); *result != expected {
+		t.Errorf("OrientationDegrees%v expected OrientationBytes%v got OrientationBytes%v",
+			input, expected, result)
+	}
+}
+
 func TestAbsIntXyz_ToChunkXz(t *testing.T) {
 	type Test struct {
 		input    AbsIntXyz
@@ -518,3 +596,38 @@ func TestBlockXyz_ToAbsIntXyz(t *testing.T) {
 		}
 	}
 }
+
+func TestAbsIntCoord_Conversion(t *testing.T) {
+	type Test struct {
+		abs      AbsCoord
+		absInt   AbsIntCoord
+		wireData []byte
+	}
+
+	var tests = []Test{
+		{0, 0, []byte{0x00, 0x00, 0x00, 0x00}},
+		{1.5, 48, []byte{0x00, 0x00, 0x00, 0x30}},
+		{-1, -32, []byte{0xff, 0xff, 0xff, 0xe0}},
+		{1000.25, 32008, []byte{0x00, 0x00, 0x7d, 0x08}},
+	}
+
+	for _, r := range tests {
+		absInt := r.abs.ToAbsIntCoord()
+		if absInt != r.absInt {
+			t.Errorf("AbsCoord(%v) expected AbsIntCoord(%d) got AbsIntCoord(%d)",
+				r.abs, r.absInt, absInt)
+		}
+
+		buf := new(bytes.Buffer)
+		binary.Write(buf, binary.BigEndian, absInt)
+		if !bytes.Equal(r.wireData, buf.Bytes()) {
+			t.Errorf("AbsIntCoord(%d) expected wire data %x got %x",
+				absInt, r.wireData, buf.Bytes())
+		}
+
+		// Converting back should be within a pixel of the original value.
+		if diff := math.Fabs(float64(absInt.ToAbsCoord() - r.abs)); diff >= 1.0/PixelsPerBlock {
+			t.Errorf("AbsCoord(%v) round-tripped to AbsCoord(%v)", r.abs, absInt.ToAbsCoord())
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package chunkymonkey
+
+import (
+	"io"
+	"os"
+	"rand"
+
+	"chunkymonkey/proto"
+	. "chunkymonkey/types"
+)
+
+const (
+	// Clear weather lasts for weatherClearMinTicks plus up to
+	// weatherClearRandTicks.
+	weatherClearMinTicks  = 12000
+	weatherClearRandTicks = 168000
+
+	// Rain and thunder storms last for weatherRainMinTicks plus up to
+	// weatherRainRandTicks.
+	weatherRainMinTicks  = 12000
+	weatherRainRandTicks = 12000
+
+	// One in weatherThunderChance storms is a thunder storm.
+	weatherThunderChance = 4
+
+	// How much darker sky light is in rain and in thunder storms.
+	weatherRainDarkness    = 3
+	weatherThunderDarkness = 10
+)
+
+// weatherState is the weather in a world, which changes after a random
+// number of ticks.
+type weatherState struct {
+	weather   Weather
+	remaining Ticks // Ticks until the weather next changes.
+}
+
+// tick counts down to the next change in the weather. Clear weather turns to
+// rain or thunder, and storms clear up. Returns true if the weather changed.
+func (w *weatherState) tick(rand *rand.Rand) (changed bool) {
+	if w.remaining > 0 {
+		w.remaining--
+		return false
+	}
+
+	next := WeatherClear
+	if w.weather == WeatherClear {
+		next = WeatherRain
+		if rand.Intn(weatherThunderChance) == 0 {
+			next = WeatherThunder
+		}
+	}
+	w.set(next, rand)
+
+	return true
+}
+
+// set changes the weather, and restarts the countdown to the next change.
+func (w *weatherState) set(weather Weather, rand *rand.Rand) {
+	w.weather = weather
+	if weather == WeatherClear {
+		w.remaining = weatherClearMinTicks + Ticks(rand.Intn(weatherClearRandTicks))
+	} else {
+		w.remaining = weatherRainMinTicks + Ticks(rand.Intn(weatherRainRandTicks))
+	}
+}
+
+// darkness returns how much the weather darkens sky light.
+func (w *weatherState) darkness() int8 {
+	switch w.weather {
+	case WeatherRain:
+		return weatherRainDarkness
+	case WeatherThunder:
+		return weatherThunderDarkness
+	}
+	return 0
+}
+
+// writeWeather writes the packet that tells clients whether it is raining.
+// The protocol has no separate state for thunder storms, which clients see as
+// rain.
+func writeWeather(writer io.Writer, weather Weather) os.Error {
+	reason := byte(StateReasonEndRain)
+	if weather != WeatherClear {
+		reason = StateReasonBeginRain
+	}
+	return proto.WriteState(writer, reason, 0)
+}
@@ -11,7 +11,6 @@ import (
 )
 
 const (
-	playerInvArmorNum   = 4
 	playerInvMainNum    = 3 * 9
 	playerInvHoldingNum = 9
 )
@@ -20,7 +19,7 @@ type PlayerInventory struct {
 	Window
 	entityId     EntityId
 	crafting     gamerules.CraftingInventory
-	armor        gamerules.Inventory
+	armor        gamerules.ArmorInventory
 	main         gamerules.Inventory
 	holding      gamerules.Inventory
 	holdingIndex SlotId
@@ -32,7 +31,7 @@ func (w *PlayerInventory) Init(entityId EntityId, viewer IWindowViewer) {
 	w.entityId = entityId
 
 	w.crafting.InitPlayerCraftingInventory()
-	w.armor.Init(playerInvArmorNum)
+	w.armor.InitArmorInventory()
 	w.main.Init(playerInvMainNum)
 	w.holding.Init(playerInvHoldingNum)
 	w.Window.Init(
@@ -43,7 +42,6 @@ func (w *PlayerInventory) Init(entityId EntityId, viewer IWindowViewer) {
 		viewer,
 		"Inventory",
 		&w.crafting,
-		// TODO Create and use special inventory type for armor slots only.
 		&w.armor,
 		&w.main,
 		&w.holding,
@@ -80,11 +78,32 @@ func (w *PlayerInventory) NewWindow(invTypeId InvTypeId, windowId WindowId, inv
 	return nil
 }
 
-// SetHolding chooses the held item (0-8). Out of range values have no effect.
-func (w *PlayerInventory) SetHolding(holding SlotId) {
+// SetHolding chooses the held item (0-8). Out of range values have no effect,
+// and false is returned.
+func (w *PlayerInventory) SetHolding(holding SlotId) bool {
 	if holding >= 0 && holding < SlotId(playerInvHoldingNum) {
 		w.holdingIndex = holding
+		return true
 	}
+	return false
+}
+
+// SetSlot replaces the contents of a slot in the armor, main or holding
+// sections of the inventory, as players in creative mode may do. Returns false
+// if slotId is not in one of those sections.
+func (w *PlayerInventory) SetSlot(slotId SlotId, slot *gamerules.Slot) bool {
+	// The crafting section is skipped, as its output slot is always computed.
+	for _, view := range w.Window.views[1:] {
+		if slotId >= view.startSlot && slotId < view.endSlot {
+			inv, ok := view.inventory.(*gamerules.Inventory)
+			if !ok {
+				return false
+			}
+			inv.SetSlot(slotId-view.startSlot, slot)
+			return true
+		}
+	}
+	return false
 }
 
 // HeldItem returns the slot that is the current "held" item.
@@ -101,6 +120,12 @@ func (w *PlayerInventory) TakeOneHeldItem(into *gamerules.Slot) {
 	w.holding.TakeOneItem(w.holdingIndex, into)
 }
 
+// UseHeldTool uses up one of the remaining uses of the held item, if it is a
+// tool. Returns true if the tool broke.
+func (w *PlayerInventory) UseHeldTool() (broke bool) {
+	return w.holding.UseTool(w.holdingIndex)
+}
+
 // Writes packets for other players to see the equipped items.
 func (w *PlayerInventory) SendFullEquipmentUpdate(writer io.Writer) (err os.Error) {
 	slot, _ := w.HeldItem()
@@ -120,6 +145,12 @@ func (w *PlayerInventory) SendFullEquipmentUpdate(writer io.Writer) (err os.Erro
 	return
 }
 
+// Armor returns the player's armor inventory, e.g. for working out how much
+// damage the armor absorbs.
+func (w *PlayerInventory) Armor() *gamerules.ArmorInventory {
+	return &w.armor
+}
+
 // PutItem attempts to put the item stack into the player's inventory. The item
 // will be modified as a result.
 func (w *PlayerInventory) PutItem(item *gamerules.Slot) {
@@ -217,7 +248,7 @@ func (w *PlayerInventory) MarshalNbt(tag *nbt.Compound) (err os.Error) {
 		slot := w.armor.Slot(SlotId(i))
 		if !slot.IsEmpty() {
 			slotTag := nbt.NewCompound()
-			slotTag.Set("Slot", &nbt.Byte{int8(i + 100)})
+			slotTag.Set("Slot", &nbt.Byte{int8(103 - i)})
 			if err = slot.MarshalNbt(slotTag); err != nil {
 				return
 			}
@@ -0,0 +1,157 @@
+package chunkymonkey
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"rand"
+	"strings"
+	"time"
+
+	. "chunkymonkey/entity"
+	"chunkymonkey/gamerules"
+	"chunkymonkey/logging"
+	"chunkymonkey/proto"
+	"chunkymonkey/shardserver"
+	. "chunkymonkey/types"
+	"chunkymonkey/worldstore"
+)
+
+// The name of the world given on the command line, which players join when
+// they log in.
+const defaultWorldName = "world"
+
+// Sky light is at most this much darker than at midday in clear weather.
+const maxSkyDarkness = 15
+
+// World is a named world within the game. Each world has its own chunks,
+// spawn position, time of day and weather.
+type World struct {
+	name          string
+	shardManager  *shardserver.LocalShardManager
+	spawnPosition BlockXyz
+	time          Ticks
+	weather       weatherState
+	rand          *rand.Rand
+
+	// Players currently in the world.
+	players map[EntityId]gamerules.IPlayerClient
+	// Players in the world who are asleep, and the beds that they are in.
+	sleepers map[EntityId]BlockXyz
+}
+
+// NewWorld creates a world with chunks stored in worldStore. The spawn
+// position and time of day are read from the world's level data.
+func NewWorld(name string, worldStore *worldstore.WorldStore, entityManager *EntityManager, logger logging.Logger) *World {
+	world := &World{
+		name:          name,
+		shardManager:  shardserver.NewLocalShardManager(worldStore.ChunkStore, entityManager, logger),
+		spawnPosition: worldStore.SpawnPosition,
+		time:          worldStore.Time,
+		rand:          rand.New(rand.NewSource(time.Nanoseconds())),
+		players:       make(map[EntityId]gamerules.IPlayerClient),
+		sleepers:      make(map[EntityId]BlockXyz),
+	}
+	world.weather.set(WeatherClear, world.rand)
+	return world
+}
+
+func (world *World) Name() string {
+	return world.name
+}
+
+// advanceTime moves the time of day on by one tick, wrapping around at the
+// end of the day. Returns true if the time should be sent to players.
+func (world *World) advanceTime(dayLength, updateInterval Ticks) (sendUpdate bool) {
+	world.time++
+	if dayLength > 0 {
+		world.time %= dayLength
+	}
+	return updateInterval > 0 && world.time%updateInterval == 0
+}
+
+// removePlayer removes a player from the world, for instance when they
+// disconnect or move to another world.
+func (world *World) removePlayer(entityId EntityId) {
+	world.players[entityId] = nil, false
+	world.sleepers[entityId] = BlockXyz{}, false
+}
+
+// isNight returns true if it is night, when players may sleep.
+func (world *World) isNight(dayLength Ticks) bool {
+	return dayLength > 0 && skyDarkness(world.time, dayLength) > 0
+}
+
+// bedOccupied returns true if a player is asleep in the bed at bedLoc.
+func (world *World) bedOccupied(bedLoc *BlockXyz) bool {
+	for _, sleeperBedLoc := range world.sleepers {
+		if sleeperBedLoc == *bedLoc {
+			return true
+		}
+	}
+	return false
+}
+
+// allSleeping returns true if there are players in the world and all of them
+// are asleep.
+func (world *World) allSleeping() bool {
+	if len(world.players) == 0 {
+		return false
+	}
+	for entityId := range world.players {
+		if _, asleep := world.sleepers[entityId]; !asleep {
+			return false
+		}
+	}
+	return true
+}
+
+// skyDarkness returns how much darker sky light is than at midday in clear
+// weather, taking into account the time of day and the weather.
+func (world *World) skyDarkness(dayLength Ticks) int8 {
+	darkness := skyDarkness(world.time, dayLength) + world.weather.darkness()
+	if darkness > maxSkyDarkness {
+		darkness = maxSkyDarkness
+	}
+	return darkness
+}
+
+// joinPackets returns the packets that tell a player joining the world its
+// time of day and weather.
+func (world *World) joinPackets() []byte {
+	buf := new(bytes.Buffer)
+	proto.ServerWriteTimeUpdate(buf, world.time)
+	if world.weather.weather != WeatherClear {
+		writeWeather(buf, world.weather.weather)
+	}
+	return buf.Bytes()
+}
+
+// multicastPacket sends a packet to every player in the world.
+func (world *World) multicastPacket(packet []byte) {
+	for _, player := range world.players {
+		player.TransmitPacket(packet)
+	}
+}
+
+// parseWorldPaths parses a comma-separated list of name=path pairs, as given
+// to the -game_worlds flag.
+func parseWorldPaths(s string) (worldPaths map[string]string, err os.Error) {
+	worldPaths = make(map[string]string)
+	if s == "" {
+		return
+	}
+
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid world %q, expected name=path", pair)
+		}
+		if _, ok := worldPaths[parts[0]]; ok || parts[0] == defaultWorldName {
+			return nil, fmt.Errorf("world %q given more than once", parts[0])
+		}
+		worldPaths[parts[0]] = parts[1]
+	}
+
+	return
+}
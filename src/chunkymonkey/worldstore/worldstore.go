@@ -3,7 +3,6 @@
 package worldstore
 
 import (
-	"compress/gzip"
 	"fmt"
 	"log"
 	"os"
@@ -72,7 +71,7 @@ func LoadWorldStore(worldPath string) (world *WorldStore, err os.Error) {
 		seed = rand.NewSource(time.Seconds()).Int63()
 	}
 
-	chunkStores = append(chunkStores, chunkstore.NewChunkService(generation.NewTestGenerator(seed)))
+	chunkStores = append(chunkStores, chunkstore.NewChunkService(generation.NewPerlinChunkGenerator(seed)))
 
 	for _, store := range chunkStores {
 		go store.Serve()
@@ -100,13 +99,7 @@ func loadLevelData(worldPath string) (levelData nbt.ITag, err os.Error) {
 	}
 	defer file.Close()
 
-	gzipReader, err := gzip.NewReader(file)
-	if err != nil {
-		return
-	}
-	defer gzipReader.Close()
-
-	levelData, err = nbt.Read(gzipReader)
+	levelData, err = nbt.ReadGzip(file)
 
 	return
 }
@@ -135,13 +128,7 @@ func (world *WorldStore) PlayerData(user string) (playerData *nbt.Compound, err
 	}
 	defer file.Close()
 
-	gzipReader, err := gzip.NewReader(file)
-	if err != nil {
-		return
-	}
-	defer gzipReader.Close()
-
-	playerData, err = nbt.Read(gzipReader)
+	playerData, err = nbt.ReadGzip(file)
 
 	return
 }
@@ -153,21 +140,13 @@ func (world *WorldStore) WritePlayerData(user string, data *nbt.Compound) (err o
 	}
 
 	filename := path.Join(world.WorldPath, "players", user+".dat")
-	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE, 0666)
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	gzipWriter, err := gzip.NewWriter(file)
-	if err != nil {
-		return
-	}
-
-	err = nbt.Write(gzipWriter, data)
-	gzipWriter.Close()
-
-	return
+	return nbt.WriteGzip(file, data)
 }
 
 // Creates a new world at 'worldPath'
@@ -206,17 +185,9 @@ func CreateWorld(worldPath string) (err os.Error) {
 	if err != nil {
 		return err
 	}
+	defer file.Close()
 
-	gzipWriter, err := gzip.NewWriter(file)
-	if err != nil {
-		return err
-	}
-
-	err = nbt.Write(gzipWriter, data)
-	gzipWriter.Close()
-	file.Close()
-
-	return nil
+	return nbt.WriteGzip(file, data)
 }
 
 func absXyzFromNbt(tag nbt.ITag, path string) (pos AbsXyz, err os.Error) {
@@ -8,9 +8,13 @@ import (
 	"log"
 	"net"
 	"os"
+	"os/signal"
 
 	"chunkymonkey"
 	"chunkymonkey/gamerules"
+	"chunkymonkey/logging"
+	"chunkymonkey/rcon"
+	"chunkymonkey/types"
 	"chunkymonkey/worldstore"
 )
 
@@ -20,7 +24,17 @@ var addr = flag.String(
 
 var httpAddr = flag.String(
 	"http_addr", ":25566",
-	"Serves HTTP diagnostics on the given address:port.")
+	"Serves HTTP diagnostics, and the game status at /status and /metrics, on "+
+		"the given address:port. Empty to disable.")
+
+var rconAddr = flag.String(
+	"rcon_addr", "",
+	"Serves RCON remote administration on the given address:port. RCON is "+
+		"disabled if this is empty.")
+
+var rconPassword = flag.String(
+	"rcon_password", "",
+	"The password that RCON clients must authenticate with.")
 
 var blockDefs = flag.String(
 	"blocks", "blocks.json",
@@ -60,20 +74,43 @@ var maxPlayerCount = flag.Int(
 	"max_player_count", 16,
 	"Maximum number of players to allow concurrently. (Does not work yet)")
 
+var tickRate = flag.Int(
+	"tick_rate", types.TicksPerSecond,
+	"The number of game ticks to run per second.")
+
+var logLevel = flag.String(
+	"log_level", "info",
+	"The least important messages to log: debug, info, warn or error. "+
+		"Messages about individual packets are logged at debug.")
+
 func usage() {
 	os.Stderr.WriteString("usage: " + os.Args[0] + " [flags] <world>\n")
 	flag.PrintDefaults()
 }
 
-func startHttpServer(addr string) (err os.Error) {
+func startHttpServer(addr string, game *chunkymonkey.Game) (err os.Error) {
 	httpPort, err := net.Listen("tcp", addr)
 	if err != nil {
 		return
 	}
+	game.HandleStatus(http.DefaultServeMux)
 	go http.Serve(httpPort, nil)
 	return
 }
 
+func startRconServer(addr, password string, game *chunkymonkey.Game) (err os.Error) {
+	if password == "" {
+		return os.NewError("an RCON password must be given with -rcon_password")
+	}
+	rconPort, err := net.Listen("tcp", addr)
+	if err != nil {
+		return
+	}
+	server := rcon.NewServer(password, gamerules.CommandFramework, game)
+	go server.Serve(rconPort)
+	return
+}
+
 func main() {
 	var err os.Error
 
@@ -91,6 +128,13 @@ func main() {
 		os.Exit(1)
 	}
 
+	level, err := logging.ParseLevel(*logLevel)
+	if err != nil {
+		log.Print(err)
+		os.Exit(1)
+	}
+	logger := logging.New(level)
+
 	worldPath := flag.Arg(0)
 	fi, err := os.Stat(worldPath)
 	if err != nil {
@@ -114,15 +158,37 @@ func main() {
 		log.Fatal(err)
 	}
 
-	game, err := chunkymonkey.NewGame(worldPath, listener, *serverDesc, *maintenanceMsg, *maxPlayerCount)
+	game, err := chunkymonkey.NewGame(worldPath, listener, *serverDesc, *maintenanceMsg, *maxPlayerCount, logger)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	err = startHttpServer(*httpAddr)
-	if err != nil {
-		log.Fatal(err)
+	if *httpAddr != "" {
+		err = startHttpServer(*httpAddr, game)
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 
+	if *rconAddr != "" {
+		err = startRconServer(*rconAddr, *rconPassword, game)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	go shutdownOnSignal(game)
+	go game.RunTicks(*tickRate)
+
 	game.Serve()
 }
+
+// shutdownOnSignal cleanly shuts down the game when the process is
+// interrupted or terminated.
+func shutdownOnSignal(game *chunkymonkey.Game) {
+	for sig := range signal.Incoming {
+		if sig == os.SIGINT || sig == os.SIGTERM {
+			game.Shutdown()
+		}
+	}
+}
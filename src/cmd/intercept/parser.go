@@ -207,6 +207,11 @@ func (p *MessageParser) PacketEntityStatus(entityId EntityId, status EntityStatu
 		entityId, status)
 }
 
+func (p *MessageParser) PacketAttachEntity(entityId EntityId, vehicleId EntityId) {
+	p.printf("PacketAttachEntity(entityId=%d, vehicleId=%d)",
+		entityId, vehicleId)
+}
+
 func (p *MessageParser) PacketEntityMetadata(entityId EntityId, metadata []proto.EntityMetadata) {
 	p.printf("PacketEntityMetadata(entityId=%d, metadata=%v)", entityId, metadata)
 }
@@ -282,6 +287,11 @@ func (p *MessageParser) PacketWindowClick(windowId WindowId, slot SlotId, rightC
 		windowId, slot, rightClick, txId, shiftClick, expectedSlot)
 }
 
+func (p *MessageParser) PacketCreativeInventoryAction(slotId SlotId, slot *proto.WindowSlot) {
+	p.printf("PacketCreativeInventoryAction(slotId=%d, slot=%#v)",
+		slotId, slot)
+}
+
 func (p *MessageParser) PacketWindowSetSlot(windowId WindowId, slot SlotId, itemId ItemTypeId, amount ItemCount, data ItemData) {
 	p.printf("PacketWindowSetSlot(windowId=%d, slot=%d, itemId=%d, amount=%d, data=%d)",
 		windowId, slot, itemId, amount, data)
@@ -322,6 +332,11 @@ func (p *MessageParser) PacketUserListItem(username string, online bool, pingMs
 		username, online, pingMs)
 }
 
+func (p *MessageParser) PacketClientSettings(locale string, viewDistance byte, chatFlags byte) {
+	p.printf("PacketClientSettings(locale=%q, viewDistance=%d, chatFlags=%d)",
+		locale, viewDistance, chatFlags)
+}
+
 func (p *MessageParser) PacketServerListPing() {
 	p.printf("PacketServerListPing()")
 }
@@ -10,6 +10,11 @@ import (
 	"chunkymonkey/record"
 )
 
+var replayCapture = flag.Bool(
+	"capture", false,
+	"The file is a capture written by the server with -capture_dir, rather "+
+		"than a record written by intercept.")
+
 func usage() {
 	os.Stderr.WriteString("usage: " + os.Args[0] + " server:port file.record\n")
 	flag.PrintDefaults()
@@ -37,20 +42,28 @@ func main() {
 	serverAddr := flag.Arg(0)
 	recordFilename := flag.Arg(1)
 
-	recordInput, err := os.Open(recordFilename)
-	if err != nil {
-		log.Fatalf("Failed to open record file %q: %v", recordFilename, err)
-	}
-	defer recordInput.Close()
-
 	conn, err := net.Dial("tcp", serverAddr)
 	if err != nil {
 		log.Fatalf("Failed to connect to server %q: %v", serverAddr, err)
 	}
 	defer conn.Close()
 
-	replayer := record.NewReaderReplayer(recordInput, conn)
 	// Discard everything the server sends us.
 	go readAndDiscard(conn)
+
+	if *replayCapture {
+		if err = record.ReplayFile(recordFilename, conn); err != nil {
+			log.Fatalf("Failed to replay capture file %q: %v", recordFilename, err)
+		}
+		return
+	}
+
+	recordInput, err := os.Open(recordFilename)
+	if err != nil {
+		log.Fatalf("Failed to open record file %q: %v", recordFilename, err)
+	}
+	defer recordInput.Close()
+
+	replayer := record.NewReaderReplayer(recordInput, conn)
 	replayer.Replay()
 }
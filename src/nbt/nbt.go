@@ -19,6 +19,7 @@
 //           "Double": &Double{6},
 //           "String": &String{"foo"},
 //           "List":   &List{TagByte, []ITag{&Byte{1}, &Byte{2}}},
+//           "Ints":   &IntArray{[]int32{1, 2}},
 //         },
 //       },
 //     },
@@ -27,10 +28,12 @@
 // It is required that the root structure be a Compound for compatibility with
 // existing NBT structures observed in the official server.
 //
-// NBT structures can be read from an io.Reader with the Read function.
+// NBT structures can be read from an io.Reader with the Read function, or with
+// ReadGzip for gzip compressed files such as level.dat.
 package nbt
 
 import (
+	"compress/gzip"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -63,6 +66,7 @@ const (
 	TagString    = TagType(8)
 	TagList      = TagType(9)
 	TagCompound  = TagType(10)
+	TagIntArray  = TagType(11)
 )
 
 // NewTag creates a new tag of the given TagType. TagEnd is not a valid value
@@ -89,6 +93,8 @@ func (tt TagType) NewTag() (tag ITag, err os.Error) {
 		tag = new(List)
 	case TagCompound:
 		tag = new(Compound)
+	case TagIntArray:
+		tag = new(IntArray)
 	default:
 		err = fmt.Errorf("invalid NBT tag type %#x", tt)
 	}
@@ -264,6 +270,48 @@ func (*ByteArray) Lookup(path string) ITag {
 	return nil
 }
 
+type IntArray struct {
+	Value []int32
+}
+
+func (*IntArray) Type() TagType {
+	return TagIntArray
+}
+
+func (a *IntArray) Read(reader io.Reader) (err os.Error) {
+	var length Int
+
+	err = length.Read(reader)
+	if err != nil {
+		return
+	}
+	if length.Value < 0 {
+		return fmt.Errorf("invalid NBT int array length %d", length.Value)
+	}
+
+	ints := make([]int32, length.Value)
+	if err = binary.Read(reader, binary.BigEndian, ints); err != nil {
+		return
+	}
+
+	a.Value = ints
+	return
+}
+
+func (a *IntArray) Write(writer io.Writer) (err os.Error) {
+	length := Int{int32(len(a.Value))}
+
+	if err = length.Write(writer); err != nil {
+		return
+	}
+
+	return binary.Write(writer, binary.BigEndian, a.Value)
+}
+
+func (*IntArray) Lookup(path string) ITag {
+	return nil
+}
+
 type String struct {
 	Value string
 }
@@ -498,3 +546,29 @@ func Read(reader io.Reader) (tag *Compound, err os.Error) {
 func Write(writer io.Writer, tag *Compound) (err os.Error) {
 	return writeTagAndName(writer, tag, "")
 }
+
+// ReadGzip reads a gzip compressed NBT compound from the given reader.
+func ReadGzip(reader io.Reader) (tag *Compound, err os.Error) {
+	gzipReader, err := gzip.NewReader(reader)
+	if err != nil {
+		return
+	}
+	defer gzipReader.Close()
+
+	return Read(gzipReader)
+}
+
+// WriteGzip writes a gzip compressed NBT compound to the given writer.
+func WriteGzip(writer io.Writer, tag *Compound) (err os.Error) {
+	gzipWriter, err := gzip.NewWriter(writer)
+	if err != nil {
+		return
+	}
+
+	if err = Write(gzipWriter, tag); err != nil {
+		gzipWriter.Close()
+		return
+	}
+
+	return gzipWriter.Close()
+}
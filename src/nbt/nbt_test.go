@@ -70,6 +70,7 @@ func TestSerialization(t *testing.T) {
 		{te.LiteralString("\x3f\xf0\x00\x00\x00\x00\x00\x00"), &Double{1.0}},
 		{te.LiteralString("\x00\x00\x00\x04\x00\x01\x02\x03"), &ByteArray{[]byte{0, 1, 2, 3}}},
 		{te.LiteralString("\x00\x03foo"), &String{"foo"}},
+		{te.LiteralString("\x00\x00\x00\x02\x00\x00\x00\x01\xff\xff\xff\xfe"), &IntArray{[]int32{1, -2}}},
 		{te.LiteralString("\x01\x00\x00\x00\x02\x01\x02"), &List{TagByte, []ITag{&Byte{1}, &Byte{2}}}},
 		{te.LiteralString("\x03\x00\x00\x00\x02\x00\x00\x00\x01\x00\x00\x00\x02"), &List{TagInt, []ITag{&Int{1}, &Int{2}}}},
 
@@ -214,3 +215,55 @@ func Test_Lookup(t *testing.T) {
 		t.Fatalf("Failed to look up Byte, got: %#v", tag)
 	}
 }
+
+func Test_GzipRoundTrip(t *testing.T) {
+	// A level.dat style structure.
+	levelData := &Compound{
+		map[string]ITag{
+			"Data": &Compound{
+				map[string]ITag{
+					"Time":       &Long{24000},
+					"SpawnX":     &Int{-12},
+					"SpawnY":     &Int{75},
+					"SpawnZ":     &Int{30},
+					"raining":    &Byte{0},
+					"LevelName":  &String{"world"},
+					"RandomSeed": &Long{-4172144997902289642},
+					"Player": &Compound{
+						map[string]ITag{
+							"Health":   &Short{20},
+							"Pos":      &List{TagDouble, []ITag{&Double{0.5}, &Double{64}, &Double{-0.5}}},
+							"Rotation": &List{TagFloat, []ITag{&Float{90}, &Float{0}}},
+							"Inventory": &List{TagCompound, []ITag{
+								&Compound{
+									map[string]ITag{
+										"id":     &Short{276},
+										"Count":  &Byte{1},
+										"Damage": &Short{0},
+										"Slot":   &Byte{0},
+									},
+								},
+							}},
+						},
+					},
+					"HeightMap": &IntArray{[]int32{64, 65, 63}},
+					"Blocks":    &ByteArray{[]byte{1, 2, 3}},
+				},
+			},
+		},
+	}
+
+	buf := new(bytes.Buffer)
+	if err := WriteGzip(buf, levelData); err != nil {
+		t.Fatalf("Got WriteGzip error: %v", err)
+	}
+
+	result, err := ReadGzip(buf)
+	if err != nil {
+		t.Fatalf("Got ReadGzip error: %v", err)
+	}
+
+	if !reflect.DeepEqual(levelData, result) {
+		t.Errorf("Got unexpected result: %#v", result)
+	}
+}